@@ -0,0 +1,393 @@
+// Package binlogsql renders the row events of the binlog as SQL statements that can be
+// replayed on a server, or as the inverse statements to undo them (flashback).
+package binlogsql
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// Config is the configuration of a Renderer.
+type Config struct {
+	// Flashback renders the inverse statements in reverse order: a DELETE for an INSERT,
+	// an INSERT for a DELETE, and an UPDATE from the after image to the before image.
+	// The before image must have all the columns, i.e. binlog_row_image=FULL.
+	Flashback bool
+
+	// GetTable returns the table of a TableMapEvent without the column names, i.e.
+	// binlog_row_metadata=MINIMAL, e.g. schema.NewTable on a connection to the server.
+	// The table must have the columns the rows were written with. If nil, rendering
+	// the rows of such a table fails.
+	GetTable func(schema string, table string) (*schema.Table, error)
+}
+
+// Renderer renders the rows events as INSERT, UPDATE and DELETE statements, one for
+// every row. The rows are identified by the primary key if it is known, otherwise by
+// all the columns of the row but the FLOAT, GEOMETRY and VECTOR ones, which can't be
+// compared exactly.
+//
+// The values are rendered like they are decoded, so the TIMESTAMP values are in the
+// TimestampStringLocation of the parser, or in the local time zone, and the session
+// time zone replaying the statements must be the same.
+type Renderer struct {
+	cfg Config
+}
+
+// NewRenderer creates a Renderer.
+func NewRenderer(cfg Config) *Renderer {
+	return &Renderer{cfg: cfg}
+}
+
+// RenderTransaction renders the rows events of a transaction, including those in a
+// TransactionPayloadEvent. In flashback mode, the events are rendered in reverse order.
+func (r *Renderer) RenderTransaction(events []*replication.BinlogEvent) ([]string, error) {
+	var rows []*replication.BinlogEvent
+	for _, e := range events {
+		if ev, ok := e.Event.(*replication.TransactionPayloadEvent); ok {
+			rows = append(rows, ev.Events...)
+		} else {
+			rows = append(rows, e)
+		}
+	}
+	if r.cfg.Flashback {
+		slices.Reverse(rows)
+	}
+
+	var stmts []string
+	for _, e := range rows {
+		s, err := r.RenderEvent(e)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		stmts = append(stmts, s...)
+	}
+	return stmts, nil
+}
+
+// RenderEvent renders the rows of a rows event, in flashback mode the rows are rendered
+// in reverse order. It returns nothing for the other events.
+func (r *Renderer) RenderEvent(e *replication.BinlogEvent) ([]string, error) {
+	ev, ok := e.Event.(*replication.RowsEvent)
+	if !ok {
+		return nil, nil
+	}
+	if ev.Table == nil {
+		return nil, errors.New("rows event has no table map event")
+	}
+	t, err := r.table(ev.Table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var insert, update bool
+	switch e.Header.EventType {
+	case replication.WRITE_ROWS_EVENTv0, replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2,
+		replication.MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
+		insert = true
+	case replication.UPDATE_ROWS_EVENTv0, replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2,
+		replication.PARTIAL_UPDATE_ROWS_EVENT, replication.MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1:
+		update = true
+	case replication.DELETE_ROWS_EVENTv0, replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2,
+		replication.MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1:
+	default:
+		return nil, errors.Errorf("%s of %s not supported", e.Header.EventType, t)
+	}
+
+	// the rows are read with RowIterator, so the events decoded lazily are rendered too
+	var stmts []string
+	var before rowImage
+	images := 0
+	it := ev.RowIterator()
+	for it.Next() {
+		row := newRowImage(it.Row(), it.SkippedColumns())
+		images++
+		if update && images%2 == 1 {
+			// the after image follows
+			before = row
+			continue
+		}
+
+		var stmt string
+		switch {
+		case update && r.cfg.Flashback:
+			stmt, err = t.update(row, before)
+		case update:
+			stmt, err = t.update(before, row)
+		case insert != r.cfg.Flashback:
+			stmt, err = t.insert(row)
+		default:
+			stmt, err = t.delete(row)
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		stmts = append(stmts, stmt)
+	}
+	if err = it.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if update && images%2 != 0 {
+		return nil, errors.Errorf("update rows event of %s has an odd number of images", t)
+	}
+
+	if r.cfg.Flashback {
+		slices.Reverse(stmts)
+	}
+	return stmts, nil
+}
+
+// column is what the renderer knows about a column of a table.
+type column struct {
+	name string
+	// tp is the column type in the binlog, and meta is its metadata
+	tp   byte
+	meta uint16
+
+	enum, set  bool
+	enumValues []string
+	setValues  []string
+
+	// text and binary are true if the column is known to have a character or a
+	// binary collation
+	text, binary bool
+}
+
+type table struct {
+	schema, name string
+	columns      []column
+	pk           []int
+}
+
+func (t *table) String() string {
+	return quoteIdent(t.schema) + "." + quoteIdent(t.name)
+}
+
+// table builds the table from the metadata of the TableMapEvent, or from Config.GetTable.
+func (r *Renderer) table(e *replication.TableMapEvent) (*table, error) {
+	t := &table{
+		schema:  string(e.Schema),
+		name:    string(e.Table),
+		columns: make([]column, e.ColumnCount),
+	}
+	if len(e.ColumnType) != int(e.ColumnCount) || len(e.ColumnMeta) != int(e.ColumnCount) {
+		return nil, errors.Errorf("invalid table map event of %s", t)
+	}
+	for i := range t.columns {
+		c := &t.columns[i]
+		c.tp = e.ColumnType[i]
+		c.meta = e.ColumnMeta[i]
+		c.enum = e.IsEnumColumn(i)
+		c.set = e.IsSetColumn(i)
+	}
+
+	if names := e.ColumnNameString(); len(names) == len(t.columns) {
+		collations := e.CollationMap()
+		enumSetCollations := e.EnumSetCollationMap()
+		enumValues := e.EnumStrValueMap()
+		setValues := e.SetStrValueMap()
+		for i := range t.columns {
+			c := &t.columns[i]
+			c.name = names[i]
+			c.enumValues = enumValues[i]
+			c.setValues = setValues[i]
+			collation, ok := collations[i]
+			if !ok {
+				collation, ok = enumSetCollations[i]
+			}
+			if ok {
+				c.binary = collation == mysql.BINARY_COLLATION_ID
+				c.text = !c.binary
+			}
+		}
+		t.pk = make([]int, len(e.PrimaryKey))
+		for i, col := range e.PrimaryKey {
+			t.pk[i] = int(col)
+		}
+	} else {
+		if r.cfg.GetTable == nil {
+			return nil, errors.Errorf("table map event of %s has no column names, binlog_row_metadata=FULL or Config.GetTable is required", t)
+		}
+		ta, err := r.cfg.GetTable(t.schema, t.name)
+		if err != nil {
+			return nil, errors.Annotatef(err, "get table %s", t)
+		}
+		if len(ta.Columns) != len(t.columns) {
+			return nil, errors.Errorf("table %s has %d columns, but the rows have %d", t, len(ta.Columns), len(t.columns))
+		}
+		for i := range t.columns {
+			c := &t.columns[i]
+			tc := &ta.Columns[i]
+			c.name = tc.Name
+			c.enumValues = tc.EnumValues
+			c.setValues = tc.SetValues
+			c.text = tc.Collation != ""
+			c.binary = !c.text
+		}
+		t.pk = ta.PKColumns
+	}
+
+	for _, i := range t.pk {
+		if i < 0 || i >= len(t.columns) {
+			return nil, errors.Errorf("invalid primary key column %d of table %s", i, t)
+		}
+	}
+	return t, nil
+}
+
+// rowImage is a row of a rows event, skipped is true for the columns not in the image.
+type rowImage struct {
+	values  []any
+	skipped []bool
+}
+
+func newRowImage(values []any, skippedColumns []int) rowImage {
+	row := rowImage{values: values, skipped: make([]bool, len(values))}
+	for _, col := range skippedColumns {
+		if col < len(row.skipped) {
+			row.skipped[col] = true
+		}
+	}
+	return row
+}
+
+func (t *table) insert(row rowImage) (string, error) {
+	var names, values []string
+	for i, v := range row.values {
+		if row.skipped[i] {
+			continue
+		}
+		s, err := t.columns[i].value(v)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		names = append(names, quoteIdent(t.columns[i].name))
+		values = append(values, s)
+	}
+	if len(names) == 0 {
+		return "", errors.Errorf("no column to insert into %s", t)
+	}
+
+	return "INSERT INTO " + t.String() + " (" + strings.Join(names, ", ") + ") VALUES (" + strings.Join(values, ", ") + ")", nil
+}
+
+func (t *table) delete(row rowImage) (string, error) {
+	where, err := t.where(row)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return "DELETE FROM " + t.String() + " WHERE " + where + " LIMIT 1", nil
+}
+
+// update renders the UPDATE from the before image to the after image.
+func (t *table) update(before rowImage, after rowImage) (string, error) {
+	var sets []string
+	for i, v := range after.values {
+		if after.skipped[i] {
+			continue
+		}
+		c := &t.columns[i]
+		var s string
+		var err error
+		switch v := v.(type) {
+		case *replication.JsonDiff:
+			s, err = jsonDiffs(c, []*replication.JsonDiff{v})
+		case []*replication.JsonDiff:
+			s, err = jsonDiffs(c, v)
+		default:
+			s, err = c.value(v)
+		}
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		sets = append(sets, quoteIdent(c.name)+"="+s)
+	}
+	if len(sets) == 0 {
+		return "", errors.Errorf("no column to update in %s", t)
+	}
+
+	where, err := t.where(before)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return "UPDATE " + t.String() + " SET " + strings.Join(sets, ", ") + " WHERE " + where + " LIMIT 1", nil
+}
+
+// where identifies the row by the primary key, or by all its comparable columns.
+func (t *table) where(row rowImage) (string, error) {
+	cols := t.pk
+	for _, i := range cols {
+		if row.skipped[i] {
+			// not in the image
+			cols = nil
+			break
+		}
+	}
+	if len(cols) == 0 {
+		cols = make([]int, 0, len(t.columns))
+		for i := range t.columns {
+			if !row.skipped[i] && t.columns[i].comparable(row.values[i]) {
+				cols = append(cols, i)
+			}
+		}
+	}
+	if len(cols) == 0 {
+		return "", errors.Errorf("no column to identify the row of %s", t)
+	}
+
+	conds := make([]string, 0, len(cols))
+	for _, i := range cols {
+		c := &t.columns[i]
+		if row.values[i] == nil {
+			conds = append(conds, quoteIdent(c.name)+" IS NULL")
+			continue
+		}
+		s, err := c.value(row.values[i])
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		conds = append(conds, quoteIdent(c.name)+"="+s)
+	}
+	return strings.Join(conds, " AND "), nil
+}
+
+// comparable reports whether the value can identify the row in a WHERE.
+func (c *column) comparable(v any) bool {
+	switch v.(type) {
+	case *replication.JsonDiff, []*replication.JsonDiff:
+		return false
+	}
+	switch c.tp {
+	case mysql.MYSQL_TYPE_FLOAT, mysql.MYSQL_TYPE_GEOMETRY, mysql.MYSQL_TYPE_VECTOR:
+		return false
+	}
+	return true
+}
+
+// jsonDiffs renders the JSON functions applying the diffs of a partial JSON update.
+func jsonDiffs(c *column, diffs []*replication.JsonDiff) (string, error) {
+	s := quoteIdent(c.name)
+	for _, d := range diffs {
+		path := quoteString(d.Path)
+		switch d.Op {
+		case replication.JsonDiffOperationReplace:
+			s = "JSON_REPLACE(" + s + ", " + path + ", " + jsonValue(d.Value) + ")"
+		case replication.JsonDiffOperationInsert:
+			fn := "JSON_INSERT"
+			if strings.HasSuffix(d.Path, "]") {
+				fn = "JSON_ARRAY_INSERT"
+			}
+			s = fn + "(" + s + ", " + path + ", " + jsonValue(d.Value) + ")"
+		case replication.JsonDiffOperationRemove:
+			s = "JSON_REMOVE(" + s + ", " + path + ")"
+		default:
+			return "", errors.Errorf("unknown JSON diff operation %s of column %s", d.Op, c.name)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,223 @@
+package binlogsql
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+func newTestTableMap(withNames bool) *replication.TableMapEvent {
+	e := &replication.TableMapEvent{
+		Schema:      []byte("db"),
+		Table:       []byte("t`1"),
+		ColumnCount: 10,
+		ColumnType: []byte{
+			mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_NEWDECIMAL,
+			mysql.MYSQL_TYPE_BIT, mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_JSON,
+			mysql.MYSQL_TYPE_FLOAT, mysql.MYSQL_TYPE_DATETIME2,
+		},
+		ColumnMeta: []uint16{
+			0, 255, 2, 10<<8 | 2,
+			5, uint16(mysql.MYSQL_TYPE_ENUM)<<8 | 1, uint16(mysql.MYSQL_TYPE_SET)<<8 | 1, 4,
+			4, 3,
+		},
+	}
+	if withNames {
+		e.ColumnName = [][]byte{
+			[]byte("id"), []byte("name"), []byte("data"), []byte("price"),
+			[]byte("flags"), []byte("color"), []byte("tags"), []byte("doc"),
+			[]byte("f"), []byte("ts"),
+		}
+		e.PrimaryKey = []uint64{0}
+		// utf8mb4 but the binary BLOB
+		e.DefaultCharset = []uint64{255, 1, mysql.BINARY_COLLATION_ID}
+		e.EnumSetDefaultCharset = []uint64{255}
+		e.EnumStrValue = [][][]byte{{[]byte("red"), []byte("green")}}
+		e.SetStrValue = [][][]byte{{[]byte("a"), []byte("b"), []byte("c")}}
+	}
+	return e
+}
+
+func newTestRows(eventType replication.EventType, table *replication.TableMapEvent, rows ...[]any) *replication.BinlogEvent {
+	return &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: eventType},
+		Event:  &replication.RowsEvent{Table: table, ColumnCount: table.ColumnCount, Rows: rows},
+	}
+}
+
+func TestRenderer(t *testing.T) {
+	table := newTestTableMap(true)
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 123000000, time.UTC)
+	row1 := []any{int32(1), "it's", []byte{0, 1}, "12.50", int64(5), int64(2), int64(5), `{"a": 1}`, float32(1.5), ts}
+	row2 := []any{int32(2), nil, []byte{}, "-1.00", int64(0), int64(0), int64(0), []byte{}, float32(0.1), ts}
+	row1Updated := []any{int32(1), "a\nb", []byte{0xff}, "12.50", int64(5), int64(1), int64(3), `{"a": 2}`, float32(1.5), ts}
+
+	const (
+		insertRow1 = "INSERT INTO `db`.`t``1` (`id`, `name`, `data`, `price`, `flags`, `color`, `tags`, `doc`, `f`, `ts`) VALUES " +
+			`(1, 'it\'s', X'0001', 12.50, b'101', 'green', 'a,c', CAST('{\"a\": 1}' AS JSON), 1.5, '2024-01-02 03:04:05.123')`
+		insertRow2 = "INSERT INTO `db`.`t``1` (`id`, `name`, `data`, `price`, `flags`, `color`, `tags`, `doc`, `f`, `ts`) VALUES " +
+			`(2, NULL, '', -1.00, b'0', '', '', CAST('null' AS JSON), 0.1, '2024-01-02 03:04:05.123')`
+		deleteRow1 = "DELETE FROM `db`.`t``1` WHERE `id`=1 LIMIT 1"
+		deleteRow2 = "DELETE FROM `db`.`t``1` WHERE `id`=2 LIMIT 1"
+		updateRow1 = "UPDATE `db`.`t``1` SET `id`=1, `name`='a\\nb', `data`=X'ff', `price`=12.50, `flags`=b'101', `color`='red', `tags`='a,b', " +
+			"`doc`=CAST('{\\\"a\\\": 2}' AS JSON), `f`=1.5, `ts`='2024-01-02 03:04:05.123' WHERE `id`=1 LIMIT 1"
+		revertRow1 = "UPDATE `db`.`t``1` SET `id`=1, `name`='it\\'s', `data`=X'0001', `price`=12.50, `flags`=b'101', `color`='green', `tags`='a,c', " +
+			"`doc`=CAST('{\\\"a\\\": 1}' AS JSON), `f`=1.5, `ts`='2024-01-02 03:04:05.123' WHERE `id`=1 LIMIT 1"
+	)
+
+	insert := newTestRows(replication.WRITE_ROWS_EVENTv2, table, row1, row2)
+	update := newTestRows(replication.UPDATE_ROWS_EVENTv2, table, row1, row1Updated)
+	del := newTestRows(replication.DELETE_ROWS_EVENTv2, table, row1, row2)
+	events := []*replication.BinlogEvent{
+		insert,
+		{Header: &replication.EventHeader{EventType: replication.XID_EVENT}, Event: &replication.XIDEvent{}},
+	}
+
+	r := NewRenderer(Config{})
+	stmts, err := r.RenderEvent(insert)
+	require.NoError(t, err)
+	require.Equal(t, []string{insertRow1, insertRow2}, stmts)
+	stmts, err = r.RenderEvent(update)
+	require.NoError(t, err)
+	require.Equal(t, []string{updateRow1}, stmts)
+	stmts, err = r.RenderEvent(del)
+	require.NoError(t, err)
+	require.Equal(t, []string{deleteRow1, deleteRow2}, stmts)
+	stmts, err = r.RenderTransaction(events)
+	require.NoError(t, err)
+	require.Equal(t, []string{insertRow1, insertRow2}, stmts)
+
+	// the inverse statements in reverse order
+	r = NewRenderer(Config{Flashback: true})
+	stmts, err = r.RenderEvent(insert)
+	require.NoError(t, err)
+	require.Equal(t, []string{deleteRow2, deleteRow1}, stmts)
+	stmts, err = r.RenderEvent(update)
+	require.NoError(t, err)
+	require.Equal(t, []string{revertRow1}, stmts)
+	stmts, err = r.RenderEvent(del)
+	require.NoError(t, err)
+	require.Equal(t, []string{insertRow2, insertRow1}, stmts)
+	stmts, err = r.RenderTransaction([]*replication.BinlogEvent{insert, update})
+	require.NoError(t, err)
+	require.Equal(t, []string{revertRow1, deleteRow2, deleteRow1}, stmts)
+}
+
+func TestRendererWithoutPrimaryKey(t *testing.T) {
+	table := &replication.TableMapEvent{
+		Schema:      []byte("db"),
+		Table:       []byte("t"),
+		ColumnCount: 4,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_FLOAT, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_JSON},
+		ColumnMeta:  []uint16{0, 4, 255, 4},
+		ColumnName:  [][]byte{[]byte("a"), []byte("f"), []byte("s"), []byte("j")},
+	}
+	e := newTestRows(replication.PARTIAL_UPDATE_ROWS_EVENT, table,
+		[]any{int32(1), float32(0.1), nil, `{"a": [1]}`},
+		[]any{int32(2), float32(0.2), "x", &replication.JsonDiff{Op: replication.JsonDiffOperationInsert, Path: "$.a[1]", Value: "2"}},
+	)
+
+	stmts, err := NewRenderer(Config{}).RenderEvent(e)
+	require.NoError(t, err)
+	// the FLOAT is not compared
+	require.Equal(t, []string{
+		"UPDATE `db`.`t` SET `a`=2, `f`=0.2, `s`='x', `j`=JSON_ARRAY_INSERT(`j`, '$.a[1]', CAST('2' AS JSON)) " +
+			"WHERE `a`=1 AND `s` IS NULL AND `j`=CAST('{\\\"a\\\": [1]}' AS JSON) LIMIT 1",
+	}, stmts)
+
+	// the partial update is not compared
+	stmts, err = NewRenderer(Config{Flashback: true}).RenderEvent(e)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"UPDATE `db`.`t` SET `a`=1, `f`=0.1, `s`=NULL, `j`=CAST('{\\\"a\\\": [1]}' AS JSON) WHERE `a`=2 AND `s`='x' LIMIT 1",
+	}, stmts)
+}
+
+func TestRendererGetTable(t *testing.T) {
+	table := newTestTableMap(false)
+	e := newTestRows(replication.DELETE_ROWS_EVENTv2, table,
+		[]any{int32(1), "x", []byte("y"), "1.00", int64(1), int64(1), int64(1), `[]`, float32(1), "2024-01-02 03:04:05.000"})
+
+	_, err := NewRenderer(Config{}).RenderEvent(e)
+	require.Error(t, err)
+
+	r := NewRenderer(Config{GetTable: func(db string, name string) (*schema.Table, error) {
+		require.Equal(t, "db", db)
+		require.Equal(t, "t`1", name)
+		ta := &schema.Table{Schema: db, Name: name}
+		for _, c := range []string{"id", "name", "data", "price", "flags", "color", "tags", "doc", "f", "ts"} {
+			ta.AddColumn(c, "int", "", "")
+		}
+		ta.Columns[1].Collation = "utf8mb4_0900_ai_ci"
+		ta.Columns[5].EnumValues = []string{"red", "green"}
+		ta.Columns[6].SetValues = []string{"a", "b", "c"}
+		return ta, nil
+	}})
+	stmts, err := r.RenderEvent(e)
+	require.NoError(t, err)
+	// no primary key
+	require.Equal(t, []string{
+		"DELETE FROM `db`.`t``1` WHERE `id`=1 AND `name`='x' AND `data`=X'79' AND `price`=1.00 AND `flags`=b'1' AND " +
+			"`color`='red' AND `tags`='a' AND `doc`=CAST('[]' AS JSON) AND `ts`='2024-01-02 03:04:05.000' LIMIT 1",
+	}, stmts)
+}
+
+func TestRendererLazyRowsDecode(t *testing.T) {
+	table := &replication.TableMapEvent{
+		TableID:     100,
+		Schema:      []byte("db"),
+		Table:       []byte("t"),
+		ColumnCount: 2,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR},
+		ColumnMeta:  []uint16{0, 255},
+		NullBitmap:  []byte{0x02},
+		ColumnName:  [][]byte{[]byte("id"), []byte("name")},
+		PrimaryKey:  []uint64{0},
+		// utf8mb4
+		DefaultCharset: []uint64{255},
+	}
+
+	dir := t.TempDir()
+	w, err := replication.NewBinlogWriter(replication.BinlogWriterConfig{Dir: dir, ServerID: 1})
+	require.NoError(t, err)
+	write := func(eventType replication.EventType, e replication.Event) {
+		require.NoError(t, w.WriteEvent(&replication.BinlogEvent{Header: &replication.EventHeader{EventType: eventType, ServerID: 1}, Event: e}))
+	}
+	write(replication.TABLE_MAP_EVENT, table)
+	insert, err := replication.NewRowsEvent(replication.WRITE_ROWS_EVENTv2, table)
+	require.NoError(t, err)
+	insert.Rows = [][]any{{int32(1), "a"}, {int32(2), nil}}
+	write(replication.WRITE_ROWS_EVENTv2, insert)
+	write(replication.TABLE_MAP_EVENT, table)
+	update, err := replication.NewRowsEvent(replication.UPDATE_ROWS_EVENTv2, table)
+	require.NoError(t, err)
+	update.Rows = [][]any{{int32(1), "a"}, {int32(1), "b"}}
+	update.Flags = replication.RowsEventStmtEndFlag
+	write(replication.UPDATE_ROWS_EVENTv2, update)
+	name := w.Position().Name
+	require.NoError(t, w.Close())
+
+	p := replication.NewBinlogParser()
+	p.SetLazyRowsDecode(true)
+	var stmts []string
+	r := NewRenderer(Config{})
+	require.NoError(t, p.ParseFile(filepath.Join(dir, name), 0, func(e *replication.BinlogEvent) error {
+		if ev, ok := e.Event.(*replication.RowsEvent); ok {
+			require.Nil(t, ev.Rows)
+		}
+		s, err := r.RenderEvent(e)
+		stmts = append(stmts, s...)
+		return err
+	}))
+	require.Equal(t, []string{
+		"INSERT INTO `db`.`t` (`id`, `name`) VALUES (1, 'a')",
+		"INSERT INTO `db`.`t` (`id`, `name`) VALUES (2, NULL)",
+		"UPDATE `db`.`t` SET `id`=1, `name`='b' WHERE `id`=1 LIMIT 1",
+	}, stmts)
+}
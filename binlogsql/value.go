@@ -0,0 +1,152 @@
+package binlogsql
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pingcap/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// value renders the value of a column decoded by the replication package as a SQL
+// literal, see RowsEvent for the types of the values.
+func (c *column) value(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		switch {
+		case c.enum:
+			return c.enumValue(v), nil
+		case c.set:
+			return c.setValue(v), nil
+		case c.tp == mysql.MYSQL_TYPE_BIT:
+			return "b'" + strconv.FormatUint(uint64(v), 2) + "'", nil
+		}
+		return strconv.FormatInt(v, 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case decimal.Decimal:
+		return v.String(), nil
+	case time.Time:
+		return quoteString(c.formatTime(v)), nil
+	case string:
+		switch {
+		case c.tp == mysql.MYSQL_TYPE_NEWDECIMAL:
+			return v, nil
+		case c.tp == mysql.MYSQL_TYPE_JSON:
+			return jsonValue(v), nil
+		case c.binary && c.isString(), !utf8.ValidString(v):
+			return hexString(v), nil
+		}
+		// the temporal types are strings too
+		return quoteString(v), nil
+	case []byte:
+		switch {
+		case c.tp == mysql.MYSQL_TYPE_JSON:
+			// an empty document is the JSON null literal
+			return jsonValue(string(v)), nil
+		case c.text && utf8.Valid(v):
+			return quoteString(string(v)), nil
+		}
+		return hexString(string(v)), nil
+	case *replication.JsonDiff, []*replication.JsonDiff:
+		return "", errors.Errorf("partial JSON update of column %s is only supported as an updated value", c.name)
+	default:
+		return "", errors.Errorf("unsupported value %T of column %s", v, c.name)
+	}
+}
+
+// isString reports whether the column is a CHAR, VARCHAR, BINARY or VARBINARY.
+func (c *column) isString() bool {
+	switch c.tp {
+	case mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING:
+		return !c.enum && !c.set
+	}
+	return false
+}
+
+// enumValue renders the index of an ENUM value, index 0 is the empty string of the
+// invalid values.
+func (c *column) enumValue(v int64) string {
+	if v == 0 {
+		return "''"
+	}
+	if c.enumValues == nil || v > int64(len(c.enumValues)) {
+		return strconv.FormatInt(v, 10)
+	}
+	return quoteString(c.enumValues[v-1])
+}
+
+// setValue renders the bitmap of a SET value.
+func (c *column) setValue(v int64) string {
+	if c.setValues == nil || v>>len(c.setValues) != 0 {
+		return strconv.FormatInt(v, 10)
+	}
+	var values []string
+	for i, s := range c.setValues {
+		if v&(1<<i) != 0 {
+			values = append(values, s)
+		}
+	}
+	return quoteString(strings.Join(values, ","))
+}
+
+// formatTime formats a DATETIME or TIMESTAMP with its fractional seconds precision.
+func (c *column) formatTime(t time.Time) string {
+	layout := time.DateTime
+	switch c.tp {
+	case mysql.MYSQL_TYPE_DATETIME2, mysql.MYSQL_TYPE_TIMESTAMP2:
+		if c.meta > 0 && c.meta <= 6 {
+			layout += "." + strings.Repeat("0", int(c.meta))
+		}
+	}
+	return t.Format(layout)
+}
+
+// jsonValue renders a JSON document in its text form.
+func jsonValue(s string) string {
+	if s == "" {
+		s = "null"
+	}
+	return "CAST(" + quoteString(s) + " AS JSON)"
+}
+
+func hexString(s string) string {
+	if s == "" {
+		return "''"
+	}
+	return "X'" + hex.EncodeToString([]byte(s)) + "'"
+}
+
+func quoteString(s string) string {
+	return "'" + mysql.Escape(s) + "'"
+}
+
+func quoteIdent(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
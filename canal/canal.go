@@ -33,7 +33,7 @@ type Canal struct {
 
 	parser     *parser.Parser
 	master     *masterInfo
-	dumper     *dump.Dumper
+	dumper     dumper
 	dumped     bool
 	dumpDoneCh chan struct{}
 	syncer     *replication.BinlogSyncer
@@ -46,6 +46,16 @@ type Canal struct {
 	tableLock          sync.RWMutex
 	tables             map[string]*schema.Table
 	errorTablesGetTime map[string]time.Time
+	// tableMaps are the TableMapEvents the tables were built from if UseTableMapMetadata is set
+	tableMaps map[string]*replication.TableMapEvent
+
+	history *schemaHistory
+
+	// txn is the transaction buffered for TransactionHandler
+	txn *Transaction
+
+	// dispatcher is set while the binlog is synced if ParallelWorkers is enabled
+	dispatcher *dispatcher
 
 	tableMatchCache   map[string]bool
 	includeTableRegex []*regexp.Regexp
@@ -53,6 +63,13 @@ type Canal struct {
 
 	delay atomic.Uint32
 
+	positionSaveLock sync.Mutex
+	lastPositionSave time.Time
+
+	snapshotLock       sync.Mutex
+	snapshotWindowLock sync.Mutex
+	snapshotWindow     *snapshotWindow
+
 	ctx    context.Context
 	cancel context.CancelFunc
 }
@@ -80,6 +97,7 @@ func NewCanal(cfg *Config) (*Canal, error) {
 	c.eventHandler = &DummyEventHandler{}
 	c.parser = parser.New()
 	c.tables = make(map[string]*schema.Table)
+	c.tableMaps = make(map[string]*replication.TableMapEvent)
 	if c.cfg.DiscardNoMetaRowEvent {
 		c.errorTablesGetTime = make(map[string]time.Time)
 	}
@@ -135,26 +153,54 @@ func (c *Canal) initTableFilter() error {
 	return nil
 }
 
+// dumper is implemented by dump.Dumper and dump.SnapshotDumper.
+type dumper interface {
+	AddDatabases(dbs ...string)
+	AddTables(db string, tables ...string)
+	AddIgnoreTables(db string, tables ...string)
+	DumpAndParse(h dump.ParseHandler) error
+}
+
 func (c *Canal) prepareDumper() error {
-	var err error
-	dumpPath := c.cfg.Dump.ExecutionPath
-	if len(dumpPath) == 0 {
-		// ignore mysqldump, use binlog only
-		return nil
-	}
+	if c.cfg.Dump.UseSnapshot {
+		c.dumper = c.newSnapshotDumper()
+	} else {
+		dumpPath := c.cfg.Dump.ExecutionPath
+		if len(dumpPath) == 0 {
+			// ignore mysqldump, use binlog only
+			return nil
+		}
 
-	if c.dumper, err = dump.NewDumper(dumpPath,
-		c.cfg.Addr, c.cfg.User, c.cfg.Password); err != nil {
-		return errors.Trace(err)
-	}
+		d, err := dump.NewDumper(dumpPath, c.cfg.Addr, c.cfg.User, c.cfg.Password)
+		if err != nil {
+			return errors.Trace(err)
+		}
 
-	if c.dumper == nil {
-		// no mysqldump, use binlog only
-		return nil
-	}
+		if d == nil {
+			// no mysqldump, use binlog only
+			return nil
+		}
 
-	// use the same logger for the dumper
-	c.dumper.Logger = c.cfg.Logger
+		// use the same logger for the dumper
+		d.Logger = c.cfg.Logger
+
+		d.SetCharset(c.cfg.Charset)
+		d.SetWhere(c.cfg.Dump.Where)
+		d.SkipMasterData(c.cfg.Dump.SkipMasterData)
+		d.SetMaxAllowedPacket(c.cfg.Dump.MaxAllowedPacketMB)
+		d.SetProtocol(c.cfg.Dump.Protocol)
+		d.SetExtraOptions(c.cfg.Dump.ExtraOptions)
+		// Use hex blob for mysqldump
+		d.SetHexBlob(true)
+
+		if c.cfg.Dump.DiscardErr {
+			d.SetErrOut(io.Discard)
+		} else {
+			d.SetErrOut(os.Stderr)
+		}
+
+		c.dumper = d
+	}
 
 	dbs := c.cfg.Dump.Databases
 	tables := c.cfg.Dump.Tables
@@ -166,30 +212,30 @@ func (c *Canal) prepareDumper() error {
 		c.dumper.AddTables(tableDB, tables...)
 	}
 
-	charset := c.cfg.Charset
-	c.dumper.SetCharset(charset)
-
-	c.dumper.SetWhere(c.cfg.Dump.Where)
-	c.dumper.SkipMasterData(c.cfg.Dump.SkipMasterData)
-	c.dumper.SetMaxAllowedPacket(c.cfg.Dump.MaxAllowedPacketMB)
-	c.dumper.SetProtocol(c.cfg.Dump.Protocol)
-	c.dumper.SetExtraOptions(c.cfg.Dump.ExtraOptions)
-	// Use hex blob for mysqldump
-	c.dumper.SetHexBlob(true)
-
 	for _, ignoreTable := range c.cfg.Dump.IgnoreTables {
 		if seps := strings.Split(ignoreTable, ","); len(seps) == 2 {
 			c.dumper.AddIgnoreTables(seps[0], seps[1])
 		}
 	}
 
-	if c.cfg.Dump.DiscardErr {
-		c.dumper.SetErrOut(io.Discard)
-	} else {
-		c.dumper.SetErrOut(os.Stderr)
+	return nil
+}
+
+func (c *Canal) newSnapshotDumper() *dump.SnapshotDumper {
+	d := dump.NewSnapshotDumper(c.cfg.Addr, c.cfg.User, c.cfg.Password)
+	d.Connect = func() (*client.Conn, error) {
+		return c.connect(c.tlsOptions()...)
 	}
+	d.Logger = c.cfg.Logger
 
-	return nil
+	d.SetCharset(c.cfg.Charset)
+	d.SetWhere(c.cfg.Dump.Where)
+	d.SkipMasterData(c.cfg.Dump.SkipMasterData)
+	if c.cfg.Dump.ChunkSize > 0 {
+		d.SetChunkSize(c.cfg.Dump.ChunkSize)
+	}
+
+	return d
 }
 
 func (c *Canal) GetDelay() uint32 {
@@ -233,6 +279,16 @@ func (c *Canal) run() error {
 
 	c.master.UpdateTimestamp(uint32(utils.Now().Unix()))
 
+	if err := c.loadPosition(); err != nil {
+		c.cfg.Logger.Error("canal load position err", slog.Any("error", err))
+		return errors.Trace(err)
+	}
+
+	if err := c.loadSchemaHistory(); err != nil {
+		c.cfg.Logger.Error("canal load schema history err", slog.Any("error", err))
+		return errors.Trace(err)
+	}
+
 	if !c.dumped {
 		c.dumped = true
 
@@ -270,6 +326,9 @@ func (c *Canal) Close() {
 	c.connLock.Unlock()
 
 	_ = c.eventHandler.OnPosSynced(nil, c.master.Position(), c.master.GTIDSet(), true)
+	if err := c.savePosition(true); err != nil {
+		c.cfg.Logger.Error("save position on close", slog.Any("error", err))
+	}
 }
 
 func (c *Canal) WaitDumpDone() <-chan struct{} {
@@ -280,6 +339,28 @@ func (c *Canal) Ctx() context.Context {
 	return c.ctx
 }
 
+// decodeRowsEvent decodes the rows of the matched tables, and of SignalTable whether it
+// matches or not, as IncrementalSnapshot waits for its watermarks.
+func (c *Canal) decodeRowsEvent(event *replication.RowsEvent, data []byte) error {
+	pos, err := event.DecodeHeader(data)
+	if err != nil {
+		return err
+	}
+
+	schemaName, tableName := string(event.Table.Schema), string(event.Table.Table)
+	if c.isSignalTable(schemaName, tableName) {
+		return event.DecodeData(pos, data)
+	}
+	if !c.checkTableMatch(fmt.Sprintf("%s.%s", schemaName, tableName)) {
+		return nil
+	}
+
+	if _, ok := c.rowIteratorHandler(); ok {
+		return event.DecodeDataLazily(pos, data)
+	}
+	return event.DecodeData(pos, data)
+}
+
 func (c *Canal) checkTableMatch(key string) bool {
 	// no filter, return true
 	if c.tableMatchCache == nil {
@@ -344,6 +425,22 @@ func (c *Canal) GetTable(db string, table string) (*schema.Table, error) {
 		}
 	}
 
+	if c.history != nil {
+		t, known, err := c.history.tableAt(db, table, c.master.Position(), c.master.GTIDSet())
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if known {
+			if t == nil {
+				return nil, schema.ErrTableNotExist
+			}
+			c.tableLock.Lock()
+			c.tables[key] = t
+			c.tableLock.Unlock()
+			return t, nil
+		}
+	}
+
 	t, err := schema.NewTable(c, db, table)
 	if err != nil {
 		// check table not exists
@@ -382,6 +479,17 @@ func (c *Canal) GetTable(db string, table string) (*schema.Table, error) {
 		return nil, err
 	}
 
+	if c.history != nil {
+		// the table is valid from here as its previous versions are unknown
+		r := &SchemaHistoryRecord{Pos: c.master.Position(), Schema: db, Table: table, TableInfo: t}
+		if gset := c.master.GTIDSet(); gset != nil {
+			r.GTIDSet = gset.String()
+		}
+		if err = c.history.record(r); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
 	c.tableLock.Lock()
 	c.tables[key] = t
 	if c.cfg.DiscardNoMetaRowEvent {
@@ -393,11 +501,42 @@ func (c *Canal) GetTable(db string, table string) (*schema.Table, error) {
 	return t, nil
 }
 
+// getTableFromTableMap returns the table built from the metadata of the TableMapEvent,
+// it is rebuilt only if the row event refers to a new TableMapEvent.
+func (c *Canal) getTableFromTableMap(e *replication.TableMapEvent) (*schema.Table, error) {
+	key := fmt.Sprintf("%s.%s", e.Schema, e.Table)
+	if !c.checkTableMatch(key) {
+		return nil, ErrExcludedTable
+	}
+
+	c.tableLock.RLock()
+	t, ok := c.tables[key]
+	last := c.tableMaps[key]
+	c.tableLock.RUnlock()
+
+	if ok && last == e {
+		return t, nil
+	}
+
+	t, err := schema.NewTableFromTableMap(e)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	c.tableLock.Lock()
+	c.tables[key] = t
+	c.tableMaps[key] = e
+	c.tableLock.Unlock()
+
+	return t, nil
+}
+
 // ClearTableCache clear table cache
 func (c *Canal) ClearTableCache(db []byte, table []byte) {
 	key := fmt.Sprintf("%s.%s", db, table)
 	c.tableLock.Lock()
 	delete(c.tables, key)
+	delete(c.tableMaps, key)
 	if c.cfg.DiscardNoMetaRowEvent {
 		delete(c.errorTablesGetTime, key)
 	}
@@ -466,21 +605,11 @@ func (c *Canal) prepareSyncer() error {
 		Dialer:                  c.cfg.Dialer,
 		Localhost:               c.cfg.Localhost,
 		EventCacheCount:         c.cfg.EventCacheCount,
+		EventCacheBytes:         c.cfg.EventCacheBytes,
+		Metrics:                 c.cfg.Metrics,
 		FillZeroLogPos:          c.cfg.FillZeroLogPos,
 
-		RowsEventDecodeFunc: func(event *replication.RowsEvent, data []byte) error {
-			pos, err := event.DecodeHeader(data)
-			if err != nil {
-				return err
-			}
-
-			key := fmt.Sprintf("%s.%s", string(event.Table.Schema), string(event.Table.Table))
-			if !c.checkTableMatch(key) {
-				return nil
-			}
-
-			return event.DecodeData(pos, data)
-		},
+		RowsEventDecodeFunc: c.decodeRowsEvent,
 	}
 
 	if strings.Contains(c.cfg.Addr, "/") {
@@ -512,10 +641,7 @@ func (c *Canal) connect(options ...client.Option) (*client.Conn, error) {
 		c.cfg.User, c.cfg.Password, "", c.cfg.Dialer, options...)
 }
 
-// Execute a SQL
-func (c *Canal) Execute(cmd string, args ...any) (rr *mysql.Result, err error) {
-	c.connLock.Lock()
-	defer c.connLock.Unlock()
+func (c *Canal) tlsOptions() []client.Option {
 	argF := make([]client.Option, 0)
 	if c.cfg.TLSConfig != nil {
 		argF = append(argF, func(conn *client.Conn) error {
@@ -523,6 +649,14 @@ func (c *Canal) Execute(cmd string, args ...any) (rr *mysql.Result, err error) {
 			return nil
 		})
 	}
+	return argF
+}
+
+// Execute a SQL
+func (c *Canal) Execute(cmd string, args ...any) (rr *mysql.Result, err error) {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	argF := c.tlsOptions()
 
 	retryNum := 3
 	for range retryNum {
@@ -9,13 +9,15 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/go-mysql-org/go-mysql/client"
 	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
 	"github.com/go-mysql-org/go-mysql/test_util"
 )
 
 type canalTestSuite struct {
-	addr string
+	addr         string
+	snapshotDump bool
 	suite.Suite
 	c *Canal
 }
@@ -28,6 +30,12 @@ func withAddr(addr string) canalTestSuiteOption {
 	}
 }
 
+func withSnapshotDump() canalTestSuiteOption {
+	return func(c *canalTestSuite) {
+		c.snapshotDump = true
+	}
+}
+
 func newCanalTestSuite(opts ...canalTestSuiteOption) *canalTestSuite {
 	c := new(canalTestSuite)
 	for _, opt := range opts {
@@ -39,6 +47,7 @@ func newCanalTestSuite(opts ...canalTestSuiteOption) *canalTestSuite {
 func TestCanalSuite(t *testing.T) {
 	suite.Run(t, newCanalTestSuite())
 	suite.Run(t, newCanalTestSuite(withAddr(mysql.DEFAULT_IPV6_ADDR)))
+	suite.Run(t, newCanalTestSuite(withSnapshotDump()))
 }
 
 const (
@@ -67,6 +76,8 @@ func (s *canalTestSuite) SetupSuite() {
 	cfg.Dump.TableDB = "test"
 	cfg.Dump.Tables = []string{"canal_test"}
 	cfg.Dump.Where = "id>0"
+	cfg.Dump.UseSnapshot = s.snapshotDump
+	cfg.Dump.ChunkSize = 2
 
 	// include & exclude config
 	cfg.IncludeTableRegex = make([]string, 1)
@@ -190,6 +201,55 @@ func (s *canalTestSuite) TestAnalyzeAdvancesSyncedPos() {
 	require.Greater(s.T(), endingPos.Pos, startingPos.Pos)
 }
 
+func (s *canalTestSuite) TestMySQLPositionStore() {
+	s.execute("DROP TABLE IF EXISTS test.canal_position")
+
+	conn, err := client.Connect(s.c.cfg.Addr, s.c.cfg.User, s.c.cfg.Password, "")
+	require.NoError(s.T(), err)
+	defer conn.Close()
+
+	store, err := NewMySQLPositionStore(conn, "test", "canal_position", "canal_test", s.c.cfg.Flavor)
+	require.NoError(s.T(), err)
+
+	startingPos, err := s.c.GetMasterPos()
+	require.NoError(s.T(), err)
+
+	cp, err := store.Load()
+	require.NoError(s.T(), err)
+	require.Nil(s.T(), cp)
+
+	saved := &Checkpoint{Pos: mysql.Position{Name: "mysql-bin.000002", Pos: 1234}, Timestamp: 1700000000}
+	for range 2 {
+		require.NoError(s.T(), store.Save(saved))
+		cp, err = store.Load()
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), saved, cp)
+		saved.Pos.Pos++
+	}
+
+	// the saves aren't written to the binlog, so they aren't synced by the Canal
+	endingPos, err := s.c.GetMasterPos()
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), startingPos, endingPos)
+}
+
+func (s *canalTestSuite) TestIncrementalSnapshot() {
+	<-s.c.WaitDumpDone()
+
+	s.c.cfg.SignalTable = "test.canal_signal"
+	s.c.cfg.IncrementalSnapshotChunkSize = 2
+	defer func() {
+		s.c.cfg.SignalTable = ""
+	}()
+
+	err := s.c.IncrementalSnapshot("test", "canal_test")
+	require.NoError(s.T(), err)
+
+	r := s.execute("SELECT COUNT(*) FROM test.canal_signal")
+	n, _ := r.GetInt(0, 0)
+	require.Equal(s.T(), int64(0), n)
+}
+
 func (s *canalTestSuite) TestCanalFilter() {
 	// included
 	sch, err := s.c.GetTable("test", "canal_test")
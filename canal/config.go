@@ -48,6 +48,13 @@ type DumpConfig struct {
 
 	// Set extra options
 	ExtraOptions []string `toml:"extra_options"`
+
+	// Set true to dump with a consistent snapshot read through the MySQL connection
+	// instead of mysqldump, ExecutionPath is not used then.
+	UseSnapshot bool `toml:"use_snapshot"`
+
+	// Rows read per query by the snapshot dump, 1000 if not set
+	ChunkSize int `toml:"chunk_size"`
 }
 
 type Config struct {
@@ -102,6 +109,12 @@ type Config struct {
 	// Set Logger
 	Logger *slog.Logger
 
+	// Metrics receives the measurements of the Canal and of its binlog sync, see Metrics.
+	Metrics Metrics `toml:"-"`
+
+	// Tracer traces the calls of the EventHandler, see Tracer.
+	Tracer Tracer `toml:"-"`
+
 	// Set Dialer
 	Dialer client.Dialer
 
@@ -114,6 +127,57 @@ type Config struct {
 	// if you table contain large columns, you can decrease this value to avoid OOM.
 	EventCacheCount int
 
+	// EventCacheBytes bounds the raw size of the events in the BinlogStreamer internal
+	// event channel, 0 means no bound. Unlike EventCacheCount, it also bounds the memory
+	// used by a few large events.
+	EventCacheBytes int64
+
+	// PositionStore persists the synced position. If set, Run resumes from the saved
+	// position unless RunFrom or StartFromGTID is used, and the position is saved
+	// whenever it is synced, after OnPosSynced.
+	PositionStore PositionStore `toml:"-"`
+
+	// PositionFlushInterval is the minimum interval between two saves to PositionStore.
+	// Forced saves, e.g. on rotate, DDL and Close, are never delayed.
+	// Zero means the position is saved every time it is synced.
+	PositionFlushInterval time.Duration `toml:"position_flush_interval"`
+
+	// SchemaHistory persists the tables changed by the DDLs in the binlog. If set, the rows
+	// are decoded with the table valid at their position instead of the current table
+	// of the server, which is only read for the tables seen for the first time.
+	SchemaHistory SchemaHistoryStore `toml:"-"`
+
+	// ParallelWorkers is the number of goroutines calling EventHandler.OnRow for the binlog rows,
+	// they are called on the sync goroutine if it is zero or one. The rows with the same table
+	// and primary key are always handled in order by the same goroutine. The rows are handled
+	// before the next DDL and rotate, and OnPosSynced is called in order once all the rows of
+	// the transaction are handled. The other callbacks, e.g. OnXID, are still called on the
+	// sync goroutine when the event is read, maybe before the rows of the transaction are handled.
+	ParallelWorkers int `toml:"parallel_workers"`
+
+	// TransactionBufferSize is the maximum size in bytes of the rows of a transaction kept in
+	// memory for TransactionHandler, the rest are spilled to a temporary file.
+	// Zero means no limit.
+	TransactionBufferSize int64 `toml:"transaction_buffer_size"`
+
+	// TransactionSpillDir is the directory of the temporary files of TransactionBufferSize,
+	// os.TempDir() is used if it is empty.
+	TransactionSpillDir string `toml:"transaction_spill_dir"`
+
+	// UseTableMapMetadata builds the tables of the row events from the optional metadata of
+	// their TableMapEvents instead of querying the server, so the rows are always decoded
+	// with the table they were written with. It requires binlog_row_metadata=FULL.
+	// The tables of the dump and of GetTable are still read from the server.
+	UseTableMapMetadata bool `toml:"use_table_map_metadata"`
+
+	// SignalTable is the table, in db.table format, where IncrementalSnapshot writes its
+	// watermarks. It is created if it doesn't exist.
+	SignalTable string `toml:"signal_table"`
+
+	// IncrementalSnapshotChunkSize is the number of rows read per chunk by IncrementalSnapshot,
+	// the table is read in one chunk if it is zero.
+	IncrementalSnapshotChunkSize int `toml:"incremental_snapshot_chunk_size"`
+
 	// FillZeroLogPos enables dynamic LogPos calculation for MariaDB.
 	// When enabled, automatically adds BINLOG_SEND_ANNOTATE_ROWS_EVENT flag
 	// to ensure correct position calculation in MariaDB 11.4+.
@@ -156,6 +220,9 @@ func NewDefaultConfig() *Config {
 	c.Dump.DiscardErr = true
 	c.Dump.SkipMasterData = false
 
+	c.IncrementalSnapshotChunkSize = 1024
+	c.TransactionBufferSize = 64 * 1024 * 1024
+
 	c.Logger = slog.Default()
 
 	dialer := &net.Dialer{}
@@ -0,0 +1,266 @@
+package canal
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// dispatchQueueSize is the capacity of the queue of each worker and of the commits.
+const dispatchQueueSize = 1024
+
+// dispatchTxn counts the rows of a transaction which are not handled yet.
+type dispatchTxn struct {
+	wg sync.WaitGroup
+}
+
+type dispatchTask struct {
+	e   *RowsEvent
+	txn *dispatchTxn
+}
+
+// dispatchCommit is the position after a transaction, it is synced once all rows
+// of the transaction are handled.
+type dispatchCommit struct {
+	header *replication.EventHeader
+	pos    mysql.Position
+	gset   mysql.GTIDSet
+	txn    *dispatchTxn
+}
+
+// dispatcher calls EventHandler.OnRow from several workers, see Config.ParallelWorkers.
+//
+// The rows are hashed by table and primary key, so the rows with the same key are handled
+// in the binlog order by the same worker. The rows of a table without primary key are all
+// handled by one worker. The positions are synced in order by the committer after the rows
+// of their transaction are handled.
+type dispatcher struct {
+	c *Canal
+
+	// ctx is canceled on the first error
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	workers []chan *dispatchTask
+	commits chan *dispatchCommit
+
+	// pending counts the tasks and commits which are not processed yet
+	pending sync.WaitGroup
+	exited  sync.WaitGroup
+
+	// txn is the transaction being dispatched, it's only used by the sync goroutine
+	txn *dispatchTxn
+
+	errLock sync.Mutex
+	err     error
+}
+
+func newDispatcher(c *Canal, workers int) *dispatcher {
+	d := &dispatcher{
+		c:       c,
+		workers: make([]chan *dispatchTask, workers),
+		commits: make(chan *dispatchCommit, dispatchQueueSize),
+		txn:     new(dispatchTxn),
+	}
+	d.ctx, d.cancel = context.WithCancel(c.ctx)
+
+	d.exited.Add(len(d.workers) + 1)
+	for i := range d.workers {
+		d.workers[i] = make(chan *dispatchTask, dispatchQueueSize)
+		go d.runWorker(d.workers[i])
+	}
+	go d.runCommitter()
+
+	return d
+}
+
+func (d *dispatcher) runWorker(tasks chan *dispatchTask) {
+	defer d.exited.Done()
+
+	for t := range tasks {
+		// skip the rows after an error, their positions are never synced
+		if d.ctx.Err() == nil {
+			if err := d.c.handleRow(t.e); err != nil {
+				d.setError(errors.Trace(err))
+			}
+		}
+		t.txn.wg.Done()
+		d.pending.Done()
+	}
+}
+
+func (d *dispatcher) runCommitter() {
+	defer d.exited.Done()
+
+	for cm := range d.commits {
+		cm.txn.wg.Wait()
+		if d.ctx.Err() == nil {
+			if err := d.c.syncPosition(cm.header, cm.pos, cm.gset, false); err != nil {
+				d.setError(errors.Trace(err))
+			}
+		}
+		d.pending.Done()
+	}
+}
+
+func (d *dispatcher) setError(err error) {
+	d.errLock.Lock()
+	defer d.errLock.Unlock()
+
+	if d.err == nil {
+		d.err = err
+		d.cancel()
+	}
+}
+
+func (d *dispatcher) error() error {
+	d.errLock.Lock()
+	defer d.errLock.Unlock()
+
+	return d.err
+}
+
+// dispatch queues the rows to the workers of their keys.
+func (d *dispatcher) dispatch(e *RowsEvent) error {
+	if err := d.error(); err != nil {
+		return err
+	}
+
+	step := 1
+	if e.Action == UpdateAction {
+		step = 2
+	}
+
+	rows := make([][][]any, len(d.workers))
+	for i := 0; i < len(e.Rows); i += step {
+		w := d.worker(e.Table, e.Rows[i])
+		if step == 2 && i+1 < len(e.Rows) && d.worker(e.Table, e.Rows[i+1]) != w {
+			// the primary key is updated, the order of both keys is kept by handling
+			// the event after all the previous rows
+			if err := d.wait(); err != nil {
+				return err
+			}
+			return errors.Trace(d.c.handleRow(e))
+		}
+		end := min(i+step, len(e.Rows))
+		rows[w] = append(rows[w], e.Rows[i:end]...)
+	}
+
+	for w, rs := range rows {
+		if len(rs) == 0 {
+			continue
+		}
+		ev := *e
+		ev.Rows = rs
+
+		d.pending.Add(1)
+		d.txn.wg.Add(1)
+		d.workers[w] <- &dispatchTask{e: &ev, txn: d.txn}
+	}
+
+	return nil
+}
+
+func (d *dispatcher) worker(t *schema.Table, row []any) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(t.Schema))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(t.Name))
+	if pk, err := t.GetPKValues(row); err == nil {
+		for _, v := range pk {
+			_, _ = h.Write([]byte{0})
+			_, _ = h.Write([]byte(valueToString(v)))
+		}
+	}
+
+	return int(h.Sum32() % uint32(len(d.workers)))
+}
+
+// commit queues the position after the current transaction, it is synced after the rows
+// of the transaction are handled.
+func (d *dispatcher) commit(header *replication.EventHeader, pos mysql.Position, gset mysql.GTIDSet) error {
+	if err := d.error(); err != nil {
+		return err
+	}
+
+	d.pending.Add(1)
+	d.commits <- &dispatchCommit{header: header, pos: pos, gset: gset, txn: d.txn}
+	d.txn = new(dispatchTxn)
+
+	return nil
+}
+
+// wait is the barrier which waits until all dispatched rows are handled and all queued
+// positions are synced.
+func (d *dispatcher) wait() error {
+	d.pending.Wait()
+	return d.error()
+}
+
+// stop discards the rows and positions which are not processed yet and waits for the workers.
+func (d *dispatcher) stop() {
+	d.cancel()
+	for _, tasks := range d.workers {
+		close(tasks)
+	}
+	close(d.commits)
+	d.exited.Wait()
+}
+
+// onRow passes the rows to EventHandler.OnRow, from the workers if ParallelWorkers is enabled.
+func (c *Canal) onRow(e *RowsEvent) error {
+	if c.dispatcher != nil {
+		return c.dispatcher.dispatch(e)
+	}
+	return c.handleRow(e)
+}
+
+// handleRow passes the rows to EventHandler.OnRow and records the time it takes.
+func (c *Canal) handleRow(e *RowsEvent) error {
+	end := c.traceHandler(TraceHandler{
+		Method: "OnRow",
+		Action: e.Action,
+		Schema: e.Table.Schema,
+		Table:  e.Table.Name,
+		Rows:   len(e.Rows),
+	})
+	start := time.Now()
+	err := c.eventHandler.OnRow(e)
+	c.rowHandled(e.Action, start, err)
+	end(err)
+	return err
+}
+
+func (c *Canal) rowHandled(action string, start time.Time, err error) {
+	if c.cfg.Metrics != nil {
+		c.cfg.Metrics.OnRowHandled(action, time.Since(start), err)
+	}
+}
+
+// traceHandler starts the span of an EventHandler call with Config.Tracer, the returned
+// func ends it.
+func (c *Canal) traceHandler(h TraceHandler) func(err error) {
+	if c.cfg.Tracer == nil {
+		return func(error) {}
+	}
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return c.cfg.Tracer.StartHandler(ctx, h)
+}
+
+// waitDispatched waits until the rows passed to onRow are handled.
+func (c *Canal) waitDispatched() error {
+	if c.dispatcher != nil {
+		return c.dispatcher.wait()
+	}
+	return nil
+}
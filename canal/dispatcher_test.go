@@ -0,0 +1,174 @@
+package canal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+type dispatchRecorder struct {
+	DummyEventHandler
+
+	m sync.Mutex
+	// values of the rows by id in the order they were handled
+	values  map[int32][]int32
+	handled int
+	// number of rows handled when the positions were synced
+	synced  []mysql.Position
+	handles []int
+	rotated int
+}
+
+func (h *dispatchRecorder) OnRow(e *RowsEvent) error {
+	// let the workers interleave
+	time.Sleep(time.Millisecond)
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	for _, row := range e.Rows {
+		id := row[0].(int32)
+		h.values[id] = append(h.values[id], row[1].(int32))
+		h.handled++
+	}
+	return nil
+}
+
+func (h *dispatchRecorder) OnRotate(*replication.EventHeader, *replication.RotateEvent) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.rotated = h.handled
+	return nil
+}
+
+func (h *dispatchRecorder) OnPosSynced(_ *replication.EventHeader, pos mysql.Position, _ mysql.GTIDSet, _ bool) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.synced = append(h.synced, pos)
+	h.handles = append(h.handles, h.handled)
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	h := &dispatchRecorder{values: make(map[int32][]int32)}
+	c := &Canal{
+		cfg:          &Config{ParallelWorkers: 4, Logger: slog.Default()},
+		eventHandler: h,
+		master:       &masterInfo{pos: mysql.Position{Name: "mysql-bin.000001", Pos: 4}, logger: slog.Default()},
+		tables: map[string]*schema.Table{
+			"db.t": {
+				Schema:    "db",
+				Name:      "t",
+				Columns:   []schema.TableColumn{{Name: "id", Type: schema.TYPE_NUMBER}, {Name: "v", Type: schema.TYPE_NUMBER}},
+				PKColumns: []int{0},
+			},
+		},
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	defer c.cancel()
+
+	c.dispatcher = newDispatcher(c, c.cfg.ParallelWorkers)
+	defer c.dispatcher.stop()
+
+	tableMap := &replication.TableMapEvent{Schema: []byte("db"), Table: []byte("t")}
+	var logPos uint32 = 4
+	handle := func(eventType replication.EventType, e replication.Event) {
+		logPos += 10
+		ev := &replication.BinlogEvent{Header: &replication.EventHeader{EventType: eventType, LogPos: logPos}, Event: e}
+		require.NoError(t, c.handleEvent(ev))
+	}
+
+	const txns, keys = 20, 8
+	for i := range txns {
+		rows := make([][]any, 0, keys)
+		for id := range keys {
+			rows = append(rows, []any{int32(id), int32(i)})
+		}
+		handle(replication.WRITE_ROWS_EVENTv2, &replication.RowsEvent{Table: tableMap, Rows: rows})
+		// the primary key is updated
+		handle(replication.UPDATE_ROWS_EVENTv2, &replication.RowsEvent{Table: tableMap, Rows: [][]any{
+			{int32(i%keys + 100), int32(i)}, {int32(i%keys + 200), int32(i)},
+		}})
+		handle(replication.XID_EVENT, &replication.XIDEvent{})
+
+		if i == txns/2 {
+			handle(replication.ROTATE_EVENT, &replication.RotateEvent{Position: 4, NextLogName: []byte("mysql-bin.000002")})
+			h.m.Lock()
+			require.Equal(t, (i+1)*(keys+2), h.rotated)
+			h.m.Unlock()
+			logPos = 4
+		}
+	}
+	require.NoError(t, c.waitDispatched())
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	// per key order
+	for id := range keys {
+		expected := make([]int32, txns)
+		for i := range expected {
+			expected[i] = int32(i)
+		}
+		require.Equal(t, expected, h.values[int32(id)], fmt.Sprintf("id %d", id))
+	}
+
+	// the positions are synced in order after the rows of their transactions
+	require.Len(t, h.synced, txns+1)
+	for i := 1; i < len(h.synced); i++ {
+		require.Equal(t, 1, h.synced[i].Compare(h.synced[i-1]))
+	}
+	for i := range txns {
+		j := i
+		if i > txns/2 {
+			// after the rotate
+			j++
+		}
+		require.GreaterOrEqual(t, h.handles[j], (i+1)*(keys+2))
+	}
+	require.Equal(t, h.synced[len(h.synced)-1], c.master.Position())
+	require.Equal(t, "mysql-bin.000002", c.master.Position().Name)
+}
+
+type handlerTracer struct {
+	handlers []TraceHandler
+	errs     []error
+}
+
+func (t *handlerTracer) StartHandler(_ context.Context, h TraceHandler) func(err error) {
+	t.handlers = append(t.handlers, h)
+	return func(err error) {
+		t.errs = append(t.errs, err)
+	}
+}
+
+func TestTraceHandler(t *testing.T) {
+	tracer := &handlerTracer{}
+	c := &Canal{cfg: &Config{Tracer: tracer, Logger: slog.Default()}, eventHandler: &transactionRecorder{}}
+
+	table := &schema.Table{Schema: "db", Name: "t"}
+	e := &RowsEvent{Table: table, Action: InsertAction, Rows: [][]any{{1}, {2}}}
+	require.NoError(t, c.handleRow(e))
+	require.NoError(t, c.onXID(&replication.EventHeader{}, mysql.Position{}))
+	require.NoError(t, c.bufferRows(e))
+	require.NoError(t, c.bufferRows(e))
+	require.NoError(t, c.commitTransaction(&replication.EventHeader{}, mysql.Position{}))
+
+	require.Equal(t, []TraceHandler{
+		{Method: "OnRow", Action: InsertAction, Schema: "db", Table: "t", Rows: 2},
+		{Method: "OnXID"},
+		{Method: "OnTransaction", Rows: 2},
+	}, tracer.handlers)
+	require.Equal(t, []error{nil, nil, nil}, tracer.errs)
+}
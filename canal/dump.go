@@ -112,7 +112,70 @@ func (h *dumpParseHandler) Data(db string, table string, values []string) error
 	}
 
 	events := newRowsEvent(tableInfo, InsertAction, [][]any{vs}, nil, nil)
-	return h.c.eventHandler.OnRow(events)
+	return h.c.handleRow(events)
+}
+
+// Row handles the typed rows of dump.SnapshotDumper.
+func (h *dumpParseHandler) Row(db string, table string, values []any) error {
+	if err := h.c.ctx.Err(); err != nil {
+		return err
+	}
+
+	tableInfo, err := h.c.GetTable(db, table)
+	if err != nil {
+		e := errors.Cause(err)
+		if e == ErrExcludedTable ||
+			e == schema.ErrTableNotExist ||
+			e == schema.ErrMissingTableMeta {
+			return nil
+		}
+		h.c.cfg.Logger.Error("error getting table information", slog.String("database", db), slog.String("table", table), slog.Any("error", err))
+		return errors.Trace(err)
+	}
+
+	vs, err := h.c.convertSnapshotRow(tableInfo, values)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	events := newRowsEvent(tableInfo, InsertAction, [][]any{vs}, nil, nil)
+	return h.c.handleRow(events)
+}
+
+// convertSnapshotRow converts the typed values of dump.SnapshotDumper like the values
+// parsed from mysqldump.
+func (c *Canal) convertSnapshotRow(tableInfo *schema.Table, values []any) ([]any, error) {
+	vs := make([]any, len(values))
+
+	for i, v := range values {
+		switch v := v.(type) {
+		case []byte:
+			// the same as the hex blob of mysqldump
+			vs[i] = string(v)
+		case string:
+			if i < len(tableInfo.Columns) && tableInfo.Columns[i].Type == schema.TYPE_DECIMAL {
+				if c.cfg.UseDecimal {
+					d, err := decimal.NewFromString(v)
+					if err != nil {
+						return nil, fmt.Errorf("parse row %v at %d error %v, decimal expected", values, i, err)
+					}
+					vs[i] = d
+				} else {
+					f, err := strconv.ParseFloat(v, 64)
+					if err != nil {
+						return nil, fmt.Errorf("parse row %v at %d error %v, float expected", values, i, err)
+					}
+					vs[i] = f
+				}
+			} else {
+				vs[i] = v
+			}
+		default:
+			vs[i] = v
+		}
+	}
+
+	return vs, nil
 }
 
 func (c *Canal) AddDumpDatabases(dbs ...string) {
@@ -141,7 +204,7 @@ func (c *Canal) AddDumpIgnoreTables(db string, tables ...string) {
 
 func (c *Canal) dump() error {
 	if c.dumper == nil {
-		return errors.New("mysqldump does not exist")
+		return errors.New("dumper does not exist")
 	}
 
 	c.master.UpdateTimestamp(uint32(utils.Now().Unix()))
@@ -181,6 +244,9 @@ func (c *Canal) dump() error {
 	if err := c.eventHandler.OnPosSynced(nil, pos, c.master.GTIDSet(), true); err != nil {
 		return errors.Trace(err)
 	}
+	if err := c.savePosition(true); err != nil {
+		return errors.Trace(err)
+	}
 	var startPos fmt.Stringer = pos
 	if h.gset != nil {
 		c.master.UpdateGTIDSet(h.gset)
@@ -1,6 +1,9 @@
 package canal
 
 import (
+	"context"
+	"time"
+
 	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
 	"github.com/go-mysql-org/go-mysql/schema"
@@ -14,6 +17,7 @@ type EventHandler interface {
 	OnTableChanged(header *replication.EventHeader, schema string, table string) error
 	OnDDL(header *replication.EventHeader, nextPos mysql.Position, queryEvent *replication.QueryEvent) error
 	OnRow(e *RowsEvent) error
+	// OnXID is called when a transaction commits, or when an XA transaction is prepared.
 	OnXID(header *replication.EventHeader, nextPos mysql.Position) error
 	OnGTID(header *replication.EventHeader, gtidEvent mysql.BinlogGTIDEvent) error
 	// OnPosSynced Use your own way to sync position. When force is true, sync position immediately.
@@ -28,6 +32,72 @@ type EventHandler interface {
 	String() string
 }
 
+// TransactionHandler is implemented by an EventHandler which handles the binlog rows by
+// transaction. If the handler registered by SetEventHandler implements it, the RowsEvents
+// of a transaction are buffered and passed to OnTransaction when the transaction commits,
+// after OnXID and before OnPosSynced. OnRow is then only called for the dumped rows and the
+// rows of IncrementalSnapshot, and ParallelWorkers has no effect on the binlog rows.
+type TransactionHandler interface {
+	OnTransaction(tx *Transaction) error
+}
+
+// ExtraEventHandler is implemented by an EventHandler which needs the binlog events logged
+// for the statements with binlog_format=STATEMENT or MIXED, and by group replication.
+// If the handler registered by SetEventHandler implements it, OnExtraEvent is called for
+// the IntVarEvent, RandEvent, UserVarEvent, IncidentEvent, ViewChangeEvent,
+// XAPrepareEvent and TransactionContextEvent.
+type ExtraEventHandler interface {
+	OnExtraEvent(header *replication.EventHeader, e replication.Event) error
+}
+
+// RowIteratorHandler is implemented by an EventHandler which reads the binlog rows one at a
+// time, e.g. for the bulk updates of tables with large BLOBs. If the handler registered by
+// SetEventHandler implements it, the binlog rows are not decoded up front, and
+// OnRowIterator is called instead of OnRow with a RowsEvent without Rows. The rows must be
+// read before OnRowIterator returns. TransactionHandler and ParallelWorkers have no effect
+// on the binlog rows.
+type RowIteratorHandler interface {
+	// RowColumns returns the indexes of the columns of the table to decode, or nil to decode
+	// all of them. The primary key columns are always decoded, the others are nil.
+	RowColumns(table *schema.Table) []int
+	OnRowIterator(e *RowsEvent, rows *RowIterator) error
+}
+
+// Metrics receives the measurements of a Canal, see Config.Metrics. It also receives the
+// measurements of the BinlogSyncer of the Canal, see replication.Metrics.
+type Metrics interface {
+	replication.Metrics
+	// OnRowHandled is called after EventHandler.OnRow, RowIteratorHandler.OnRowIterator or
+	// TransactionHandler.OnTransaction returns, with the action of the rows, TransactionAction
+	// for OnTransaction, the time taken by the handler and its error.
+	OnRowHandled(action string, d time.Duration, err error)
+}
+
+// Tracer traces the calls of the EventHandler, see Config.Tracer. It's meant to be an
+// adapter to a tracing library, e.g. OpenTelemetry, which starts a span with the
+// attributes of the TraceHandler.
+type Tracer interface {
+	// StartHandler is called before the handler method, ctx is the context of the Canal.
+	// The returned func is called with the error of the method when it returns.
+	StartHandler(ctx context.Context, h TraceHandler) func(err error)
+}
+
+// TraceHandler describes a traced call of the EventHandler.
+type TraceHandler struct {
+	// Method is one of "OnRow", "OnRowIterator", "OnTransaction", "OnDDL" and "OnXID".
+	Method string
+	// Action is the action of the rows of OnRow and OnRowIterator.
+	Action string
+	// Schema and Table are the table of the rows, or of the DDL.
+	Schema string
+	Table  string
+	// Rows is the number of rows passed to OnRow, or the number of RowsEvents of the
+	// transaction passed to OnTransaction.
+	Rows int
+	// Statement is the query of the DDL.
+	Statement string
+}
+
 type DummyEventHandler struct{}
 
 func (h *DummyEventHandler) OnRotate(*replication.EventHeader, *replication.RotateEvent) error {
@@ -0,0 +1,317 @@
+package canal
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pingcap/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/go-mysql-org/go-mysql/dump"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+const (
+	lowWatermark  = "low"
+	highWatermark = "high"
+)
+
+// snapshotWindow is the chunk of an incremental snapshot between its low and high
+// watermarks, see IncrementalSnapshot.
+type snapshotWindow struct {
+	id    string
+	table *schema.Table
+	open  bool
+	// rows of the chunk, they are set before the high watermark is written
+	rows [][]any
+	// keys of the rows changed in the binlog after the low watermark
+	changed map[string]struct{}
+	done    chan error
+}
+
+// IncrementalSnapshot reads db.table in chunks while the binlog is synced, and passes
+// the rows to EventHandler.OnRow with SnapshotAction. The binlog sync must be running.
+//
+// Each chunk is read between a low and a high watermark row written to SignalTable.
+// The rows changed in the binlog between the two watermarks are removed from the chunk,
+// the rest are passed when the high watermark is synced, so a snapshot row never
+// overwrites a newer change. The table must have a primary key.
+//
+// It blocks until the whole table is read, so it must not be called from EventHandler.
+func (c *Canal) IncrementalSnapshot(db string, table string) error {
+	signalDB, signalTable, err := c.signalTable()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	c.snapshotLock.Lock()
+	defer c.snapshotLock.Unlock()
+
+	t, err := c.GetTable(db, table)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(t.PKColumns) == 0 {
+		return errors.Errorf("table %s has no PK, incremental snapshot is not supported", t)
+	}
+
+	if _, err = c.Execute(fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s`.`%s` ("+
+		"id VARCHAR(64) NOT NULL PRIMARY KEY, "+
+		"type VARCHAR(32) NOT NULL, "+
+		"data VARCHAR(2048) NULL)", signalDB, signalTable)); err != nil {
+		return errors.Trace(err)
+	}
+
+	conn, err := c.connect(c.tlsOptions()...)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer conn.Close()
+
+	if err = conn.SetCharset(c.cfg.Charset); err != nil {
+		return errors.Trace(err)
+	}
+
+	r, err := dump.NewTableChunkReader(conn, db, table, "", c.cfg.IncrementalSnapshotChunkSize)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer r.Close()
+
+	c.cfg.Logger.Info("start incremental snapshot", slog.String("database", db), slog.String("table", table))
+	defer c.closeSnapshotWindow()
+
+	for chunk := 1; ; chunk++ {
+		w := &snapshotWindow{
+			id:      uuid.NewString(),
+			table:   t,
+			changed: make(map[string]struct{}),
+			done:    make(chan error, 1),
+		}
+		c.snapshotWindowLock.Lock()
+		c.snapshotWindow = w
+		c.snapshotWindowLock.Unlock()
+
+		if err = c.writeWatermark(signalDB, signalTable, w.id, lowWatermark, t.String()); err != nil {
+			return errors.Trace(err)
+		}
+
+		var rows [][]any
+		more, err := r.Next(func(values []any) error {
+			vs, err := c.convertSnapshotRow(t, values)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			rows = append(rows, vs)
+			return nil
+		})
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		c.snapshotWindowLock.Lock()
+		w.rows = rows
+		c.snapshotWindowLock.Unlock()
+
+		if err = c.writeWatermark(signalDB, signalTable, w.id, highWatermark, t.String()); err != nil {
+			return errors.Trace(err)
+		}
+
+		select {
+		case err = <-w.done:
+			if err != nil {
+				return errors.Trace(err)
+			}
+		case <-c.ctx.Done():
+			return errors.Trace(c.ctx.Err())
+		}
+
+		if _, err = c.Execute(fmt.Sprintf("DELETE FROM `%s`.`%s` WHERE id = ?", signalDB, signalTable), w.id); err != nil {
+			return errors.Trace(err)
+		}
+
+		c.cfg.Logger.Debug("incremental snapshot chunk done", slog.String("table", t.String()), slog.Int("chunk", chunk), slog.Int("rows", len(rows)))
+		if !more {
+			break
+		}
+	}
+
+	c.cfg.Logger.Info("incremental snapshot done", slog.String("database", db), slog.String("table", table))
+	return nil
+}
+
+func (c *Canal) signalTable() (string, string, error) {
+	seps := strings.Split(c.cfg.SignalTable, ".")
+	if len(seps) != 2 || seps[0] == "" || seps[1] == "" {
+		return "", "", errors.Errorf("invalid signal table %q, db.table is expected", c.cfg.SignalTable)
+	}
+	return seps[0], seps[1], nil
+}
+
+func (c *Canal) isSignalTable(db string, table string) bool {
+	signalDB, signalTable, err := c.signalTable()
+	return err == nil && db == signalDB && table == signalTable
+}
+
+func (c *Canal) writeWatermark(db string, table string, id string, kind string, data string) error {
+	_, err := c.Execute(fmt.Sprintf("INSERT INTO `%s`.`%s` (id, type, data) VALUES (?, ?, ?)", db, table), id, kind, data)
+	return errors.Trace(err)
+}
+
+func (c *Canal) closeSnapshotWindow() {
+	c.snapshotWindowLock.Lock()
+	c.snapshotWindow = nil
+	c.snapshotWindowLock.Unlock()
+}
+
+// handleSignalRows opens and closes the snapshot window on its watermarks, the rows
+// of the chunk are passed when the high watermark is synced.
+func (c *Canal) handleSignalRows(header *replication.EventHeader, ev *replication.RowsEvent) error {
+	switch header.EventType {
+	case replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2, replication.MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
+	default:
+		return nil
+	}
+
+	for _, row := range ev.Rows {
+		if len(row) < 2 {
+			continue
+		}
+		id, kind := valueToString(row[0]), valueToString(row[1])
+
+		c.snapshotWindowLock.Lock()
+		w := c.snapshotWindow
+		if w == nil || w.id != id {
+			c.snapshotWindowLock.Unlock()
+			continue
+		}
+
+		switch kind {
+		case lowWatermark:
+			w.open = true
+			c.snapshotWindowLock.Unlock()
+		case highWatermark:
+			w.open = false
+			rows := make([][]any, 0, len(w.rows))
+			for _, row := range w.rows {
+				if _, ok := w.changed[snapshotRowKey(w.table, row)]; !ok {
+					rows = append(rows, row)
+				}
+			}
+			c.snapshotWindowLock.Unlock()
+
+			var err error
+			if len(rows) > 0 {
+				err = c.onRow(newRowsEvent(w.table, SnapshotAction, rows, header, nil))
+			}
+			if err == nil {
+				// the chunk is done when the rows are handled, not only dispatched
+				err = c.waitDispatched()
+			}
+			w.done <- err
+			if err != nil {
+				return errors.Trace(err)
+			}
+		default:
+			c.snapshotWindowLock.Unlock()
+		}
+	}
+
+	return nil
+}
+
+// trackSnapshotChanges records the rows changed in the snapshot window, they are
+// removed from the chunk as the binlog has newer values.
+func (c *Canal) trackSnapshotChanges(t *schema.Table, rows [][]any) {
+	c.snapshotWindowLock.Lock()
+	defer c.snapshotWindowLock.Unlock()
+
+	w := c.snapshotWindow
+	if w == nil || !w.open || w.table.Schema != t.Schema || w.table.Name != t.Name {
+		return
+	}
+
+	for _, row := range rows {
+		w.changed[snapshotRowKey(t, row)] = struct{}{}
+	}
+}
+
+// snapshotRowKey returns the primary key of the row, the values of binlog and
+// snapshot rows have different types so they are normalized by snapshotKeyValue.
+func snapshotRowKey(t *schema.Table, row []any) string {
+	var b strings.Builder
+	for _, i := range t.PKColumns {
+		if i < len(row) {
+			b.WriteString(snapshotKeyValue(t, i, row[i]))
+		}
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// snapshotKeyValue returns the same string for a value of the column whether it's
+// decoded from the binlog or read by the snapshot, e.g. for int32 and int64, []byte
+// and string, or a decimal as string and float64.
+func snapshotKeyValue(t *schema.Table, column int, v any) string {
+	switch v := v.(type) {
+	case int8:
+		return strconv.FormatInt(int64(v), 10)
+	case int16:
+		return strconv.FormatInt(int64(v), 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.FormatInt(int64(v), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	}
+
+	if column < len(t.Columns) && t.Columns[column].Type == schema.TYPE_DECIMAL {
+		var d decimal.Decimal
+		var err error
+		switch v := v.(type) {
+		case decimal.Decimal:
+			d = v
+		case float64:
+			d = decimal.NewFromFloat(v)
+		default:
+			d, err = decimal.NewFromString(valueToString(v))
+		}
+		if err == nil {
+			return d.String()
+		}
+	}
+
+	switch v := v.(type) {
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return valueToString(v)
+}
+
+func valueToString(v any) string {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,197 @@
+package canal
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+type rowsRecorder struct {
+	DummyEventHandler
+	events []*RowsEvent
+}
+
+func (h *rowsRecorder) OnRow(e *RowsEvent) error {
+	h.events = append(h.events, e)
+	return nil
+}
+
+func TestSnapshotWindow(t *testing.T) {
+	h := &rowsRecorder{}
+	c := &Canal{cfg: &Config{SignalTable: "db.signal", Logger: slog.Default()}, eventHandler: h}
+
+	table := &schema.Table{
+		Schema:    "db",
+		Name:      "t",
+		Columns:   []schema.TableColumn{{Name: "id", Type: schema.TYPE_NUMBER}, {Name: "v", Type: schema.TYPE_STRING}},
+		PKColumns: []int{0},
+	}
+	w := &snapshotWindow{
+		id:      "w1",
+		table:   table,
+		rows:    [][]any{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}},
+		changed: make(map[string]struct{}),
+		done:    make(chan error, 1),
+	}
+	c.snapshotWindow = w
+
+	signal := func(id string, kind string) error {
+		header := &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2}
+		return c.handleSignalRows(header, &replication.RowsEvent{Rows: [][]any{{id, kind, "db.t"}}})
+	}
+
+	require.True(t, c.isSignalTable("db", "signal"))
+	require.False(t, c.isSignalTable("db", "t"))
+
+	// changes before the low watermark are not tracked
+	c.trackSnapshotChanges(table, [][]any{{int32(1), "a0"}})
+	require.NoError(t, signal("other", lowWatermark))
+	require.NoError(t, signal("w1", lowWatermark))
+	c.trackSnapshotChanges(table, [][]any{{int32(2), "b2"}})
+	c.trackSnapshotChanges(&schema.Table{Schema: "db", Name: "t2", PKColumns: []int{0}}, [][]any{{int32(3)}})
+	require.NoError(t, signal("w1", highWatermark))
+
+	require.NoError(t, <-w.done)
+	require.Len(t, h.events, 1)
+	require.Equal(t, SnapshotAction, h.events[0].Action)
+	require.Equal(t, [][]any{{int64(1), "a"}, {int64(3), "c"}}, h.events[0].Rows)
+
+	// the window is closed after the high watermark
+	c.trackSnapshotChanges(table, [][]any{{int32(1), "a1"}})
+	require.Len(t, w.changed, 1)
+}
+
+func TestSnapshotWindowParallelWorkers(t *testing.T) {
+	h := &dispatchRecorder{values: make(map[int32][]int32)}
+	c := &Canal{cfg: &Config{SignalTable: "db.signal", ParallelWorkers: 4, Logger: slog.Default()}, eventHandler: h}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	defer c.cancel()
+	c.dispatcher = newDispatcher(c, c.cfg.ParallelWorkers)
+	defer c.dispatcher.stop()
+
+	table := &schema.Table{
+		Schema:    "db",
+		Name:      "t",
+		Columns:   []schema.TableColumn{{Name: "id", Type: schema.TYPE_NUMBER}, {Name: "v", Type: schema.TYPE_NUMBER}},
+		PKColumns: []int{0},
+	}
+	w := &snapshotWindow{
+		id:      "w1",
+		table:   table,
+		rows:    [][]any{{int32(1), int32(10)}, {int32(2), int32(20)}, {int32(3), int32(30)}},
+		changed: make(map[string]struct{}),
+		done:    make(chan error, 1),
+	}
+	c.snapshotWindow = w
+
+	header := &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2}
+	require.NoError(t, c.handleSignalRows(header, &replication.RowsEvent{Rows: [][]any{{"w1", lowWatermark}}}))
+	require.NoError(t, c.handleSignalRows(header, &replication.RowsEvent{Rows: [][]any{{"w1", highWatermark}}}))
+
+	// the chunk is done after the workers handled its rows
+	require.NoError(t, <-w.done)
+	h.m.Lock()
+	require.Equal(t, 3, h.handled)
+	h.m.Unlock()
+}
+
+func TestSnapshotRowKey(t *testing.T) {
+	table := &schema.Table{
+		Columns: []schema.TableColumn{
+			{Name: "id", Type: schema.TYPE_NUMBER},
+			{Name: "price", Type: schema.TYPE_DECIMAL},
+			{Name: "code", Type: schema.TYPE_BINARY},
+			{Name: "ratio", Type: schema.TYPE_FLOAT},
+		},
+		PKColumns: []int{0, 1, 2, 3},
+	}
+
+	// as decoded from the binlog and as read by the snapshot
+	binlogRow := []any{int32(7), "1.50", []byte("a"), float32(0.1)}
+	snapshotRow := []any{int64(7), 1.5, "a", 0.1}
+	require.Equal(t, snapshotRowKey(table, binlogRow), snapshotRowKey(table, snapshotRow))
+	require.Equal(t, snapshotRowKey(table, []any{uint32(7), decimal.RequireFromString("1.5"), "a", float32(0.1)}),
+		snapshotRowKey(table, snapshotRow))
+
+	require.NotEqual(t, snapshotRowKey(table, []any{int32(8), "1.50", []byte("a"), float32(0.1)}), snapshotRowKey(table, snapshotRow))
+	require.NotEqual(t, snapshotRowKey(table, []any{int32(7), "1.51", []byte("a"), float32(0.1)}), snapshotRowKey(table, snapshotRow))
+}
+
+func TestSnapshotSignalTableNotIncluded(t *testing.T) {
+	h := &rowsRecorder{}
+	c := &Canal{
+		cfg:               &Config{SignalTable: "db.signal", Logger: slog.Default()},
+		eventHandler:      h,
+		includeTableRegex: []*regexp.Regexp{regexp.MustCompile(`^db\.t$`)},
+		tableMatchCache:   make(map[string]bool),
+	}
+	table := &schema.Table{
+		Schema:    "db",
+		Name:      "t",
+		Columns:   []schema.TableColumn{{Name: "id", Type: schema.TYPE_NUMBER}},
+		PKColumns: []int{0},
+	}
+	w := &snapshotWindow{
+		id:      "w1",
+		table:   table,
+		rows:    [][]any{{int64(1)}},
+		changed: make(map[string]struct{}),
+		done:    make(chan error, 1),
+	}
+	c.snapshotWindow = w
+
+	// the watermarks written to the signal table, which the include regex doesn't match
+	dir := t.TempDir()
+	bw, err := replication.NewBinlogWriter(replication.BinlogWriterConfig{Dir: dir, ServerID: 1})
+	require.NoError(t, err)
+	signal := &replication.TableMapEvent{
+		TableID:     100,
+		Schema:      []byte("db"),
+		Table:       []byte("signal"),
+		ColumnCount: 2,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VARCHAR},
+		ColumnMeta:  []uint16{256, 128},
+		NullBitmap:  []byte{0},
+	}
+	for _, kind := range []string{lowWatermark, highWatermark} {
+		rows, err := replication.NewRowsEvent(replication.WRITE_ROWS_EVENTv2, signal)
+		require.NoError(t, err)
+		rows.Rows = [][]any{{"w1", kind}}
+		rows.Flags = replication.RowsEventStmtEndFlag
+		for _, e := range []*replication.BinlogEvent{
+			{Header: &replication.EventHeader{EventType: replication.TABLE_MAP_EVENT, ServerID: 1}, Event: signal},
+			{Header: &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2, ServerID: 1}, Event: rows},
+		} {
+			require.NoError(t, bw.WriteEvent(e))
+		}
+	}
+	name := bw.Position().Name
+	require.NoError(t, bw.Close())
+
+	p := replication.NewBinlogParser()
+	p.SetRowsEventDecodeFunc(c.decodeRowsEvent)
+	require.NoError(t, p.ParseFile(filepath.Join(dir, name), 0, func(e *replication.BinlogEvent) error {
+		if _, ok := e.Event.(*replication.RowsEvent); ok {
+			return c.handleRowsEvent(e)
+		}
+		return nil
+	}))
+
+	select {
+	case err = <-w.done:
+		require.NoError(t, err)
+	default:
+		require.FailNow(t, "the chunk is not done")
+	}
+	require.Len(t, h.events, 1)
+	require.Equal(t, [][]any{{int64(1)}}, h.events[0].Rows)
+}
@@ -0,0 +1,288 @@
+package canal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/utils"
+)
+
+// Checkpoint is the synced state of a Canal that a PositionStore persists.
+type Checkpoint struct {
+	Pos mysql.Position
+	// GTIDSet is nil if Canal doesn't sync with GTID
+	GTIDSet   mysql.GTIDSet
+	Timestamp uint32
+}
+
+// PositionStore persists the synced position of a Canal, so that a restarted Canal
+// resumes where it stopped. Implementations must be safe for concurrent use.
+type PositionStore interface {
+	// Load returns the last saved checkpoint, or nil if nothing was saved yet.
+	Load() (*Checkpoint, error)
+	// Save persists the checkpoint, it must be durable when Save returns.
+	Save(cp *Checkpoint) error
+}
+
+type checkpointData struct {
+	Name      string `json:"binlog_name"`
+	Pos       uint32 `json:"binlog_pos"`
+	GTIDSet   string `json:"gtid_set,omitempty"`
+	Timestamp uint32 `json:"timestamp"`
+}
+
+// FilePositionStore is a PositionStore which saves the checkpoint as JSON in a file.
+// The file is replaced atomically, so a crash never leaves a partially written checkpoint.
+type FilePositionStore struct {
+	m sync.Mutex
+
+	path   string
+	flavor string
+}
+
+// NewFilePositionStore creates a FilePositionStore saving to path. flavor is used to
+// parse the saved GTID set.
+func NewFilePositionStore(path string, flavor string) *FilePositionStore {
+	return &FilePositionStore{path: path, flavor: flavor}
+}
+
+func (s *FilePositionStore) Load() (*Checkpoint, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var d checkpointData
+	if err = json.Unmarshal(data, &d); err != nil {
+		return nil, errors.Annotatef(err, "parse checkpoint file %s", s.path)
+	}
+
+	return newCheckpoint(s.flavor, d.Name, d.Pos, d.GTIDSet, d.Timestamp)
+}
+
+func (s *FilePositionStore) Save(cp *Checkpoint) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	d := checkpointData{Name: cp.Pos.Name, Pos: cp.Pos.Pos, Timestamp: cp.Timestamp}
+	if cp.GTIDSet != nil {
+		d.GTIDSet = cp.GTIDSet.String()
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	return writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic replaces the file at path with data, so a crash never leaves a
+// partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, base+".tmp")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if err = os.Rename(f.Name(), path); err != nil {
+		return errors.Trace(err)
+	}
+
+	// make the rename durable
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer dirFile.Close()
+
+	return errors.Trace(dirFile.Sync())
+}
+
+// MySQLPositionStore is a PositionStore which saves the checkpoint as a row of a MySQL table,
+// identified by a name so that many Canals can share the table.
+//
+// The checkpoint is written with sql_log_bin disabled, so saving it doesn't write a binlog
+// event which would be synced and saved again by the Canal. The table isn't replicated either.
+type MySQLPositionStore struct {
+	m sync.Mutex
+
+	conn   *client.Conn
+	schema string
+	table  string
+	name   string
+	flavor string
+}
+
+// NewMySQLPositionStore creates a MySQLPositionStore saving to the row name of schema.table
+// and creates the table if it doesn't exist. flavor is used to parse the saved GTID set.
+//
+// conn must be a connection dedicated to the store: it runs SET SESSION sql_log_bin = 0,
+// which needs the SUPER or SYSTEM_VARIABLES_ADMIN privilege, and it must not be shared with
+// statements that have to be replicated.
+func NewMySQLPositionStore(conn *client.Conn, schema, table, name, flavor string) (*MySQLPositionStore, error) {
+	s := &MySQLPositionStore{conn: conn, schema: schema, table: table, name: name, flavor: flavor}
+
+	if _, err := conn.Execute("SET SESSION sql_log_bin = 0"); err != nil {
+		return nil, errors.Annotate(err, "disable binlog of the position store connection")
+	}
+
+	_, err := conn.Execute(fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s`.`%s` ("+
+		"name VARCHAR(255) NOT NULL PRIMARY KEY, "+
+		"binlog_name VARCHAR(255) NOT NULL, "+
+		"binlog_pos INT UNSIGNED NOT NULL, "+
+		"gtid_set MEDIUMTEXT NOT NULL, "+
+		"binlog_timestamp INT UNSIGNED NOT NULL, "+
+		"updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP)", schema, table))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return s, nil
+}
+
+func (s *MySQLPositionStore) Load() (*Checkpoint, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	r, err := s.conn.Execute(fmt.Sprintf("SELECT binlog_name, binlog_pos, gtid_set, binlog_timestamp FROM `%s`.`%s` WHERE name = ?",
+		s.schema, s.table), s.name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer r.Close()
+
+	if r.RowNumber() == 0 {
+		return nil, nil
+	}
+
+	name, _ := r.GetString(0, 0)
+	pos, _ := r.GetUint(0, 1)
+	gset, _ := r.GetString(0, 2)
+	ts, _ := r.GetUint(0, 3)
+
+	return newCheckpoint(s.flavor, name, uint32(pos), gset, uint32(ts))
+}
+
+func (s *MySQLPositionStore) Save(cp *Checkpoint) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	gset := ""
+	if cp.GTIDSet != nil {
+		gset = cp.GTIDSet.String()
+	}
+
+	r, err := s.conn.Execute(fmt.Sprintf("INSERT INTO `%s`.`%s` (name, binlog_name, binlog_pos, gtid_set, binlog_timestamp) "+
+		"VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE binlog_name = VALUES(binlog_name), binlog_pos = VALUES(binlog_pos), "+
+		"gtid_set = VALUES(gtid_set), binlog_timestamp = VALUES(binlog_timestamp)", s.schema, s.table),
+		s.name, cp.Pos.Name, cp.Pos.Pos, gset, cp.Timestamp)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	r.Close()
+
+	return nil
+}
+
+func newCheckpoint(flavor string, name string, pos uint32, gtidSet string, ts uint32) (*Checkpoint, error) {
+	cp := &Checkpoint{Pos: mysql.Position{Name: name, Pos: pos}, Timestamp: ts}
+	if gtidSet != "" {
+		gset, err := mysql.ParseGTIDSet(flavor, gtidSet)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		cp.GTIDSet = gset
+	}
+
+	return cp, nil
+}
+
+// loadPosition resumes from the checkpoint in PositionStore, unless a position was given.
+func (c *Canal) loadPosition() error {
+	if c.cfg.PositionStore == nil {
+		return nil
+	}
+
+	pos := c.master.Position()
+	gset := c.master.GTIDSet()
+	if pos.Name != "" || (gset != nil && gset.String() != "") {
+		return nil
+	}
+
+	cp, err := c.cfg.PositionStore.Load()
+	if err != nil || cp == nil {
+		return errors.Trace(err)
+	}
+
+	c.cfg.Logger.Info("load position from position store", slog.Any("pos", cp.Pos), slog.Any("gset", cp.GTIDSet))
+	c.master.Update(cp.Pos)
+	if cp.GTIDSet != nil {
+		c.master.UpdateGTIDSet(cp.GTIDSet)
+	}
+	if cp.Timestamp != 0 {
+		c.master.UpdateTimestamp(cp.Timestamp)
+	}
+
+	return nil
+}
+
+// savePosition saves the synced position to PositionStore, at most once per
+// PositionFlushInterval unless force is true.
+func (c *Canal) savePosition(force bool) error {
+	if c.cfg.PositionStore == nil {
+		return nil
+	}
+
+	c.positionSaveLock.Lock()
+	defer c.positionSaveLock.Unlock()
+
+	now := utils.Now()
+	if !force && now.Sub(c.lastPositionSave) < c.cfg.PositionFlushInterval {
+		return nil
+	}
+
+	cp := &Checkpoint{
+		Pos:       c.master.Position(),
+		GTIDSet:   c.master.GTIDSet(),
+		Timestamp: c.master.Timestamp(),
+	}
+	if cp.Pos.Name == "" && (cp.GTIDSet == nil || cp.GTIDSet.String() == "") {
+		// nothing synced yet, keep the saved checkpoint
+		return nil
+	}
+	if err := c.cfg.PositionStore.Save(cp); err != nil {
+		return errors.Trace(err)
+	}
+	c.lastPositionSave = now
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package canal
+
+import (
+	"log/slog"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+type countingPositionStore struct {
+	PositionStore
+	saves int
+}
+
+func (s *countingPositionStore) Save(cp *Checkpoint) error {
+	s.saves++
+	return s.PositionStore.Save(cp)
+}
+
+func TestFilePositionStore(t *testing.T) {
+	file := path.Join(t.TempDir(), "master.info")
+	s := NewFilePositionStore(file, mysql.MySQLFlavor)
+
+	cp, err := s.Load()
+	require.NoError(t, err)
+	require.Nil(t, cp)
+
+	gset, err := mysql.ParseMysqlGTIDSet("5aa72a7f-44a8-11e6-885a-0e7e1c9d8b3a:1-20")
+	require.NoError(t, err)
+	saved := &Checkpoint{Pos: mysql.Position{Name: "mysql-bin.000002", Pos: 1234}, GTIDSet: gset, Timestamp: 1700000000}
+	require.NoError(t, s.Save(saved))
+
+	cp, err = s.Load()
+	require.NoError(t, err)
+	require.Equal(t, saved.Pos, cp.Pos)
+	require.Equal(t, saved.Timestamp, cp.Timestamp)
+	require.True(t, saved.GTIDSet.Equal(cp.GTIDSet))
+
+	saved = &Checkpoint{Pos: mysql.Position{Name: "mysql-bin.000003", Pos: 4}}
+	require.NoError(t, s.Save(saved))
+	cp, err = s.Load()
+	require.NoError(t, err)
+	require.Equal(t, saved, cp)
+
+	// no temporary file is left behind
+	entries, err := os.ReadDir(path.Dir(file))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	require.NoError(t, os.WriteFile(file, []byte("{"), 0o644))
+	_, err = s.Load()
+	require.Error(t, err)
+}
+
+func TestCanalPositionStore(t *testing.T) {
+	store := &countingPositionStore{PositionStore: NewFilePositionStore(path.Join(t.TempDir(), "master.info"), mysql.MySQLFlavor)}
+	saved := &Checkpoint{Pos: mysql.Position{Name: "mysql-bin.000002", Pos: 1234}, Timestamp: 1700000000}
+	require.NoError(t, store.Save(saved))
+
+	c := &Canal{
+		cfg:    &Config{PositionStore: store, PositionFlushInterval: time.Hour, Logger: slog.Default()},
+		master: &masterInfo{logger: slog.Default()},
+	}
+	require.NoError(t, c.loadPosition())
+	require.Equal(t, saved.Pos, c.SyncedPosition())
+	require.Equal(t, saved.Timestamp, c.SyncedTimestamp())
+
+	// the first save is not delayed, later ones wait for the flush interval unless forced
+	c.master.Update(mysql.Position{Name: "mysql-bin.000002", Pos: 2000})
+	require.NoError(t, c.savePosition(false))
+	c.master.Update(mysql.Position{Name: "mysql-bin.000002", Pos: 3000})
+	require.NoError(t, c.savePosition(false))
+	require.Equal(t, 2, store.saves)
+	cp, err := store.Load()
+	require.NoError(t, err)
+	require.Equal(t, uint32(2000), cp.Pos.Pos)
+
+	require.NoError(t, c.savePosition(true))
+	require.Equal(t, 3, store.saves)
+	cp, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, uint32(3000), cp.Pos.Pos)
+
+	// an explicit position wins over the saved one
+	c = &Canal{
+		cfg:    &Config{PositionStore: store, Logger: slog.Default()},
+		master: &masterInfo{logger: slog.Default()},
+	}
+	c.master.Update(mysql.Position{Name: "mysql-bin.000005", Pos: 4})
+	require.NoError(t, c.loadPosition())
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000005", Pos: 4}, c.SyncedPosition())
+
+	// nothing synced yet, the saved position is kept
+	c = &Canal{
+		cfg:    &Config{PositionStore: store, Logger: slog.Default()},
+		master: &masterInfo{logger: slog.Default()},
+	}
+	require.NoError(t, c.savePosition(true))
+	require.Equal(t, 3, store.saves)
+}
@@ -12,6 +12,8 @@ const (
 	UpdateAction = "update"
 	InsertAction = "insert"
 	DeleteAction = "delete"
+	// SnapshotAction is the action of the rows read by Canal.IncrementalSnapshot
+	SnapshotAction = "snapshot"
 )
 
 // RowsEvent is the event for row replication.
@@ -51,43 +53,77 @@ func (r *RowsEvent) handleUnsigned() {
 	// Handle Unsigned Columns here, for binlog replication, we can't know the integer is unsigned or not,
 	// so we use int type but this may cause overflow outside sometimes, so we must convert to the really .
 	// unsigned type
-	if len(r.Table.UnsignedColumns) == 0 {
-		return
+	for _, row := range r.Rows {
+		handleUnsignedRow(r.Table, row)
 	}
+}
 
-	for i := 0; i < len(r.Rows); i++ {
-		for _, columnIdx := range r.Table.UnsignedColumns {
-			// When Canal.delay is big, after call Canal.StartFromGTID(),
-			// we will get the newest table schema (for example, after DDL "alter table add column xxx unsigned..."),
-			// but the binlog data can be very old (before DDL "alter table add column xxx unsigned..."),
-			// results in max(columnIdx) >= len(r.Rows[i]), then r.Rows[i][columnIdx] panic.
-			if columnIdx >= len(r.Rows[i]) {
-				continue
-			}
-			switch value := r.Rows[i][columnIdx].(type) {
-			case int8:
-				r.Rows[i][columnIdx] = uint8(value)
-			case int16:
-				r.Rows[i][columnIdx] = uint16(value)
-			case int32:
-				// problem with mediumint is that it's a 3-byte type. There is no compatible golang type to match that.
-				// So to convert from negative to positive we'd need to convert the value manually
-				if value < 0 && r.Table.Columns[columnIdx].Type == schema.TYPE_MEDIUM_INT {
-					r.Rows[i][columnIdx] = uint32(maxMediumintUnsigned + value + 1)
-				} else {
-					r.Rows[i][columnIdx] = uint32(value)
-				}
-			case int64:
-				r.Rows[i][columnIdx] = uint64(value)
-			case int:
-				r.Rows[i][columnIdx] = uint(value)
-			default:
-				// nothing to do
+func handleUnsignedRow(table *schema.Table, row []any) {
+	for _, columnIdx := range table.UnsignedColumns {
+		// When Canal.delay is big, after call Canal.StartFromGTID(),
+		// we will get the newest table schema (for example, after DDL "alter table add column xxx unsigned..."),
+		// but the binlog data can be very old (before DDL "alter table add column xxx unsigned..."),
+		// results in max(columnIdx) >= len(row), then row[columnIdx] panic.
+		if columnIdx >= len(row) {
+			continue
+		}
+		switch value := row[columnIdx].(type) {
+		case int8:
+			row[columnIdx] = uint8(value)
+		case int16:
+			row[columnIdx] = uint16(value)
+		case int32:
+			// problem with mediumint is that it's a 3-byte type. There is no compatible golang type to match that.
+			// So to convert from negative to positive we'd need to convert the value manually
+			if value < 0 && table.Columns[columnIdx].Type == schema.TYPE_MEDIUM_INT {
+				row[columnIdx] = uint32(maxMediumintUnsigned + value + 1)
+			} else {
+				row[columnIdx] = uint32(value)
 			}
+		case int64:
+			row[columnIdx] = uint64(value)
+		case int:
+			row[columnIdx] = uint(value)
+		default:
+			// nothing to do
 		}
 	}
 }
 
+// RowIterator reads the rows of a RowsEvent one at a time, see RowIteratorHandler. The rows
+// are like RowsEvent.Rows.
+type RowIterator struct {
+	rows  *replication.RowIterator
+	table *schema.Table
+	// onRow is called with each row, e.g. to track the changes of an incremental snapshot
+	onRow func(row []any)
+	row   []any
+}
+
+// Next decodes the next row, it returns false after the last row or on an error.
+func (it *RowIterator) Next() bool {
+	if !it.rows.Next() {
+		it.row = nil
+		return false
+	}
+	it.row = it.rows.Row()
+	handleUnsignedRow(it.table, it.row)
+	if it.onRow != nil {
+		it.onRow(it.row)
+	}
+	return true
+}
+
+// Row returns the current row.
+func (it *RowIterator) Row() []any {
+	return it.row
+}
+
+// Err returns the error which stopped the iteration.
+func (it *RowIterator) Err() error {
+	return it.rows.Err()
+}
+
 // String implements fmt.Stringer interface.
 func (r *RowsEvent) String() string {
 	return fmt.Sprintf("%s %s %v", r.Action, r.Table, r.Rows)
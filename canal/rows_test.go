@@ -1,8 +1,11 @@
 package canal
 
 import (
+	"context"
+	"log/slog"
 	"testing"
 
+	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
 	"github.com/go-mysql-org/go-mysql/schema"
 	"github.com/stretchr/testify/require"
@@ -74,3 +77,60 @@ func TestRowsEvent_flags(t *testing.T) {
 
 	require.Equal(t, canalEvent.Flags, replEvent.Flags)
 }
+
+type rowIteratorRecorder struct {
+	DummyEventHandler
+
+	actions []string
+	rows    [][]any
+}
+
+func (h *rowIteratorRecorder) RowColumns(*schema.Table) []int { return []int{2} }
+
+func (h *rowIteratorRecorder) OnRowIterator(e *RowsEvent, rows *RowIterator) error {
+	h.actions = append(h.actions, e.Action)
+	for rows.Next() {
+		h.rows = append(h.rows, rows.Row())
+	}
+	return rows.Err()
+}
+
+func (h *rowIteratorRecorder) OnRow(*RowsEvent) error {
+	panic("OnRow is not called with a RowIteratorHandler")
+}
+
+func TestRowIteratorHandler(t *testing.T) {
+	h := &rowIteratorRecorder{}
+	c := &Canal{
+		cfg:          &Config{Logger: slog.Default()},
+		eventHandler: h,
+		master:       &masterInfo{pos: mysql.Position{Name: "mysql-bin.000001", Pos: 4}, logger: slog.Default()},
+		tables: map[string]*schema.Table{
+			"db.t": {
+				Schema: "db",
+				Name:   "t",
+				Columns: []schema.TableColumn{
+					{Name: "id", Type: schema.TYPE_NUMBER, IsUnsigned: true},
+					{Name: "name", Type: schema.TYPE_STRING},
+					{Name: "v", Type: schema.TYPE_NUMBER},
+				},
+				PKColumns:       []int{0},
+				UnsignedColumns: []int{0},
+			},
+		},
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	defer c.cancel()
+
+	tableMap := &replication.TableMapEvent{Schema: []byte("db"), Table: []byte("t"), ColumnCount: 3}
+	rows := [][]any{{int32(-1), "a", int32(1)}, {int32(-1), "b", int32(2)}}
+	ev := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.UPDATE_ROWS_EVENTv2, LogPos: 100},
+		Event:  &replication.RowsEvent{Table: tableMap, ColumnCount: 3, Rows: rows},
+	}
+	require.NoError(t, c.handleEvent(ev))
+
+	require.Equal(t, []string{UpdateAction}, h.actions)
+	// the primary key is decoded with the projected columns
+	require.Equal(t, [][]any{{uint32(4294967295), nil, int32(1)}, {uint32(4294967295), nil, int32(2)}}, h.rows)
+}
@@ -0,0 +1,448 @@
+package canal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// tableChange is a table changed by a DDL, t is nil if the table is dropped.
+// If reload is true, the DDL can't be applied and the table must be read from the server.
+type tableChange struct {
+	db     string
+	table  string
+	t      *schema.Table
+	reload bool
+}
+
+// tableLookup returns the table known before a DDL, known is false if the table
+// has never been seen and t is nil if the table was dropped.
+type tableLookup func(db string, table string) (t *schema.Table, known bool)
+
+// applyDDL applies stmt to the tables returned by lookup, db is the default database
+// of the statement. Tables which are not known are skipped, except the created ones.
+func applyDDL(stmt ast.StmtNode, db string, lookup tableLookup) []tableChange {
+	tableDB := func(tn *ast.TableName) string {
+		if tn.Schema.O != "" {
+			return tn.Schema.O
+		}
+		return db
+	}
+
+	var changes []tableChange
+	switch st := stmt.(type) {
+	case *ast.CreateTableStmt:
+		d, name := tableDB(st.Table), st.Table.Name.O
+		if old, _ := lookup(d, name); old != nil && st.IfNotExists {
+			return nil
+		}
+
+		var m *tableModel
+		if st.ReferTable != nil {
+			refer, _ := lookup(tableDB(st.ReferTable), st.ReferTable.Name.O)
+			if refer == nil {
+				return []tableChange{{db: d, table: name, reload: true}}
+			}
+			m = newTableModel(refer)
+			m.db, m.name = d, name
+		} else {
+			if st.Select != nil {
+				// the columns of CREATE TABLE ... SELECT are unknown
+				return []tableChange{{db: d, table: name, reload: true}}
+			}
+			m = &tableModel{db: d, name: name}
+			for _, def := range st.Cols {
+				m.addColumn(def, nil)
+			}
+			for _, cons := range st.Constraints {
+				m.addConstraint(cons)
+			}
+		}
+		changes = append(changes, tableChange{db: d, table: name, t: m.table()})
+	case *ast.AlterTableStmt:
+		d, name := tableDB(st.Table), st.Table.Name.O
+		old, _ := lookup(d, name)
+		if old == nil {
+			return nil
+		}
+
+		m := newTableModel(old)
+		for _, spec := range st.Specs {
+			if err := m.alter(spec); err != nil {
+				return []tableChange{{db: d, table: name, reload: true}}
+			}
+		}
+		if m.db != d || m.name != name {
+			changes = append(changes, tableChange{db: d, table: name})
+		}
+		changes = append(changes, tableChange{db: m.db, table: m.name, t: m.table()})
+	case *ast.DropTableStmt:
+		if st.IsView {
+			return nil
+		}
+		for _, tn := range st.Tables {
+			if _, known := lookup(tableDB(tn), tn.Name.O); known {
+				changes = append(changes, tableChange{db: tableDB(tn), table: tn.Name.O})
+			}
+		}
+	case *ast.RenameTableStmt:
+		// the renames are applied in order, the later ones see the earlier ones
+		renamed := make(map[[2]string]*schema.Table)
+		find := func(d string, name string) (*schema.Table, bool) {
+			if t, ok := renamed[[2]string{d, name}]; ok {
+				return t, true
+			}
+			return lookup(d, name)
+		}
+		for _, tt := range st.TableToTables {
+			oldDB, oldName := tableDB(tt.OldTable), tt.OldTable.Name.O
+			newDB, newName := tableDB(tt.NewTable), tt.NewTable.Name.O
+
+			old, _ := find(oldDB, oldName)
+			renamed[[2]string{oldDB, oldName}] = nil
+			changes = append(changes, tableChange{db: oldDB, table: oldName})
+			if old == nil {
+				continue
+			}
+			m := newTableModel(old)
+			m.db, m.name = newDB, newName
+			t := m.table()
+			renamed[[2]string{newDB, newName}] = t
+			changes = append(changes, tableChange{db: newDB, table: newName, t: t})
+		}
+	case *ast.CreateIndexStmt:
+		d, name := tableDB(st.Table), st.Table.Name.O
+		old, _ := lookup(d, name)
+		if old == nil {
+			return nil
+		}
+		m := newTableModel(old)
+		m.addIndex(st.IndexName, st.IndexPartSpecifications, st.KeyType == ast.IndexKeyTypeUnique, st.IndexOption)
+		changes = append(changes, tableChange{db: d, table: name, t: m.table()})
+	case *ast.DropIndexStmt:
+		d, name := tableDB(st.Table), st.Table.Name.O
+		old, _ := lookup(d, name)
+		if old == nil {
+			return nil
+		}
+		m := newTableModel(old)
+		m.dropIndex(st.IndexName)
+		changes = append(changes, tableChange{db: d, table: name, t: m.table()})
+	}
+
+	return changes
+}
+
+// tableModel is a schema.Table being changed by a DDL.
+type tableModel struct {
+	db      string
+	name    string
+	columns []schema.TableColumn
+	indexes []*schema.Index
+}
+
+func newTableModel(t *schema.Table) *tableModel {
+	m := &tableModel{db: t.Schema, name: t.Name, columns: slices.Clone(t.Columns)}
+	for _, idx := range t.Indexes {
+		c := *idx
+		c.Columns = slices.Clone(idx.Columns)
+		c.Cardinality = slices.Clone(idx.Cardinality)
+		m.indexes = append(m.indexes, &c)
+	}
+	return m
+}
+
+// table builds the schema.Table like schema.NewTable.
+func (m *tableModel) table() *schema.Table {
+	t := &schema.Table{
+		Schema:  m.db,
+		Name:    m.name,
+		Columns: slices.Clone(m.columns),
+		Indexes: make([]*schema.Index, 0, len(m.indexes)),
+	}
+	for i, col := range t.Columns {
+		if col.IsUnsigned {
+			t.UnsignedColumns = append(t.UnsignedColumns, i)
+		}
+	}
+
+	// like SHOW INDEX, the primary key is the first index
+	for _, idx := range m.indexes {
+		if idx.Name == "PRIMARY" {
+			t.Indexes = append([]*schema.Index{idx}, t.Indexes...)
+			t.PKColumns = make([]int, len(idx.Columns))
+			for i, name := range idx.Columns {
+				t.PKColumns[i] = t.FindColumn(name)
+			}
+		} else {
+			t.Indexes = append(t.Indexes, idx)
+		}
+	}
+
+	return t
+}
+
+func (m *tableModel) findColumn(name string) int {
+	return slices.IndexFunc(m.columns, func(col schema.TableColumn) bool {
+		return strings.EqualFold(col.Name, name)
+	})
+}
+
+func (m *tableModel) findIndex(name string) int {
+	return slices.IndexFunc(m.indexes, func(idx *schema.Index) bool {
+		return strings.EqualFold(idx.Name, name)
+	})
+}
+
+// addColumn adds the column at pos, or at the end if pos is nil, with the indexes
+// defined by its options.
+func (m *tableModel) addColumn(def *ast.ColumnDef, pos *ast.ColumnPosition) {
+	col, pk, unique := newTableColumn(def)
+	m.insertColumn(col, pos)
+
+	key := []*ast.IndexPartSpecification{{Column: def.Name}}
+	if pk {
+		m.addIndex("PRIMARY", key, true, nil)
+	}
+	if unique {
+		m.addIndex(col.Name, key, true, nil)
+	}
+}
+
+func (m *tableModel) insertColumn(col schema.TableColumn, pos *ast.ColumnPosition) {
+	i := len(m.columns)
+	if pos != nil {
+		switch pos.Tp {
+		case ast.ColumnPositionFirst:
+			i = 0
+		case ast.ColumnPositionAfter:
+			if j := m.findColumn(pos.RelativeColumn.Name.O); j >= 0 {
+				i = j + 1
+			}
+		}
+	}
+	m.columns = slices.Insert(m.columns, i, col)
+}
+
+// dropColumn drops the column and removes it from the indexes.
+func (m *tableModel) dropColumn(name string) bool {
+	i := m.findColumn(name)
+	if i < 0 {
+		return false
+	}
+	m.columns = slices.Delete(m.columns, i, i+1)
+
+	indexes := m.indexes[:0]
+	for _, idx := range m.indexes {
+		if j := slices.IndexFunc(idx.Columns, func(c string) bool { return strings.EqualFold(c, name) }); j >= 0 {
+			idx.Columns = slices.Delete(idx.Columns, j, j+1)
+			if j < len(idx.Cardinality) {
+				idx.Cardinality = slices.Delete(idx.Cardinality, j, j+1)
+			}
+		}
+		if len(idx.Columns) > 0 {
+			indexes = append(indexes, idx)
+		}
+	}
+	m.indexes = indexes
+
+	return true
+}
+
+func (m *tableModel) renameColumn(oldName string, newName string) {
+	if i := m.findColumn(oldName); i >= 0 {
+		m.columns[i].Name = newName
+	}
+	for _, idx := range m.indexes {
+		for j, c := range idx.Columns {
+			if strings.EqualFold(c, oldName) {
+				idx.Columns[j] = newName
+			}
+		}
+	}
+}
+
+// replaceColumn replaces the column oldName with def, keeping its position if pos is nil.
+func (m *tableModel) replaceColumn(oldName string, def *ast.ColumnDef, pos *ast.ColumnPosition) error {
+	i := m.findColumn(oldName)
+	if i < 0 {
+		return errors.Errorf("column %s not found", oldName)
+	}
+	col, pk, unique := newTableColumn(def)
+	m.renameColumn(oldName, col.Name)
+
+	if pos == nil || pos.Tp == ast.ColumnPositionNone {
+		m.columns[i] = col
+	} else {
+		m.columns = slices.Delete(m.columns, i, i+1)
+		m.insertColumn(col, pos)
+	}
+
+	key := []*ast.IndexPartSpecification{{Column: def.Name}}
+	if pk {
+		m.addIndex("PRIMARY", key, true, nil)
+	}
+	if unique {
+		m.addIndex(col.Name, key, true, nil)
+	}
+	return nil
+}
+
+func (m *tableModel) addConstraint(cons *ast.Constraint) {
+	switch cons.Tp {
+	case ast.ConstraintPrimaryKey:
+		m.addIndex("PRIMARY", cons.Keys, true, cons.Option)
+	case ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+		m.addIndex(cons.Name, cons.Keys, true, cons.Option)
+	case ast.ConstraintKey, ast.ConstraintIndex:
+		m.addIndex(cons.Name, cons.Keys, false, cons.Option)
+	}
+}
+
+// addIndex adds an index, it is named after its first column if name is empty like MySQL does.
+func (m *tableModel) addIndex(name string, keys []*ast.IndexPartSpecification, unique bool, opt *ast.IndexOption) {
+	idx := &schema.Index{Name: name, Visible: true}
+	if !unique {
+		idx.NoneUnique = 1
+	}
+	if opt != nil && opt.Visibility == ast.IndexVisibilityInvisible {
+		idx.Visible = false
+	}
+	for _, key := range keys {
+		if key.Column != nil {
+			idx.AddColumn(key.Column.Name.O, 0)
+		}
+	}
+	if len(idx.Columns) == 0 {
+		// functional key parts are not columns of the table
+		return
+	}
+
+	if idx.Name == "" {
+		idx.Name = idx.Columns[0]
+		for i := 2; m.findIndex(idx.Name) >= 0; i++ {
+			idx.Name = fmt.Sprintf("%s_%d", idx.Columns[0], i)
+		}
+	}
+
+	if i := m.findIndex(idx.Name); i >= 0 {
+		m.indexes[i] = idx
+	} else {
+		m.indexes = append(m.indexes, idx)
+	}
+}
+
+func (m *tableModel) dropIndex(name string) {
+	if i := m.findIndex(name); i >= 0 {
+		m.indexes = slices.Delete(m.indexes, i, i+1)
+	}
+}
+
+func (m *tableModel) alter(spec *ast.AlterTableSpec) error {
+	switch spec.Tp {
+	case ast.AlterTableAddColumns:
+		pos := spec.Position
+		for _, def := range spec.NewColumns {
+			m.addColumn(def, pos)
+			if pos != nil && pos.Tp != ast.ColumnPositionNone {
+				// the next columns follow the added one
+				pos = &ast.ColumnPosition{Tp: ast.ColumnPositionAfter, RelativeColumn: def.Name}
+			}
+		}
+		for _, cons := range spec.NewConstraints {
+			m.addConstraint(cons)
+		}
+	case ast.AlterTableDropColumn:
+		if !m.dropColumn(spec.OldColumnName.Name.O) && !spec.IfExists {
+			return errors.Errorf("column %s not found", spec.OldColumnName.Name.O)
+		}
+	case ast.AlterTableModifyColumn:
+		return m.replaceColumn(spec.NewColumns[0].Name.Name.O, spec.NewColumns[0], spec.Position)
+	case ast.AlterTableChangeColumn:
+		return m.replaceColumn(spec.OldColumnName.Name.O, spec.NewColumns[0], spec.Position)
+	case ast.AlterTableRenameColumn:
+		m.renameColumn(spec.OldColumnName.Name.O, spec.NewColumnName.Name.O)
+	case ast.AlterTableRenameTable:
+		if spec.NewTable.Schema.O != "" {
+			m.db = spec.NewTable.Schema.O
+		}
+		m.name = spec.NewTable.Name.O
+	case ast.AlterTableAddConstraint:
+		m.addConstraint(spec.Constraint)
+	case ast.AlterTableDropPrimaryKey:
+		m.dropIndex("PRIMARY")
+	case ast.AlterTableDropIndex:
+		m.dropIndex(spec.Name)
+	case ast.AlterTableRenameIndex:
+		if i := m.findIndex(spec.FromKey.O); i >= 0 {
+			m.indexes[i].Name = spec.ToKey.O
+		}
+	case ast.AlterTableIndexInvisible:
+		if i := m.findIndex(spec.IndexName.O); i >= 0 {
+			m.indexes[i].Visible = spec.Visibility != ast.IndexVisibilityInvisible
+		}
+	}
+	return nil
+}
+
+// newTableColumn builds the column like schema.Table.AddColumn does from SHOW FULL COLUMNS,
+// pk and unique are true if the column is defined as a primary or unique key.
+func newTableColumn(def *ast.ColumnDef) (col schema.TableColumn, pk bool, unique bool) {
+	// year has no display width
+	columnType := strings.ReplaceAll(def.Tp.InfoSchemaStr(), "(-1)", "")
+	collation := def.Tp.GetCollate()
+
+	var auto, virtual, stored, defaultExpr, onUpdate bool
+	for _, opt := range def.Options {
+		switch opt.Tp {
+		case ast.ColumnOptionAutoIncrement:
+			auto = true
+		case ast.ColumnOptionGenerated:
+			if opt.Stored {
+				stored = true
+			} else {
+				virtual = true
+			}
+		case ast.ColumnOptionDefaultValue:
+			if _, ok := opt.Expr.(ast.ValueExpr); !ok && opt.Expr != nil {
+				defaultExpr = true
+			}
+		case ast.ColumnOptionOnUpdate:
+			onUpdate = true
+		case ast.ColumnOptionCollate:
+			collation = opt.StrValue
+		case ast.ColumnOptionPrimaryKey:
+			pk = true
+		case ast.ColumnOptionUniqKey:
+			unique = true
+		}
+	}
+
+	var extra string
+	switch {
+	case auto:
+		extra = "auto_increment"
+	case virtual:
+		extra = "VIRTUAL GENERATED"
+	case stored:
+		extra = "STORED GENERATED"
+	default:
+		var extras []string
+		if defaultExpr {
+			extras = append(extras, "DEFAULT_GENERATED")
+		}
+		if onUpdate {
+			extras = append(extras, "on update CURRENT_TIMESTAMP")
+		}
+		extra = strings.Join(extras, " ")
+	}
+
+	t := &schema.Table{}
+	t.AddColumn(def.Name.Name.O, columnType, collation, extra)
+	return t.Columns[0], pk, unique
+}
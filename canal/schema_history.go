@@ -0,0 +1,316 @@
+package canal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// SchemaHistoryRecord is a version of a table, valid from Pos until the next record
+// of the table.
+type SchemaHistoryRecord struct {
+	Pos mysql.Position `json:"pos"`
+	// GTIDSet is empty if Canal doesn't sync with GTID
+	GTIDSet string `json:"gtid_set,omitempty"`
+	Schema  string `json:"schema"`
+	Table   string `json:"table"`
+	// TableInfo is nil if the table is dropped at Pos
+	TableInfo *schema.Table `json:"table_info,omitempty"`
+	// DDL is the statement which changed the table, it is empty if the table was read from the server
+	DDL string `json:"ddl,omitempty"`
+}
+
+// SchemaHistoryStore persists the schema history, so that a restarted Canal decodes
+// the rows with the tables valid at its position instead of the current ones.
+type SchemaHistoryStore interface {
+	// Load returns the records in the order they were appended.
+	Load() ([]*SchemaHistoryRecord, error)
+	// Append persists the records after the existing ones, it must be durable when Append returns.
+	Append(records []*SchemaHistoryRecord) error
+	// Truncate removes the records after pos, or after gset for the records with a GTID set.
+	// It does nothing if both are empty.
+	Truncate(pos mysql.Position, gset mysql.GTIDSet) error
+}
+
+// FileSchemaHistoryStore is a SchemaHistoryStore which saves the records as JSON lines in a file.
+type FileSchemaHistoryStore struct {
+	m sync.Mutex
+
+	path string
+}
+
+func NewFileSchemaHistoryStore(path string) *FileSchemaHistoryStore {
+	return &FileSchemaHistoryStore{path: path}
+}
+
+func (s *FileSchemaHistoryStore) Load() ([]*SchemaHistoryRecord, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.load()
+}
+
+func (s *FileSchemaHistoryStore) load() ([]*SchemaHistoryRecord, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var records []*SchemaHistoryRecord
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		r := new(SchemaHistoryRecord)
+		if err = json.Unmarshal(line, r); err != nil {
+			if !bytes.HasSuffix(data, []byte("\n")) && bytes.HasSuffix(data, line) {
+				// the last append was interrupted, it was never acknowledged
+				break
+			}
+			return nil, errors.Annotatef(err, "parse schema history file %s", s.path)
+		}
+		records = append(records, r)
+	}
+
+	return records, errors.Trace(sc.Err())
+}
+
+func (s *FileSchemaHistoryStore) Append(records []*SchemaHistoryRecord) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	var buf bytes.Buffer
+	for _, r := range records {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	_, err = f.Write(buf.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return errors.Trace(err)
+}
+
+func (s *FileSchemaHistoryStore) Truncate(pos mysql.Position, gset mysql.GTIDSet) error {
+	if pos.Name == "" && gset == nil {
+		return nil
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	var buf bytes.Buffer
+	for _, r := range records {
+		after, err := r.after(pos, gset)
+		if err != nil {
+			return errors.Trace(err)
+		} else if after {
+			continue
+		}
+		data, err := json.Marshal(r)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	return writeFileAtomic(s.path, buf.Bytes())
+}
+
+// after reports whether the record is after gset, or after pos if the record or gset
+// has no GTID set. The GTID set is compared first as the position is only known
+// from the first rotate event when Canal starts from a GTID set.
+func (r *SchemaHistoryRecord) after(pos mysql.Position, gset mysql.GTIDSet) (bool, error) {
+	if r.GTIDSet != "" && gset != nil {
+		flavor := mysql.MySQLFlavor
+		if _, ok := gset.(*mysql.MariadbGTIDSet); ok {
+			flavor = mysql.MariaDBFlavor
+		}
+		rset, err := mysql.ParseGTIDSet(flavor, r.GTIDSet)
+		if err != nil {
+			return false, errors.Annotatef(err, "parse GTID set of %s.%s at %s", r.Schema, r.Table, r.Pos)
+		}
+		return !gset.Contain(rset), nil
+	}
+	if r.Pos.Name != "" && pos.Name != "" {
+		return r.Pos.Compare(pos) > 0, nil
+	}
+	return false, nil
+}
+
+// schemaHistory is the versions of the tables in SchemaHistoryStore.
+type schemaHistory struct {
+	m sync.Mutex
+
+	store SchemaHistoryStore
+	// versions are in the order they were recorded, TableInfo is nil if dropped
+	versions map[string][]*SchemaHistoryRecord
+}
+
+// table returns the latest version of the table.
+func (h *schemaHistory) table(db string, table string) (*schema.Table, bool) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	versions := h.versions[fmt.Sprintf("%s.%s", db, table)]
+	if len(versions) == 0 {
+		return nil, false
+	}
+	return versions[len(versions)-1].TableInfo, true
+}
+
+// tableAt returns the version of the table valid at pos and gset.
+func (h *schemaHistory) tableAt(db string, table string, pos mysql.Position, gset mysql.GTIDSet) (*schema.Table, bool, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	versions := h.versions[fmt.Sprintf("%s.%s", db, table)]
+	for i := len(versions) - 1; i >= 0; i-- {
+		after, err := versions[i].after(pos, gset)
+		if err != nil {
+			return nil, false, errors.Trace(err)
+		} else if !after {
+			return versions[i].TableInfo, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (h *schemaHistory) record(records ...*SchemaHistoryRecord) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if err := h.store.Append(records); err != nil {
+		return errors.Trace(err)
+	}
+	for _, r := range records {
+		key := fmt.Sprintf("%s.%s", r.Schema, r.Table)
+		h.versions[key] = append(h.versions[key], r)
+	}
+
+	return nil
+}
+
+// loadSchemaHistory loads the tables from SchemaHistory, the records after the current
+// position or GTID set are removed as the binlog is replayed from it.
+func (c *Canal) loadSchemaHistory() error {
+	if c.cfg.SchemaHistory == nil || c.history != nil {
+		return nil
+	}
+
+	pos := c.master.Position()
+	gset := c.master.GTIDSet()
+	if pos.Name == "" && gset == nil {
+		c.cfg.Logger.Warn("unknown binlog position and GTID set, keep the whole schema history")
+	} else if err := c.cfg.SchemaHistory.Truncate(pos, gset); err != nil {
+		return errors.Trace(err)
+	}
+	records, err := c.cfg.SchemaHistory.Load()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	h := &schemaHistory{store: c.cfg.SchemaHistory, versions: make(map[string][]*SchemaHistoryRecord)}
+	for _, r := range records {
+		key := fmt.Sprintf("%s.%s", r.Schema, r.Table)
+		h.versions[key] = append(h.versions[key], r)
+	}
+	c.history = h
+
+	c.tableLock.Lock()
+	c.tables = make(map[string]*schema.Table)
+	c.tableLock.Unlock()
+
+	c.cfg.Logger.Info("load schema history", slog.Any("pos", pos), slog.Any("gtid_set", gset), slog.Int("tables", len(h.versions)))
+	return nil
+}
+
+// updateSchemaHistory applies the DDL to the schema history, pos is the position after the DDL.
+func (c *Canal) updateSchemaHistory(pos mysql.Position, e *replication.QueryEvent, stmt ast.StmtNode) error {
+	if c.history == nil {
+		return nil
+	}
+
+	changes := applyDDL(stmt, string(e.Schema), c.history.table)
+
+	var gset string
+	if e.GSet != nil {
+		gset = e.GSet.String()
+	}
+	records := make([]*SchemaHistoryRecord, 0, len(changes))
+	for _, change := range changes {
+		if !c.checkTableMatch(fmt.Sprintf("%s.%s", change.db, change.table)) {
+			continue
+		}
+
+		t := change.t
+		if change.reload {
+			var err error
+			c.cfg.Logger.Warn("can not apply DDL to schema history, read the table from server",
+				slog.String("database", change.db), slog.String("table", change.table), slog.String("query", string(e.Query)))
+			if t, err = schema.NewTable(c, change.db, change.table); err != nil {
+				if ok, err1 := schema.IsTableExist(c, change.db, change.table); err1 != nil || ok {
+					return errors.Trace(err)
+				}
+				t = nil
+			}
+		}
+
+		records = append(records, &SchemaHistoryRecord{
+			Pos:       pos,
+			GTIDSet:   gset,
+			Schema:    change.db,
+			Table:     change.table,
+			TableInfo: t,
+			DDL:       string(e.Query),
+		})
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	if err := c.history.record(records...); err != nil {
+		return errors.Trace(err)
+	}
+	for _, r := range records {
+		c.ClearTableCache([]byte(r.Schema), []byte(r.Table))
+	}
+
+	return nil
+}
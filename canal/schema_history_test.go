@@ -0,0 +1,280 @@
+package canal
+
+import (
+	"log/slog"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+func columnNames(t *schema.Table) []string {
+	names := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+func TestApplyDDL(t *testing.T) {
+	p := parser.New()
+	tables := make(map[string]*schema.Table)
+	lookup := func(db string, table string) (*schema.Table, bool) {
+		ta, ok := tables[db+"."+table]
+		return ta, ok
+	}
+	apply := func(query string) []tableChange {
+		stmts, _, err := p.Parse(query, "", "")
+		require.NoError(t, err)
+		var changes []tableChange
+		for _, stmt := range stmts {
+			cs := applyDDL(stmt, "db", lookup)
+			for _, c := range cs {
+				tables[c.db+"."+c.table] = c.t
+			}
+			changes = append(changes, cs...)
+		}
+		return changes
+	}
+
+	apply("CREATE TABLE t (id int unsigned NOT NULL AUTO_INCREMENT, name varchar(64) COLLATE utf8mb4_bin, price decimal(10,2), " +
+		"updated datetime DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, PRIMARY KEY (id), UNIQUE KEY (name))")
+	ta := tables["db.t"]
+	require.Equal(t, []string{"id", "name", "price", "updated"}, columnNames(ta))
+	require.Equal(t, []int{0}, ta.PKColumns)
+	require.Equal(t, []int{0}, ta.UnsignedColumns)
+	require.True(t, ta.Columns[0].IsAuto)
+	require.Equal(t, "utf8mb4_bin", ta.Columns[1].Collation)
+	require.Equal(t, schema.TYPE_DECIMAL, ta.Columns[2].Type)
+	require.True(t, ta.Columns[3].IsDefaultExpr)
+	require.True(t, ta.Columns[3].IsAutoUpdating)
+	require.Equal(t, "PRIMARY", ta.Indexes[0].Name)
+	require.Equal(t, "name", ta.Indexes[1].Name)
+
+	apply("ALTER TABLE db.t ADD COLUMN age int FIRST, DROP COLUMN price, CHANGE name title varchar(128), ADD COLUMN (a int, b bigint unsigned)")
+	ta = tables["db.t"]
+	require.Equal(t, []string{"age", "id", "title", "updated", "a", "b"}, columnNames(ta))
+	require.Equal(t, []int{1}, ta.PKColumns)
+	require.Equal(t, []int{1, 5}, ta.UnsignedColumns)
+	require.Equal(t, []string{"title"}, ta.Indexes[1].Columns)
+
+	apply("ALTER TABLE t MODIFY age bigint AFTER b, DROP PRIMARY KEY, ADD PRIMARY KEY (id, title)")
+	ta = tables["db.t"]
+	require.Equal(t, []string{"id", "title", "updated", "a", "b", "age"}, columnNames(ta))
+	require.Equal(t, []int{0, 1}, ta.PKColumns)
+
+	// the later renames see the earlier ones
+	changes := apply("RENAME TABLE t TO t2, t2 TO db2.t3")
+	require.Len(t, changes, 4)
+	require.Nil(t, tables["db.t"])
+	require.Nil(t, tables["db.t2"])
+	require.Equal(t, "db2.t3", tables["db2.t3"].String())
+
+	apply("CREATE TABLE db2.t4 LIKE db2.t3")
+	require.Equal(t, columnNames(tables["db2.t3"]), columnNames(tables["db2.t4"]))
+
+	apply("CREATE INDEX idx_a ON db2.t4 (a)")
+	require.Equal(t, "idx_a", tables["db2.t4"].Indexes[2].Name)
+	apply("DROP INDEX idx_a ON db2.t4")
+	require.Len(t, tables["db2.t4"].Indexes, 2)
+
+	apply("DROP TABLE db2.t4, db2.unknown")
+	_, known := tables["db2.t4"]
+	require.True(t, known)
+	require.Nil(t, tables["db2.t4"])
+	_, known = tables["db2.unknown"]
+	require.False(t, known)
+
+	// unknown tables are skipped, unless their columns are unknown
+	require.Empty(t, apply("ALTER TABLE unknown ADD COLUMN c int"))
+	require.Equal(t, []tableChange{{db: "db", table: "s", reload: true}}, apply("CREATE TABLE s SELECT * FROM db2.t3"))
+	require.Equal(t, []tableChange{{db: "db2", table: "t3", reload: true}}, apply("ALTER TABLE db2.t3 DROP COLUMN missing"))
+}
+
+func TestFileSchemaHistoryStore(t *testing.T) {
+	file := path.Join(t.TempDir(), "schema.history")
+	s := NewFileSchemaHistoryStore(file)
+
+	records, err := s.Load()
+	require.NoError(t, err)
+	require.Empty(t, records)
+
+	ta := &schema.Table{Schema: "db", Name: "t"}
+	ta.AddColumn("id", "int", "", "")
+	saved := []*SchemaHistoryRecord{
+		{Pos: mysql.Position{Name: "mysql-bin.000001", Pos: 100}, Schema: "db", Table: "t", TableInfo: ta},
+		{Pos: mysql.Position{Name: "mysql-bin.000002", Pos: 200}, Schema: "db", Table: "t", DDL: "DROP TABLE t"},
+	}
+	require.NoError(t, s.Append(saved[:1]))
+	require.NoError(t, s.Append(saved[1:]))
+
+	records, err = s.Load()
+	require.NoError(t, err)
+	require.Equal(t, saved, records)
+
+	// an interrupted append is ignored
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"pos":`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	records, err = s.Load()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	require.NoError(t, s.Truncate(mysql.Position{Name: "mysql-bin.000002", Pos: 199}, nil))
+	records, err = s.Load()
+	require.NoError(t, err)
+	require.Equal(t, saved[:1], records)
+
+	// an unknown position keeps the records
+	require.NoError(t, s.Truncate(mysql.Position{}, nil))
+	records, err = s.Load()
+	require.NoError(t, err)
+	require.Equal(t, saved[:1], records)
+}
+
+func TestCanalSchemaHistory(t *testing.T) {
+	store := NewFileSchemaHistoryStore(path.Join(t.TempDir(), "schema.history"))
+	ta := &schema.Table{Schema: "db", Name: "t", Indexes: []*schema.Index{}}
+	ta.AddColumn("id", "int", "", "")
+	require.NoError(t, store.Append([]*SchemaHistoryRecord{
+		{Pos: mysql.Position{Name: "mysql-bin.000001", Pos: 100}, Schema: "db", Table: "t", TableInfo: ta},
+		{Pos: mysql.Position{Name: "mysql-bin.000001", Pos: 900}, Schema: "db", Table: "t", DDL: "DROP TABLE t"},
+	}))
+
+	c := &Canal{
+		cfg:    &Config{SchemaHistory: store, Logger: slog.Default()},
+		master: &masterInfo{logger: slog.Default()},
+		parser: parser.New(),
+		tables: make(map[string]*schema.Table),
+	}
+	c.master.Update(mysql.Position{Name: "mysql-bin.000001", Pos: 500})
+	require.NoError(t, c.loadSchemaHistory())
+
+	// the drop after the position is replayed again
+	got, err := c.GetTable("db", "t")
+	require.NoError(t, err)
+	require.Equal(t, ta, got)
+
+	stmts, _, err := c.parser.Parse("ALTER TABLE t ADD COLUMN name varchar(10)", "", "")
+	require.NoError(t, err)
+	pos := mysql.Position{Name: "mysql-bin.000001", Pos: 600}
+	require.NoError(t, c.updateSchemaHistory(pos, &replication.QueryEvent{Schema: []byte("db"), Query: []byte("ALTER TABLE t ADD COLUMN name varchar(10)")}, stmts[0]))
+	c.master.Update(pos)
+
+	got, err = c.GetTable("db", "t")
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "name"}, columnNames(got))
+
+	records, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, pos, records[1].Pos)
+}
+
+func TestCanalSchemaHistoryFromGTID(t *testing.T) {
+	store := NewFileSchemaHistoryStore(path.Join(t.TempDir(), "schema.history"))
+	ta := &schema.Table{Schema: "db", Name: "t", Indexes: []*schema.Index{}}
+	ta.AddColumn("id", "int", "", "")
+	altered := &schema.Table{Schema: "db", Name: "t", Indexes: []*schema.Index{}}
+	altered.AddColumn("id", "int", "", "")
+	altered.AddColumn("name", "varchar(10)", "", "")
+	require.NoError(t, store.Append([]*SchemaHistoryRecord{
+		{Pos: mysql.Position{Name: "mysql-bin.000001", Pos: 100}, GTIDSet: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5", Schema: "db", Table: "t", TableInfo: ta},
+		{Pos: mysql.Position{Name: "mysql-bin.000001", Pos: 900}, GTIDSet: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-8", Schema: "db", Table: "t", TableInfo: altered, DDL: "ALTER TABLE t ADD COLUMN name varchar(10)"},
+	}))
+
+	// restarted with StartFromGTID before the ALTER, the binlog position isn't known yet
+	gset, err := mysql.ParseGTIDSet(mysql.MySQLFlavor, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-6")
+	require.NoError(t, err)
+	c := &Canal{
+		cfg:    &Config{SchemaHistory: store, Logger: slog.Default()},
+		master: &masterInfo{logger: slog.Default()},
+		parser: parser.New(),
+		tables: make(map[string]*schema.Table),
+	}
+	c.master.UpdateGTIDSet(gset)
+	require.NoError(t, c.loadSchemaHistory())
+
+	got, err := c.GetTable("db", "t")
+	require.NoError(t, err)
+	require.Equal(t, ta, got)
+
+	records, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	// the ALTER is replayed once
+	query := "ALTER TABLE t ADD COLUMN name varchar(10)"
+	stmts, _, err := c.parser.Parse(query, "", "")
+	require.NoError(t, err)
+	require.NoError(t, gset.Update("3e11fa47-71ca-11e1-9e33-c80aa9429562:7-8"))
+	pos := mysql.Position{Name: "mysql-bin.000001", Pos: 900}
+	require.NoError(t, c.updateSchemaHistory(pos, &replication.QueryEvent{Schema: []byte("db"), Query: []byte(query), GSet: gset}, stmts[0]))
+	c.master.Update(pos)
+	c.master.UpdateGTIDSet(gset)
+
+	got, err = c.GetTable("db", "t")
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "name"}, columnNames(got))
+}
+
+func TestSchemaHistoryTableAt(t *testing.T) {
+	ta := &schema.Table{Schema: "db", Name: "t"}
+	ta.AddColumn("id", "int", "", "")
+	altered := &schema.Table{Schema: "db", Name: "t"}
+	altered.AddColumn("id", "int", "", "")
+	altered.AddColumn("name", "varchar(10)", "", "")
+	h := &schemaHistory{
+		store:    NewFileSchemaHistoryStore(path.Join(t.TempDir(), "schema.history")),
+		versions: make(map[string][]*SchemaHistoryRecord),
+	}
+	require.NoError(t, h.record(
+		&SchemaHistoryRecord{Pos: mysql.Position{Name: "mysql-bin.000001", Pos: 100}, GTIDSet: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5", Schema: "db", Table: "t", TableInfo: ta},
+		&SchemaHistoryRecord{Pos: mysql.Position{Name: "mysql-bin.000002", Pos: 100}, GTIDSet: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-8", Schema: "db", Table: "t", TableInfo: altered},
+		&SchemaHistoryRecord{Pos: mysql.Position{Name: "mysql-bin.000003", Pos: 100}, GTIDSet: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-9", Schema: "db", Table: "t"},
+	))
+
+	gtidSet := func(s string) mysql.GTIDSet {
+		gset, err := mysql.ParseGTIDSet(mysql.MySQLFlavor, s)
+		require.NoError(t, err)
+		return gset
+	}
+
+	got, known, err := h.tableAt("db", "t", mysql.Position{Name: "mysql-bin.000001", Pos: 500}, nil)
+	require.NoError(t, err)
+	require.True(t, known)
+	require.Equal(t, ta, got)
+
+	got, known, err = h.tableAt("db", "t", mysql.Position{Name: "mysql-bin.000002", Pos: 500}, nil)
+	require.NoError(t, err)
+	require.True(t, known)
+	require.Equal(t, altered, got)
+
+	// the GTID set is compared before the position
+	got, known, err = h.tableAt("db", "t", mysql.Position{Name: "mysql-bin.000003", Pos: 4}, gtidSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-9"))
+	require.NoError(t, err)
+	require.True(t, known)
+	require.Nil(t, got)
+
+	got, known, err = h.tableAt("db", "t", mysql.Position{}, gtidSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-7"))
+	require.NoError(t, err)
+	require.True(t, known)
+	require.Equal(t, ta, got)
+
+	_, known, err = h.tableAt("db", "t", mysql.Position{}, gtidSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-4"))
+	require.NoError(t, err)
+	require.False(t, known)
+
+	// the latest version if the position is unknown
+	got, known = h.table("db", "t")
+	require.True(t, known)
+	require.Nil(t, got)
+}
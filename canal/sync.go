@@ -3,6 +3,8 @@ package canal
 import (
 	"context"
 	"log/slog"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/go-mysql-org/go-mysql/mysql"
@@ -39,9 +41,30 @@ func (c *Canal) runSyncBinlog() error {
 		return err
 	}
 
+	defer func() {
+		if err := c.discardTransaction(); err != nil {
+			c.cfg.Logger.Error("discard transaction", slog.Any("error", err))
+		}
+	}()
+
+	ctx := c.ctx
+	if c.cfg.ParallelWorkers > 1 {
+		c.dispatcher = newDispatcher(c, c.cfg.ParallelWorkers)
+		ctx = c.dispatcher.ctx
+		defer func() {
+			c.dispatcher.stop()
+			c.dispatcher = nil
+		}()
+	}
+
 	for {
-		ev, err := s.GetEvent(c.ctx)
+		ev, err := s.GetEvent(ctx)
 		if err != nil {
+			if c.dispatcher != nil {
+				if derr := c.dispatcher.error(); derr != nil {
+					return derr
+				}
+			}
 			return errors.Trace(err)
 		}
 
@@ -78,6 +101,7 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 	savePos := false
 	force := false
 	pos := c.master.Position()
+	var gset mysql.GTIDSet
 	var err error
 
 	curPos := pos.Pos
@@ -96,6 +120,9 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 		c.cfg.Logger.Info("rotate binlog", slog.Any("pos", pos))
 		savePos = true
 		force = true
+		if err = c.waitDispatched(); err != nil {
+			return errors.Trace(err)
+		}
 		if err = c.eventHandler.OnRotate(ev.Header, e); err != nil {
 			return errors.Trace(err)
 		}
@@ -120,25 +147,72 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 	case *replication.XIDEvent:
 		savePos = true
 		// try to save the position later
-		if err := c.eventHandler.OnXID(ev.Header, pos); err != nil {
+		if err := c.onXID(ev.Header, pos); err != nil {
+			return errors.Trace(err)
+		}
+		if err := c.commitTransaction(ev.Header, pos); err != nil {
+			return errors.Trace(err)
+		}
+		gset = e.GSet
+	case *replication.XAPrepareEvent:
+		savePos = true
+		if err := c.onExtraEvent(ev.Header, e); err != nil {
+			return errors.Trace(err)
+		}
+		// the rows of an XA transaction are logged when it is prepared
+		if err := c.onXID(ev.Header, pos); err != nil {
+			return errors.Trace(err)
+		}
+		if err := c.commitTransaction(ev.Header, pos); err != nil {
 			return errors.Trace(err)
 		}
-		if e.GSet != nil {
-			c.master.UpdateGTIDSet(e.GSet)
+		gset = e.GSet
+	case *replication.IncidentEvent:
+		c.cfg.Logger.Error("incident event, the binlog may miss some changes",
+			slog.Uint64("type", uint64(e.Type)), slog.String("message", string(e.Message)))
+		if err := c.onExtraEvent(ev.Header, e); err != nil {
+			return errors.Trace(err)
 		}
+		return nil
+	case *replication.IntVarEvent, *replication.RandEvent, *replication.UserVarEvent,
+		*replication.ViewChangeEvent, *replication.TransactionContextEvent:
+		return errors.Trace(c.onExtraEvent(ev.Header, e))
 	case *replication.MariadbGTIDEvent:
 		if err := c.eventHandler.OnGTID(ev.Header, e); err != nil {
 			return errors.Trace(err)
 		}
+		if err := c.beginTransaction(e); err != nil {
+			return errors.Trace(err)
+		}
 	case *replication.GTIDEvent:
 		if err := c.eventHandler.OnGTID(ev.Header, e); err != nil {
 			return errors.Trace(err)
 		}
+		if err := c.beginTransaction(e); err != nil {
+			return errors.Trace(err)
+		}
 	case *replication.RowsQueryEvent:
 		if err := c.eventHandler.OnRowsQueryEvent(e); err != nil {
 			return errors.Trace(err)
 		}
+		if err := c.bufferRowsQuery(string(e.Query)); err != nil {
+			return errors.Trace(err)
+		}
 	case *replication.QueryEvent:
+		if stmt, ok := xaStatement(e.Query); ok {
+			// the parser doesn't support the XA statements
+			switch stmt {
+			case "START", "BEGIN":
+				if err = c.beginTransaction(nil); err != nil {
+					return errors.Trace(err)
+				}
+			case "COMMIT", "ROLLBACK":
+				// the second phase, the rows were passed at the XAPrepareEvent
+				savePos = true
+				gset = e.GSet
+			}
+			break
+		}
 		stmts, _, err := c.parser.Parse(string(e.Query), "", "")
 		if err != nil {
 			// The parser does not understand all syntax.
@@ -148,12 +222,33 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 		}
 		for _, stmt := range stmts {
 			switch stmt.(type) {
-			case *ast.BeginStmt, *ast.SavepointStmt:
+			case *ast.BeginStmt:
+				if err = c.beginTransaction(nil); err != nil {
+					return errors.Trace(err)
+				}
 				// transaction not yet complete; checkpointing here would skip it on GTID resume
 				continue
+			case *ast.SavepointStmt:
+				continue
+			case *ast.CommitStmt:
+				if err = c.commitTransaction(ev.Header, pos); err != nil {
+					return errors.Trace(err)
+				}
 			}
 			savePos = true
 			nodes := parseStmt(stmt)
+			if len(nodes) > 0 {
+				// the DDL is a barrier, the rows before it are handled first
+				if err = c.waitDispatched(); err != nil {
+					return errors.Trace(err)
+				}
+				if err = c.discardTransaction(); err != nil {
+					return errors.Trace(err)
+				}
+			}
+			if err = c.updateSchemaHistory(pos, e, stmt); err != nil {
+				return errors.Trace(err)
+			}
 			for _, node := range nodes {
 				if node.db == "" {
 					node.db = string(e.Schema)
@@ -165,30 +260,59 @@ func (c *Canal) handleEvent(ev *replication.BinlogEvent) error {
 			if len(nodes) > 0 {
 				force = true
 				// Now we only handle Table Changed DDL, maybe we will support more later.
-				if err = c.eventHandler.OnDDL(ev.Header, pos, e); err != nil {
+				if err = c.onDDL(ev.Header, pos, e, nodes[0]); err != nil {
 					return errors.Trace(err)
 				}
 			}
 		}
-		if savePos && e.GSet != nil {
-			c.master.UpdateGTIDSet(e.GSet)
-		}
+		gset = e.GSet
 	default:
 		return nil
 	}
 
 	if savePos {
-		c.master.Update(pos)
-		c.master.UpdateTimestamp(ev.Header.Timestamp)
-
-		if err := c.eventHandler.OnPosSynced(ev.Header, pos, c.master.GTIDSet(), force); err != nil {
+		if c.dispatcher != nil && !force {
+			return errors.Trace(c.dispatcher.commit(ev.Header, pos, gset))
+		}
+		if err := c.waitDispatched(); err != nil {
 			return errors.Trace(err)
 		}
+		return errors.Trace(c.syncPosition(ev.Header, pos, gset, force))
+	}
+
+	return nil
+}
+
+// syncPosition updates the master position and passes it to OnPosSynced and PositionStore.
+func (c *Canal) syncPosition(header *replication.EventHeader, pos mysql.Position, gset mysql.GTIDSet, force bool) error {
+	if gset != nil {
+		c.master.UpdateGTIDSet(gset)
 	}
+	c.master.Update(pos)
+	c.master.UpdateTimestamp(header.Timestamp)
 
+	if err := c.eventHandler.OnPosSynced(header, pos, c.master.GTIDSet(), force); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(c.savePosition(force))
+}
+
+func (c *Canal) onExtraEvent(header *replication.EventHeader, e replication.Event) error {
+	if h, ok := c.eventHandler.(ExtraEventHandler); ok {
+		return h.OnExtraEvent(header, e)
+	}
 	return nil
 }
 
+// xaStatement returns the XA statement of the query, e.g. START for XA START 'xid'.
+func xaStatement(query []byte) (string, bool) {
+	fields := strings.Fields(string(query))
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "XA") {
+		return "", false
+	}
+	return strings.ToUpper(fields[1]), true
+}
+
 type node struct {
 	db    string
 	table string
@@ -271,7 +395,17 @@ func (c *Canal) handleRowsEvent(e *replication.BinlogEvent) error {
 	schemaName := string(ev.Table.Schema)
 	tableName := string(ev.Table.Table)
 
-	t, err := c.GetTable(schemaName, tableName)
+	if c.isSignalTable(schemaName, tableName) {
+		return c.handleSignalRows(e.Header, ev)
+	}
+
+	var t *schema.Table
+	var err error
+	if c.cfg.UseTableMapMetadata {
+		t, err = c.getTableFromTableMap(ev.Table)
+	} else {
+		t, err = c.GetTable(schemaName, tableName)
+	}
 	if err != nil {
 		cause := errors.Cause(err)
 		// ignore errors below
@@ -295,8 +429,69 @@ func (c *Canal) handleRowsEvent(e *replication.BinlogEvent) error {
 	default:
 		return errors.Errorf("%s not supported now", e.Header.EventType)
 	}
+	if h, ok := c.rowIteratorHandler(); ok {
+		return c.onRowIterator(h, t, newRowsEvent(t, action, nil, e.Header, ev), ev)
+	}
 	events := newRowsEvent(t, action, ev.Rows, e.Header, ev)
-	return c.eventHandler.OnRow(events)
+	c.trackSnapshotChanges(t, events.Rows)
+	if _, ok := c.transactionHandler(); ok {
+		return c.bufferRows(events)
+	}
+	return c.onRow(events)
+}
+
+func (c *Canal) rowIteratorHandler() (RowIteratorHandler, bool) {
+	h, ok := c.eventHandler.(RowIteratorHandler)
+	return h, ok
+}
+
+// onRowIterator passes the rows of ev to RowIteratorHandler.OnRowIterator, after the rows
+// passed to onRow are handled.
+func (c *Canal) onRowIterator(h RowIteratorHandler, t *schema.Table, e *RowsEvent, ev *replication.RowsEvent) error {
+	if err := c.waitDispatched(); err != nil {
+		return errors.Trace(err)
+	}
+
+	var rows *replication.RowIterator
+	if columns := h.RowColumns(t); columns != nil {
+		rows = ev.RowIterator(append(slices.Clone(columns), t.PKColumns...)...)
+	} else {
+		rows = ev.RowIterator()
+	}
+	it := &RowIterator{rows: rows, table: t, onRow: func(row []any) {
+		c.trackSnapshotChanges(t, [][]any{row})
+	}}
+	end := c.traceHandler(TraceHandler{
+		Method: "OnRowIterator",
+		Action: e.Action,
+		Schema: t.Schema,
+		Table:  t.Name,
+	})
+	start := time.Now()
+	err := h.OnRowIterator(e, it)
+	c.rowHandled(e.Action, start, err)
+	end(err)
+	return errors.Trace(err)
+}
+
+func (c *Canal) onXID(header *replication.EventHeader, pos mysql.Position) error {
+	end := c.traceHandler(TraceHandler{Method: "OnXID"})
+	err := c.eventHandler.OnXID(header, pos)
+	end(err)
+	return err
+}
+
+// onDDL passes the DDL of the table of node to EventHandler.OnDDL.
+func (c *Canal) onDDL(header *replication.EventHeader, pos mysql.Position, e *replication.QueryEvent, node *node) error {
+	end := c.traceHandler(TraceHandler{
+		Method:    "OnDDL",
+		Schema:    node.db,
+		Table:     node.table,
+		Statement: string(e.Query),
+	})
+	err := c.eventHandler.OnDDL(header, pos, e)
+	end(err)
+	return err
 }
 
 func (c *Canal) FlushBinlog() error {
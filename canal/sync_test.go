@@ -1,9 +1,14 @@
 package canal
 
 import (
+	"log/slog"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
 )
 
 func TestGetShowBinaryLogQuery(t *testing.T) {
@@ -29,3 +34,60 @@ func TestGetShowBinaryLogQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleRowsEventWithTableMapMetadata(t *testing.T) {
+	h := &rowsRecorder{}
+	c := &Canal{
+		cfg:          &Config{UseTableMapMetadata: true, Logger: slog.Default()},
+		eventHandler: h,
+		tables:       make(map[string]*schema.Table),
+		tableMaps:    make(map[string]*replication.TableMapEvent),
+	}
+
+	newTableMap := func(names ...string) *replication.TableMapEvent {
+		e := &replication.TableMapEvent{
+			Schema:      []byte("db"),
+			Table:       []byte("t"),
+			ColumnCount: uint64(len(names)),
+			ColumnType:  make([]byte, len(names)),
+			ColumnMeta:  make([]uint16, len(names)),
+			PrimaryKey:  []uint64{0},
+		}
+		for i, name := range names {
+			e.ColumnType[i] = mysql.MYSQL_TYPE_LONG
+			e.ColumnName = append(e.ColumnName, []byte(name))
+		}
+		return e
+	}
+	handle := func(tableMap *replication.TableMapEvent, row ...any) {
+		e := &replication.BinlogEvent{
+			Header: &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2},
+			Event:  &replication.RowsEvent{Table: tableMap, Rows: [][]any{row}},
+		}
+		require.NoError(t, c.handleRowsEvent(e))
+	}
+
+	tableMap := newTableMap("id", "a")
+	handle(tableMap, int32(1), int32(2))
+	handle(tableMap, int32(2), int32(3))
+	require.Len(t, h.events, 2)
+	require.Same(t, h.events[0].Table, h.events[1].Table)
+	require.Equal(t, "a", h.events[0].Table.Columns[1].Name)
+	require.Equal(t, []int{0}, h.events[0].Table.PKColumns)
+
+	// the table was altered, the next TableMapEvent has the new columns
+	handle(newTableMap("id", "b", "c"), int32(3), int32(4), int32(5))
+	require.Len(t, h.events, 3)
+	require.Len(t, h.events[2].Table.Columns, 3)
+	require.Equal(t, "b", h.events[2].Table.Columns[1].Name)
+
+	// binlog_row_metadata=MINIMAL
+	e := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2},
+		Event: &replication.RowsEvent{Table: &replication.TableMapEvent{
+			Schema: []byte("db"), Table: []byte("t2"), ColumnCount: 1,
+			ColumnType: []byte{mysql.MYSQL_TYPE_LONG}, ColumnMeta: []uint16{0},
+		}},
+	}
+	require.ErrorIs(t, c.handleRowsEvent(e), schema.ErrMissingRowMetadata)
+}
@@ -0,0 +1,280 @@
+package canal
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+func init() {
+	// the row values which are not registered by gob
+	gob.Register(time.Time{})
+	gob.Register(decimal.Decimal{})
+	gob.Register(&replication.JsonDiff{})
+}
+
+// TransactionAction is the action passed to Metrics.OnRowHandled for the calls of
+// TransactionHandler.OnTransaction.
+const TransactionAction = "transaction"
+
+// Transaction is a committed binlog transaction passed to TransactionHandler.
+//
+// The RowsEvents are kept in memory up to Config.TransactionBufferSize, the rest are
+// spilled to a temporary file which is removed after OnTransaction returns, so the
+// Transaction must not be used after it.
+type Transaction struct {
+	// GTIDEvent is the GTID event of the transaction, it is nil if GTID is disabled
+	GTIDEvent mysql.BinlogGTIDEvent
+	// GTID is the GTID of the transaction, it is empty if GTID is disabled
+	GTID string
+	// ImmediateCommitTime and OriginalCommitTime are the commit time on the immediate and
+	// the original source, they are zero if not available, e.g. before MySQL 8.0.1 or in MariaDB.
+	ImmediateCommitTime time.Time
+	OriginalCommitTime  time.Time
+	// Queries are the texts of the RowsQueryEvents, binlog_rows_query_log_events=ON is required
+	Queries []string
+	// Header is the header of the event committing the transaction
+	Header *replication.EventHeader
+	// NextPos is the position after the transaction
+	NextPos mysql.Position
+
+	limit int64
+	dir   string
+
+	events []*RowsEvent
+	count  int
+	size   int64
+
+	spill *os.File
+	w     *bufio.Writer
+	enc   *gob.Encoder
+}
+
+func newTransaction(limit int64, dir string) *Transaction {
+	return &Transaction{limit: limit, dir: dir}
+}
+
+// RowsEventCount returns the number of RowsEvents in the transaction.
+func (tx *Transaction) RowsEventCount() int {
+	return tx.count
+}
+
+// Spilled returns true if the RowsEvents don't fit in memory and some are in a temporary file.
+func (tx *Transaction) Spilled() bool {
+	return tx.spill != nil
+}
+
+// ForEachRowsEvent calls fn for each RowsEvent in the binlog order, it stops on the first error.
+// The RowsEvents read from the temporary file have their own copy of the Table.
+func (tx *Transaction) ForEachRowsEvent(fn func(e *RowsEvent) error) error {
+	for _, e := range tx.events {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if tx.spill == nil {
+		return nil
+	}
+
+	if err := tx.w.Flush(); err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := tx.spill.Seek(0, io.SeekStart); err != nil {
+		return errors.Trace(err)
+	}
+	// the offset is restored for the next appends
+	defer func() {
+		_, _ = tx.spill.Seek(0, io.SeekEnd)
+	}()
+
+	dec := gob.NewDecoder(bufio.NewReader(tx.spill))
+	for i := len(tx.events); i < tx.count; i++ {
+		e := new(RowsEvent)
+		if err := dec.Decode(e); err != nil {
+			return errors.Annotatef(err, "read spilled rows event %d", i)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (tx *Transaction) addRowsEvent(e *RowsEvent) error {
+	if tx.spill == nil {
+		size := rowsEventSize(e)
+		if tx.limit <= 0 || tx.size+size <= tx.limit {
+			tx.events = append(tx.events, e)
+			tx.size += size
+			tx.count++
+			return nil
+		}
+
+		f, err := os.CreateTemp(tx.dir, "canal-transaction-*")
+		if err != nil {
+			return errors.Trace(err)
+		}
+		tx.spill = f
+		tx.w = bufio.NewWriter(f)
+		tx.enc = gob.NewEncoder(tx.w)
+	}
+
+	if err := tx.enc.Encode(e); err != nil {
+		return errors.Annotatef(err, "spill rows event to %s", tx.spill.Name())
+	}
+	tx.count++
+	return nil
+}
+
+func (tx *Transaction) hasContent() bool {
+	return tx.count > 0 || len(tx.Queries) > 0
+}
+
+// close removes the temporary file.
+func (tx *Transaction) close() error {
+	if tx.spill == nil {
+		return nil
+	}
+
+	name := tx.spill.Name()
+	err := tx.spill.Close()
+	if rerr := os.Remove(name); err == nil {
+		err = rerr
+	}
+	tx.spill = nil
+	return errors.Trace(err)
+}
+
+// rowsEventSize estimates the memory used by the rows.
+func rowsEventSize(e *RowsEvent) int64 {
+	var size int64
+	for _, row := range e.Rows {
+		for _, v := range row {
+			// the interface value
+			size += 16
+			switch v := v.(type) {
+			case string:
+				size += int64(len(v))
+			case []byte:
+				size += int64(len(v))
+			case *replication.JsonDiff:
+				size += int64(len(v.Path) + len(v.Value))
+			}
+		}
+	}
+	return size
+}
+
+func (c *Canal) transactionHandler() (TransactionHandler, bool) {
+	h, ok := c.eventHandler.(TransactionHandler)
+	return h, ok
+}
+
+// beginTransaction starts buffering a transaction at its GTID event, or at its BEGIN if
+// GTID is disabled.
+func (c *Canal) beginTransaction(gtidEvent mysql.BinlogGTIDEvent) error {
+	if _, ok := c.transactionHandler(); !ok {
+		return nil
+	}
+
+	if gtidEvent == nil && c.txn != nil && c.txn.GTIDEvent != nil && !c.txn.hasContent() {
+		// the BEGIN after the GTID event
+		return nil
+	}
+	if err := c.discardTransaction(); err != nil {
+		return errors.Trace(err)
+	}
+
+	tx := newTransaction(c.cfg.TransactionBufferSize, c.cfg.TransactionSpillDir)
+	if gtidEvent != nil {
+		tx.GTIDEvent = gtidEvent
+		if next, err := gtidEvent.GTIDNext(); err == nil {
+			tx.GTID = next.String()
+		}
+		if e, ok := gtidEvent.(*replication.GTIDEvent); ok {
+			tx.ImmediateCommitTime = e.ImmediateCommitTime()
+			tx.OriginalCommitTime = e.OriginalCommitTime()
+		}
+	}
+	c.txn = tx
+
+	return nil
+}
+
+func (c *Canal) currentTransaction() (*Transaction, error) {
+	if c.txn == nil {
+		// the sync started in the middle of the transaction
+		if err := c.beginTransaction(nil); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return c.txn, nil
+}
+
+func (c *Canal) bufferRowsQuery(query string) error {
+	if _, ok := c.transactionHandler(); !ok {
+		return nil
+	}
+
+	tx, err := c.currentTransaction()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	tx.Queries = append(tx.Queries, query)
+	return nil
+}
+
+func (c *Canal) bufferRows(e *RowsEvent) error {
+	tx, err := c.currentTransaction()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(tx.addRowsEvent(e))
+}
+
+// commitTransaction passes the buffered transaction to TransactionHandler.
+func (c *Canal) commitTransaction(header *replication.EventHeader, pos mysql.Position) error {
+	h, ok := c.transactionHandler()
+	if !ok || c.txn == nil {
+		return nil
+	}
+
+	tx := c.txn
+	c.txn = nil
+	defer func() {
+		if err := tx.close(); err != nil {
+			c.cfg.Logger.Error("remove transaction spill file", slog.Any("error", err))
+		}
+	}()
+
+	tx.Header = header
+	tx.NextPos = pos
+
+	end := c.traceHandler(TraceHandler{Method: "OnTransaction", Rows: tx.RowsEventCount()})
+	start := time.Now()
+	err := h.OnTransaction(tx)
+	c.rowHandled(TransactionAction, start, err)
+	end(err)
+	return errors.Trace(err)
+}
+
+// discardTransaction drops the buffered transaction, e.g. a DDL has no rows.
+func (c *Canal) discardTransaction() error {
+	if c.txn == nil {
+		return nil
+	}
+
+	tx := c.txn
+	c.txn = nil
+	return errors.Trace(tx.close())
+}
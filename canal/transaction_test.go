@@ -0,0 +1,233 @@
+package canal
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+type transactionRecorder struct {
+	DummyEventHandler
+
+	txs    []*Transaction
+	events [][]*RowsEvent
+	spills []string
+	rows   int
+}
+
+func (h *transactionRecorder) OnRow(*RowsEvent) error {
+	h.rows++
+	return nil
+}
+
+func (h *transactionRecorder) OnTransaction(tx *Transaction) error {
+	var events []*RowsEvent
+	if err := tx.ForEachRowsEvent(func(e *RowsEvent) error {
+		events = append(events, e)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if tx.Spilled() {
+		h.spills = append(h.spills, tx.spill.Name())
+	}
+	h.txs = append(h.txs, tx)
+	h.events = append(h.events, events)
+	return nil
+}
+
+func TestTransactionHandler(t *testing.T) {
+	h := &transactionRecorder{}
+	c := &Canal{
+		cfg: &Config{
+			Logger:                slog.Default(),
+			TransactionBufferSize: 200,
+			TransactionSpillDir:   t.TempDir(),
+		},
+		eventHandler: h,
+		parser:       parser.New(),
+		master:       &masterInfo{pos: mysql.Position{Name: "mysql-bin.000001", Pos: 4}, logger: slog.Default()},
+		tables: map[string]*schema.Table{
+			"db.t": {
+				Schema: "db",
+				Name:   "t",
+				Columns: []schema.TableColumn{
+					{Name: "id", Type: schema.TYPE_NUMBER},
+					{Name: "v", Type: schema.TYPE_STRING},
+					{Name: "d", Type: schema.TYPE_DECIMAL},
+					{Name: "ts", Type: schema.TYPE_DATETIME},
+				},
+				PKColumns: []int{0},
+			},
+		},
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	defer c.cancel()
+
+	tableMap := &replication.TableMapEvent{Schema: []byte("db"), Table: []byte("t")}
+	var logPos uint32 = 4
+	handle := func(eventType replication.EventType, e replication.Event) {
+		logPos += 100
+		ev := &replication.BinlogEvent{Header: &replication.EventHeader{EventType: eventType, LogPos: logPos}, Event: e}
+		require.NoError(t, c.handleEvent(ev))
+	}
+	insert := func(id int32, v string) {
+		ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		handle(replication.WRITE_ROWS_EVENTv2, &replication.RowsEvent{Table: tableMap, Rows: [][]any{
+			{id, v, decimal.RequireFromString("1.5"), ts},
+			{id + 1, nil, nil, nil},
+		}})
+	}
+
+	sid := uuid.MustParse("3e11fa47-71ca-11e1-9e33-c80aa9429562")
+	commitTime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	handle(replication.GTID_EVENT, &replication.GTIDEvent{
+		SID:                      sid[:],
+		GNO:                      7,
+		ImmediateCommitTimestamp: uint64(commitTime.UnixMicro()),
+		OriginalCommitTimestamp:  uint64(commitTime.Add(-time.Second).UnixMicro()),
+	})
+	handle(replication.QUERY_EVENT, &replication.QueryEvent{Query: []byte("BEGIN")})
+	handle(replication.ROWS_QUERY_EVENT, &replication.RowsQueryEvent{Query: []byte("INSERT INTO t VALUES (1, 'a')")})
+	insert(1, "a")
+	insert(3, "a very long value which doesn't fit in the transaction buffer")
+	insert(5, "c")
+	handle(replication.XID_EVENT, &replication.XIDEvent{})
+
+	require.Zero(t, h.rows)
+	require.Len(t, h.txs, 1)
+	tx := h.txs[0]
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:7", tx.GTID)
+	require.True(t, commitTime.Equal(tx.ImmediateCommitTime))
+	require.True(t, commitTime.Add(-time.Second).Equal(tx.OriginalCommitTime))
+	require.Equal(t, []string{"INSERT INTO t VALUES (1, 'a')"}, tx.Queries)
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: logPos}, tx.NextPos)
+	require.Equal(t, 3, tx.RowsEventCount())
+
+	// the last two events are spilled and the file is removed after OnTransaction
+	require.Len(t, h.spills, 1)
+	require.Len(t, tx.events, 1)
+	_, err := os.Stat(h.spills[0])
+	require.True(t, os.IsNotExist(err))
+
+	events := h.events[0]
+	require.Len(t, events, 3)
+	for i, e := range events {
+		require.Equal(t, InsertAction, e.Action)
+		require.Equal(t, "t", e.Table.Name)
+		require.Len(t, e.Rows, 2)
+		require.Equal(t, int32(1+2*i), e.Rows[0][0])
+		require.True(t, decimal.RequireFromString("1.5").Equal(e.Rows[0][2].(decimal.Decimal)))
+		require.True(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).Equal(e.Rows[0][3].(time.Time)))
+		require.Equal(t, []any{int32(2 + 2*i), nil, nil, nil}, e.Rows[1])
+	}
+	require.Equal(t, "a very long value which doesn't fit in the transaction buffer", events[1].Rows[0][1])
+
+	// a DDL is not a transaction
+	handle(replication.GTID_EVENT, &replication.GTIDEvent{SID: sid[:], GNO: 8})
+	handle(replication.QUERY_EVENT, &replication.QueryEvent{Schema: []byte("db"), Query: []byte("CREATE TABLE t2 (id INT)")})
+	require.Nil(t, c.txn)
+
+	// without GTID
+	handle(replication.QUERY_EVENT, &replication.QueryEvent{Query: []byte("BEGIN")})
+	insert(10, "x")
+	handle(replication.QUERY_EVENT, &replication.QueryEvent{Query: []byte("COMMIT")})
+
+	require.Len(t, h.txs, 2)
+	require.Empty(t, h.txs[1].GTID)
+	require.Nil(t, h.txs[1].GTIDEvent)
+	require.False(t, h.txs[1].Spilled())
+	require.Len(t, h.events[1], 1)
+	require.Equal(t, int32(10), h.events[1][0].Rows[0][0])
+	require.Zero(t, h.rows)
+}
+
+type xaRecorder struct {
+	transactionRecorder
+
+	xids   []mysql.Position
+	extras []replication.Event
+	synced []mysql.Position
+}
+
+func (h *xaRecorder) OnXID(_ *replication.EventHeader, pos mysql.Position) error {
+	h.xids = append(h.xids, pos)
+	return nil
+}
+
+func (h *xaRecorder) OnExtraEvent(_ *replication.EventHeader, e replication.Event) error {
+	h.extras = append(h.extras, e)
+	return nil
+}
+
+func (h *xaRecorder) OnPosSynced(_ *replication.EventHeader, pos mysql.Position, _ mysql.GTIDSet, _ bool) error {
+	h.synced = append(h.synced, pos)
+	return nil
+}
+
+func TestXATransaction(t *testing.T) {
+	h := &xaRecorder{}
+	c := &Canal{
+		cfg:          &Config{Logger: slog.Default()},
+		eventHandler: h,
+		parser:       parser.New(),
+		master:       &masterInfo{pos: mysql.Position{Name: "mysql-bin.000001", Pos: 4}, logger: slog.Default()},
+		tables: map[string]*schema.Table{
+			"db.t": {Schema: "db", Name: "t", Columns: []schema.TableColumn{{Name: "id", Type: schema.TYPE_NUMBER}}, PKColumns: []int{0}},
+		},
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	defer c.cancel()
+
+	var logPos uint32 = 4
+	handle := func(eventType replication.EventType, e replication.Event) {
+		logPos += 100
+		ev := &replication.BinlogEvent{Header: &replication.EventHeader{EventType: eventType, LogPos: logPos}, Event: e}
+		require.NoError(t, c.handleEvent(ev))
+	}
+
+	sid := uuid.MustParse("3e11fa47-71ca-11e1-9e33-c80aa9429562")
+	gset, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-7")
+	require.NoError(t, err)
+
+	handle(replication.GTID_EVENT, &replication.GTIDEvent{SID: sid[:], GNO: 7})
+	handle(replication.QUERY_EVENT, &replication.QueryEvent{Query: []byte("XA START X'61',X'',1")})
+	handle(replication.USER_VAR_EVENT, &replication.UserVarEvent{Name: []byte("v"), IsNull: true})
+	handle(replication.WRITE_ROWS_EVENTv2, &replication.RowsEvent{
+		Table: &replication.TableMapEvent{Schema: []byte("db"), Table: []byte("t")},
+		Rows:  [][]any{{int32(1)}},
+	})
+	handle(replication.QUERY_EVENT, &replication.QueryEvent{Query: []byte("XA END X'61',X'',1")})
+	require.Empty(t, h.txs)
+	require.Empty(t, h.synced)
+
+	prepare := &replication.XAPrepareEvent{FormatID: 1, GTRID: []byte("a"), GSet: gset}
+	handle(replication.XA_PREPARE_LOG_EVENT, prepare)
+	preparePos := mysql.Position{Name: "mysql-bin.000001", Pos: logPos}
+
+	require.Len(t, h.txs, 1)
+	require.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:7", h.txs[0].GTID)
+	require.Len(t, h.events[0], 1)
+	require.Equal(t, []mysql.Position{preparePos}, h.xids)
+	require.Equal(t, []mysql.Position{preparePos}, h.synced)
+	require.Equal(t, []replication.Event{&replication.UserVarEvent{Name: []byte("v"), IsNull: true}, prepare}, h.extras)
+	require.True(t, gset.Equal(c.master.GTIDSet()))
+
+	// the second phase is another transaction
+	handle(replication.GTID_EVENT, &replication.GTIDEvent{SID: sid[:], GNO: 8})
+	handle(replication.QUERY_EVENT, &replication.QueryEvent{Query: []byte("XA COMMIT X'61',X'',1")})
+	require.Len(t, h.synced, 2)
+	require.Equal(t, logPos, c.master.Position().Pos)
+	require.Len(t, h.txs, 1)
+}
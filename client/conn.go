@@ -70,6 +70,12 @@ type Conn struct {
 
 	// Include the file + line as query attribute. The number set which frame in the stack should be used.
 	includeLine int
+
+	tracer           Tracer
+	traceCtx         context.Context
+	redactStatements bool
+	// traceParent is the traceparent of the span of the statement being sent
+	traceParent string
 }
 
 // This function will be called for every row in resultset from ExecuteSelectStreaming.
@@ -314,7 +320,7 @@ func (c *Conn) CompareServerVersion(v string) (int, error) {
 
 func (c *Conn) Execute(command string, args ...any) (*mysql.Result, error) {
 	if len(args) == 0 {
-		return c.exec(command)
+		return c.tracedExec("query", command)
 	}
 	s, err := c.Prepare(command)
 	if err != nil {
@@ -572,32 +578,32 @@ func (c *Conn) ExecQueryRelayLocalInfile(query string, relayFile func(filename [
 }
 
 func (c *Conn) Begin() error {
-	_, err := c.exec("BEGIN")
+	_, err := c.tracedExec("begin", "BEGIN")
 	return errors.Trace(err)
 }
 
 func (c *Conn) BeginTx(readOnly bool, txIsolation string) error {
 	if txIsolation != "" {
-		if _, err := c.exec("SET TRANSACTION ISOLATION LEVEL " + txIsolation); err != nil {
+		if _, err := c.tracedExec("begin", "SET TRANSACTION ISOLATION LEVEL "+txIsolation); err != nil {
 			return errors.Trace(err)
 		}
 	}
 	var err error
 	if readOnly {
-		_, err = c.exec("START TRANSACTION READ ONLY")
+		_, err = c.tracedExec("begin", "START TRANSACTION READ ONLY")
 	} else {
-		_, err = c.exec("START TRANSACTION")
+		_, err = c.tracedExec("begin", "START TRANSACTION")
 	}
 	return errors.Trace(err)
 }
 
 func (c *Conn) Commit() error {
-	_, err := c.exec("COMMIT")
+	_, err := c.tracedExec("commit", "COMMIT")
 	return errors.Trace(err)
 }
 
 func (c *Conn) Rollback() error {
-	_, err := c.exec("ROLLBACK")
+	_, err := c.tracedExec("rollback", "ROLLBACK")
 	return errors.Trace(err)
 }
 
@@ -711,11 +717,20 @@ func (c *Conn) exec(query string) (*mysql.Result, error) {
 	return c.readResult(false)
 }
 
+// tracedExec is exec in a span of the Tracer, if any.
+func (c *Conn) tracedExec(operation string, query string) (*mysql.Result, error) {
+	span := c.startSpan(operation, query)
+	r, err := c.exec(query)
+	c.endSpan(span, r, err)
+	return r, err
+}
+
 // Sends COM_QUERY
 // https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_com_query.html
 func (c *Conn) execSend(query string) error {
 	var buf bytes.Buffer
-	defer clear(c.queryAttributes)
+	// the attributes are only sent with one query
+	defer func() { c.queryAttributes = nil }()
 
 	if c.capability&mysql.CLIENT_QUERY_ATTRIBUTES > 0 {
 		if c.includeLine >= 0 {
@@ -728,6 +743,7 @@ func (c *Conn) execSend(query string) error {
 				c.queryAttributes = append(c.queryAttributes, lineAttr)
 			}
 		}
+		c.traceParentAttribute()
 
 		numParams := len(c.queryAttributes)
 		buf.Write(mysql.PutLengthEncodedInt(uint64(numParams)))
@@ -16,6 +16,8 @@ import (
 type Stmt struct {
 	conn     *Conn
 	warnings int
+	// query is the text of the statement, for the Tracer
+	query string
 
 	// PreparedStmt contains common fields shared with server.Stmt for proxy passthrough
 	stmt.PreparedStmt
@@ -33,7 +35,10 @@ func (s *Stmt) WarningsNum() int {
 	return s.warnings
 }
 
-func (s *Stmt) Execute(args ...any) (*mysql.Result, error) {
+func (s *Stmt) Execute(args ...any) (r *mysql.Result, err error) {
+	span := s.conn.startSpan("execute", s.query)
+	defer func() { s.conn.endSpan(span, r, err) }()
+
 	if err := s.write(args...); err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -102,7 +107,8 @@ func (s *Stmt) Close() error {
 
 // https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_com_stmt_execute.html
 func (s *Stmt) write(args ...any) error {
-	defer clear(s.conn.queryAttributes)
+	// the attributes are only sent with one statement
+	defer func() { s.conn.queryAttributes = nil }()
 	paramsNum := s.Params
 
 	if len(args) != paramsNum {
@@ -119,6 +125,9 @@ func (s *Stmt) write(args ...any) error {
 			s.conn.queryAttributes = append(s.conn.queryAttributes, lineAttr)
 		}
 	}
+	if s.conn.capability&mysql.CLIENT_QUERY_ATTRIBUTES > 0 {
+		s.conn.traceParentAttribute()
+	}
 
 	qaLen := len(s.conn.queryAttributes)
 	paramTypes := make([][]byte, paramsNum+qaLen)
@@ -278,7 +287,10 @@ func (s *Stmt) write(args ...any) error {
 	return s.conn.WritePacket(data.Bytes())
 }
 
-func (c *Conn) Prepare(query string) (*Stmt, error) {
+func (c *Conn) Prepare(query string) (s *Stmt, err error) {
+	span := c.startSpan("prepare", query)
+	defer func() { c.endSpan(span, nil, err) }()
+
 	if err := c.writeCommandStr(mysql.COM_STMT_PREPARE, query); err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -294,8 +306,9 @@ func (c *Conn) Prepare(query string) (*Stmt, error) {
 		return nil, mysql.ErrMalformPacket
 	}
 
-	s := new(Stmt)
+	s = new(Stmt)
 	s.conn = c
+	s.query = query
 
 	pos := 1
 
@@ -0,0 +1,174 @@
+package client
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// TraceParentAttribute is the query attribute carrying the W3C trace context of a traced
+// statement to the server.
+const TraceParentAttribute = "traceparent"
+
+// Tracer traces the statements of a Conn, see Conn.SetTracer. It's meant to be an adapter
+// to a tracing library, e.g. OpenTelemetry, which starts a client span with the attributes
+// of the TraceStatement:
+//
+//	db.system               TraceStatement.System
+//	db.operation            TraceStatement.Operation
+//	db.statement            TraceStatement.Statement
+//	db.mysql.connection_id  TraceStatement.ConnectionID
+//	db.rows_affected        mysql.Result.AffectedRows, when the span ends
+type Tracer interface {
+	// StartStatement is called before the statement is sent to the server, ctx is the
+	// context set by Conn.SetTraceContext.
+	StartStatement(ctx context.Context, s TraceStatement) TraceSpan
+}
+
+// TraceSpan is the span of a statement started by a Tracer.
+type TraceSpan interface {
+	// TraceParent returns the W3C traceparent of the span, e.g.
+	// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01". If it's not empty, it's
+	// sent as the query attribute TraceParentAttribute when the server supports the
+	// query attributes, so the server side of the statement can be correlated.
+	TraceParent() string
+	// End is called with the result of the statement, r is nil on an error.
+	End(r *mysql.Result, err error)
+}
+
+// TraceStatement describes a traced statement.
+type TraceStatement struct {
+	// System is always "mysql".
+	System string
+	// Operation is one of "query", "prepare", "execute", "begin", "commit" and "rollback".
+	Operation string
+	// Statement is the text of the statement, redacted by RedactStatement if
+	// Conn.RedactStatements is set. The "execute" statements have the text of the
+	// prepared statement.
+	Statement string
+	// ConnectionID is the thread id of the connection on the server.
+	ConnectionID uint32
+}
+
+// SetTracer traces the statements sent by Execute, Prepare, Stmt.Execute, Begin, BeginTx,
+// Commit and Rollback with t, nil disables the tracing.
+func (c *Conn) SetTracer(t Tracer) {
+	c.tracer = t
+}
+
+// SetTraceContext sets the context passed to the Tracer for the next statements, it
+// carries the parent span. The driver sets it to the context of each call.
+func (c *Conn) SetTraceContext(ctx context.Context) {
+	c.traceCtx = ctx
+}
+
+// RedactStatements can be passed as option when connecting to redact the literals of the
+// traced statements with RedactStatement.
+func (c *Conn) RedactStatements(redact bool) {
+	c.redactStatements = redact
+}
+
+// startSpan starts the span of a statement, it returns nil if the connection isn't traced.
+// The traceparent of the span is sent with the next statement.
+func (c *Conn) startSpan(operation string, statement string) TraceSpan {
+	if c.tracer == nil {
+		return nil
+	}
+
+	if c.redactStatements {
+		statement = RedactStatement(statement)
+	}
+	ctx := c.traceCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	span := c.tracer.StartStatement(ctx, TraceStatement{
+		System:       "mysql",
+		Operation:    operation,
+		Statement:    statement,
+		ConnectionID: c.connectionID,
+	})
+	c.traceParent = span.TraceParent()
+	return span
+}
+
+// endSpan ends the span started by startSpan, if any.
+func (c *Conn) endSpan(span TraceSpan, r *mysql.Result, err error) {
+	c.traceParent = ""
+	if span != nil {
+		span.End(r, err)
+	}
+}
+
+// traceParentAttribute adds the traceparent of the current span to the query attributes.
+func (c *Conn) traceParentAttribute() {
+	if c.traceParent != "" {
+		c.queryAttributes = append(c.queryAttributes, mysql.QueryAttribute{Name: TraceParentAttribute, Value: c.traceParent})
+	}
+}
+
+// RedactStatement replaces the string and number literals of the statement with "?", so
+// the statement can be traced without the values of the query.
+func RedactStatement(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	for i := 0; i < len(query); {
+		ch := query[i]
+		switch {
+		case ch == '\'' || ch == '"':
+			i = skipQuoted(query, i)
+			b.WriteByte('?')
+		case ch == '`':
+			// quoted identifier
+			end := skipQuoted(query, i)
+			b.WriteString(query[i:end])
+			i = end
+		case isDigit(ch) && (i == 0 || !isIdentChar(query[i-1])):
+			for i < len(query) && (isIdentChar(query[i]) || query[i] == '.') {
+				i++
+			}
+			b.WriteByte('?')
+		case isIdentChar(ch):
+			start := i
+			for i < len(query) && isIdentChar(query[i]) {
+				i++
+			}
+			b.WriteString(query[start:i])
+		default:
+			b.WriteByte(ch)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// skipQuoted returns the position after the quoted string at i, the quote can be escaped
+// by a backslash or doubled.
+func skipQuoted(query string, i int) int {
+	quote := query[i]
+	for i++; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isIdentChar(ch byte) bool {
+	return isDigit(ch) || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_' || ch == '$' || ch >= 0x80
+}
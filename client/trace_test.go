@@ -0,0 +1,114 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/packet"
+	"github.com/stretchr/testify/require"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+type testTracer struct {
+	statements []TraceStatement
+	ctxs       []context.Context
+	results    []*mysql.Result
+	errs       []error
+}
+
+func (t *testTracer) StartStatement(ctx context.Context, s TraceStatement) TraceSpan {
+	t.statements = append(t.statements, s)
+	t.ctxs = append(t.ctxs, ctx)
+	return t
+}
+
+func (t *testTracer) TraceParent() string {
+	return testTraceParent
+}
+
+func (t *testTracer) End(r *mysql.Result, err error) {
+	t.results = append(t.results, r)
+	t.errs = append(t.errs, err)
+}
+
+type traceCtxKey struct{}
+
+func TestTracer(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	queries := make(chan []byte, 2)
+	serverPC := packet.NewConn(serverConn)
+	go func() {
+		for range 2 {
+			serverPC.ResetSequence()
+			pkt, err := serverPC.ReadPacket()
+			require.NoError(t, err)
+			queries <- pkt
+			// 2 affected rows
+			require.NoError(t, writeServerPacket(serverPC, []byte{mysql.OK_HEADER, 2, 0, 0x02, 0x00, 0, 0}))
+		}
+	}()
+
+	tracer := &testTracer{}
+	c := &Conn{
+		Conn:         packet.NewConn(clientConn),
+		capability:   mysql.CLIENT_PROTOCOL_41 | mysql.CLIENT_QUERY_ATTRIBUTES,
+		connectionID: 7,
+		includeLine:  -1,
+	}
+	c.SetTracer(tracer)
+	c.RedactStatements(true)
+	ctx := context.WithValue(context.Background(), traceCtxKey{}, "parent")
+	c.SetTraceContext(ctx)
+
+	r, err := c.Execute("UPDATE t SET a = 'x' WHERE id IN (1, 2)")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), r.AffectedRows)
+
+	q := <-queries
+	require.Equal(t, mysql.COM_QUERY, q[0])
+	require.Equal(t, byte(1), q[1], "one query attribute")
+	require.True(t, bytes.Contains(q, []byte(TraceParentAttribute)))
+	require.True(t, bytes.Contains(q, []byte(testTraceParent)))
+
+	require.Equal(t, []TraceStatement{{
+		System:       "mysql",
+		Operation:    "query",
+		Statement:    "UPDATE t SET a = ? WHERE id IN (?, ?)",
+		ConnectionID: 7,
+	}}, tracer.statements)
+	require.Equal(t, "parent", tracer.ctxs[0].Value(traceCtxKey{}))
+	require.Equal(t, []*mysql.Result{r}, tracer.results)
+	require.Equal(t, []error{nil}, tracer.errs)
+
+	// the attribute is only sent with the traced statement
+	c.SetTracer(nil)
+	_, err = c.Execute("COMMIT")
+	require.NoError(t, err)
+	q = <-queries
+	require.Equal(t, byte(0), q[1], "no query attribute")
+	require.Len(t, tracer.statements, 1)
+}
+
+func TestRedactStatement(t *testing.T) {
+	tests := []struct {
+		query    string
+		redacted string
+	}{
+		{"SELECT 1", "SELECT ?"},
+		{"SELECT * FROM t1 WHERE id = 10 AND name = 'a''b'", "SELECT * FROM t1 WHERE id = ? AND name = ?"},
+		{`INSERT INTO t VALUES ("x\"y", -1.5e3, 0x1F)`, "INSERT INTO t VALUES (?, -?, ?)"},
+		{"SELECT `col 1`, c2 FROM `db`.`t2` LIMIT 5", "SELECT `col 1`, c2 FROM `db`.`t2` LIMIT ?"},
+		{"SELECT ?, 'unterminated", "SELECT ?, ?"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.redacted, RedactStatement(test.query), test.query)
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"os"
+	"strings"
 
 	"github.com/go-mysql-org/go-mysql/replication"
 )
@@ -11,6 +13,11 @@ var (
 	name   = flag.String("name", "", "binlog file name")
 	offset = flag.Int64("offset", 0, "parse start offset")
 	verify = flag.Bool("verify", false, "verify checksum")
+	format = flag.String("format", "plain", "output format: plain, or json for one JSON object per event (NDJSON)")
+
+	keyFile   = flag.String("keyfile", "", "key file of the MariaDB file_key_management plugin to read encrypted binlog files")
+	fileKey   = flag.String("filekey", "", "key to decrypt the key file, read from a file if it starts with FILE:")
+	algorithm = flag.String("encryption-algorithm", "aes_cbc", "encryption algorithm of the binlog files, aes_cbc or aes_ctr")
 )
 
 func main() {
@@ -19,10 +26,41 @@ func main() {
 	p := replication.NewBinlogParser()
 	p.SetVerifyChecksum(*verify)
 
+	if *keyFile != "" {
+		alg := replication.ENCRYPTION_ALGORITHM_AES_CBC
+		switch strings.ToLower(*algorithm) {
+		case "aes_cbc":
+		case "aes_ctr":
+			alg = replication.ENCRYPTION_ALGORITHM_AES_CTR
+		default:
+			println("invalid encryption algorithm " + *algorithm)
+			os.Exit(1)
+		}
+
+		provider, err := replication.NewFileKeyProvider(*keyFile, *fileKey, alg)
+		if err != nil {
+			println(err.Error())
+			os.Exit(1)
+		}
+		p.SetEncryptionKeyProvider(provider)
+	}
+
 	f := func(e *replication.BinlogEvent) error {
 		e.Dump(os.Stdout)
 		return nil
 	}
+	switch *format {
+	case "plain":
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		f = func(e *replication.BinlogEvent) error {
+			return enc.Encode(e)
+		}
+	default:
+		println("unsupported format " + *format)
+		os.Exit(1)
+	}
 
 	err := p.ParseFile(*name, *offset, f)
 	if err != nil {
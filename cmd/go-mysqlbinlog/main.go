@@ -5,15 +5,23 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/pingcap/errors"
 
+	"github.com/go-mysql-org/go-mysql/binlogsql"
+	"github.com/go-mysql-org/go-mysql/client"
 	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/schema"
 )
 
 var (
@@ -28,12 +36,19 @@ var (
 	pos  = flag.Int("pos", 4, "Binlog position")
 	gtid = flag.String("gtid", "", "Binlog GTID set that this slave has executed")
 
+	stopFile         = flag.String("stop_file", "", "Binlog filename of stop_pos")
+	stopPos          = flag.Int("stop_pos", 4, "Stop before the first transaction at or after this position in stop_file")
+	stopGTID         = flag.String("stop_gtid", "", "Stop after the executed GTID set contains this GTID set")
+	stopDatetime     = flag.String("stop_datetime", "", "Stop before the first transaction committed at or after this local time, e.g. 2006-01-02 15:04:05")
+	stopTransactions = flag.Int("stop_transactions", 0, "Stop after this number of transactions")
+
 	semiSync   = flag.Bool("semisync", false, "Support semi sync")
 	backupPath = flag.String("backup_path", "", "backup path to store binlog files")
 
-	rawMode = flag.Bool("raw", false, "Use raw mode")
-	format  = flag.String("format", "plain", "log format")
-	verbose = flag.Bool("verbose", false, "verbose logging")
+	rawMode   = flag.Bool("raw", false, "Use raw mode")
+	format    = flag.String("format", "plain", "output format: plain, json for one JSON object per event (NDJSON), or sql to print the row events as SQL statements")
+	flashback = flag.Bool("flashback", false, "Print the SQL statements undoing the row events in reverse order, implies -format sql, requires a stop condition")
+	verbose   = flag.Bool("verbose", false, "verbose logging")
 )
 
 func main() {
@@ -57,9 +72,17 @@ func main() {
 		AddSource: *verbose,
 	}
 
+	if *flashback {
+		*format = "sql"
+	}
+
 	switch *format {
+	case "sql":
+		// stdout is for the statements
+		cfg.Logger = slog.New(slog.NewTextHandler(os.Stderr, logOpts))
 	case "json":
-		cfg.Logger = slog.New(slog.NewJSONHandler(os.Stdout, logOpts))
+		// stdout is for the events
+		cfg.Logger = slog.New(slog.NewJSONHandler(os.Stderr, logOpts))
 	case "plain":
 		cfg.Logger = slog.New(slog.NewTextHandler(os.Stdout, logOpts))
 	default:
@@ -72,6 +95,36 @@ func main() {
 		return
 	}
 
+	if len(*stopFile) > 0 {
+		cfg.StopCondition.Position = mysql.Position{Name: *stopFile, Pos: uint32(*stopPos)}
+	}
+	if len(*stopGTID) > 0 {
+		cfg.StopCondition.GTIDSet, err = mysql.ParseGTIDSet(*flavor, *stopGTID)
+		if err != nil {
+			fmt.Printf("Failed to parse stop gtid %s with flavor %s, error: %v\n",
+				*stopGTID, *flavor, errors.ErrorStack(err))
+			return
+		}
+	}
+	if len(*stopDatetime) > 0 {
+		cfg.StopCondition.Time, err = time.ParseInLocation(time.DateTime, *stopDatetime, time.Local)
+		if err != nil {
+			fmt.Printf("Failed to parse stop datetime %s, error: %v\n", *stopDatetime, err)
+			return
+		}
+	}
+	cfg.StopCondition.Transactions = *stopTransactions
+	if *flashback && len(*stopFile) == 0 && len(*stopGTID) == 0 && len(*stopDatetime) == 0 && *stopTransactions <= 0 {
+		fmt.Println("Flashback requires a stop condition")
+		return
+	}
+
+	var printer *sqlPrinter
+	if *format == "sql" {
+		printer = newSQLPrinter(os.Stdout, *flashback)
+		defer printer.close()
+	}
+
 	b := replication.NewBinlogSyncer(cfg)
 
 	pos := mysql.Position{Name: *file, Pos: uint32(*pos)}
@@ -108,17 +161,198 @@ func main() {
 
 		for {
 			e, err := s.GetEvent(context.Background())
+			if err == io.EOF {
+				// the stop condition is met
+				if printer != nil {
+					printer.flush()
+				}
+				return
+			}
+			if err != nil && printer != nil {
+				fmt.Fprintf(os.Stderr, "Get event error: %v\n", errors.ErrorStack(err))
+				return
+			}
 			if err != nil {
 				// Try to output all left events
 				events := s.DumpEvents()
 				for _, e := range events {
-					e.Dump(os.Stdout)
+					dump(e)
 				}
 				fmt.Printf("Get event error: %v\n", errors.ErrorStack(err))
 				return
 			}
 
-			e.Dump(os.Stdout)
+			if printer != nil {
+				if err = printer.add(e); err != nil {
+					fmt.Fprintf(os.Stderr, "Render SQL error: %v\n", errors.ErrorStack(err))
+					return
+				}
+				continue
+			}
+			dump(e)
 		}
 	}
 }
+
+var jsonEncoder = newJSONEncoder()
+
+func newJSONEncoder() *json.Encoder {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	return enc
+}
+
+// dump prints the event in the -format.
+func dump(e *replication.BinlogEvent) {
+	if *format != "json" {
+		e.Dump(os.Stdout)
+		return
+	}
+	if err := jsonEncoder.Encode(e); err != nil {
+		fmt.Fprintf(os.Stderr, "Encode event error: %v\n", err)
+	}
+}
+
+// sqlPrinter prints the transactions of the row events as SQL statements, see binlogsql.
+// In flashback mode, the transactions are printed in reverse order by flush.
+type sqlPrinter struct {
+	w         io.Writer
+	flashback bool
+	r         *binlogsql.Renderer
+
+	// txn is the events of the current transaction, inTxn is true after its BEGIN
+	txn   []*replication.BinlogEvent
+	inTxn bool
+	// undo is the transactions to print by flush in flashback mode
+	undo []string
+
+	// conn and tables get the tables of the TableMapEvents without the column names
+	conn   *client.Conn
+	tables map[string]*schema.Table
+}
+
+func newSQLPrinter(w io.Writer, flashback bool) *sqlPrinter {
+	p := &sqlPrinter{
+		w:         w,
+		flashback: flashback,
+		tables:    make(map[string]*schema.Table),
+	}
+	p.r = binlogsql.NewRenderer(binlogsql.Config{
+		Flashback: flashback,
+		GetTable:  p.getTable,
+	})
+	return p
+}
+
+func (p *sqlPrinter) add(e *replication.BinlogEvent) error {
+	switch ev := e.Event.(type) {
+	case *replication.QueryEvent:
+		query := strings.TrimSpace(string(ev.Query))
+		switch {
+		case strings.EqualFold(query, "BEGIN"):
+			p.txn = p.txn[:0]
+			p.inTxn = true
+		case strings.EqualFold(query, "COMMIT"):
+			return p.commit()
+		case strings.EqualFold(query, "ROLLBACK"):
+			p.txn = p.txn[:0]
+			p.inTxn = false
+		case p.inTxn:
+			// a statement in a transaction with row events, e.g. SAVEPOINT
+		default:
+			p.ddl(ev, query)
+		}
+	case *replication.RowsEvent:
+		p.txn = append(p.txn, e)
+	case *replication.TransactionPayloadEvent:
+		// the payload has the whole transaction
+		p.txn = append(p.txn, e)
+		return p.commit()
+	case *replication.XIDEvent, *replication.XAPrepareEvent:
+		return p.commit()
+	}
+	return nil
+}
+
+func (p *sqlPrinter) commit() error {
+	stmts, err := p.r.RenderTransaction(p.txn)
+	p.txn = p.txn[:0]
+	p.inTxn = false
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(stmts) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("BEGIN;\n")
+	for _, stmt := range stmts {
+		b.WriteString(stmt)
+		b.WriteString(";\n")
+	}
+	b.WriteString("COMMIT;\n")
+	p.print(b.String())
+	return nil
+}
+
+// ddl prints a statement out of a transaction, it can't be undone in flashback mode.
+func (p *sqlPrinter) ddl(ev *replication.QueryEvent, query string) {
+	// the table definitions may have changed
+	clear(p.tables)
+
+	if p.flashback {
+		p.print("-- skipped: " + strings.ReplaceAll(query, "\n", " ") + "\n")
+		return
+	}
+	var b strings.Builder
+	if len(ev.Schema) > 0 {
+		b.WriteString("USE `" + strings.ReplaceAll(string(ev.Schema), "`", "``") + "`;\n")
+	}
+	b.WriteString(query)
+	b.WriteString(";\n")
+	p.print(b.String())
+}
+
+func (p *sqlPrinter) print(s string) {
+	if p.flashback {
+		p.undo = append(p.undo, s)
+		return
+	}
+	_, _ = io.WriteString(p.w, s)
+}
+
+// flush prints the transactions of the flashback mode in reverse order.
+func (p *sqlPrinter) flush() {
+	for _, s := range slices.Backward(p.undo) {
+		_, _ = io.WriteString(p.w, s)
+	}
+	p.undo = nil
+}
+
+func (p *sqlPrinter) getTable(db string, table string) (*schema.Table, error) {
+	key := db + "." + table
+	if t, ok := p.tables[key]; ok {
+		return t, nil
+	}
+
+	if p.conn == nil {
+		conn, err := client.Connect(fmt.Sprintf("%s:%d", *host, *port), *user, *password, "")
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		p.conn = conn
+	}
+	t, err := schema.NewTable(p.conn, db, table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	p.tables[key] = t
+	return t, nil
+}
+
+func (p *sqlPrinter) close() {
+	if p.conn != nil {
+		_ = p.conn.Close()
+	}
+}
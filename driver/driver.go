@@ -259,7 +259,7 @@ func (ci Connector) Connect(ctx context.Context) (sqldriver.Conn, error) {
 	// false for IsValid() signaling the connection is bad and should be discarded.
 	return &Conn{
 		Conn:  c,
-		state: &state{contexts: contexts, valid: true, useStdLibErrors: retries},
+		state: &state{conn: c, contexts: contexts, valid: true, useStdLibErrors: retries},
 	}, nil
 }
 
@@ -274,6 +274,7 @@ func (ci Connector) Driver() sqldriver.Driver {
 type CheckNamedValueFunc func(*sqldriver.NamedValue) error
 
 type state struct {
+	conn     *client.Conn
 	contexts chan context.Context
 	valid    bool
 	// when true, the driver connection will return ErrBadConn from the golang Standard Library
@@ -282,8 +283,11 @@ type state struct {
 
 func (s *state) watchCtx(ctx context.Context) func() {
 	s.contexts <- ctx
+	// the context carries the parent span of the statements
+	s.conn.SetTraceContext(ctx)
 	return func() {
 		s.contexts <- context.Background()
+		s.conn.SetTraceContext(nil)
 	}
 }
 
@@ -360,7 +364,7 @@ func (c *Conn) Begin() (sqldriver.Tx, error) {
 		return nil, errors.Trace(err)
 	}
 
-	return &tx{c.Conn}, nil
+	return &tx{Conn: c.Conn}, nil
 }
 
 var isolationLevelTransactionIsolation = map[sql.IsolationLevel]string{
@@ -383,7 +387,7 @@ func (c *Conn) BeginTx(ctx context.Context, opts sqldriver.TxOptions) (sqldriver
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	return &tx{c.Conn}, nil
+	return &tx{Conn: c.Conn, ctx: ctx}, nil
 }
 
 func buildArgs(args []sqldriver.Value) []any {
@@ -516,13 +520,19 @@ func (s *stmt) QueryContext(ctx context.Context, args []sqldriver.NamedValue) (s
 
 type tx struct {
 	*client.Conn
+	// ctx is the context of BeginTx, for the spans of Commit and Rollback
+	ctx context.Context
 }
 
 func (t *tx) Commit() error {
+	t.Conn.SetTraceContext(t.ctx)
+	defer t.Conn.SetTraceContext(nil)
 	return t.Conn.Commit()
 }
 
 func (t *tx) Rollback() error {
+	t.Conn.SetTraceContext(t.ctx)
+	defer t.Conn.SetTraceContext(nil)
 	return t.Conn.Rollback()
 }
 
@@ -121,3 +121,41 @@ func (s *schemaTestSuite) TestParse() {
 	err = Parse(&buf, new(testParseHandler), true)
 	require.NoError(s.T(), err)
 }
+
+type snapshotTestHandler struct {
+	testParseHandler
+	name string
+	rows map[string][][]any
+}
+
+func (h *snapshotTestHandler) BinLog(name string, pos uint64) error {
+	h.name = name
+	return nil
+}
+
+func (h *snapshotTestHandler) Row(schema string, table string, values []any) error {
+	h.rows[schema+"."+table] = append(h.rows[schema+"."+table], values)
+	return nil
+}
+
+func (s *schemaTestSuite) TestSnapshotDumpAndParse() {
+	addr := fmt.Sprintf("%s:%s", *test_util.MysqlHost, *test_util.MysqlPort)
+	d := NewSnapshotDumper(addr, "root", "")
+	d.SetChunkSize(3)
+	d.AddDatabases("test1", "test2")
+	d.AddIgnoreTables("test1", "t2")
+
+	h := &snapshotTestHandler{rows: make(map[string][][]any)}
+	err := d.DumpAndParse(h)
+	require.NoError(s.T(), err)
+	require.NotEmpty(s.T(), h.name)
+
+	require.Len(s.T(), h.rows, 3)
+	require.Equal(s.T(), [][]any{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "\\"}, {int64(4), "''"}}, h.rows["test1.t1"])
+
+	// mysqldump style values for a ParseHandler
+	d.Reset()
+	d.AddTables("test1", "t1")
+	err = d.DumpAndParse(new(testParseHandler))
+	require.NoError(s.T(), err)
+}
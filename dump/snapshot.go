@@ -0,0 +1,544 @@
+package dump
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// RowParseHandler is a ParseHandler which receives the typed rows of SnapshotDumper
+// instead of the mysqldump style values.
+//
+// The values are nil, int64, uint64, float64, string or []byte for binary strings.
+// DECIMAL, date and time values are strings.
+type RowParseHandler interface {
+	ParseHandler
+	Row(schema string, table string, values []any) error
+}
+
+// SnapshotDumper dumps the tables like Dumper without the mysqldump binary.
+// It reads all the tables in one consistent snapshot transaction, table by table
+// in chunks of primary key ranges.
+type SnapshotDumper struct {
+	Addr     string
+	User     string
+	Password string
+
+	// Connect opens the connection for the snapshot, it connects to Addr if nil.
+	Connect func() (*client.Conn, error)
+
+	// Will override Databases
+	Tables  []string
+	TableDB string
+
+	Databases []string
+
+	Where   string
+	Charset string
+
+	IgnoreTables map[string][]string
+
+	// ChunkSize is the number of rows read per query, tables without a primary key
+	// are read in one query.
+	ChunkSize int
+
+	masterDataSkipped bool
+
+	Logger *slog.Logger
+}
+
+func NewSnapshotDumper(addr string, user string, password string) *SnapshotDumper {
+	d := new(SnapshotDumper)
+	d.Addr = addr
+	d.User = user
+	d.Password = password
+	d.Tables = make([]string, 0, 16)
+	d.Databases = make([]string, 0, 16)
+	d.Charset = mysql.DEFAULT_CHARSET
+	d.IgnoreTables = make(map[string][]string)
+	d.ChunkSize = 1000
+	d.Logger = slog.Default()
+
+	return d
+}
+
+func (d *SnapshotDumper) SetCharset(charset string) {
+	d.Charset = charset
+}
+
+func (d *SnapshotDumper) SetWhere(where string) {
+	d.Where = where
+}
+
+func (d *SnapshotDumper) SetChunkSize(size int) {
+	d.ChunkSize = size
+}
+
+// SkipMasterData: In some cloud MySQL, we have no privilege to use `FLUSH TABLES WITH READ LOCK`.
+// The binlog position is not reported to the handler then.
+func (d *SnapshotDumper) SkipMasterData(v bool) {
+	d.masterDataSkipped = v
+}
+
+func (d *SnapshotDumper) AddDatabases(dbs ...string) {
+	d.Databases = append(d.Databases, dbs...)
+}
+
+func (d *SnapshotDumper) AddTables(db string, tables ...string) {
+	if d.TableDB != db {
+		d.TableDB = db
+		d.Tables = d.Tables[0:0]
+	}
+
+	d.Tables = append(d.Tables, tables...)
+}
+
+func (d *SnapshotDumper) AddIgnoreTables(db string, tables ...string) {
+	t := d.IgnoreTables[db]
+	t = append(t, tables...)
+	d.IgnoreTables[db] = t
+}
+
+func (d *SnapshotDumper) Reset() {
+	d.Tables = d.Tables[0:0]
+	d.TableDB = ""
+	d.IgnoreTables = make(map[string][]string)
+	d.Databases = d.Databases[0:0]
+	d.Where = ""
+}
+
+// DumpAndParse reads the snapshot and passes it to h. The binlog position and
+// GTID set of the snapshot are passed before any row. If h is a RowParseHandler
+// the rows are passed to Row, otherwise to Data as mysqldump style values.
+func (d *SnapshotDumper) DumpAndParse(h ParseHandler) error {
+	conn, err := d.connect()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer conn.Close()
+
+	if err = d.startSnapshot(conn, h); err != nil {
+		return errors.Trace(err)
+	}
+
+	tables, err := d.listTables(conn)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, t := range tables {
+		d.Logger.Info("dump table", slog.String("schema", t[0]), slog.String("table", t[1]))
+		if err = d.dumpTable(conn, h, t[0], t[1]); err != nil {
+			return errors.Annotatef(err, "dump table %s.%s", t[0], t[1])
+		}
+	}
+
+	_, err = conn.Execute("COMMIT")
+	return errors.Trace(err)
+}
+
+func (d *SnapshotDumper) connect() (*client.Conn, error) {
+	var conn *client.Conn
+	var err error
+	if d.Connect != nil {
+		conn, err = d.Connect()
+	} else {
+		conn, err = client.Connect(d.Addr, d.User, d.Password, "")
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if len(d.Charset) != 0 {
+		if err = conn.SetCharset(d.Charset); err != nil {
+			conn.Close()
+			return nil, errors.Trace(err)
+		}
+	}
+
+	return conn, nil
+}
+
+// startSnapshot starts the consistent snapshot transaction and passes its binlog position to h.
+func (d *SnapshotDumper) startSnapshot(conn *client.Conn, h ParseHandler) error {
+	if _, err := conn.Execute("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+		return errors.Trace(err)
+	}
+
+	isMariaDB := strings.Contains(conn.GetServerVersion(), "MariaDB")
+
+	// MariaDB reports the binlog position of the snapshot without a lock
+	locked := !d.masterDataSkipped && !isMariaDB
+	if locked {
+		if _, err := conn.Execute("FLUSH TABLES WITH READ LOCK"); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if _, err := conn.Execute("START TRANSACTION WITH CONSISTENT SNAPSHOT"); err != nil {
+		return errors.Trace(err)
+	}
+
+	if !d.masterDataSkipped {
+		var err error
+		if isMariaDB {
+			err = d.readMariaDBSnapshotPos(conn, h)
+		} else {
+			err = d.readMySQLSnapshotPos(conn, h)
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if locked {
+		if _, err := conn.Execute("UNLOCK TABLES"); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
+func (d *SnapshotDumper) readMySQLSnapshotPos(conn *client.Conn, h ParseHandler) error {
+	query := "SHOW MASTER STATUS"
+	if eq, err := mysql.CompareServerVersions(conn.GetServerVersion(), "8.4.0"); err == nil && eq >= 0 {
+		query = "SHOW BINARY LOG STATUS"
+	}
+
+	r, err := conn.Execute(query)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if r.RowNumber() == 0 {
+		return errors.Errorf("%s returns no rows, binary log may be disabled", query)
+	}
+
+	name, _ := r.GetString(0, 0)
+	pos, _ := r.GetUint(0, 1)
+	gset, _ := r.GetStringByName(0, "Executed_Gtid_Set")
+
+	// like mysqldump, GTID set comes before binlog file-position
+	if gset = strings.ReplaceAll(gset, "\n", ""); gset != "" {
+		if err = h.GtidSet(gset); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return errors.Trace(h.BinLog(name, pos))
+}
+
+func (d *SnapshotDumper) readMariaDBSnapshotPos(conn *client.Conn, h ParseHandler) error {
+	r, err := conn.Execute("SHOW STATUS LIKE 'binlog_snapshot_%'")
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	var name string
+	var pos uint64
+	for i := range r.RowNumber() {
+		key, _ := r.GetString(i, 0)
+		value, _ := r.GetString(i, 1)
+		switch key {
+		case "Binlog_snapshot_file":
+			name = value
+		case "Binlog_snapshot_position":
+			if pos, err = strconv.ParseUint(value, 10, 64); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	if name == "" {
+		return errors.New("binlog snapshot position is empty, binary log may be disabled")
+	}
+
+	return errors.Trace(h.BinLog(name, pos))
+}
+
+// listTables returns the schema and name of the base tables to dump.
+func (d *SnapshotDumper) listTables(conn *client.Conn) ([][2]string, error) {
+	var tables [][2]string
+	if len(d.Tables) > 0 {
+		for _, table := range d.Tables {
+			tables = append(tables, [2]string{d.TableDB, table})
+		}
+		return tables, nil
+	}
+
+	dbs := d.Databases
+	if len(dbs) == 0 {
+		r, err := conn.Execute("SHOW DATABASES")
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for i := range r.RowNumber() {
+			db, _ := r.GetString(i, 0)
+			// the same system schemas mysqldump --all-databases skips
+			switch strings.ToLower(db) {
+			case "information_schema", "performance_schema", "sys":
+				continue
+			}
+			dbs = append(dbs, db)
+		}
+	}
+
+	for _, db := range dbs {
+		r, err := conn.Execute(fmt.Sprintf("SHOW FULL TABLES FROM %s WHERE Table_type = 'BASE TABLE'", quoteIdentifier(db)))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for i := range r.RowNumber() {
+			table, _ := r.GetString(i, 0)
+			if slices.Contains(d.IgnoreTables[db], table) {
+				continue
+			}
+			tables = append(tables, [2]string{db, table})
+		}
+	}
+
+	return tables, nil
+}
+
+func (d *SnapshotDumper) dumpTable(conn *client.Conn, h ParseHandler, db string, table string) error {
+	r, err := NewTableChunkReader(conn, db, table, d.Where, d.ChunkSize)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer r.Close()
+
+	rowHandler, _ := h.(RowParseHandler)
+
+	perRow := func(fields []*mysql.Field, row []mysql.FieldValue) error {
+		var err error
+		if rowHandler != nil {
+			err = rowHandler.Row(db, table, rowToAny(fields, row))
+		} else {
+			values := make([]string, len(row))
+			for i := range row {
+				values[i] = fieldValueToLiteral(fields[i], row[i])
+			}
+			err = h.Data(db, table, values)
+		}
+		if err != nil && err != ErrSkip {
+			return errors.Trace(err)
+		}
+		return nil
+	}
+
+	for {
+		more, err := r.readChunk(perRow)
+		if err != nil || !more {
+			return errors.Trace(err)
+		}
+	}
+}
+
+// TableChunkReader reads a table in chunks ordered by the primary key, each chunk
+// starts after the primary key of the last row of the previous one.
+// A table without a primary key is read in one chunk.
+type TableChunkReader struct {
+	Table *schema.Table
+
+	chunkSize int
+	first     *client.Stmt
+	after     *client.Stmt
+
+	lastKey []any
+	done    bool
+}
+
+// NewTableChunkReader prepares the chunk queries of db.table on conn, where filters the rows
+// if not empty. conn can not be used for other queries while a chunk is read.
+func NewTableChunkReader(conn *client.Conn, db string, table string, where string, chunkSize int) (*TableChunkReader, error) {
+	ta, err := schema.NewTable(conn, db, table)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	pkNames := make([]string, 0, len(ta.PKColumns))
+	for _, i := range ta.PKColumns {
+		pkNames = append(pkNames, ta.Columns[i].Name)
+	}
+
+	if len(pkNames) == 0 || chunkSize <= 0 {
+		chunkSize = 0
+	}
+
+	r := &TableChunkReader{Table: ta, chunkSize: chunkSize}
+	if r.first, err = conn.Prepare(buildChunkQuery(db, table, where, pkNames, chunkSize, false)); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if chunkSize > 0 {
+		if r.after, err = conn.Prepare(buildChunkQuery(db, table, where, pkNames, chunkSize, true)); err != nil {
+			r.first.Close()
+			return nil, errors.Trace(err)
+		}
+	}
+
+	return r, nil
+}
+
+// Next reads the next chunk and passes its rows to fn, the values are typed like
+// RowParseHandler.Row. It returns false if there are no more chunks.
+func (r *TableChunkReader) Next(fn func(values []any) error) (bool, error) {
+	return r.readChunk(func(fields []*mysql.Field, row []mysql.FieldValue) error {
+		return fn(rowToAny(fields, row))
+	})
+}
+
+func (r *TableChunkReader) readChunk(fn func(fields []*mysql.Field, row []mysql.FieldValue) error) (bool, error) {
+	if r.done {
+		return false, nil
+	}
+
+	var fields []*mysql.Field
+	lastKey := make([]any, len(r.Table.PKColumns))
+	rows := 0
+	perResult := func(result *mysql.Result) error {
+		fields = result.Fields
+		return nil
+	}
+	perRow := func(row []mysql.FieldValue) error {
+		rows++
+		if r.chunkSize > 0 {
+			for i, pk := range r.Table.PKColumns {
+				lastKey[i] = fieldValueToAny(fields[pk], row[pk])
+			}
+		}
+		return fn(fields, row)
+	}
+
+	stmt := r.first
+	if r.lastKey != nil {
+		stmt = r.after
+	}
+	var result mysql.Result
+	if err := stmt.ExecuteSelectStreaming(&result, perRow, perResult, r.lastKey...); err != nil {
+		return false, errors.Trace(err)
+	}
+
+	if r.chunkSize == 0 || rows < r.chunkSize {
+		r.done = true
+		return false, nil
+	}
+	r.lastKey = lastKey
+
+	return true, nil
+}
+
+func (r *TableChunkReader) Close() error {
+	err := r.first.Close()
+	if r.after != nil {
+		if nerr := r.after.Close(); err == nil {
+			err = nerr
+		}
+	}
+	return errors.Trace(err)
+}
+
+// buildChunkQuery builds the query of a chunk, after is true if it reads the rows
+// after the primary key given as the parameters.
+func buildChunkQuery(db string, table string, where string, pkNames []string, chunkSize int, after bool) string {
+	var conds []string
+	if where != "" {
+		conds = append(conds, "("+where+")")
+	}
+
+	quoted := make([]string, len(pkNames))
+	for i, name := range pkNames {
+		quoted[i] = quoteIdentifier(name)
+	}
+
+	if after {
+		params := strings.TrimSuffix(strings.Repeat("?, ", len(pkNames)), ", ")
+		conds = append(conds, fmt.Sprintf("(%s) > (%s)", strings.Join(quoted, ", "), params))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "SELECT * FROM %s.%s", quoteIdentifier(db), quoteIdentifier(table))
+	if len(conds) > 0 {
+		b.WriteString(" WHERE ")
+		b.WriteString(strings.Join(conds, " AND "))
+	}
+	if chunkSize > 0 {
+		fmt.Fprintf(&b, " ORDER BY %s LIMIT %d", strings.Join(quoted, ", "), chunkSize)
+	}
+
+	return b.String()
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// isBinaryString returns true for the binary string columns, which mysqldump dumps
+// as hex with --hex-blob.
+func isBinaryString(f *mysql.Field) bool {
+	switch f.Type {
+	case mysql.MYSQL_TYPE_BIT:
+		return true
+	case mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_VAR_STRING, mysql.MYSQL_TYPE_VARCHAR,
+		mysql.MYSQL_TYPE_TINY_BLOB, mysql.MYSQL_TYPE_MEDIUM_BLOB, mysql.MYSQL_TYPE_LONG_BLOB, mysql.MYSQL_TYPE_BLOB:
+		return f.Charset == 63 // binary
+	default:
+		return false
+	}
+}
+
+// fieldValueToAny converts a value of the binary protocol, strings are copied
+// because the buffer is reused by the next row.
+func fieldValueToAny(f *mysql.Field, v mysql.FieldValue) any {
+	switch v.Type {
+	case mysql.FieldValueTypeNull:
+		return nil
+	case mysql.FieldValueTypeUnsigned:
+		return v.AsUint64()
+	case mysql.FieldValueTypeSigned:
+		return v.AsInt64()
+	case mysql.FieldValueTypeFloat:
+		return v.AsFloat64()
+	default:
+		if isBinaryString(f) {
+			return slices.Clone(v.AsString())
+		}
+		return string(v.AsString())
+	}
+}
+
+func rowToAny(fields []*mysql.Field, row []mysql.FieldValue) []any {
+	values := make([]any, len(row))
+	for i := range row {
+		values[i] = fieldValueToAny(fields[i], row[i])
+	}
+	return values
+}
+
+// fieldValueToLiteral converts a value of the binary protocol to the value Parse
+// passes to ParseHandler.Data for mysqldump --hex-blob output.
+func fieldValueToLiteral(f *mysql.Field, v mysql.FieldValue) string {
+	switch v.Type {
+	case mysql.FieldValueTypeNull:
+		return "NULL"
+	case mysql.FieldValueTypeUnsigned, mysql.FieldValueTypeSigned, mysql.FieldValueTypeFloat:
+		return v.String()
+	default:
+		s := v.AsString()
+		switch {
+		case f.Type == mysql.MYSQL_TYPE_DECIMAL || f.Type == mysql.MYSQL_TYPE_NEWDECIMAL:
+			return string(s)
+		case isBinaryString(f) && len(s) > 0:
+			return "0x" + strings.ToUpper(hex.EncodeToString(s))
+		default:
+			return "'" + string(s) + "'"
+		}
+	}
+}
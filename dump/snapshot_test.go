@@ -0,0 +1,41 @@
+package dump
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestBuildChunkQuery(t *testing.T) {
+	require.Equal(t, "SELECT * FROM `db`.`t` ORDER BY `id` LIMIT 10",
+		buildChunkQuery("db", "t", "", []string{"id"}, 10, false))
+	require.Equal(t, "SELECT * FROM `db`.`t` WHERE (id > 5) AND (`a`, `b``c`) > (?, ?) ORDER BY `a`, `b``c` LIMIT 10",
+		buildChunkQuery("db", "t", "id > 5", []string{"a", "b`c"}, 10, true))
+	require.Equal(t, "SELECT * FROM `db`.`t`",
+		buildChunkQuery("db", "t", "", nil, 0, false))
+}
+
+func TestFieldValueConversion(t *testing.T) {
+	tbl := []struct {
+		field   mysql.Field
+		value   mysql.FieldValue
+		typed   any
+		literal string
+	}{
+		{mysql.Field{Type: mysql.MYSQL_TYPE_LONG}, mysql.NewFieldValue(mysql.FieldValueTypeNull, 0, nil), nil, "NULL"},
+		{mysql.Field{Type: mysql.MYSQL_TYPE_LONG}, mysql.NewFieldValue(mysql.FieldValueTypeSigned, uint64(1<<64-5), nil), int64(-5), "-5"},
+		{mysql.Field{Type: mysql.MYSQL_TYPE_LONGLONG}, mysql.NewFieldValue(mysql.FieldValueTypeUnsigned, 7, nil), uint64(7), "7"},
+		{mysql.Field{Type: mysql.MYSQL_TYPE_NEWDECIMAL, Charset: 63}, mysql.NewFieldValue(mysql.FieldValueTypeString, 0, []byte("1.50")), "1.50", "1.50"},
+		{mysql.Field{Type: mysql.MYSQL_TYPE_VAR_STRING, Charset: 33}, mysql.NewFieldValue(mysql.FieldValueTypeString, 0, []byte("it's")), "it's", "'it's'"},
+		{mysql.Field{Type: mysql.MYSQL_TYPE_BLOB, Charset: 63}, mysql.NewFieldValue(mysql.FieldValueTypeString, 0, []byte{0xab, 0x01}), []byte{0xab, 0x01}, "0xAB01"},
+		{mysql.Field{Type: mysql.MYSQL_TYPE_BLOB, Charset: 63}, mysql.NewFieldValue(mysql.FieldValueTypeString, 0, []byte{}), []byte{}, "''"},
+		{mysql.Field{Type: mysql.MYSQL_TYPE_DATETIME, Charset: 63}, mysql.NewFieldValue(mysql.FieldValueTypeString, 0, []byte("2024-01-02 03:04:05")), "2024-01-02 03:04:05", "'2024-01-02 03:04:05'"},
+	}
+
+	for _, v := range tbl {
+		require.Equal(t, v.typed, fieldValueToAny(&v.field, v.value))
+		require.Equal(t, v.literal, fieldValueToLiteral(&v.field, v.value))
+	}
+}
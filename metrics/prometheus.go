@@ -0,0 +1,282 @@
+// Package metrics collects the measurements of replication.BinlogSyncer and canal.Canal.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// parseBuckets are the upper bounds in seconds of the event parse time histogram, from
+// 1µs to 1s.
+var parseBuckets = []float64{1e-6, 4e-6, 16e-6, 64e-6, 256e-6, 1e-3, 4e-3, 16e-3, 64e-3, 256e-3, 1}
+
+// handlerBuckets are the upper bounds in seconds of the handler time histogram, the
+// default buckets of the Prometheus client.
+var handlerBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusCollector implements replication.Metrics and canal.Metrics, and serves the
+// metrics over HTTP in the Prometheus text exposition format, so it doesn't depend on a
+// Prometheus client:
+//
+//	c := metrics.NewPrometheusCollector("binlog")
+//	cfg.Metrics = c
+//	http.Handle("/metrics", c)
+//
+// The metrics are, with the namespace as the prefix:
+//
+//	events_total{type}                  counter of the events received by type
+//	event_bytes_total{type}             counter of the raw size of the events received by type
+//	event_parse_seconds                 histogram of the time to parse the events
+//	reconnects_total{result}            counter of the reconnections, result is success or failure
+//	semisync_acks_total                 counter of the semi-sync ACKs sent
+//	streamer_queued_events              gauge of the events waiting in the BinlogStreamer
+//	streamer_queued_bytes               gauge of the raw size of the events waiting in the BinlogStreamer
+//	seconds_behind_source               gauge of the delay of the last event received
+//	gtid_set_intervals                  gauge of the GTID intervals, or MariaDB domains, of the executed GTID set
+//	row_handler_seconds{action}         histogram of the time taken by the canal row handler
+//	row_handler_errors_total{action}    counter of the errors of the canal row handler
+type PrometheusCollector struct {
+	namespace string
+
+	m                sync.Mutex
+	events           map[string]uint64
+	eventBytes       map[string]uint64
+	parseSeconds     *histogram
+	reconnects       map[string]uint64
+	semiSyncACKs     uint64
+	queuedEvents     int
+	queuedBytes      int64
+	sourceDelay      time.Duration
+	gtidSetIntervals int
+	handlerSeconds   map[string]*histogram
+	handlerErrors    map[string]uint64
+}
+
+// NewPrometheusCollector creates the collector, namespace prefixes the names of the
+// metrics if it's not empty.
+func NewPrometheusCollector(namespace string) *PrometheusCollector {
+	return &PrometheusCollector{
+		namespace:      namespace,
+		events:         make(map[string]uint64),
+		eventBytes:     make(map[string]uint64),
+		parseSeconds:   newHistogram(parseBuckets),
+		reconnects:     map[string]uint64{"success": 0, "failure": 0},
+		handlerSeconds: make(map[string]*histogram),
+		handlerErrors:  make(map[string]uint64),
+	}
+}
+
+func (c *PrometheusCollector) OnEvent(header *replication.EventHeader, parseDuration time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	t := header.EventType.String()
+	c.events[t]++
+	c.eventBytes[t] += uint64(header.EventSize)
+	c.parseSeconds.observe(parseDuration.Seconds())
+}
+
+func (c *PrometheusCollector) OnReconnect(err error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if err != nil {
+		c.reconnects["failure"]++
+	} else {
+		c.reconnects["success"]++
+	}
+}
+
+func (c *PrometheusCollector) OnSemiSyncACK() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.semiSyncACKs++
+}
+
+func (c *PrometheusCollector) OnStreamerQueue(events int, bytes int64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.queuedEvents, c.queuedBytes = events, bytes
+}
+
+func (c *PrometheusCollector) OnSourceDelay(delay time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.sourceDelay = delay
+}
+
+func (c *PrometheusCollector) OnGTIDSet(gset mysql.GTIDSet) {
+	n := gtidSetIntervals(gset)
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.gtidSetIntervals = n
+}
+
+func (c *PrometheusCollector) OnRowHandled(action string, d time.Duration, err error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	h, ok := c.handlerSeconds[action]
+	if !ok {
+		h = newHistogram(handlerBuckets)
+		c.handlerSeconds[action] = h
+	}
+	h.observe(d.Seconds())
+	if err != nil {
+		c.handlerErrors[action]++
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (c *PrometheusCollector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = c.Write(w)
+}
+
+// Write writes the metrics in the Prometheus text exposition format.
+func (c *PrometheusCollector) Write(w io.Writer) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e := &expositionWriter{namespace: c.namespace}
+	e.counters("events_total", "Binlog events received by type.", "type", c.events)
+	e.counters("event_bytes_total", "Raw size in bytes of the binlog events received by type.", "type", c.eventBytes)
+	e.histograms("event_parse_seconds", "Time to parse the binlog events.", "", map[string]*histogram{"": c.parseSeconds})
+	e.counters("reconnects_total", "Attempts to re-sync a broken binlog connection by result.", "result", c.reconnects)
+	e.counters("semisync_acks_total", "Semi-sync ACKs sent to the source.", "", map[string]uint64{"": c.semiSyncACKs})
+	e.gauge("streamer_queued_events", "Binlog events waiting in the streamer.", float64(c.queuedEvents))
+	e.gauge("streamer_queued_bytes", "Raw size in bytes of the binlog events waiting in the streamer.", float64(c.queuedBytes))
+	e.gauge("seconds_behind_source", "Delay of the last binlog event received from the source.", c.sourceDelay.Seconds())
+	e.gauge("gtid_set_intervals", "GTID intervals, or MariaDB domains, of the executed GTID set.", float64(c.gtidSetIntervals))
+	if len(c.handlerSeconds) > 0 {
+		e.histograms("row_handler_seconds", "Time taken by the row handler by action.", "action", c.handlerSeconds)
+		e.counters("row_handler_errors_total", "Errors of the row handler by action.", "action", c.handlerErrors)
+	}
+
+	_, err := io.WriteString(w, e.b.String())
+	return err
+}
+
+// gtidSetIntervals returns the number of intervals of a MySQL GTID set, or the number of
+// domains of a MariaDB GTID set.
+func gtidSetIntervals(gset mysql.GTIDSet) int {
+	n := 0
+	switch s := gset.(type) {
+	case *mysql.MysqlGTIDSet:
+		for _, tags := range *s {
+			for _, intervals := range tags {
+				n += len(intervals)
+			}
+		}
+	case *mysql.MariadbGTIDSet:
+		n = len(s.Sets)
+	}
+	return n
+}
+
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	if i, _ := slices.BinarySearch(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// expositionWriter formats the metrics in the Prometheus text exposition format.
+type expositionWriter struct {
+	namespace string
+	b         strings.Builder
+}
+
+func (e *expositionWriter) header(name string, help string, typ string) string {
+	if e.namespace != "" {
+		name = e.namespace + "_" + name
+	}
+	fmt.Fprintf(&e.b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	return name
+}
+
+func (e *expositionWriter) sample(name string, labels string, v float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(&e.b, "%s%s %s\n", name, labels, formatFloat(v))
+}
+
+func (e *expositionWriter) gauge(name string, help string, v float64) {
+	name = e.header(name, help, "gauge")
+	e.sample(name, "", v)
+}
+
+func (e *expositionWriter) counters(name string, help string, label string, values map[string]uint64) {
+	name = e.header(name, help, "counter")
+	for _, k := range slices.Sorted(maps.Keys(values)) {
+		e.sample(name, labelPair(label, k), float64(values[k]))
+	}
+}
+
+func (e *expositionWriter) histograms(name string, help string, label string, values map[string]*histogram) {
+	name = e.header(name, help, "histogram")
+	for _, k := range slices.Sorted(maps.Keys(values)) {
+		h := values[k]
+		labels := labelPair(label, k)
+		prefix := labels
+		if prefix != "" {
+			prefix += ","
+		}
+
+		var cumulative uint64
+		for i, bound := range h.bounds {
+			cumulative += h.counts[i]
+			e.sample(name+"_bucket", prefix+labelPair("le", formatFloat(bound)), float64(cumulative))
+		}
+		e.sample(name+"_bucket", prefix+labelPair("le", "+Inf"), float64(h.count))
+		e.sample(name+"_sum", labels, h.sum)
+		e.sample(name+"_count", labels, float64(h.count))
+	}
+}
+
+func labelPair(name string, value string) string {
+	if name == "" {
+		return ""
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return name + `="` + r.Replace(value) + `"`
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
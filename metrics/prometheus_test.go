@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+var _ canal.Metrics = (*PrometheusCollector)(nil)
+
+func TestPrometheusCollector(t *testing.T) {
+	c := NewPrometheusCollector("binlog")
+
+	c.OnEvent(&replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2, EventSize: 100}, 3*time.Microsecond)
+	c.OnEvent(&replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2, EventSize: 50}, 2*time.Second)
+	c.OnEvent(&replication.EventHeader{EventType: replication.XID_EVENT, EventSize: 31}, time.Microsecond)
+	c.OnReconnect(errors.New("connection refused"))
+	c.OnReconnect(nil)
+	c.OnSemiSyncACK()
+	c.OnStreamerQueue(3, 4096)
+	c.OnSourceDelay(1500 * time.Millisecond)
+	gset, err := mysql.ParseGTIDSet(mysql.MySQLFlavor, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7-9,5e11fa47-71ca-11e1-9e33-c80aa9429562:1")
+	require.NoError(t, err)
+	c.OnGTIDSet(gset)
+	c.OnRowHandled(canal.InsertAction, 20*time.Millisecond, nil)
+	c.OnRowHandled(canal.InsertAction, time.Minute, errors.New("handler failed"))
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Equal(t, `# HELP binlog_events_total Binlog events received by type.
+# TYPE binlog_events_total counter
+binlog_events_total{type="WriteRowsEventV2"} 2
+binlog_events_total{type="XIDEvent"} 1
+# HELP binlog_event_bytes_total Raw size in bytes of the binlog events received by type.
+# TYPE binlog_event_bytes_total counter
+binlog_event_bytes_total{type="WriteRowsEventV2"} 150
+binlog_event_bytes_total{type="XIDEvent"} 31
+# HELP binlog_event_parse_seconds Time to parse the binlog events.
+# TYPE binlog_event_parse_seconds histogram
+binlog_event_parse_seconds_bucket{le="1e-06"} 1
+binlog_event_parse_seconds_bucket{le="4e-06"} 2
+binlog_event_parse_seconds_bucket{le="1.6e-05"} 2
+binlog_event_parse_seconds_bucket{le="6.4e-05"} 2
+binlog_event_parse_seconds_bucket{le="0.000256"} 2
+binlog_event_parse_seconds_bucket{le="0.001"} 2
+binlog_event_parse_seconds_bucket{le="0.004"} 2
+binlog_event_parse_seconds_bucket{le="0.016"} 2
+binlog_event_parse_seconds_bucket{le="0.064"} 2
+binlog_event_parse_seconds_bucket{le="0.256"} 2
+binlog_event_parse_seconds_bucket{le="1"} 2
+binlog_event_parse_seconds_bucket{le="+Inf"} 3
+binlog_event_parse_seconds_sum 2.000004
+binlog_event_parse_seconds_count 3
+# HELP binlog_reconnects_total Attempts to re-sync a broken binlog connection by result.
+# TYPE binlog_reconnects_total counter
+binlog_reconnects_total{result="failure"} 1
+binlog_reconnects_total{result="success"} 1
+# HELP binlog_semisync_acks_total Semi-sync ACKs sent to the source.
+# TYPE binlog_semisync_acks_total counter
+binlog_semisync_acks_total 1
+# HELP binlog_streamer_queued_events Binlog events waiting in the streamer.
+# TYPE binlog_streamer_queued_events gauge
+binlog_streamer_queued_events 3
+# HELP binlog_streamer_queued_bytes Raw size in bytes of the binlog events waiting in the streamer.
+# TYPE binlog_streamer_queued_bytes gauge
+binlog_streamer_queued_bytes 4096
+# HELP binlog_seconds_behind_source Delay of the last binlog event received from the source.
+# TYPE binlog_seconds_behind_source gauge
+binlog_seconds_behind_source 1.5
+# HELP binlog_gtid_set_intervals GTID intervals, or MariaDB domains, of the executed GTID set.
+# TYPE binlog_gtid_set_intervals gauge
+binlog_gtid_set_intervals 3
+# HELP binlog_row_handler_seconds Time taken by the row handler by action.
+# TYPE binlog_row_handler_seconds histogram
+binlog_row_handler_seconds_bucket{action="insert",le="0.005"} 0
+binlog_row_handler_seconds_bucket{action="insert",le="0.01"} 0
+binlog_row_handler_seconds_bucket{action="insert",le="0.025"} 1
+binlog_row_handler_seconds_bucket{action="insert",le="0.05"} 1
+binlog_row_handler_seconds_bucket{action="insert",le="0.1"} 1
+binlog_row_handler_seconds_bucket{action="insert",le="0.25"} 1
+binlog_row_handler_seconds_bucket{action="insert",le="0.5"} 1
+binlog_row_handler_seconds_bucket{action="insert",le="1"} 1
+binlog_row_handler_seconds_bucket{action="insert",le="2.5"} 1
+binlog_row_handler_seconds_bucket{action="insert",le="5"} 1
+binlog_row_handler_seconds_bucket{action="insert",le="10"} 1
+binlog_row_handler_seconds_bucket{action="insert",le="+Inf"} 2
+binlog_row_handler_seconds_sum{action="insert"} 60.02
+binlog_row_handler_seconds_count{action="insert"} 2
+# HELP binlog_row_handler_errors_total Errors of the row handler by action.
+# TYPE binlog_row_handler_errors_total counter
+binlog_row_handler_errors_total{action="insert"} 1
+`, w.Body.String())
+}
@@ -232,6 +232,10 @@ const (
 	DEFAULT_COLLATION_NAME string = "utf8mb4_0900_ai_ci"
 )
 
+// BINARY_COLLATION_ID is the ID of the binary collation, the collation of the binary
+// strings and the character set of the binary fields.
+const BINARY_COLLATION_ID = 63
+
 const (
 	DEFAULT_DUMP_EXECUTION_PATH = "mysqldump"
 )
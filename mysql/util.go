@@ -3,7 +3,6 @@ package mysql
 import (
 	"bytes"
 	"cmp"
-	"compress/zlib"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
@@ -14,12 +13,14 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"math"
 	mrand "math/rand"
 	"runtime"
 	"strconv"
 	"strings"
 
 	"filippo.io/edwards25519"
+	"github.com/go-mysql-org/go-mysql/compress"
 	"github.com/go-mysql-org/go-mysql/utils"
 	"github.com/pingcap/errors"
 )
@@ -281,24 +282,74 @@ func NewSha256PasswordHash(pwd string) (string, error) {
 	return hashCrypt256(pwd, string(salt), SHA256_PASSWORD_ITERATIONS)
 }
 
+// DecompressMariadbData decompresses the data of the MariaDB compressed query and rows
+// events. The header byte is 0x80 | algorithm<<4 | lenlen, followed by the uncompressed
+// length in lenlen big-endian bytes and the zlib stream, the algorithm is always 0=zlib.
 func DecompressMariadbData(data []byte) ([]byte, error) {
-	// algorithm always 0=zlib
-	// algorithm := (data[pos] & 0x07) >> 4
+	if len(data) == 0 {
+		return nil, errors.New("missing header of mariadb compressed data")
+	}
+	if algorithm := (data[0] & 0x70) >> 4; algorithm != 0 {
+		return nil, errors.Errorf("unsupported mariadb compression algorithm %d", algorithm)
+	}
 	headerSize := int(data[0] & 0x07)
+	if headerSize < 1 || headerSize > 4 {
+		return nil, errors.Errorf("invalid length size %d of mariadb compressed data", headerSize)
+	}
+	if len(data) < 1+headerSize {
+		return nil, errors.Trace(io.ErrUnexpectedEOF)
+	}
 	uncompressedDataSize := BFixedLengthInt(data[1 : 1+headerSize])
-	uncompressedData := make([]byte, uncompressedDataSize)
-	r, err := zlib.NewReader(bytes.NewReader(data[1+headerSize:]))
+
+	r, err := compress.GetPooledZlibReader(bytes.NewReader(data[1+headerSize:]))
 	if err != nil {
-		return nil, err
+		return nil, errors.Trace(err)
 	}
 	defer r.Close()
-	_, err = io.ReadFull(r, uncompressedData)
+
+	// the length is not trusted for the allocation, one more byte is read to detect
+	// the longer data
+	uncompressedData, err := io.ReadAll(io.LimitReader(r, int64(uncompressedDataSize)+1))
 	if err != nil {
-		return nil, err
+		return nil, errors.Trace(err)
+	}
+	if uint64(len(uncompressedData)) != uncompressedDataSize {
+		return nil, errors.Errorf("mariadb compressed data has %d bytes, %d expected", len(uncompressedData), uncompressedDataSize)
 	}
 	return uncompressedData, nil
 }
 
+// CompressMariadbData compresses the data in the format read by DecompressMariadbData.
+func CompressMariadbData(data []byte) ([]byte, error) {
+	size := uint64(len(data))
+	if size > math.MaxUint32 {
+		return nil, errors.Errorf("data is too long to compress, %d bytes", size)
+	}
+	headerSize := 1
+	for size>>(8*headerSize) > 0 {
+		headerSize++
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(0x80 | byte(headerSize))
+	for i := headerSize - 1; i >= 0; i-- {
+		buf.WriteByte(byte(size >> (8 * i)))
+	}
+
+	w, err := compress.GetPooledZlibWriter(&buf)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if _, err = w.Write(data); err != nil {
+		_ = w.Close()
+		return nil, errors.Trace(err)
+	}
+	if err = w.Close(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return buf.Bytes(), nil
+}
+
 // AppendLengthEncodedInteger: encodes a uint64 value and appends it to the given bytes slice
 func AppendLengthEncodedInteger(b []byte, n uint64) []byte {
 	switch {
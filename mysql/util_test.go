@@ -129,3 +129,43 @@ func TestToBinaryDateTime(t *testing.T) {
 		})
 	}
 }
+
+func TestMariadbCompressedData(t *testing.T) {
+	// "hello" compressed by MariaDB, the length in one byte
+	data := []byte{0x81, 0x05, 0x78, 0x9c, 0xcb, 0x48, 0xcd, 0xc9, 0xc9, 0x07, 0x00, 0x06, 0x2c, 0x02, 0x15}
+	got, err := DecompressMariadbData(data)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), got)
+
+	for _, size := range []int{0, 5, 300, 70000} {
+		raw := make([]byte, size)
+		for i := range raw {
+			raw[i] = byte(i % 7)
+		}
+		compressed, err := CompressMariadbData(raw)
+		require.NoError(t, err)
+		got, err = DecompressMariadbData(compressed)
+		require.NoError(t, err)
+		require.Equal(t, raw, got)
+	}
+
+	for _, data := range [][]byte{
+		nil,
+		// the length is truncated
+		{0x82, 0x00},
+		// invalid length size
+		{0x80, 0x78, 0x9c},
+		{0x85, 0, 0, 0, 0, 5},
+		// unsupported algorithm
+		{0x91, 0x05, 0x78, 0x9c},
+		// the data is shorter than the length
+		{0x81, 0x06, 0x78, 0x9c, 0xcb, 0x48, 0xcd, 0xc9, 0xc9, 0x07, 0x00, 0x06, 0x2c, 0x02, 0x15},
+		// the data is longer than the length
+		{0x81, 0x04, 0x78, 0x9c, 0xcb, 0x48, 0xcd, 0xc9, 0xc9, 0x07, 0x00, 0x06, 0x2c, 0x02, 0x15},
+		// corrupted zlib stream
+		{0x81, 0x05, 0x78, 0x9c, 0xcb, 0x48},
+	} {
+		_, err = DecompressMariadbData(data)
+		require.Error(t, err, "%x", data)
+	}
+}
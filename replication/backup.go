@@ -178,7 +178,7 @@ func processWithHandler(b *BinlogSyncer, s *BinlogStreamer, backupHandler *Backu
 		case err := <-s.ech:
 			return errors.Trace(err)
 		case e := <-s.ch:
-			err := backupHandler.HandleEvent(e)
+			err := backupHandler.HandleEvent(s.dequeued(e))
 			if err != nil {
 				return errors.Trace(err)
 			}
@@ -0,0 +1,330 @@
+package replication
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// errStopBinlogRead stops reading a binlog file once the time search has what it needs.
+var errStopBinlogRead = errors.New("stop reading binlog file")
+
+// binlogFileReadFunc reads the events of the binlog file name from position 4 until the
+// end of the file, or until onEvent returns errStopBinlogRead.
+type binlogFileReadFunc func(name string, onEvent OnEventFunc) error
+
+// BinlogTimePosition is the start of the first transaction committed at or after a time,
+// see BinlogParser.FindTransactionByTime and BinlogSyncer.StartSyncFromTime.
+type BinlogTimePosition struct {
+	// Pos is the position of the first event of the transaction, its GTID event or BEGIN.
+	// If no transaction is committed at or after the time, it's the end of the last file.
+	Pos mysql.Position
+	// GTIDSet is the set of transactions executed before the transaction, it's nil if the
+	// transaction has no GTID.
+	GTIDSet mysql.GTIDSet
+	// CommitTime is the commit time of the transaction, it's zero if there is none.
+	CommitTime time.Time
+}
+
+// findBinlogTransactionByTime returns the start of the first transaction committed at or
+// after t in the files, which must be in the order they were written.
+//
+// The file to start scanning from is found by a binary search on the timestamp of the
+// first event of each file, i.e. its creation time, then the files are scanned to the
+// first transaction whose commit time is at or after t. The commit time is the immediate
+// commit timestamp of the GTID event (MySQL 8.0.1+), or the second-precision timestamp
+// of the XID or COMMIT event.
+func findBinlogTransactionByTime(files []string, t time.Time, read binlogFileReadFunc) (*BinlogTimePosition, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no binlog file to search")
+	}
+
+	// The transactions of a file are committed before the next file is created, so the
+	// transaction is in the last file created before t, or in a later one. The creation
+	// time only has a second precision.
+	since := t.Truncate(time.Second)
+	var searchErr error
+	i := sort.Search(len(files), func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		created, err := binlogFileCreateTime(files[i], read)
+		if err != nil {
+			searchErr = errors.Annotatef(err, "read first event of %s", files[i])
+			return true
+		}
+		return !created.Before(since)
+	})
+	if searchErr != nil {
+		return nil, searchErr
+	}
+
+	for i = max(i-1, 0); i < len(files); i++ {
+		pos, found, err := scanBinlogFileByTime(files[i], t, read)
+		if err != nil {
+			return nil, errors.Annotatef(err, "scan %s", files[i])
+		}
+		if found || i == len(files)-1 {
+			return pos, nil
+		}
+	}
+	return nil, nil
+}
+
+// binlogFileCreateTime returns the timestamp of the first event of the binlog file.
+func binlogFileCreateTime(name string, read binlogFileReadFunc) (time.Time, error) {
+	var created time.Time
+	err := read(name, func(e *BinlogEvent) error {
+		if e.Header.Flags&LOG_EVENT_ARTIFICIAL_F != 0 || e.Header.Timestamp == 0 {
+			return nil
+		}
+		created = time.Unix(int64(e.Header.Timestamp), 0)
+		return errStopBinlogRead
+	})
+	if err != nil && errors.Cause(err) != errStopBinlogRead {
+		return time.Time{}, errors.Trace(err)
+	}
+	if created.IsZero() {
+		return time.Time{}, errors.Errorf("binlog file %s has no event", name)
+	}
+	return created, nil
+}
+
+// scanBinlogFileByTime scans the binlog file for the first transaction committed at or
+// after t, if there is none it returns the end of the file and false.
+func scanBinlogFileByTime(name string, t time.Time, read binlogFileReadFunc) (*BinlogTimePosition, bool, error) {
+	var (
+		// the offset of the next event in the file
+		pos      uint32 = 4
+		txnStart uint32
+		gset     mysql.GTIDSet
+		tracker  transactionTracker
+
+		result *BinlogTimePosition
+	)
+
+	err := read(name, func(e *BinlogEvent) error {
+		h := e.Header
+		if h.Flags&LOG_EVENT_ARTIFICIAL_F != 0 || h.EventType == HEARTBEAT_EVENT || h.EventType == HEARTBEAT_LOG_EVENT_V2 {
+			// not in the file
+			return nil
+		}
+		start := pos
+		pos += h.EventSize
+
+		switch ev := e.Event.(type) {
+		case *PreviousGTIDsEvent:
+			s, err := mysql.ParseMysqlGTIDSet(ev.GTIDSets)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			gset = s
+		case *MariadbGTIDListEvent:
+			set, _ := mysql.ParseMariadbGTIDSet("")
+			s := set.(*mysql.MariadbGTIDSet)
+			for i := range ev.GTIDs {
+				if err := s.AddSet(&ev.GTIDs[i]); err != nil {
+					return errors.Trace(err)
+				}
+			}
+			gset = s
+		}
+
+		txn, first, last, err := tracker.track(e)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if first {
+			txnStart = start
+		}
+		if !last {
+			return nil
+		}
+
+		commitTime, since := txn.commitTime, t
+		if commitTime.IsZero() {
+			commitTime = time.Unix(int64(h.Timestamp), 0)
+			since = t.Truncate(time.Second)
+		}
+		if !commitTime.Before(since) {
+			result = &BinlogTimePosition{
+				Pos:        mysql.Position{Name: name, Pos: txnStart},
+				CommitTime: commitTime,
+			}
+			if gset != nil && txn.gtid != "" {
+				result.GTIDSet = gset
+			}
+			return errStopBinlogRead
+		}
+
+		if gset != nil && txn.gtid != "" {
+			return errors.Trace(gset.Update(txn.gtid))
+		}
+		return nil
+	})
+	if err != nil && errors.Cause(err) != errStopBinlogRead {
+		return nil, false, errors.Trace(err)
+	}
+
+	if result != nil {
+		return result, true, nil
+	}
+	return &BinlogTimePosition{Pos: mysql.Position{Name: name, Pos: pos}}, false, nil
+}
+
+// newTimeSearchParser returns a parser for the time search, it doesn't decode the rows.
+func (p *BinlogParser) newTimeSearchParser() *BinlogParser {
+	s := NewBinlogParser()
+	s.flavor = p.flavor
+	s.keyProvider = p.keyProvider
+	s.rowsEventDecodeFunc = func(*RowsEvent, []byte) error { return nil }
+	return s
+}
+
+// FindTransactionByTime returns the start of the first transaction committed at or after
+// t in the local binlog files names, which must be in the order they were written. The
+// files are searched by the timestamps in the event headers, the rows are not decoded.
+func (p *BinlogParser) FindTransactionByTime(names []string, t time.Time) (*BinlogTimePosition, error) {
+	s := p.newTimeSearchParser()
+	return findBinlogTransactionByTime(names, t, func(name string, onEvent OnEventFunc) error {
+		return s.ParseFile(name, 4, onEvent)
+	})
+}
+
+// ParseFilesFromTime parses the local binlog files names from the first transaction
+// committed at or after t, see FindTransactionByTime. It returns io.EOF if the stop
+// condition is met, see SetStopCondition.
+func (p *BinlogParser) ParseFilesFromTime(names []string, t time.Time, onEvent OnEventFunc) error {
+	start, err := p.FindTransactionByTime(names, t)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	i := 0
+	for names[i] != start.Pos.Name {
+		i++
+	}
+	offset := int64(start.Pos.Pos)
+	for _, name := range names[i:] {
+		if p.stopProcessing.Load() {
+			break
+		}
+		if err = p.ParseFile(name, offset, onEvent); err != nil {
+			if err == io.EOF {
+				// the stop condition is met
+				return err
+			}
+			return errors.Trace(err)
+		}
+		offset = 4
+	}
+	return nil
+}
+
+// StartSyncFromTime starts syncing from the first transaction committed at or after t.
+//
+// The binary logs listed by SHOW BINARY LOGS are searched on separate connections, see
+// BinlogParser.FindTransactionByTime, then the sync starts with StartSyncGTID if the
+// transaction has a GTID, or with StartSync from its position otherwise.
+func (b *BinlogSyncer) StartSyncFromTime(t time.Time) (*BinlogStreamer, error) {
+	b.m.Lock()
+	running := b.running
+	b.m.Unlock()
+	if running {
+		return nil, errors.Trace(errSyncRunning)
+	}
+
+	files, err := b.showBinaryLogs()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	start, err := findBinlogTransactionByTime(files, t, b.readBinlogFile)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	b.cfg.Logger.Info("found binlog transaction by time", slog.Time("time", t),
+		slog.Any("position", start.Pos), slog.Any("GTID set", start.GTIDSet), slog.Time("commit time", start.CommitTime))
+
+	if start.GTIDSet != nil {
+		return b.StartSyncGTID(start.GTIDSet)
+	}
+	return b.StartSync(start.Pos)
+}
+
+func (b *BinlogSyncer) showBinaryLogs() ([]string, error) {
+	c, err := b.newConnection(b.ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer c.Close()
+
+	r, err := c.Execute("SHOW BINARY LOGS")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	files := make([]string, 0, r.RowNumber())
+	for i := range r.RowNumber() {
+		name, err := r.GetStringByName(i, "Log_name")
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		files = append(files, name)
+	}
+	return files, nil
+}
+
+// readBinlogFile is the binlogFileReadFunc of the syncer, it dumps the file with
+// BINLOG_DUMP_NON_BLOCK on a new connection, so the dump ends after the last file.
+func (b *BinlogSyncer) readBinlogFile(name string, onEvent OnEventFunc) error {
+	cfg := b.cfg
+	cfg.DumpCommandFlag = BINLOG_DUMP_NON_BLOCK
+	cfg.SemiSyncEnabled = false
+	cfg.HeartbeatPeriod = 0
+	// the search isn't a part of the sync
+	cfg.Metrics = noopMetrics{}
+
+	s := &BinlogSyncer{cfg: cfg, parser: b.parser.newTimeSearchParser()}
+	s.ctx, s.cancel = context.WithCancel(b.ctx)
+	defer s.cancel()
+
+	if err := s.prepareSyncPos(mysql.Position{Name: name, Pos: 4}); err != nil {
+		return errors.Trace(err)
+	}
+	defer s.c.Close()
+
+	for {
+		data, err := s.c.ReadPacket()
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		switch data[0] {
+		case mysql.OK_HEADER:
+			e, _, err := s.parseEvent(data)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if err = onEvent(e); err != nil {
+				return errors.Trace(err)
+			}
+			if e.Header.EventType == ROTATE_EVENT && e.Header.Flags&LOG_EVENT_ARTIFICIAL_F == 0 {
+				// the last event of the file
+				return nil
+			}
+		case mysql.ERR_HEADER:
+			return errors.Trace(s.c.HandleErrorPacket(data))
+		case mysql.EOF_HEADER:
+			// the end of the last file
+			return nil
+		default:
+			return errors.Errorf("invalid stream header %d", data[0])
+		}
+	}
+}
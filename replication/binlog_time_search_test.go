@@ -0,0 +1,126 @@
+package replication
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+const testTimeSearchUUID = "5aa72a7f-44a8-11e6-885a-0e7e1c9d8b3a"
+
+// writeTimeSearchBinlog writes a binlog file created at created with a transaction committed
+// at each of commits, in microseconds, and returns the positions of the transactions and
+// the end of the file. If immediate is false, the commit time is only the second of the
+// XID event.
+func writeTimeSearchBinlog(t *testing.T, name string, created uint32, gno int64, commits []uint64, immediate bool, next string) ([]uint32, uint32) {
+	sid := []byte{0x5a, 0xa7, 0x2a, 0x7f, 0x44, 0xa8, 0x11, 0xe6, 0x88, 0x5a, 0x0e, 0x7e, 0x1c, 0x9d, 0x8b, 0x3a}
+
+	data := append([]byte(nil), BinLogFileHeader...)
+	pos := uint32(len(data))
+	write := func(ts uint32, eventType EventType, e Event) {
+		h := &EventHeader{Timestamp: ts, EventType: eventType, ServerID: 1}
+		raw, err := encodeEvent(h, e, BINLOG_CHECKSUM_ALG_CRC32, &pos)
+		require.NoError(t, err)
+		data = append(data, raw...)
+		pos = h.LogPos
+	}
+
+	write(created, FORMAT_DESCRIPTION_EVENT, &FormatDescriptionEvent{
+		Version:                4,
+		ServerVersion:          defaultBinlogVersion,
+		CreateTimestamp:        created,
+		EventHeaderLength:      EventHeaderSize,
+		EventTypeHeaderLengths: mysql80EventTypeHeaderLengths,
+		ChecksumAlgorithm:      BINLOG_CHECKSUM_ALG_CRC32,
+	})
+	previous := ""
+	if gno > 1 {
+		previous = testTimeSearchUUID + ":1-" + strconv.FormatInt(gno-1, 10)
+	}
+	write(created, PREVIOUS_GTIDS_EVENT, &PreviousGTIDsEvent{GTIDSets: previous})
+
+	var starts []uint32
+	for _, commit := range commits {
+		starts = append(starts, pos)
+		ts := uint32(commit / 1000000)
+		gtid := &GTIDEvent{SID: sid, GNO: gno}
+		if immediate {
+			gtid.ImmediateCommitTimestamp = commit
+			gtid.OriginalCommitTimestamp = commit
+		}
+		write(ts, GTID_EVENT, gtid)
+		write(ts, QUERY_EVENT, &QueryEvent{Schema: []byte("db"), Query: []byte("BEGIN")})
+		write(ts, XID_EVENT, &XIDEvent{XID: uint64(gno)})
+		gno++
+	}
+	if next != "" {
+		write(created, ROTATE_EVENT, &RotateEvent{Position: 4, NextLogName: []byte(next)})
+	}
+
+	require.NoError(t, os.WriteFile(name, data, 0o600))
+	return starts, pos
+}
+
+func TestFindTransactionByTime(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		filepath.Join(dir, "mysql-bin.000001"),
+		filepath.Join(dir, "mysql-bin.000002"),
+		filepath.Join(dir, "mysql-bin.000003"),
+	}
+	starts1, _ := writeTimeSearchBinlog(t, names[0], 1000, 1, []uint64{1001_000000, 1002_000000}, false, "mysql-bin.000002")
+	starts2, _ := writeTimeSearchBinlog(t, names[1], 1010, 3, []uint64{1011_000000, 1012_000000}, false, "mysql-bin.000003")
+	starts3, end := writeTimeSearchBinlog(t, names[2], 1020, 5, []uint64{1021_500000}, true, "")
+
+	testcases := []struct {
+		t        time.Time
+		name     string
+		pos      uint32
+		gset     string
+		noGTID   bool
+		commitTs int64
+	}{
+		{t: time.Unix(500, 0), name: names[0], pos: starts1[0], gset: "", commitTs: 1001},
+		{t: time.Unix(1002, 0), name: names[0], pos: starts1[1], gset: testTimeSearchUUID + ":1", commitTs: 1002},
+		// the next file has the first transaction committed after the time
+		{t: time.Unix(1005, 0), name: names[1], pos: starts2[0], gset: testTimeSearchUUID + ":1-2", commitTs: 1011},
+		// the XID timestamp only has a second precision
+		{t: time.Unix(1012, 900000000), name: names[1], pos: starts2[1], gset: testTimeSearchUUID + ":1-3", commitTs: 1012},
+		{t: time.Unix(1021, 400000000), name: names[2], pos: starts3[0], gset: testTimeSearchUUID + ":1-4", commitTs: 1021},
+		// no transaction is committed after the time
+		{t: time.Unix(1021, 600000000), name: names[2], pos: end, noGTID: true},
+		{t: time.Unix(5000, 0), name: names[2], pos: end, noGTID: true},
+	}
+
+	p := NewBinlogParser()
+	for _, tc := range testcases {
+		start, err := p.FindTransactionByTime(names, tc.t)
+		require.NoError(t, err, tc.t)
+		require.Equal(t, mysql.Position{Name: tc.name, Pos: tc.pos}, start.Pos, tc.t)
+		if tc.noGTID {
+			require.Nil(t, start.GTIDSet)
+			require.True(t, start.CommitTime.IsZero())
+			continue
+		}
+		require.Equal(t, tc.gset, start.GTIDSet.String(), tc.t)
+		require.Equal(t, tc.commitTs, start.CommitTime.Unix(), tc.t)
+	}
+
+	var gnos []int64
+	require.NoError(t, p.ParseFilesFromTime(names, time.Unix(1012, 0), func(e *BinlogEvent) error {
+		if gtid, ok := e.Event.(*GTIDEvent); ok {
+			gnos = append(gnos, gtid.GNO)
+		}
+		return nil
+	}))
+	require.Equal(t, []int64{4, 5}, gnos)
+
+	_, err := p.FindTransactionByTime(nil, time.Unix(1000, 0))
+	require.Error(t, err)
+}
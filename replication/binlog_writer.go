@@ -0,0 +1,433 @@
+package replication
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+const (
+	defaultBinlogBaseName    = "mysql-bin"
+	defaultBinlogMaxFileSize = 1 << 30
+	defaultBinlogVersion     = "8.0.36-go-mysql"
+)
+
+// mysql80EventTypeHeaderLengths are the post-header lengths written by MySQL 8.0
+// in its FORMAT_DESCRIPTION_EVENT, indexed by event type - 1.
+var mysql80EventTypeHeaderLengths = []byte{
+	0x38, 0x0d, 0x00, 0x08, 0x00, 0x12, 0x00, 0x04, 0x04, 0x04, 0x04, 0x12, 0x00, 0x00,
+	0x62, 0x00, 0x04, 0x1a, 0x08, 0x00, 0x00, 0x00, 0x08, 0x08, 0x08, 0x02, 0x00, 0x00,
+	0x00, 0x0a, 0x0a, 0x0a, 0x2a, 0x2a, 0x00, 0x12, 0x34, 0x00, 0x0a, 0x28, 0x00,
+}
+
+// BinlogWriterConfig is the configuration of a BinlogWriter.
+type BinlogWriterConfig struct {
+	// Dir is the directory the binlog files and the index file are written to.
+	Dir string
+	// BaseName is the prefix of the binlog file names, "mysql-bin" by default.
+	BaseName string
+	// MaxFileSize is the size after which the writer rotates to a new file, 1GB by default.
+	// Like MySQL, rotation only happens at a transaction boundary, so a file may be larger.
+	MaxFileSize int64
+
+	// ServerID is used in the headers of the events generated by the writer itself.
+	ServerID uint32
+	// Flavor is "mysql" or "mariadb", "mysql" by default.
+	Flavor string
+	// FormatDescription is written at the start of every file and decides the checksum
+	// algorithm of all events. If nil, a MySQL 8.0 one with CRC32 checksums is used.
+	// It is required for the MariaDB flavor.
+	FormatDescription *FormatDescriptionEvent
+	// GTIDSet is the set of transactions executed before the first written event,
+	// it is written as the PREVIOUS_GTIDS_EVENT (or GTID_LIST_EVENT for MariaDB) of the first file.
+	// If it's nil and the writer continues after existing files, the set is read from the
+	// last file.
+	GTIDSet mysql.GTIDSet
+}
+
+// BinlogWriter writes events into binlog files that can be read by mysqlbinlog and
+// BinlogParser.ParseFile. Every file starts with the magic header, a FORMAT_DESCRIPTION_EVENT
+// and a PREVIOUS_GTIDS_EVENT, and ends with a ROTATE_EVENT when the writer moves on to
+// the next file. The names of the files are recorded in the "<BaseName>.index" file.
+type BinlogWriter struct {
+	m sync.Mutex
+
+	cfg  BinlogWriterConfig
+	fde  *FormatDescriptionEvent
+	gset mysql.GTIDSet
+
+	seq  int
+	name string
+	f    *os.File
+	pos  uint32
+
+	// tracker finds the transaction boundaries, the writer only rotates after the
+	// last event of a transaction
+	tracker transactionTracker
+}
+
+// NewBinlogWriter creates a BinlogWriter and opens its first file. If the index file
+// already exists, the writer continues after the last file listed in it.
+func NewBinlogWriter(cfg BinlogWriterConfig) (*BinlogWriter, error) {
+	if cfg.BaseName == "" {
+		cfg.BaseName = defaultBinlogBaseName
+	}
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = defaultBinlogMaxFileSize
+	}
+	if cfg.Flavor == "" {
+		cfg.Flavor = mysql.MySQLFlavor
+	}
+
+	w := &BinlogWriter{cfg: cfg}
+
+	switch {
+	case cfg.FormatDescription != nil:
+		fde := *cfg.FormatDescription
+		w.fde = &fde
+	case cfg.Flavor == mysql.MySQLFlavor:
+		w.fde = &FormatDescriptionEvent{
+			Version:                4,
+			ServerVersion:          defaultBinlogVersion,
+			EventHeaderLength:      EventHeaderSize,
+			EventTypeHeaderLengths: mysql80EventTypeHeaderLengths,
+			ChecksumAlgorithm:      BINLOG_CHECKSUM_ALG_CRC32,
+		}
+	default:
+		return nil, errors.Errorf("FormatDescription is required for flavor %s", cfg.Flavor)
+	}
+
+	if cfg.GTIDSet != nil {
+		w.gset = cfg.GTIDSet.Clone()
+	} else {
+		gset, err := mysql.ParseGTIDSet(cfg.Flavor, "")
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		w.gset = gset
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	seq, err := w.lastIndexedSeq()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	w.seq = seq
+
+	if cfg.GTIDSet == nil && seq > 0 {
+		if err = w.resumeGTIDSet(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	w.fde.CreateTimestamp = uint32(time.Now().Unix())
+	if err = w.openNextFile(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return w, nil
+}
+
+// WriteEvent encodes the event and appends it to the current file, the LogPos and
+// EventSize of the written header are recalculated. FORMAT_DESCRIPTION, ROTATE,
+// PREVIOUS_GTIDS and GTID_LIST events are managed by the writer and skipped.
+func (w *BinlogWriter) WriteEvent(e *BinlogEvent) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.f == nil {
+		return errors.New("binlog writer is closed")
+	}
+
+	switch e.Event.(type) {
+	case *FormatDescriptionEvent, *RotateEvent, *PreviousGTIDsEvent, *MariadbGTIDListEvent:
+		return nil
+	}
+
+	h := *e.Header
+	if err := w.write(&h, e.Event); err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := w.updateGTIDSet(e.Event); err != nil {
+		return errors.Trace(err)
+	}
+
+	_, _, last, err := w.tracker.track(e)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if int64(w.pos) >= w.cfg.MaxFileSize && last {
+		return errors.Trace(w.rotate())
+	}
+
+	return nil
+}
+
+// Rotate closes the current file with a ROTATE_EVENT and opens the next one.
+func (w *BinlogWriter) Rotate() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.f == nil {
+		return errors.New("binlog writer is closed")
+	}
+
+	return errors.Trace(w.rotate())
+}
+
+// Position returns the current file name and the position the next event is written at.
+func (w *BinlogWriter) Position() mysql.Position {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return mysql.Position{Name: w.name, Pos: w.pos}
+}
+
+// GTIDSet returns the set of transactions written so far, including the initial set.
+func (w *BinlogWriter) GTIDSet() mysql.GTIDSet {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.gset.Clone()
+}
+
+// Close syncs and closes the current file.
+func (w *BinlogWriter) Close() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+
+	err := w.closeFile()
+	return errors.Trace(err)
+}
+
+func (w *BinlogWriter) write(h *EventHeader, e Event) error {
+	checksumAlg := BINLOG_CHECKSUM_ALG_OFF
+	if w.fde.hasChecksumAlgorithm() {
+		checksumAlg = w.fde.ChecksumAlgorithm
+	}
+
+	data, err := encodeEvent(h, e, checksumAlg, &w.pos)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if _, err = w.f.Write(data); err != nil {
+		return errors.Trace(err)
+	}
+	w.pos = h.LogPos
+
+	return nil
+}
+
+func (w *BinlogWriter) updateGTIDSet(e Event) error {
+	var gtid *GTIDEvent
+	switch ev := e.(type) {
+	case *GTIDEvent:
+		gtid = ev
+	case *GtidTaggedLogEvent:
+		gtid = &ev.GTIDEvent
+	case *MariadbGTIDEvent:
+		gset, ok := w.gset.(*mysql.MariadbGTIDSet)
+		if !ok {
+			return errors.Errorf("unexpected %T for flavor %s", e, w.cfg.Flavor)
+		}
+		return errors.Trace(gset.AddSet(&ev.GTID))
+	default:
+		return nil
+	}
+
+	gset, ok := w.gset.(*mysql.MysqlGTIDSet)
+	if !ok {
+		return errors.Errorf("unexpected %T for flavor %s", e, w.cfg.Flavor)
+	}
+	u, err := uuid.FromBytes(gtid.SID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	gset.AddGTIDWithTag(u, gtid.Tag, gtid.GNO)
+
+	return nil
+}
+
+// resumeGTIDSet rebuilds the GTID set written so far from the last file, i.e. its
+// PREVIOUS_GTIDS_EVENT, or GTID_LIST_EVENT for MariaDB, and the GTIDs in it.
+func (w *BinlogWriter) resumeGTIDSet() error {
+	p := NewBinlogParser()
+	p.SetFlavor(w.cfg.Flavor)
+	// only the GTIDs are needed, the rows are not decoded
+	p.SetEventFilter(func(EventType, *TableMapEvent) bool { return false })
+
+	name := filepath.Join(w.cfg.Dir, w.fileName(w.seq))
+	err := p.ParseFile(name, 0, func(e *BinlogEvent) error {
+		switch ev := e.Event.(type) {
+		case *PreviousGTIDsEvent:
+			gset, err := mysql.ParseGTIDSet(w.cfg.Flavor, ev.GTIDSets)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			w.gset = gset
+		case *MariadbGTIDListEvent:
+			gset, ok := w.gset.(*mysql.MariadbGTIDSet)
+			if !ok {
+				return errors.Errorf("unexpected %T for flavor %s", e.Event, w.cfg.Flavor)
+			}
+			for i := range ev.GTIDs {
+				if err := gset.AddSet(&ev.GTIDs[i]); err != nil {
+					return errors.Trace(err)
+				}
+			}
+		}
+		return w.updateGTIDSet(e.Event)
+	})
+	return errors.Annotatef(err, "read GTID set of %s", name)
+}
+
+func (w *BinlogWriter) rotate() error {
+	next := w.fileName(w.seq + 1)
+	h := &EventHeader{
+		Timestamp: uint32(time.Now().Unix()),
+		EventType: ROTATE_EVENT,
+		ServerID:  w.cfg.ServerID,
+	}
+	if err := w.write(h, &RotateEvent{Position: 4, NextLogName: []byte(next)}); err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := w.closeFile(); err != nil {
+		return errors.Trace(err)
+	}
+
+	// like MySQL, only the first file after a start has the creation time, a replica
+	// takes a non-zero one as a restart of the source
+	w.fde.CreateTimestamp = 0
+	return errors.Trace(w.openNextFile())
+}
+
+func (w *BinlogWriter) closeFile() error {
+	err := w.f.Sync()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	w.f = nil
+
+	return errors.Trace(err)
+}
+
+func (w *BinlogWriter) openNextFile() error {
+	w.seq++
+	w.name = w.fileName(w.seq)
+
+	f, err := os.OpenFile(filepath.Join(w.cfg.Dir, w.name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	w.f = f
+
+	if _, err = f.Write(BinLogFileHeader); err != nil {
+		return errors.Trace(err)
+	}
+	w.pos = uint32(len(BinLogFileHeader))
+
+	now := uint32(time.Now().Unix())
+	h := &EventHeader{Timestamp: now, EventType: FORMAT_DESCRIPTION_EVENT, ServerID: w.cfg.ServerID}
+	if err = w.write(h, w.fde); err != nil {
+		return errors.Trace(err)
+	}
+
+	if w.cfg.Flavor == mysql.MariaDBFlavor {
+		h = &EventHeader{Timestamp: now, EventType: MARIADB_GTID_LIST_EVENT, ServerID: w.cfg.ServerID}
+		err = w.write(h, w.mariadbGTIDList())
+	} else {
+		h = &EventHeader{Timestamp: now, EventType: PREVIOUS_GTIDS_EVENT, ServerID: w.cfg.ServerID}
+		err = w.write(h, &PreviousGTIDsEvent{GTIDSets: w.gset.String()})
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(w.appendIndex(w.name))
+}
+
+func (w *BinlogWriter) mariadbGTIDList() *MariadbGTIDListEvent {
+	sets := w.gset.(*mysql.MariadbGTIDSet).Sets
+	e := &MariadbGTIDListEvent{GTIDs: make([]mysql.MariadbGTID, 0, len(sets))}
+	for _, gtid := range sets {
+		e.GTIDs = append(e.GTIDs, *gtid)
+	}
+	// keep the output stable
+	sort.Slice(e.GTIDs, func(i, j int) bool {
+		return e.GTIDs[i].DomainID < e.GTIDs[j].DomainID
+	})
+
+	return e
+}
+
+func (w *BinlogWriter) fileName(seq int) string {
+	return fmt.Sprintf("%s.%06d", w.cfg.BaseName, seq)
+}
+
+func (w *BinlogWriter) indexPath() string {
+	return filepath.Join(w.cfg.Dir, w.cfg.BaseName+".index")
+}
+
+func (w *BinlogWriter) appendIndex(name string) error {
+	f, err := os.OpenFile(w.indexPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+
+	// MySQL records the files relative to the index file
+	if _, err = f.WriteString("./" + name + "\n"); err != nil {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(f.Sync())
+}
+
+// lastIndexedSeq returns the sequence number of the last file in the index file, or 0.
+func (w *BinlogWriter) lastIndexedSeq() (int, error) {
+	f, err := os.Open(w.indexPath())
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer f.Close()
+
+	seq := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		ext := filepath.Ext(line)
+		n, err := strconv.Atoi(strings.TrimPrefix(ext, "."))
+		if err != nil {
+			return 0, errors.Errorf("invalid binlog file name %q in index", line)
+		}
+		seq = max(seq, n)
+	}
+
+	return seq, errors.Trace(scanner.Err())
+}
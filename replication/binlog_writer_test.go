@@ -0,0 +1,181 @@
+package replication
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func testBinlogTransaction(t *testing.T, gno int64) []*BinlogEvent {
+	sid := []byte{0x5a, 0xa7, 0x2a, 0x7f, 0x44, 0xa8, 0x11, 0xe6, 0x88, 0x5a, 0x0e, 0x7e, 0x1c, 0x9d, 0x8b, 0x3a}
+
+	table := &TableMapEvent{
+		tableIDSize: 6,
+		TableID:     100,
+		Flags:       1,
+		Schema:      []byte("db"),
+		Table:       []byte("tbl"),
+		ColumnCount: 1,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_LONG},
+		ColumnMeta:  []uint16{0},
+		NullBitmap:  []byte{0},
+	}
+	rows, err := NewRowsEvent(WRITE_ROWS_EVENTv2, table)
+	require.NoError(t, err)
+	rows.Rows = [][]any{{int32(gno)}}
+
+	return []*BinlogEvent{
+		{Header: &EventHeader{EventType: GTID_EVENT, ServerID: 1}, Event: &GTIDEvent{SID: sid, GNO: gno}},
+		{Header: &EventHeader{EventType: QUERY_EVENT, ServerID: 1}, Event: &QueryEvent{Schema: []byte("db"), Query: []byte("BEGIN")}},
+		{Header: &EventHeader{EventType: TABLE_MAP_EVENT, ServerID: 1}, Event: table},
+		{Header: &EventHeader{EventType: WRITE_ROWS_EVENTv2, ServerID: 1}, Event: rows},
+		{Header: &EventHeader{EventType: XID_EVENT, ServerID: 1}, Event: &XIDEvent{XID: uint64(gno)}},
+	}
+}
+
+func TestBinlogWriter(t *testing.T) {
+	dir := t.TempDir()
+
+	gset, err := mysql.ParseMysqlGTIDSet("5aa72a7f-44a8-11e6-885a-0e7e1c9d8b3a:1-10")
+	require.NoError(t, err)
+
+	w, err := NewBinlogWriter(BinlogWriterConfig{
+		Dir:         dir,
+		MaxFileSize: 500,
+		ServerID:    1,
+		GTIDSet:     gset,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "mysql-bin.000001", w.Position().Name)
+
+	for gno := int64(11); gno <= 20; gno++ {
+		for _, e := range testBinlogTransaction(t, gno) {
+			require.NoError(t, w.WriteEvent(e))
+		}
+	}
+	require.Equal(t, "5aa72a7f-44a8-11e6-885a-0e7e1c9d8b3a:1-20", w.GTIDSet().String())
+	require.NoError(t, w.Close())
+
+	index, err := os.ReadFile(filepath.Join(dir, "mysql-bin.index"))
+	require.NoError(t, err)
+
+	files := []string{}
+	for _, line := range strings.Fields(string(index)) {
+		require.True(t, strings.HasPrefix(line, "./"))
+		files = append(files, filepath.Base(line))
+	}
+	require.Greater(t, len(files), 1)
+
+	parser := NewBinlogParser()
+	parser.SetVerifyChecksum(true)
+
+	xids := uint64(0)
+	for i, name := range files {
+		var types []EventType
+		var previous string
+		pos := uint32(4)
+		err = parser.ParseFile(filepath.Join(dir, name), 0, func(e *BinlogEvent) error {
+			pos += e.Header.EventSize
+			require.Equal(t, pos, e.Header.LogPos)
+			types = append(types, e.Header.EventType)
+
+			switch ev := e.Event.(type) {
+			case *FormatDescriptionEvent:
+				// only the first file is created at the start of the writer
+				if i == 0 {
+					require.NotZero(t, ev.CreateTimestamp)
+				} else {
+					require.Zero(t, ev.CreateTimestamp)
+				}
+			case *PreviousGTIDsEvent:
+				previous = ev.GTIDSets
+			case *RowsEvent:
+				require.Equal(t, [][]any{{int32(xids + 11)}}, ev.Rows)
+			case *XIDEvent:
+				require.Equal(t, xids+11, ev.XID)
+				xids++
+			case *RotateEvent:
+				require.Equal(t, files[i+1], string(ev.NextLogName))
+				require.Equal(t, uint64(4), ev.Position)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, FORMAT_DESCRIPTION_EVENT, types[0])
+		require.Equal(t, PREVIOUS_GTIDS_EVENT, types[1])
+		if len(types) > 2 {
+			require.Equal(t, GTID_EVENT, types[2])
+		}
+		if i < len(files)-1 {
+			require.Equal(t, ROTATE_EVENT, types[len(types)-1])
+			require.Equal(t, XID_EVENT, types[len(types)-2])
+		}
+		if i == 0 {
+			require.Equal(t, "5aa72a7f-44a8-11e6-885a-0e7e1c9d8b3a:1-10", previous)
+		}
+	}
+	require.Equal(t, uint64(10), xids)
+
+	// a new writer continues after the last indexed file
+	w, err = NewBinlogWriter(BinlogWriterConfig{Dir: dir})
+	require.NoError(t, err)
+	// with the PREVIOUS_GTIDS_EVENT of the transactions of the previous files
+	require.Equal(t, mysql.Position{Name: fmt.Sprintf("mysql-bin.%06d", len(files)+1), Pos: 4 + 122 + 71}, w.Position())
+	require.Equal(t, "5aa72a7f-44a8-11e6-885a-0e7e1c9d8b3a:1-20", w.GTIDSet().String())
+	require.NoError(t, w.Rotate())
+	require.NoError(t, w.Close())
+	require.Error(t, w.WriteEvent(testBinlogTransaction(t, 21)[0]))
+
+	_, err = NewBinlogWriter(BinlogWriterConfig{Dir: dir, Flavor: mysql.MariaDBFlavor})
+	require.Error(t, err)
+}
+
+func TestBinlogWriterStatementTransactions(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewBinlogWriter(BinlogWriterConfig{Dir: dir, MaxFileSize: 200, ServerID: 1})
+	require.NoError(t, err)
+
+	sid := []byte{0x5a, 0xa7, 0x2a, 0x7f, 0x44, 0xa8, 0x11, 0xe6, 0x88, 0x5a, 0x0e, 0x7e, 0x1c, 0x9d, 0x8b, 0x3a}
+	query := func(q string) *BinlogEvent {
+		return &BinlogEvent{Header: &EventHeader{EventType: QUERY_EVENT, ServerID: 1}, Event: &QueryEvent{Schema: []byte("db"), Query: []byte(q)}}
+	}
+	for gno := int64(1); gno <= 3; gno++ {
+		events := []*BinlogEvent{
+			{Header: &EventHeader{EventType: GTID_EVENT, ServerID: 1}, Event: &GTIDEvent{SID: sid, GNO: gno}},
+			query("BEGIN"),
+			query("INSERT INTO t VALUES (1)"),
+			query("SAVEPOINT s1"),
+			query("UPDATE t SET a = 2"),
+			query("COMMIT"),
+		}
+		for _, e := range events {
+			require.NoError(t, w.WriteEvent(e))
+		}
+	}
+	require.NoError(t, w.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "mysql-bin.0*"))
+	require.NoError(t, err)
+	// the last file is opened after the rotation at the end of the last transaction
+	require.Len(t, files, 4)
+
+	// every file has a whole transaction
+	for i, name := range files[:3] {
+		var queries []string
+		err = NewBinlogParser().ParseFile(name, 0, func(e *BinlogEvent) error {
+			if ev, ok := e.Event.(*QueryEvent); ok {
+				queries = append(queries, string(ev.Query))
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"BEGIN", "INSERT INTO t VALUES (1)", "SAVEPOINT s1", "UPDATE t SET a = 2", "COMMIT"}, queries, i)
+	}
+}
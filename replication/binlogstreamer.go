@@ -2,6 +2,8 @@ package replication
 
 import (
 	"context"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/pingcap/errors"
@@ -17,43 +19,63 @@ type BinlogStreamer struct {
 	ch  chan *BinlogEvent
 	ech chan error
 	err error
+
+	// maxBytes is the budget of the raw size of the queued events, 0 if there is none
+	maxBytes int64
+	m        sync.Mutex
+	bytes    int64
+	// released wakes up the reader waiting for the budget
+	released chan struct{}
+
+	// metrics is told the size of the queue when it changes
+	metrics Metrics
 }
 
 // GetEvent gets the binlog event one by one, it will block until Syncer receives any events from MySQL
 // or meets a sync error. You can pass a context (like Cancel or Timeout) to break the block.
+// When the stop condition of the syncer is met, it returns the events left and then io.EOF.
 func (s *BinlogStreamer) GetEvent(ctx context.Context) (*BinlogEvent, error) {
-	if s.err != nil {
+	if s.err == io.EOF {
+		return s.eventAfterEOF()
+	} else if s.err != nil {
 		return nil, ErrNeedSyncAgain
 	}
 
 	select {
 	case c := <-s.ch:
-		return c, nil
+		return s.dequeued(c), nil
 	case s.err = <-s.ech:
+		if s.err == io.EOF {
+			return s.eventAfterEOF()
+		}
 		return nil, s.err
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
 }
 
+// eventAfterEOF returns the events sent before the sync stopped at its stop condition,
+// then io.EOF.
+func (s *BinlogStreamer) eventAfterEOF() (*BinlogEvent, error) {
+	select {
+	case c := <-s.ch:
+		return s.dequeued(c), nil
+	default:
+		return nil, io.EOF
+	}
+}
+
 // GetEventWithStartTime gets the binlog event with starttime, if current binlog event timestamp smaller than specify starttime
 // return nil event
 func (s *BinlogStreamer) GetEventWithStartTime(ctx context.Context, startTime time.Time) (*BinlogEvent, error) {
-	if s.err != nil {
-		return nil, ErrNeedSyncAgain
+	c, err := s.GetEvent(ctx)
+	if err != nil {
+		return nil, err
 	}
-	startUnix := startTime.Unix()
-	select {
-	case c := <-s.ch:
-		if int64(c.Header.Timestamp) >= startUnix {
-			return c, nil
-		}
-		return nil, nil
-	case s.err = <-s.ech:
-		return nil, s.err
-	case <-ctx.Done():
-		return nil, ctx.Err()
+	if int64(c.Header.Timestamp) >= startTime.Unix() {
+		return c, nil
 	}
+	return nil, nil
 }
 
 // DumpEvents dumps all left events
@@ -61,7 +83,7 @@ func (s *BinlogStreamer) DumpEvents() []*BinlogEvent {
 	count := len(s.ch)
 	events := make([]*BinlogEvent, count)
 	for i := range events {
-		events[i] = <-s.ch
+		events[i] = s.dequeued(<-s.ch)
 	}
 	return events
 }
@@ -86,6 +108,13 @@ func NewBinlogStreamer() *BinlogStreamer {
 }
 
 func NewBinlogStreamerWithChanSize(chanSize int) *BinlogStreamer {
+	return NewBinlogStreamerWithLimits(chanSize, 0)
+}
+
+// NewBinlogStreamerWithLimits creates the BinlogStreamer which queues up to chanSize events,
+// and up to maxBytes of their raw size if maxBytes > 0. An event larger than maxBytes is
+// queued alone.
+func NewBinlogStreamerWithLimits(chanSize int, maxBytes int64) *BinlogStreamer {
 	s := new(BinlogStreamer)
 
 	if chanSize <= 0 {
@@ -94,17 +123,103 @@ func NewBinlogStreamerWithChanSize(chanSize int) *BinlogStreamer {
 
 	s.ch = make(chan *BinlogEvent, chanSize)
 	s.ech = make(chan error, 4)
+	s.maxBytes = max(maxBytes, 0)
+	s.released = make(chan struct{}, 1)
+	s.metrics = noopMetrics{}
 
 	return s
 }
 
+// QueuedEvents returns the number of the events waiting to be read.
+func (s *BinlogStreamer) QueuedEvents() int {
+	return len(s.ch)
+}
+
+// QueuedBytes returns the raw size of the events waiting to be read.
+func (s *BinlogStreamer) QueuedBytes() int64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.bytes
+}
+
+// eventBytes returns the size of the event accounted in the budget.
+func eventBytes(e *BinlogEvent) int64 {
+	if e.Header == nil {
+		return int64(len(e.RawData))
+	}
+	return int64(e.Header.EventSize)
+}
+
+// reserve waits until the event of n bytes fits in the budget, and accounts it. The
+// budget is exceeded only by an event larger than the budget, when no event is queued.
+func (s *BinlogStreamer) reserve(ctx context.Context, n int64) error {
+	for {
+		s.m.Lock()
+		if s.maxBytes == 0 || s.bytes == 0 || s.bytes+n <= s.maxBytes {
+			s.bytes += n
+			s.m.Unlock()
+			return nil
+		}
+		s.m.Unlock()
+
+		select {
+		case <-s.released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release removes the event of n bytes from the budget.
+func (s *BinlogStreamer) release(n int64) {
+	s.m.Lock()
+	s.bytes -= n
+	s.m.Unlock()
+
+	select {
+	case s.released <- struct{}{}:
+	default:
+	}
+}
+
+// dequeued releases the budget of the event read from the queue.
+func (s *BinlogStreamer) dequeued(e *BinlogEvent) *BinlogEvent {
+	s.release(eventBytes(e))
+	s.metrics.OnStreamerQueue(s.QueuedEvents(), s.QueuedBytes())
+	return e
+}
+
+// enqueue queues the event, it waits for the budget first.
+func (s *BinlogStreamer) enqueue(ctx context.Context, e *BinlogEvent) error {
+	n := eventBytes(e)
+	if err := s.reserve(ctx, n); err != nil {
+		return err
+	}
+
+	select {
+	case s.ch <- e:
+		s.metrics.OnStreamerQueue(s.QueuedEvents(), s.QueuedBytes())
+		return nil
+	case <-ctx.Done():
+		s.release(n)
+		return ctx.Err()
+	}
+}
+
 // AddEventToStreamer adds a binlog event to the streamer. You can use it when you want to add an event to the streamer manually.
 // can be used in replication handlers
 func (s *BinlogStreamer) AddEventToStreamer(ev *BinlogEvent) error {
+	n := eventBytes(ev)
+	s.m.Lock()
+	s.bytes += n
+	s.m.Unlock()
+
 	select {
 	case s.ch <- ev:
 		return nil
 	case err := <-s.ech:
+		s.release(n)
 		return err
 	}
 }
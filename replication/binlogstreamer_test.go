@@ -0,0 +1,62 @@
+package replication
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinlogStreamerByteBudget(t *testing.T) {
+	s := NewBinlogStreamerWithLimits(10, 100)
+	event := func(size uint32) *BinlogEvent {
+		return &BinlogEvent{Header: &EventHeader{EventSize: size}}
+	}
+	ctx := context.Background()
+
+	require.NoError(t, s.enqueue(ctx, event(60)))
+	require.Equal(t, int64(60), s.QueuedBytes())
+	require.Equal(t, 1, s.QueuedEvents())
+
+	// the reader waits until the queued events fit in the budget
+	queued := make(chan error)
+	go func() {
+		queued <- s.enqueue(ctx, event(60))
+	}()
+	select {
+	case <-queued:
+		require.FailNow(t, "the event exceeding the budget is queued")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	e, err := s.GetEvent(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint32(60), e.Header.EventSize)
+	require.NoError(t, <-queued)
+	require.Equal(t, int64(60), s.QueuedBytes())
+
+	_, err = s.GetEvent(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), s.QueuedBytes())
+
+	// an event larger than the budget is queued alone
+	require.NoError(t, s.enqueue(ctx, event(1000)))
+	require.Equal(t, int64(1000), s.QueuedBytes())
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.ErrorIs(t, s.enqueue(canceled, event(1)), context.Canceled)
+	require.Equal(t, int64(1000), s.QueuedBytes())
+
+	require.Len(t, s.DumpEvents(), 1)
+	require.Equal(t, int64(0), s.QueuedBytes())
+	require.Equal(t, 0, s.QueuedEvents())
+
+	// no budget
+	s = NewBinlogStreamerWithChanSize(10)
+	for range 3 {
+		require.NoError(t, s.enqueue(ctx, event(1<<30)))
+	}
+	require.Equal(t, int64(3<<30), s.QueuedBytes())
+}
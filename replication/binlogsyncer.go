@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"os"
@@ -49,6 +50,17 @@ type BinlogSyncerConfig struct {
 	// SemiSyncEnabled enables semi-sync or not.
 	SemiSyncEnabled bool
 
+	// SemiSyncManualACK delays the semi-sync ACK of an event until the consumer calls
+	// BinlogSyncer.AckPosition, e.g. after it durably stored the transaction, instead of
+	// replying as soon as the event is handed to GetEvent or SynchronousEventHandler. Then
+	// a transaction committed on the source is stored downstream too.
+	SemiSyncManualACK bool
+
+	// SemiSyncACKTimeout is the time to wait for AckPosition with SemiSyncManualACK, then
+	// the ACK is sent anyway. If 0, the ACK waits for AckPosition, and the source falls
+	// back to asynchronous replication after its rpl_semi_sync_source_timeout.
+	SemiSyncACKTimeout time.Duration
+
 	// RawModeEnabled is for not parsing binlog event.
 	RawModeEnabled bool
 
@@ -110,6 +122,25 @@ type BinlogSyncerConfig struct {
 	//     are unaffected.
 	RenderJSONAsMySQLText bool
 
+	// ApplyJSONPartialUpdates applies the JSON diffs of PARTIAL_UPDATE_ROWS_EVENT
+	// (binlog_row_value_options=PARTIAL_JSON) to the before image, so the after
+	// image has the complete JSON value as a string instead of *JsonDiff. The
+	// before image must have the JSON column, i.e. binlog_row_image=FULL,
+	// otherwise the event fails to decode.
+	ApplyJSONPartialUpdates bool
+
+	// LazyRowsDecode keeps the rows data of the RowsEvents instead of decoding all the rows
+	// into Rows up front, they are decoded one at a time by RowsEvent.RowIterator, only the
+	// columns it projects. It avoids materializing the rows of the large events, e.g. the
+	// bulk updates of tables with BLOBs, while they wait in the BinlogStreamer. Rows is nil,
+	// so the APIs reading it, like RowsEvent.Dump, see no rows.
+	LazyRowsDecode bool
+
+	// EventFilter selects the events to decode by their type and, for the rows events, by
+	// their table. The rows of the filtered rows events are skipped before they are decoded,
+	// see EventFilter and NewTableEventFilter.
+	EventFilter EventFilter `json:"-"`
+
 	// RecvBufferSize sets the size in bytes of the operating system's receive buffer associated with the connection.
 	RecvBufferSize int
 
@@ -126,6 +157,16 @@ type BinlogSyncerConfig struct {
 	// whether disable re-sync for broken connection
 	DisableRetrySync bool
 
+	// FailoverSources are the other servers of the replication topology, e.g. the replicas
+	// of Host. When the sync with GTID can't reconnect to the current source, it resumes
+	// from the first of them whose executed GTID set contains the transactions received so
+	// far, and whose flavor and ServerUUID match. See BinlogSyncer.CurrentSource.
+	FailoverSources []SyncSource
+
+	// DiscoverSources returns the failover candidates instead of FailoverSources, it's
+	// called at each failover, e.g. to ask the orchestrator of the topology.
+	DiscoverSources func(ctx context.Context) ([]SyncSource, error) `json:"-"`
+
 	// Only works when MySQL/MariaDB variable binlog_checksum=CRC32.
 	// For MySQL, binlog_checksum was introduced since 5.6.2, but CRC32 was set as default value since 5.6.6 .
 	// https://dev.mysql.com/doc/refman/5.6/en/replication-options-binary-log.html#option_mysqld_binlog-checksum
@@ -159,6 +200,12 @@ type BinlogSyncerConfig struct {
 
 	EventCacheCount int
 
+	// EventCacheBytes bounds the raw size of the events queued in the BinlogStreamer, the
+	// sync waits for GetEvent when they exceed it, like when EventCacheCount events are
+	// queued. An event larger than it is queued alone. If 0, only EventCacheCount applies.
+	// See BinlogStreamer.QueuedBytes.
+	EventCacheBytes int64
+
 	// FillZeroLogPos enables dynamic LogPos calculation for MariaDB.
 	// When enabled, automatically adds BINLOG_SEND_ANNOTATE_ROWS_EVENT flag
 	// to ensure correct position calculation in MariaDB 11.4+.
@@ -169,6 +216,14 @@ type BinlogSyncerConfig struct {
 	// Default 0,  this will be set to GOMAXPROCS.
 	PayloadDecoderConcurrency int
 
+	// StopCondition ends the sync at a transaction boundary, the BinlogStreamer returns
+	// io.EOF after the last event. See StopCondition for the conditions.
+	StopCondition StopCondition
+
+	// Metrics receives the measurements of the sync, e.g. the events received and the
+	// reconnections, see Metrics.
+	Metrics Metrics `json:"-"`
+
 	// SynchronousEventHandler is used for synchronous event handling.
 	// This should not be used together with StartBackupWithHandler.
 	// If this is not nil, GetEvent does not need to be called.
@@ -207,6 +262,16 @@ type BinlogSyncer struct {
 	lastConnectionID uint32
 
 	retryCount int
+
+	stop *stopTracker
+
+	acks semiSyncACKs
+
+	// sourceUUID is the expected server UUID of the failover source Host and Port are
+	// switched to, see SyncSource.ServerUUID.
+	sourceUUID string
+	sourceM    sync.Mutex
+	source     SyncSource
 }
 
 // NewBinlogSyncer creates the BinlogSyncer with the given configuration.
@@ -225,6 +290,9 @@ func NewBinlogSyncer(cfg BinlogSyncerConfig) *BinlogSyncer {
 	if cfg.EventCacheCount == 0 {
 		cfg.EventCacheCount = 10240
 	}
+	if cfg.Metrics == nil {
+		cfg.Metrics = noopMetrics{}
+	}
 
 	// Clear the Password to avoid outputting it in logs.
 	pass := cfg.Password
@@ -243,12 +311,16 @@ func NewBinlogSyncer(cfg BinlogSyncerConfig) *BinlogSyncer {
 	b.parser.SetUseDecimal(b.cfg.UseDecimal)
 	b.parser.SetUseFloatWithTrailingZero(b.cfg.UseFloatWithTrailingZero)
 	b.parser.SetRenderJSONAsMySQLText(b.cfg.RenderJSONAsMySQLText)
+	b.parser.SetApplyJSONPartialUpdates(b.cfg.ApplyJSONPartialUpdates)
+	b.parser.SetLazyRowsDecode(b.cfg.LazyRowsDecode)
+	b.parser.SetEventFilter(b.cfg.EventFilter)
 	b.parser.SetVerifyChecksum(b.cfg.VerifyChecksum)
 	b.parser.SetPayloadDecoderConcurrency(cfg.PayloadDecoderConcurrency)
 	b.parser.SetRowsEventDecodeFunc(b.cfg.RowsEventDecodeFunc)
 	b.parser.SetTableMapOptionalMetaDecodeFunc(b.cfg.TableMapOptionalMetaDecodeFunc)
 	b.running = false
 	b.ctx, b.cancel = context.WithCancel(context.Background())
+	b.source = SyncSource{Host: cfg.Host, Port: cfg.Port}
 
 	return b
 }
@@ -300,6 +372,7 @@ func (b *BinlogSyncer) close() {
 
 	b.wg.Wait()
 
+	b.clearPendingACKs()
 	if b.c != nil {
 		b.c.Close()
 	}
@@ -459,11 +532,19 @@ func (b *BinlogSyncer) prepare() error {
 		return errors.Trace(err)
 	}
 
+	if b.failoverEnabled() {
+		if err := b.checkSource(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
 	if err := b.enableSemiSync(); err != nil {
 		return errors.Trace(err)
 	}
 
-	b.cfg.Logger.Info("Connected to server", slog.String("flavor", b.cfg.Flavor), slog.String("version", b.c.GetServerVersion()))
+	source := b.CurrentSource()
+	b.cfg.Logger.Info("Connected to server", slog.String("flavor", b.cfg.Flavor), slog.String("version", b.c.GetServerVersion()),
+		slog.String("source", source.String()), slog.String("server UUID", source.ServerUUID))
 
 	return nil
 }
@@ -471,7 +552,8 @@ func (b *BinlogSyncer) prepare() error {
 func (b *BinlogSyncer) startDumpStream() *BinlogStreamer {
 	b.running = true
 
-	s := NewBinlogStreamerWithChanSize(b.cfg.EventCacheCount)
+	s := NewBinlogStreamerWithLimits(b.cfg.EventCacheCount, b.cfg.EventCacheBytes)
+	s.metrics = b.cfg.Metrics
 
 	b.wg.Add(1)
 	go b.onStream(s)
@@ -511,6 +593,8 @@ func (b *BinlogSyncer) StartSync(pos mysql.Position) (*BinlogStreamer, error) {
 
 	b.checkFlavor()
 
+	b.stop = newStopTracker(b.cfg.StopCondition, pos.Name, nil)
+
 	return b.startDumpStream(), nil
 }
 
@@ -551,6 +635,8 @@ func (b *BinlogSyncer) StartSyncGTID(gset mysql.GTIDSet) (*BinlogStreamer, error
 
 	b.checkFlavor()
 
+	b.stop = newStopTracker(b.cfg.StopCondition, "", gset)
+
 	return b.startDumpStream(), nil
 }
 
@@ -717,6 +803,7 @@ func (b *BinlogSyncer) replySemiSyncACK(p mysql.Position) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
+	b.cfg.Metrics.OnSemiSyncACK()
 
 	return nil
 }
@@ -727,6 +814,8 @@ func (b *BinlogSyncer) retrySync() error {
 
 	b.parser.Reset()
 	b.prevMySQLGTIDEvent = nil
+	// the source doesn't wait for the ACKs on the new connection
+	b.clearPendingACKs()
 
 	if b.prevGset != nil {
 		extra := []any{slog.String("GTID Set", b.prevGset.String())}
@@ -736,7 +825,12 @@ func (b *BinlogSyncer) retrySync() error {
 		b.cfg.Logger.Info("begin to re-sync", extra...)
 
 		if err := b.prepareSyncGTID(b.prevGset); err != nil {
-			return errors.Trace(err)
+			if !b.failoverEnabled() {
+				return errors.Trace(err)
+			}
+			if err = b.failover(err); err != nil {
+				return errors.Trace(err)
+			}
 		}
 	} else {
 		b.cfg.Logger.Info("begin to re-sync", slog.String("file", b.nextPos.Name), slog.Uint64("position", uint64(b.nextPos.Pos)))
@@ -830,7 +924,9 @@ func (b *BinlogSyncer) onStream(s *BinlogStreamer) {
 					return
 				case <-time.After(time.Second):
 					b.retryCount++
-					if err = b.retrySync(); err != nil {
+					err = b.retrySync()
+					b.cfg.Metrics.OnReconnect(err)
+					if err != nil {
 						if b.cfg.MaxReconnectAttempts > 0 && b.retryCount >= b.cfg.MaxReconnectAttempts {
 							b.cfg.Logger.Error(
 								"retry sync err, exceeded max retries",
@@ -866,11 +962,25 @@ func (b *BinlogSyncer) onStream(s *BinlogStreamer) {
 		switch data[0] {
 		case mysql.OK_HEADER:
 			// Parse the event
+			start := time.Now()
 			e, needACK, err := b.parseEvent(data)
 			if err != nil {
 				s.closeWithError(err)
 				return
 			}
+			b.observeEvent(e.Header, time.Since(start))
+
+			var stopBefore, stopAfter bool
+			if b.stop != nil {
+				if stopBefore, stopAfter, err = b.stop.next(e); err != nil {
+					s.closeWithError(err)
+					return
+				}
+			}
+			if stopBefore {
+				b.stopSync(s, e, needACK)
+				return
+			}
 
 			// Handle the event and send ACK if necessary
 			err = b.handleEventAndACK(s, e, needACK)
@@ -878,6 +988,10 @@ func (b *BinlogSyncer) onStream(s *BinlogStreamer) {
 				s.closeWithError(err)
 				return
 			}
+			if stopAfter {
+				b.stopSync(s, e, false)
+				return
+			}
 		case mysql.ERR_HEADER:
 			err = b.c.HandleErrorPacket(data)
 			s.closeWithError(err)
@@ -895,6 +1009,21 @@ func (b *BinlogSyncer) onStream(s *BinlogStreamer) {
 	}
 }
 
+// stopSync ends the stream with io.EOF when the stop condition is met at the event.
+// needACK is true if the event is not handled but the source waits for its ACK.
+func (b *BinlogSyncer) stopSync(s *BinlogStreamer, e *BinlogEvent, needACK bool) {
+	b.cfg.Logger.Info("stop condition is met, stop syncing",
+		slog.String("eventType", e.Header.EventType.String()), slog.Uint64("logPos", uint64(e.Header.LogPos)))
+
+	if needACK {
+		// don't let the source wait for the semi-sync timeout
+		if err := b.replySemiSyncACK(mysql.Position{Name: b.nextPos.Name, Pos: e.Header.LogPos}); err != nil {
+			b.cfg.Logger.Warn("failed to reply semi-sync ACK", slog.Any("error", err))
+		}
+	}
+	s.closeWithError(io.EOF)
+}
+
 // parseEvent parses the raw data into a BinlogEvent.
 // It only handles parsing and does not perform any side effects.
 // Returns the parsed BinlogEvent, a boolean indicating if an ACK is needed, and an error if the
@@ -1013,6 +1142,11 @@ func (b *BinlogSyncer) handleEventAndACK(s *BinlogStreamer, e *BinlogEvent, need
 			event.GSet = b.getCurrentGtidSet()
 		}
 
+	case *XAPrepareEvent:
+		if !b.cfg.DiscardGTIDSet {
+			event.GSet = b.getCurrentGtidSet()
+		}
+
 	case *TransactionPayloadEvent:
 		// XID/Query decoded from compressed payload need GTID set attached,
 		// same as their uncompressed counterparts above; GTID event precedes
@@ -1024,11 +1158,28 @@ func (b *BinlogSyncer) handleEventAndACK(s *BinlogStreamer, e *BinlogEvent, need
 					innerEvent.GSet = b.getCurrentGtidSet()
 				case *QueryEvent:
 					innerEvent.GSet = b.getCurrentGtidSet()
+				case *XAPrepareEvent:
+					innerEvent.GSet = b.getCurrentGtidSet()
 				}
 			}
 		}
 	}
 
+	switch e.Event.(type) {
+	case *XIDEvent, *QueryEvent, *XAPrepareEvent, *TransactionPayloadEvent:
+		if b.currGset != nil {
+			b.cfg.Metrics.OnGTIDSet(b.currGset)
+		}
+	}
+
+	if needACK && b.cfg.SemiSyncManualACK {
+		// The source resets the sequence after the event waiting for the ACK, and the ACK
+		// is packet 0, so the next event is packet 1 whenever the ACK is sent.
+		b.c.Sequence = 1
+		b.addPendingACK(b.nextPos)
+		needACK = false
+	}
+
 	// Use SynchronousEventHandler if it's set
 	if b.cfg.SynchronousEventHandler != nil {
 		err := b.cfg.SynchronousEventHandler.HandleEvent(e)
@@ -1036,10 +1187,9 @@ func (b *BinlogSyncer) handleEventAndACK(s *BinlogStreamer, e *BinlogEvent, need
 			return errors.Trace(err)
 		}
 	} else {
-		// Asynchronous mode: send the event to the streamer channel
-		select {
-		case s.ch <- e:
-		case <-b.ctx.Done():
+		// Asynchronous mode: send the event to the streamer channel, it blocks while
+		// the queued events exceed EventCacheCount or EventCacheBytes
+		if err := s.enqueue(b.ctx, e); err != nil {
 			return errors.New("sync is being closed")
 		}
 	}
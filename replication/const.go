@@ -271,6 +271,27 @@ const (
 	INSERT_ID
 )
 
+// UserVarType is the type of the value of a USER_VAR_EVENT, see enum Item_result in MySQL.
+type UserVarType byte
+
+const (
+	USER_VAR_STRING UserVarType = iota
+	USER_VAR_REAL
+	USER_VAR_INT
+	USER_VAR_ROW
+	USER_VAR_DECIMAL
+)
+
+// USER_VAR_UNSIGNED_F is the flag of an unsigned USER_VAR_INT value
+const USER_VAR_UNSIGNED_F = 1
+
+type IncidentType uint16
+
+const (
+	INCIDENT_NONE IncidentType = iota
+	INCIDENT_LOST_EVENTS
+)
+
 const (
 	ENUM_EXTRA_ROW_INFO_TYPECODE_NDB byte = iota
 	ENUM_EXTRA_ROW_INFO_TYPECODE_PARTITION
@@ -0,0 +1,465 @@
+package replication
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// RandEvent is a RAND_EVENT, it is logged before a statement using RAND() with
+// binlog_format=STATEMENT.
+// https://dev.mysql.com/doc/dev/mysql-server/latest/classmysql_1_1binlog_1_1event_1_1Rand__event.html
+type RandEvent struct {
+	Seed1 uint64
+	Seed2 uint64
+}
+
+func (e *RandEvent) Decode(data []byte) error {
+	if len(data) < 16 {
+		return errors.Trace(io.ErrUnexpectedEOF)
+	}
+	e.Seed1 = binary.LittleEndian.Uint64(data)
+	e.Seed2 = binary.LittleEndian.Uint64(data[8:])
+	return nil
+}
+
+func (e *RandEvent) Encode() ([]byte, error) {
+	data := make([]byte, 0, 16)
+	data = binary.LittleEndian.AppendUint64(data, e.Seed1)
+	data = binary.LittleEndian.AppendUint64(data, e.Seed2)
+	return data, nil
+}
+
+func (e *RandEvent) Dump(w io.Writer) {
+	fmt.Fprintf(w, "Seed1: %d\n", e.Seed1)
+	fmt.Fprintf(w, "Seed2: %d\n", e.Seed2)
+	fmt.Fprintln(w)
+}
+
+// UserVarEvent is a USER_VAR_EVENT, it is logged before a statement using a user
+// variable with binlog_format=STATEMENT.
+// https://dev.mysql.com/doc/dev/mysql-server/latest/classmysql_1_1binlog_1_1event_1_1User__var__event.html
+type UserVarEvent struct {
+	Name   []byte
+	IsNull bool
+	Type   UserVarType
+	// Charset is the collation ID of a USER_VAR_STRING value
+	Charset uint32
+	// Value is the encoded value, use ParsedValue to decode it
+	Value []byte
+	Flags uint8
+}
+
+func (e *UserVarEvent) Decode(data []byte) error {
+	if len(data) < 5 {
+		return errors.Trace(io.ErrUnexpectedEOF)
+	}
+	nameLen := int(binary.LittleEndian.Uint32(data))
+	pos := 4
+	if len(data) < pos+nameLen+1 {
+		return errors.Trace(io.ErrUnexpectedEOF)
+	}
+	e.Name = data[pos : pos+nameLen]
+	pos += nameLen
+
+	e.IsNull = data[pos] != 0
+	pos++
+	if e.IsNull {
+		return nil
+	}
+
+	if len(data) < pos+9 {
+		return errors.Trace(io.ErrUnexpectedEOF)
+	}
+	e.Type = UserVarType(data[pos])
+	pos++
+	e.Charset = binary.LittleEndian.Uint32(data[pos:])
+	pos += 4
+	valueLen := int(binary.LittleEndian.Uint32(data[pos:]))
+	pos += 4
+	if len(data) < pos+valueLen {
+		return errors.Trace(io.ErrUnexpectedEOF)
+	}
+	e.Value = data[pos : pos+valueLen]
+	pos += valueLen
+
+	// the flags are logged since MySQL 5.7
+	if pos < len(data) {
+		e.Flags = data[pos]
+	}
+
+	return nil
+}
+
+func (e *UserVarEvent) Encode() ([]byte, error) {
+	data := make([]byte, 0, 4+len(e.Name)+1+10+len(e.Value))
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(e.Name)))
+	data = append(data, e.Name...)
+	if e.IsNull {
+		return append(data, 1), nil
+	}
+
+	data = append(data, 0, byte(e.Type))
+	data = binary.LittleEndian.AppendUint32(data, e.Charset)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(e.Value)))
+	data = append(data, e.Value...)
+	data = append(data, e.Flags)
+	return data, nil
+}
+
+// ParsedValue returns the value of the variable: nil, string for USER_VAR_STRING and
+// USER_VAR_DECIMAL, float64 for USER_VAR_REAL, and int64 or uint64 for USER_VAR_INT.
+func (e *UserVarEvent) ParsedValue() (any, error) {
+	if e.IsNull {
+		return nil, nil
+	}
+
+	switch e.Type {
+	case USER_VAR_STRING:
+		return string(e.Value), nil
+	case USER_VAR_REAL:
+		if len(e.Value) < 8 {
+			return nil, errors.Trace(io.ErrUnexpectedEOF)
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(e.Value)), nil
+	case USER_VAR_INT:
+		if len(e.Value) < 8 {
+			return nil, errors.Trace(io.ErrUnexpectedEOF)
+		}
+		v := binary.LittleEndian.Uint64(e.Value)
+		if e.Flags&USER_VAR_UNSIGNED_F != 0 {
+			return v, nil
+		}
+		return int64(v), nil
+	case USER_VAR_DECIMAL:
+		if len(e.Value) < 2 {
+			return nil, errors.Trace(io.ErrUnexpectedEOF)
+		}
+		v, _, err := decodeDecimal(e.Value[2:], int(e.Value[0]), int(e.Value[1]), false)
+		return v, errors.Trace(err)
+	default:
+		return nil, errors.Errorf("unsupported user variable type %d", e.Type)
+	}
+}
+
+func (e *UserVarEvent) Dump(w io.Writer) {
+	fmt.Fprintf(w, "Name: %s\n", e.Name)
+	if e.IsNull {
+		fmt.Fprintf(w, "Value: NULL\n")
+	} else {
+		fmt.Fprintf(w, "Type: %d\n", e.Type)
+		fmt.Fprintf(w, "Charset: %d\n", e.Charset)
+		if v, err := e.ParsedValue(); err == nil {
+			fmt.Fprintf(w, "Value: %v\n", v)
+		} else {
+			fmt.Fprintf(w, "Value: %q\n", e.Value)
+		}
+		fmt.Fprintf(w, "Flags: %d\n", e.Flags)
+	}
+	fmt.Fprintln(w)
+}
+
+// IncidentEvent is an INCIDENT_EVENT, it is logged when the binlog may miss some changes,
+// so a replica must not continue without checking the data.
+// https://dev.mysql.com/doc/dev/mysql-server/latest/classmysql_1_1binlog_1_1event_1_1Incident__event.html
+type IncidentEvent struct {
+	Type    IncidentType
+	Message []byte
+}
+
+func (e *IncidentEvent) Decode(data []byte) error {
+	if len(data) < 2 {
+		return errors.Trace(io.ErrUnexpectedEOF)
+	}
+	e.Type = IncidentType(binary.LittleEndian.Uint16(data))
+	if len(data) == 2 {
+		return nil
+	}
+
+	msgLen := int(data[2])
+	if len(data) < 3+msgLen {
+		return errors.Trace(io.ErrUnexpectedEOF)
+	}
+	e.Message = data[3 : 3+msgLen]
+	return nil
+}
+
+func (e *IncidentEvent) Encode() ([]byte, error) {
+	if len(e.Message) > math.MaxUint8 {
+		return nil, errors.Errorf("incident message is too long, %d bytes", len(e.Message))
+	}
+
+	data := make([]byte, 0, 3+len(e.Message))
+	data = binary.LittleEndian.AppendUint16(data, uint16(e.Type))
+	data = append(data, byte(len(e.Message)))
+	data = append(data, e.Message...)
+	return data, nil
+}
+
+func (e *IncidentEvent) Dump(w io.Writer) {
+	fmt.Fprintf(w, "Type: %d\n", e.Type)
+	fmt.Fprintf(w, "Message: %s\n", e.Message)
+	fmt.Fprintln(w)
+}
+
+// viewIDLength is ENCODED_VIEW_ID_MAX_LEN of VIEW_CHANGE_EVENT
+const viewIDLength = 40
+
+// ViewChangeEvent is a VIEW_CHANGE_EVENT, it is logged by group replication when
+// the membership of the group changes.
+// https://dev.mysql.com/doc/dev/mysql-server/latest/classmysql_1_1binlog_1_1event_1_1View__change__event.html
+type ViewChangeEvent struct {
+	ViewID    string
+	SeqNumber uint64
+	// CertificationInfo is the certification database of the group
+	CertificationInfo map[string][]byte
+}
+
+func (e *ViewChangeEvent) Decode(data []byte) error {
+	if len(data) < viewIDLength+12 {
+		return errors.Trace(io.ErrUnexpectedEOF)
+	}
+	e.ViewID = strings.TrimRight(string(data[:viewIDLength]), "\x00")
+	pos := viewIDLength
+	e.SeqNumber = binary.LittleEndian.Uint64(data[pos:])
+	pos += 8
+	count := int(binary.LittleEndian.Uint32(data[pos:]))
+	pos += 4
+
+	e.CertificationInfo = make(map[string][]byte)
+	for range count {
+		if len(data) < pos+2 {
+			return errors.Trace(io.ErrUnexpectedEOF)
+		}
+		keyLen := int(binary.LittleEndian.Uint16(data[pos:]))
+		pos += 2
+		if len(data) < pos+keyLen+4 {
+			return errors.Trace(io.ErrUnexpectedEOF)
+		}
+		key := string(data[pos : pos+keyLen])
+		pos += keyLen
+		valueLen := int(binary.LittleEndian.Uint32(data[pos:]))
+		pos += 4
+		if len(data) < pos+valueLen {
+			return errors.Trace(io.ErrUnexpectedEOF)
+		}
+		e.CertificationInfo[key] = data[pos : pos+valueLen]
+		pos += valueLen
+	}
+
+	return nil
+}
+
+func (e *ViewChangeEvent) Encode() ([]byte, error) {
+	if len(e.ViewID) > viewIDLength {
+		return nil, errors.Errorf("view ID %q is longer than %d bytes", e.ViewID, viewIDLength)
+	}
+
+	data := make([]byte, viewIDLength, viewIDLength+12)
+	copy(data, e.ViewID)
+	data = binary.LittleEndian.AppendUint64(data, e.SeqNumber)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(e.CertificationInfo)))
+	for _, key := range e.certificationKeys() {
+		if len(key) > math.MaxUint16 {
+			return nil, errors.Errorf("certification key is too long, %d bytes", len(key))
+		}
+		value := e.CertificationInfo[key]
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(key)))
+		data = append(data, key...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(value)))
+		data = append(data, value...)
+	}
+	return data, nil
+}
+
+func (e *ViewChangeEvent) certificationKeys() []string {
+	keys := make([]string, 0, len(e.CertificationInfo))
+	for key := range e.CertificationInfo {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (e *ViewChangeEvent) Dump(w io.Writer) {
+	fmt.Fprintf(w, "View ID: %s\n", e.ViewID)
+	fmt.Fprintf(w, "Seq number: %d\n", e.SeqNumber)
+	fmt.Fprintf(w, "Certification info: %d\n", len(e.CertificationInfo))
+	for _, key := range e.certificationKeys() {
+		fmt.Fprintf(w, "  %s: %s\n", key, e.CertificationInfo[key])
+	}
+	fmt.Fprintln(w)
+}
+
+// XAPrepareEvent is an XA_PREPARE_LOG_EVENT, it ends the events of an XA transaction
+// at XA PREPARE, or at XA COMMIT ... ONE PHASE.
+// https://dev.mysql.com/doc/dev/mysql-server/latest/classmysql_1_1binlog_1_1event_1_1XA__prepare__event.html
+type XAPrepareEvent struct {
+	OnePhase bool
+	FormatID int32
+	GTRID    []byte
+	BQUAL    []byte
+
+	// like XIDEvent, it is not in the event but set by BinlogSyncer
+	GSet mysql.GTIDSet
+}
+
+func (e *XAPrepareEvent) Decode(data []byte) error {
+	if len(data) < 13 {
+		return errors.Trace(io.ErrUnexpectedEOF)
+	}
+	e.OnePhase = data[0] != 0
+	e.FormatID = int32(binary.LittleEndian.Uint32(data[1:]))
+	gtridLen := int(binary.LittleEndian.Uint32(data[5:]))
+	bqualLen := int(binary.LittleEndian.Uint32(data[9:]))
+	pos := 13
+	if len(data) < pos+gtridLen+bqualLen {
+		return errors.Trace(io.ErrUnexpectedEOF)
+	}
+	e.GTRID = data[pos : pos+gtridLen]
+	pos += gtridLen
+	e.BQUAL = data[pos : pos+bqualLen]
+	return nil
+}
+
+func (e *XAPrepareEvent) Encode() ([]byte, error) {
+	data := make([]byte, 0, 13+len(e.GTRID)+len(e.BQUAL))
+	if e.OnePhase {
+		data = append(data, 1)
+	} else {
+		data = append(data, 0)
+	}
+	data = binary.LittleEndian.AppendUint32(data, uint32(e.FormatID))
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(e.GTRID)))
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(e.BQUAL)))
+	data = append(data, e.GTRID...)
+	data = append(data, e.BQUAL...)
+	return data, nil
+}
+
+// XID returns the XA transaction ID like in XA COMMIT, e.g. X'6162',X'63',1
+func (e *XAPrepareEvent) XID() string {
+	return fmt.Sprintf("X'%s',X'%s',%d", hex.EncodeToString(e.GTRID), hex.EncodeToString(e.BQUAL), e.FormatID)
+}
+
+func (e *XAPrepareEvent) Dump(w io.Writer) {
+	fmt.Fprintf(w, "One phase: %t\n", e.OnePhase)
+	fmt.Fprintf(w, "XID: %s\n", e.XID())
+	if e.GSet != nil {
+		fmt.Fprintf(w, "GTIDSet: %s\n", e.GSet.String())
+	}
+	fmt.Fprintln(w)
+}
+
+// TransactionContextEvent is a TRANSACTION_CONTEXT_EVENT, it is logged by group replication
+// with the write set of the transaction used for its certification.
+// https://dev.mysql.com/doc/dev/mysql-server/latest/classmysql_1_1binlog_1_1event_1_1Transaction__context__event.html
+type TransactionContextEvent struct {
+	ServerUUID    string
+	ThreadID      uint32
+	GTIDSpecified bool
+	// SnapshotVersion is the encoded GTID set the transaction was executed on
+	SnapshotVersion []byte
+	WriteSet        [][]byte
+	ReadSet         [][]byte
+}
+
+func (e *TransactionContextEvent) Decode(data []byte) error {
+	if len(data) < 18 {
+		return errors.Trace(io.ErrUnexpectedEOF)
+	}
+	uuidLen := int(data[0])
+	e.ThreadID = binary.LittleEndian.Uint32(data[1:])
+	e.GTIDSpecified = data[5] != 0
+	snapshotLen := int(binary.LittleEndian.Uint32(data[6:]))
+	writeSetLen := int(binary.LittleEndian.Uint32(data[10:]))
+	readSetLen := int(binary.LittleEndian.Uint32(data[14:]))
+	pos := 18
+
+	if len(data) < pos+uuidLen+snapshotLen {
+		return errors.Trace(io.ErrUnexpectedEOF)
+	}
+	e.ServerUUID = string(data[pos : pos+uuidLen])
+	pos += uuidLen
+	e.SnapshotVersion = data[pos : pos+snapshotLen]
+	pos += snapshotLen
+
+	var err error
+	if e.WriteSet, pos, err = decodeTransactionContextSet(data, pos, writeSetLen); err != nil {
+		return errors.Trace(err)
+	}
+	e.ReadSet, _, err = decodeTransactionContextSet(data, pos, readSetLen)
+	return errors.Trace(err)
+}
+
+func decodeTransactionContextSet(data []byte, pos int, count int) ([][]byte, int, error) {
+	set := make([][]byte, 0, min(count, len(data)/2))
+	for range count {
+		if len(data) < pos+2 {
+			return nil, pos, io.ErrUnexpectedEOF
+		}
+		n := int(binary.LittleEndian.Uint16(data[pos:]))
+		pos += 2
+		if len(data) < pos+n {
+			return nil, pos, io.ErrUnexpectedEOF
+		}
+		set = append(set, data[pos:pos+n])
+		pos += n
+	}
+	return set, pos, nil
+}
+
+func (e *TransactionContextEvent) Encode() ([]byte, error) {
+	if len(e.ServerUUID) > math.MaxUint8 {
+		return nil, errors.Errorf("server UUID %q is too long", e.ServerUUID)
+	}
+
+	data := make([]byte, 0, 18+len(e.ServerUUID)+len(e.SnapshotVersion))
+	data = append(data, byte(len(e.ServerUUID)))
+	data = binary.LittleEndian.AppendUint32(data, e.ThreadID)
+	if e.GTIDSpecified {
+		data = append(data, 1)
+	} else {
+		data = append(data, 0)
+	}
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(e.SnapshotVersion)))
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(e.WriteSet)))
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(e.ReadSet)))
+	data = append(data, e.ServerUUID...)
+	data = append(data, e.SnapshotVersion...)
+	for _, set := range [][][]byte{e.WriteSet, e.ReadSet} {
+		for _, item := range set {
+			if len(item) > math.MaxUint16 {
+				return nil, errors.Errorf("transaction context item is too long, %d bytes", len(item))
+			}
+			data = binary.LittleEndian.AppendUint16(data, uint16(len(item)))
+			data = append(data, item...)
+		}
+	}
+	return data, nil
+}
+
+// SnapshotGTIDSet decodes SnapshotVersion.
+func (e *TransactionContextEvent) SnapshotGTIDSet() (mysql.GTIDSet, error) {
+	return mysql.DecodeMysqlGTIDSet(e.SnapshotVersion)
+}
+
+func (e *TransactionContextEvent) Dump(w io.Writer) {
+	fmt.Fprintf(w, "Server UUID: %s\n", e.ServerUUID)
+	fmt.Fprintf(w, "Thread ID: %d\n", e.ThreadID)
+	fmt.Fprintf(w, "GTID specified: %t\n", e.GTIDSpecified)
+	if gset, err := e.SnapshotGTIDSet(); err == nil {
+		fmt.Fprintf(w, "Snapshot version: %s\n", gset)
+	}
+	fmt.Fprintf(w, "Write set: %d items\n", len(e.WriteSet))
+	fmt.Fprintf(w, "Read set: %d items\n", len(e.ReadSet))
+	fmt.Fprintln(w)
+}
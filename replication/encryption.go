@@ -0,0 +1,308 @@
+package replication
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// EncryptionAlgorithm is the cipher mode of the MariaDB binlog files encrypted at rest.
+// It is not logged in the binlog, it is configured in the key management plugin, e.g.
+// file_key_management_encryption_algorithm.
+type EncryptionAlgorithm int
+
+const (
+	ENCRYPTION_ALGORITHM_AES_CBC EncryptionAlgorithm = iota
+	ENCRYPTION_ALGORITHM_AES_CTR
+)
+
+func (a EncryptionAlgorithm) String() string {
+	switch a {
+	case ENCRYPTION_ALGORITHM_AES_CBC:
+		return "AES_CBC"
+	case ENCRYPTION_ALGORITHM_AES_CTR:
+		return "AES_CTR"
+	default:
+		return fmt.Sprintf("EncryptionAlgorithm(%d)", int(a))
+	}
+}
+
+const (
+	// BINLOG_ENCRYPTION_KEY_ID is the key id used by MariaDB to encrypt the binlog files,
+	// ENCRYPTION_KEY_SYSTEM_DATA in the server.
+	BINLOG_ENCRYPTION_KEY_ID uint32 = 1
+
+	binlogNonceLength = 12
+)
+
+// EncryptionKeyProvider returns the keys of the MariaDB binlog files encrypted at rest,
+// see BinlogParser.SetEncryptionKeyProvider.
+type EncryptionKeyProvider interface {
+	// GetKey returns the key with the id and version, the binlog key id is BINLOG_ENCRYPTION_KEY_ID.
+	GetKey(keyID uint32, keyVersion uint32) ([]byte, error)
+	// Algorithm returns the cipher mode the keys are used with.
+	Algorithm() EncryptionAlgorithm
+}
+
+// FileKeyProvider is an EncryptionKeyProvider reading the keys from the key file of the
+// MariaDB file_key_management plugin. The key file has a "<id>;<hex key>" line per key,
+// it can be encrypted by openssl enc -aes-256-cbc -md sha1 with the file key. The plugin
+// doesn't support key rotation, so all keys have version 1.
+type FileKeyProvider struct {
+	keys      map[uint32][]byte
+	algorithm EncryptionAlgorithm
+}
+
+// NewFileKeyProvider reads the key file name like file_key_management_filename. fileKey is
+// file_key_management_filekey, it is empty if the key file is not encrypted, and it's read
+// from a file if it starts with "FILE:".
+func NewFileKeyProvider(name string, fileKey string, algorithm EncryptionAlgorithm) (*FileKeyProvider, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if path, ok := strings.CutPrefix(fileKey, "FILE:"); ok {
+		secret, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		fileKey = strings.TrimRight(string(secret), "\r\n")
+	}
+
+	if bytes.HasPrefix(data, []byte(opensslSaltedPrefix)) {
+		if fileKey == "" {
+			return nil, errors.Errorf("key file %s is encrypted, the file key is required", name)
+		}
+		if data, err = decryptOpensslFile(data, fileKey); err != nil {
+			return nil, errors.Annotatef(err, "decrypt key file %s", name)
+		}
+	}
+
+	keys, err := parseKeyFile(data)
+	if err != nil {
+		return nil, errors.Annotatef(err, "parse key file %s", name)
+	}
+
+	return &FileKeyProvider{keys: keys, algorithm: algorithm}, nil
+}
+
+func (p *FileKeyProvider) GetKey(keyID uint32, keyVersion uint32) ([]byte, error) {
+	if keyVersion != 1 {
+		return nil, errors.Errorf("key %d has no version %d, the key file only has version 1", keyID, keyVersion)
+	}
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, errors.Errorf("key %d is not in the key file", keyID)
+	}
+	return key, nil
+}
+
+func (p *FileKeyProvider) Algorithm() EncryptionAlgorithm {
+	return p.algorithm
+}
+
+func parseKeyFile(data []byte) (map[uint32][]byte, error) {
+	keys := make(map[uint32][]byte)
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		id, key, ok := strings.Cut(line, ";")
+		if !ok {
+			return nil, errors.Errorf("line %d: missing ';' between the key id and the key", n)
+		}
+		keyID, err := strconv.ParseUint(strings.TrimSpace(id), 10, 32)
+		if err != nil || keyID == 0 {
+			return nil, errors.Errorf("line %d: invalid key id %q", n, id)
+		}
+		value, err := hex.DecodeString(strings.TrimSpace(key))
+		if err != nil {
+			return nil, errors.Errorf("line %d: invalid hex key: %v", n, err)
+		}
+		if l := len(value); l != 16 && l != 24 && l != 32 {
+			return nil, errors.Errorf("line %d: invalid key length %d, must be 16, 24 or 32 bytes", n, l)
+		}
+		if _, ok := keys[uint32(keyID)]; ok {
+			return nil, errors.Errorf("line %d: duplicate key id %d", n, keyID)
+		}
+		keys[uint32(keyID)] = value
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return keys, nil
+}
+
+const (
+	opensslSaltedPrefix = "Salted__"
+	opensslSaltLength   = 8
+)
+
+// decryptOpensslFile decrypts the output of openssl enc -aes-256-cbc -md sha1.
+func decryptOpensslFile(data []byte, password string) ([]byte, error) {
+	data = data[len(opensslSaltedPrefix):]
+	if len(data) < opensslSaltLength+aes.BlockSize || (len(data)-opensslSaltLength)%aes.BlockSize != 0 {
+		return nil, errors.Errorf("invalid encrypted data length %d", len(data))
+	}
+	salt, data := data[:opensslSaltLength], data[opensslSaltLength:]
+
+	// EVP_BytesToKey with SHA1 and one iteration
+	var derived, digest []byte
+	for len(derived) < 32+aes.BlockSize {
+		h := sha1.New()
+		h.Write(digest)
+		h.Write([]byte(password))
+		h.Write(salt)
+		digest = h.Sum(nil)
+		derived = append(derived, digest...)
+	}
+
+	block, err := aes.NewCipher(derived[:32])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, derived[32:32+aes.BlockSize]).CryptBlocks(plain, data)
+
+	// PKCS#7 padding
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, errors.New("bad padding, the file key may be wrong")
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("bad padding, the file key may be wrong")
+		}
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+// StartEncryptionEvent is a MARIADB_START_ENCRYPTION_EVENT, it follows the format
+// description event of a binlog file encrypted at rest, all the events after it are
+// encrypted. It is only in the binlog files, it's not sent to the replicas.
+type StartEncryptionEvent struct {
+	CryptoScheme uint8
+	KeyVersion   uint32
+	Nonce        []byte
+}
+
+func (e *StartEncryptionEvent) Decode(data []byte) error {
+	if len(data) < 1+4+binlogNonceLength {
+		return errors.Trace(io.ErrUnexpectedEOF)
+	}
+	e.CryptoScheme = data[0]
+	e.KeyVersion = binary.LittleEndian.Uint32(data[1:])
+	e.Nonce = data[5 : 5+binlogNonceLength]
+	return nil
+}
+
+func (e *StartEncryptionEvent) Encode() ([]byte, error) {
+	if len(e.Nonce) != binlogNonceLength {
+		return nil, errors.Errorf("invalid nonce length %d, must be %d", len(e.Nonce), binlogNonceLength)
+	}
+	data := make([]byte, 0, 1+4+binlogNonceLength)
+	data = append(data, e.CryptoScheme)
+	data = binary.LittleEndian.AppendUint32(data, e.KeyVersion)
+	data = append(data, e.Nonce...)
+	return data, nil
+}
+
+func (e *StartEncryptionEvent) Dump(w io.Writer) {
+	fmt.Fprintf(w, "Crypto scheme: %d\n", e.CryptoScheme)
+	fmt.Fprintf(w, "Key version: %d\n", e.KeyVersion)
+	fmt.Fprintf(w, "Nonce: %s\n", hex.EncodeToString(e.Nonce))
+	fmt.Fprintln(w)
+}
+
+// binlogDecrypter decrypts the events after a StartEncryptionEvent.
+//
+// The event is encrypted without padding from the 5th byte, with the timestamp moved to
+// the event size, and the event size is written in clear. The IV is the nonce followed by
+// the offset of the event in the file. A trailing partial AES-CBC block is XORed with the
+// AES-ECB encryption of the IV.
+type binlogDecrypter struct {
+	block     cipher.Block
+	algorithm EncryptionAlgorithm
+	nonce     []byte
+	// pos is the offset of the next event in the file
+	pos uint32
+}
+
+func newBinlogDecrypter(provider EncryptionKeyProvider, e *StartEncryptionEvent, pos uint32) (*binlogDecrypter, error) {
+	if e.CryptoScheme != 1 {
+		return nil, errors.Errorf("unsupported binlog crypto scheme %d", e.CryptoScheme)
+	}
+	algorithm := provider.Algorithm()
+	if algorithm != ENCRYPTION_ALGORITHM_AES_CBC && algorithm != ENCRYPTION_ALGORITHM_AES_CTR {
+		return nil, errors.Errorf("unsupported binlog encryption algorithm %s", algorithm)
+	}
+
+	key, err := provider.GetKey(BINLOG_ENCRYPTION_KEY_ID, e.KeyVersion)
+	if err != nil {
+		return nil, errors.Annotatef(err, "get binlog key version %d", e.KeyVersion)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return &binlogDecrypter{
+		block:     block,
+		algorithm: algorithm,
+		nonce:     append([]byte(nil), e.Nonce...),
+		pos:       pos,
+	}, nil
+}
+
+// decrypt decrypts the raw event data in place.
+func (d *binlogDecrypter) decrypt(data []byte) error {
+	if len(data) < EventHeaderSize {
+		return errors.Errorf("encrypted event size %d is too small", len(data))
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, d.nonce)
+	binary.LittleEndian.PutUint32(iv[binlogNonceLength:], d.pos)
+
+	size := binary.LittleEndian.Uint32(data[9:])
+	copy(data[9:13], data[:4])
+
+	src := data[4:]
+	switch d.algorithm {
+	case ENCRYPTION_ALGORITHM_AES_CTR:
+		cipher.NewCTR(d.block, iv).XORKeyStream(src, src)
+	default:
+		n := len(src) / aes.BlockSize * aes.BlockSize
+		cipher.NewCBCDecrypter(d.block, iv).CryptBlocks(src[:n], src[:n])
+		if n < len(src) {
+			mask := make([]byte, aes.BlockSize)
+			d.block.Encrypt(mask, iv)
+			for i := range src[n:] {
+				src[n+i] ^= mask[i]
+			}
+		}
+	}
+
+	copy(data[:4], data[9:13])
+	binary.LittleEndian.PutUint32(data[9:], size)
+	d.pos += size
+
+	return nil
+}
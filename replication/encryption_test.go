@@ -0,0 +1,171 @@
+package replication
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testBinlogKey = "a7addd9adea9978fda19f21e6be987880e68ac92632ca052e5bb42b1a506939a"
+
+// the key file below encrypted by openssl enc -aes-256-cbc -md sha1 -pass pass:secret
+var testEncryptedKeyFile = "53616c7465645f5f4b9fa4a499194ff0810473b4a434a90e0e79a7d463a5cc6f9e64ffa26561f2cf2d94830958173352535a3c85eab7ffe1a0a043028f3ade695724f9f94a8c4a93ddeca0fd80d6d1c707bb57671da191567f24b4a54c3ee9a634a777ade81161426e41ad3377c2c190fd9f0da7d5525fdb3bfc08dd0b3acd5df2ae85c0f2b95508f4963f35936426bd"
+
+const testKeyFile = "# binlog key\n1;" + testBinlogKey + "\n2;00112233445566778899aabbccddeeff\n"
+
+func TestFileKeyProvider(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		name = filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(name, data, 0o600))
+		return name
+	}
+
+	encrypted, err := hex.DecodeString(testEncryptedKeyFile)
+	require.NoError(t, err)
+	plainFile := write("keys.txt", []byte(testKeyFile))
+	encryptedFile := write("keys.enc", encrypted)
+	secretFile := write("secret", []byte("secret\n"))
+
+	for _, tc := range []struct {
+		name    string
+		fileKey string
+	}{
+		{plainFile, ""},
+		{encryptedFile, "secret"},
+		{encryptedFile, "FILE:" + secretFile},
+	} {
+		p, err := NewFileKeyProvider(tc.name, tc.fileKey, ENCRYPTION_ALGORITHM_AES_CTR)
+		require.NoError(t, err)
+		require.Equal(t, ENCRYPTION_ALGORITHM_AES_CTR, p.Algorithm())
+
+		key, err := p.GetKey(BINLOG_ENCRYPTION_KEY_ID, 1)
+		require.NoError(t, err)
+		require.Equal(t, testBinlogKey, hex.EncodeToString(key))
+		key, err = p.GetKey(2, 1)
+		require.NoError(t, err)
+		require.Len(t, key, 16)
+
+		_, err = p.GetKey(3, 1)
+		require.Error(t, err)
+		_, err = p.GetKey(1, 2)
+		require.Error(t, err)
+	}
+
+	_, err = NewFileKeyProvider(encryptedFile, "", ENCRYPTION_ALGORITHM_AES_CBC)
+	require.Error(t, err)
+	_, err = NewFileKeyProvider(encryptedFile, "wrong", ENCRYPTION_ALGORITHM_AES_CBC)
+	require.Error(t, err)
+
+	for _, content := range []string{
+		"1" + testBinlogKey,
+		"0;" + testBinlogKey,
+		"x;" + testBinlogKey,
+		"1;" + testBinlogKey[:30],
+		"1;" + testBinlogKey[:62] + "zz",
+		"1;" + testBinlogKey + "\n1;" + testBinlogKey,
+	} {
+		_, err = NewFileKeyProvider(write("invalid", []byte(content)), "", ENCRYPTION_ALGORITHM_AES_CBC)
+		require.Error(t, err, content)
+	}
+}
+
+// encryptBinlogEvent encrypts the event at pos like the MariaDB server.
+func encryptBinlogEvent(block cipher.Block, algorithm EncryptionAlgorithm, nonce []byte, pos uint32, event []byte) []byte {
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, nonce)
+	binary.LittleEndian.PutUint32(iv[binlogNonceLength:], pos)
+
+	data := slices.Clone(event)
+	copy(data[9:13], data[:4])
+	dst := data[4:]
+	if algorithm == ENCRYPTION_ALGORITHM_AES_CTR {
+		cipher.NewCTR(block, iv).XORKeyStream(dst, dst)
+	} else {
+		n := len(dst) / aes.BlockSize * aes.BlockSize
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(dst[:n], dst[:n])
+		mask := make([]byte, aes.BlockSize)
+		block.Encrypt(mask, iv)
+		for i := range dst[n:] {
+			dst[n+i] ^= mask[i]
+		}
+	}
+	copy(data[:4], data[9:13])
+	binary.LittleEndian.PutUint32(data[9:], uint32(len(event)))
+	return data
+}
+
+func TestParseEncryptedBinlogFile(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "keys.txt")
+	require.NoError(t, os.WriteFile(keyFile, []byte(testKeyFile), 0o600))
+	key, err := hex.DecodeString(testBinlogKey)
+	require.NoError(t, err)
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+
+	for _, algorithm := range []EncryptionAlgorithm{ENCRYPTION_ALGORITHM_AES_CBC, ENCRYPTION_ALGORITHM_AES_CTR} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			var file bytes.Buffer
+			file.Write(BinLogFileHeader)
+			file.Write(encodeTestEvents[0])
+
+			start := &StartEncryptionEvent{CryptoScheme: 1, KeyVersion: 1, Nonce: []byte("0123456789ab")}
+			pos := uint32(file.Len())
+			header := &EventHeader{Timestamp: 1700000000, EventType: MARIADB_START_ENCRYPTION_EVENT, ServerID: 1, LogPos: pos + EventHeaderSize + 17 + BinlogChecksumLength}
+			data, err := EncodeEvent(header, start, BINLOG_CHECKSUM_ALG_CRC32)
+			require.NoError(t, err)
+			file.Write(data)
+
+			// the table map and rows events are encrypted, the table map is repeated to
+			// start from an offset after the first encrypted event
+			tableMapPos := int64(file.Len())
+			file.Write(encryptBinlogEvent(block, algorithm, start.Nonce, uint32(file.Len()), encodeTestEvents[1]))
+			secondTableMapPos := int64(file.Len())
+			for _, event := range encodeTestEvents[1:] {
+				file.Write(encryptBinlogEvent(block, algorithm, start.Nonce, uint32(file.Len()), event))
+			}
+			name := filepath.Join(dir, "mariadb-bin.000001")
+			require.NoError(t, os.WriteFile(name, file.Bytes(), 0o600))
+
+			provider, err := NewFileKeyProvider(keyFile, "", algorithm)
+			require.NoError(t, err)
+
+			for _, offset := range []int64{0, tableMapPos, secondTableMapPos} {
+				var events []*BinlogEvent
+				p := NewBinlogParser()
+				p.SetFlavor("mariadb")
+				p.SetEncryptionKeyProvider(provider)
+				require.NoError(t, p.ParseFile(name, offset, func(e *BinlogEvent) error {
+					events = append(events, e)
+					return nil
+				}))
+
+				if offset == secondTableMapPos {
+					require.Len(t, events, 4)
+				} else {
+					require.Len(t, events, 5)
+				}
+				require.Equal(t, MARIADB_START_ENCRYPTION_EVENT, events[1].Header.EventType)
+				require.Equal(t, start.Nonce, events[1].Event.(*StartEncryptionEvent).Nonce)
+				n := len(events)
+				require.Equal(t, encodeTestEvents[1], events[n-2].RawData)
+				require.Equal(t, []byte("tbl"), events[n-2].Event.(*TableMapEvent).Table)
+				require.Equal(t, encodeTestEvents[2], events[n-1].RawData)
+				require.Equal(t, [][]any{{int32(1)}}, events[n-1].Event.(*RowsEvent).Rows)
+			}
+
+			// the key provider is required
+			err = NewBinlogParser().ParseFile(name, 0, func(*BinlogEvent) error { return nil })
+			require.ErrorContains(t, err, "SetEncryptionKeyProvider")
+		})
+	}
+}
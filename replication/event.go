@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"math"
 	"strconv"
@@ -40,6 +41,17 @@ func (e *BinlogEvent) Dump(w io.Writer) {
 	e.Event.Dump(w)
 }
 
+// Encode serializes the event from Header and Event with EncodeEvent and stores
+// the result in RawData.
+func (e *BinlogEvent) Encode(checksumAlg BinlogChecksum) ([]byte, error) {
+	data, err := EncodeEvent(e.Header, e.Event, checksumAlg)
+	if err != nil {
+		return nil, err
+	}
+	e.RawData = data
+	return data, nil
+}
+
 type Event interface {
 	// Dump Event, format like python-mysql-replication
 	Dump(w io.Writer)
@@ -61,6 +73,60 @@ func (e *EventError) Error() string {
 	return fmt.Sprintf("Header %#v, Data %q, Err: %v", e.Header, e.Data, e.Err)
 }
 
+// EventEncoder is implemented by events which can serialize their body back to
+// the binlog format, the reverse of Decode.
+type EventEncoder interface {
+	Encode() ([]byte, error)
+}
+
+// EncodeEvent serializes a full binlog event: the header, the body of e and, if
+// checksumAlg is BINLOG_CHECKSUM_ALG_CRC32, the CRC32 checksum. A
+// FormatDescriptionEvent uses its own ChecksumAlgorithm instead of checksumAlg.
+//
+// h.EventSize is set to the encoded size. h.LogPos is written as is, so callers
+// must set it to the end position of the event, or 0 for artificial events.
+func EncodeEvent(h *EventHeader, e Event, checksumAlg BinlogChecksum) ([]byte, error) {
+	return encodeEvent(h, e, checksumAlg, nil)
+}
+
+// encodeEvent is EncodeEvent, but if offset is not nil the header LogPos is set to
+// the end of the event written at offset.
+func encodeEvent(h *EventHeader, e Event, checksumAlg BinlogChecksum, offset *uint32) ([]byte, error) {
+	enc, ok := e.(EventEncoder)
+	if !ok {
+		return nil, errors.Errorf("encoding %T is not supported", e)
+	}
+
+	body, err := enc.Encode()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	withChecksum := checksumAlg == BINLOG_CHECKSUM_ALG_CRC32
+	if fde, ok := e.(*FormatDescriptionEvent); ok {
+		// FORMAT_DESCRIPTION_EVENT is always checksummed if the server supports checksums
+		withChecksum = fde.hasChecksumAlgorithm()
+	}
+
+	size := EventHeaderSize + len(body)
+	if withChecksum {
+		size += BinlogChecksumLength
+	}
+	h.EventSize = uint32(size)
+	if offset != nil {
+		h.LogPos = *offset + h.EventSize
+	}
+
+	data := make([]byte, 0, size)
+	data = append(data, h.Encode()...)
+	data = append(data, body...)
+	if withChecksum {
+		data = binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+	}
+
+	return data, nil
+}
+
 type EventHeader struct {
 	Timestamp uint32
 	EventType EventType
@@ -102,6 +168,31 @@ func (h *EventHeader) Decode(data []byte) error {
 	return nil
 }
 
+// Encode serializes the header to its 19 bytes binlog format.
+func (h *EventHeader) Encode() []byte {
+	data := make([]byte, EventHeaderSize)
+
+	pos := 0
+	binary.LittleEndian.PutUint32(data[pos:], h.Timestamp)
+	pos += 4
+
+	data[pos] = byte(h.EventType)
+	pos++
+
+	binary.LittleEndian.PutUint32(data[pos:], h.ServerID)
+	pos += 4
+
+	binary.LittleEndian.PutUint32(data[pos:], h.EventSize)
+	pos += 4
+
+	binary.LittleEndian.PutUint32(data[pos:], h.LogPos)
+	pos += 4
+
+	binary.LittleEndian.PutUint16(data[pos:], h.Flags)
+
+	return data
+}
+
 // headerFlagsString is returning a pipe separated string with flag names
 func headerFlagsString(flags uint16) string {
 	var flagstr []string
@@ -221,12 +312,7 @@ func (e *FormatDescriptionEvent) Decode(data []byte) error {
 	} else {
 		e.ServerVersion = string(serverVersionRaw[:serverVersionLength])
 	}
-	checksumProduct := checksumVersionProductMysql
-	if strings.Contains(strings.ToLower(e.ServerVersion), "mariadb") {
-		checksumProduct = checksumVersionProductMariaDB
-	}
-
-	if calcVersionProduct(e.ServerVersion) >= checksumProduct {
+	if e.hasChecksumAlgorithm() {
 		// here, the last 5 bytes is 1 byte check sum alg type and 4 byte checksum if exists
 		e.ChecksumAlgorithm = BinlogChecksum(data[len(data)-5])
 		e.EventTypeHeaderLengths = data[pos : len(data)-5]
@@ -238,6 +324,49 @@ func (e *FormatDescriptionEvent) Decode(data []byte) error {
 	return nil
 }
 
+// hasChecksumAlgorithm reports whether the server version is recent enough to
+// write the checksum algorithm byte (and a checksum) at the end of the event.
+func (e *FormatDescriptionEvent) hasChecksumAlgorithm() bool {
+	checksumProduct := checksumVersionProductMysql
+	if strings.Contains(strings.ToLower(e.ServerVersion), "mariadb") {
+		checksumProduct = checksumVersionProductMariaDB
+	}
+
+	return calcVersionProduct(e.ServerVersion) >= checksumProduct
+}
+
+func (e *FormatDescriptionEvent) Encode() ([]byte, error) {
+	if len(e.ServerVersion) > 50 {
+		return nil, errors.Errorf("server version %q is longer than 50 bytes", e.ServerVersion)
+	}
+
+	headerLength := e.EventHeaderLength
+	if headerLength == 0 {
+		headerLength = EventHeaderSize
+	}
+
+	data := make([]byte, 2+50+4+1, 2+50+4+1+len(e.EventTypeHeaderLengths)+1)
+
+	pos := 0
+	binary.LittleEndian.PutUint16(data[pos:], e.Version)
+	pos += 2
+
+	copy(data[pos:], e.ServerVersion)
+	pos += 50
+
+	binary.LittleEndian.PutUint32(data[pos:], e.CreateTimestamp)
+	pos += 4
+
+	data[pos] = headerLength
+
+	data = append(data, e.EventTypeHeaderLengths...)
+	if e.hasChecksumAlgorithm() {
+		data = append(data, byte(e.ChecksumAlgorithm))
+	}
+
+	return data, nil
+}
+
 func (e *FormatDescriptionEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "Version: %d\n", e.Version)
 	fmt.Fprintf(w, "Server version: %s\n", e.ServerVersion)
@@ -259,6 +388,14 @@ func (e *RotateEvent) Decode(data []byte) error {
 	return nil
 }
 
+func (e *RotateEvent) Encode() ([]byte, error) {
+	data := make([]byte, 8+len(e.NextLogName))
+	binary.LittleEndian.PutUint64(data, e.Position)
+	copy(data[8:], e.NextLogName)
+
+	return data, nil
+}
+
 func (e *RotateEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "Position: %d\n", e.Position)
 	fmt.Fprintf(w, "Next log name: %s\n", e.NextLogName)
@@ -352,6 +489,15 @@ func (e *PreviousGTIDsEvent) Decode(data []byte) error {
 	return nil
 }
 
+func (e *PreviousGTIDsEvent) Encode() ([]byte, error) {
+	set, err := mysql.ParseMysqlGTIDSet(e.GTIDSets)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return set.(*mysql.MysqlGTIDSet).Encode(), nil
+}
+
 func (e *PreviousGTIDsEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "Previous GTID Event: %s\n", e.GTIDSets)
 	fmt.Fprintln(w)
@@ -378,6 +524,13 @@ func (e *XIDEvent) Decode(data []byte) error {
 	return nil
 }
 
+func (e *XIDEvent) Encode() ([]byte, error) {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, e.XID)
+
+	return data, nil
+}
+
 func (e *XIDEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "XID: %d\n", e.XID)
 	if e.GSet != nil {
@@ -440,6 +593,50 @@ func (e *QueryEvent) Decode(data []byte) error {
 	return nil
 }
 
+func (e *QueryEvent) Encode() ([]byte, error) {
+	query := e.Query
+	if e.compressed {
+		var err error
+		if query, err = mysql.CompressMariadbData(e.Query); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	if len(e.Schema) > math.MaxUint8 {
+		return nil, errors.Errorf("schema name is too long, %d bytes", len(e.Schema))
+	}
+	if len(e.StatusVars) > math.MaxUint16 {
+		return nil, errors.Errorf("status vars are too long, %d bytes", len(e.StatusVars))
+	}
+
+	data := make([]byte, 4+4+1+2+2+len(e.StatusVars)+len(e.Schema)+1+len(query))
+
+	pos := 0
+	binary.LittleEndian.PutUint32(data[pos:], e.SlaveProxyID)
+	pos += 4
+
+	binary.LittleEndian.PutUint32(data[pos:], e.ExecutionTime)
+	pos += 4
+
+	data[pos] = byte(len(e.Schema))
+	pos++
+
+	binary.LittleEndian.PutUint16(data[pos:], e.ErrorCode)
+	pos += 2
+
+	binary.LittleEndian.PutUint16(data[pos:], uint16(len(e.StatusVars)))
+	pos += 2
+
+	pos += copy(data[pos:], e.StatusVars)
+	pos += copy(data[pos:], e.Schema)
+
+	// 0x00 after schema
+	pos++
+
+	copy(data[pos:], query)
+
+	return data, nil
+}
+
 func (e *QueryEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "Slave proxy ID: %d\n", e.SlaveProxyID)
 	fmt.Fprintf(w, "Execution time: %d\n", e.ExecutionTime)
@@ -539,6 +736,69 @@ func (e *GTIDEvent) Decode(data []byte) error {
 	return nil
 }
 
+func (e *GTIDEvent) Encode() ([]byte, error) {
+	if len(e.SID) != SidLength {
+		return nil, errors.Errorf("invalid SID length %d, must %d", len(e.SID), SidLength)
+	}
+	if e.Tag != (mysql.Tag{}) {
+		return nil, errors.New("encoding tagged GTID event is not supported")
+	}
+
+	data := make([]byte, 42, 42+7+7+9+4+4)
+
+	pos := 0
+	data[pos] = e.CommitFlag
+	pos++
+
+	pos += copy(data[pos:], e.SID)
+
+	binary.LittleEndian.PutUint64(data[pos:], uint64(e.GNO))
+	pos += 8
+
+	data[pos] = LogicalTimestampTypeCode
+	pos++
+
+	binary.LittleEndian.PutUint64(data[pos:], uint64(e.LastCommitted))
+	pos += PartLogicalTimestampLength
+
+	binary.LittleEndian.PutUint64(data[pos:], uint64(e.SequenceNumber))
+
+	// The MySQL 8.0 fields below are only written when present, so that
+	// events from older servers keep their original layout.
+	if e.ImmediateCommitTimestamp == 0 {
+		return data, nil
+	}
+
+	if e.OriginalCommitTimestamp != e.ImmediateCommitTimestamp {
+		data = appendUint56(data, e.ImmediateCommitTimestamp|(uint64(1)<<55))
+		data = appendUint56(data, e.OriginalCommitTimestamp)
+	} else {
+		data = appendUint56(data, e.ImmediateCommitTimestamp)
+	}
+
+	data = mysql.AppendLengthEncodedInteger(data, e.TransactionLength)
+
+	if e.ImmediateServerVersion == 0 || e.ImmediateServerVersion == UndefinedServerVer {
+		return data, nil
+	}
+
+	if e.OriginalServerVersion != e.ImmediateServerVersion {
+		data = binary.LittleEndian.AppendUint32(data, e.ImmediateServerVersion|(uint32(1)<<31))
+		data = binary.LittleEndian.AppendUint32(data, e.OriginalServerVersion)
+	} else {
+		data = binary.LittleEndian.AppendUint32(data, e.ImmediateServerVersion)
+	}
+
+	return data, nil
+}
+
+// appendUint56 appends the low 7 bytes of v in little endian.
+func appendUint56(data []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(data, buf[:7]...)
+}
+
 func (e *GTIDEvent) Dump(w io.Writer) {
 	fmtTime := func(t time.Time) string {
 		if t.IsZero() {
@@ -887,6 +1147,10 @@ func (e *MariadbAnnotateRowsEvent) Decode(data []byte) error {
 	return nil
 }
 
+func (e *MariadbAnnotateRowsEvent) Encode() ([]byte, error) {
+	return e.Query, nil
+}
+
 func (e *MariadbAnnotateRowsEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "Query: %s\n", e.Query)
 	fmt.Fprintln(w)
@@ -940,6 +1204,27 @@ func (e *MariadbGTIDEvent) Decode(data []byte) error {
 	return nil
 }
 
+func (e *MariadbGTIDEvent) Encode() ([]byte, error) {
+	// sequence number, domain id, flags and 8 bytes of commit id or 6 bytes of padding
+	data := make([]byte, 8+4+1+6, 8+4+1+8)
+
+	pos := 0
+	binary.LittleEndian.PutUint64(data[pos:], e.GTID.SequenceNumber)
+	pos += 8
+
+	binary.LittleEndian.PutUint32(data[pos:], e.GTID.DomainID)
+	pos += 4
+
+	data[pos] = e.Flags
+
+	if (e.Flags & BINLOG_MARIADB_FL_GROUP_COMMIT_ID) > 0 {
+		data = data[:pos+1]
+		data = binary.LittleEndian.AppendUint64(data, e.CommitID)
+	}
+
+	return data, nil
+}
+
 func (e *MariadbGTIDEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "GTID: %v\n", e.GTID)
 	fmt.Fprintf(w, "Flags: %v\n", e.Flags)
@@ -976,6 +1261,29 @@ func (e *MariadbGTIDListEvent) Decode(data []byte) error {
 	return nil
 }
 
+func (e *MariadbGTIDListEvent) Encode() ([]byte, error) {
+	if len(e.GTIDs) >= 1<<28 {
+		return nil, errors.Errorf("too many GTIDs %d", len(e.GTIDs))
+	}
+
+	data := make([]byte, 4+16*len(e.GTIDs))
+
+	pos := 0
+	binary.LittleEndian.PutUint32(data[pos:], uint32(len(e.GTIDs)))
+	pos += 4
+
+	for _, gtid := range e.GTIDs {
+		binary.LittleEndian.PutUint32(data[pos:], gtid.DomainID)
+		pos += 4
+		binary.LittleEndian.PutUint32(data[pos:], gtid.ServerID)
+		pos += 4
+		binary.LittleEndian.PutUint64(data[pos:], gtid.SequenceNumber)
+		pos += 8
+	}
+
+	return data, nil
+}
+
 func (e *MariadbGTIDListEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "Lists: %v\n", e.GTIDs)
 	fmt.Fprintln(w)
@@ -992,6 +1300,14 @@ func (i *IntVarEvent) Decode(data []byte) error {
 	return nil
 }
 
+func (i *IntVarEvent) Encode() ([]byte, error) {
+	data := make([]byte, 9)
+	data[0] = byte(i.Type)
+	binary.LittleEndian.PutUint64(data[1:], i.Value)
+
+	return data, nil
+}
+
 func (i *IntVarEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "Type: %d\n", i.Type)
 	fmt.Fprintf(w, "Value: %d\n", i.Value)
@@ -0,0 +1,89 @@
+package replication
+
+import (
+	"regexp"
+
+	"github.com/pingcap/errors"
+)
+
+// EventFilter decides whether a BinlogParser decodes an event, see
+// BinlogSyncerConfig.EventFilter. table is the TableMapEvent of the rows events, nil for
+// the other events.
+//
+// The rows of a filtered rows event are not decoded, only its header, see
+// RowsEvent.Filtered. The other filtered events are returned as GenericEvent. The events
+// the parser and the BinlogSyncer depend on, e.g. the format description, rotate, table
+// map, GTID, XID and query events, are always decoded.
+type EventFilter func(eventType EventType, table *TableMapEvent) bool
+
+// filteredEventType reports whether the events of the type can be filtered out.
+func filteredEventType(t EventType) bool {
+	switch t {
+	case FORMAT_DESCRIPTION_EVENT,
+		ROTATE_EVENT,
+		TABLE_MAP_EVENT,
+		QUERY_EVENT,
+		MARIADB_QUERY_COMPRESSED_EVENT,
+		XID_EVENT,
+		XA_PREPARE_LOG_EVENT,
+		GTID_EVENT,
+		ANONYMOUS_GTID_EVENT,
+		GTID_TAGGED_LOG_EVENT,
+		PREVIOUS_GTIDS_EVENT,
+		MARIADB_GTID_EVENT,
+		MARIADB_GTID_LIST_EVENT,
+		MARIADB_START_ENCRYPTION_EVENT,
+		TRANSACTION_PAYLOAD_EVENT,
+		HEARTBEAT_EVENT,
+		HEARTBEAT_LOG_EVENT_V2:
+		return false
+	}
+	return true
+}
+
+// NewTableEventFilter returns an EventFilter which decodes the rows events of the tables
+// matching the regexps, like the IncludeTableRegex and ExcludeTableRegex of canal. The
+// regexps are matched against "schema.table", no include regexp includes all the tables.
+// The other events are decoded.
+func NewTableEventFilter(includeTableRegex []string, excludeTableRegex []string) (EventFilter, error) {
+	compile := func(regexps []string) ([]*regexp.Regexp, error) {
+		res := make([]*regexp.Regexp, 0, len(regexps))
+		for _, r := range regexps {
+			re, err := regexp.Compile(r)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			res = append(res, re)
+		}
+		return res, nil
+	}
+
+	include, err := compile(includeTableRegex)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compile(excludeTableRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	match := func(regexps []*regexp.Regexp, name string) bool {
+		for _, re := range regexps {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(_ EventType, table *TableMapEvent) bool {
+		if table == nil {
+			return true
+		}
+		name := string(table.Schema) + "." + string(table.Table)
+		if len(include) > 0 && !match(include, name) {
+			return false
+		}
+		return !match(exclude, name)
+	}, nil
+}
@@ -0,0 +1,86 @@
+package replication
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestEventFilter(t *testing.T) {
+	tables := []*TableMapEvent{
+		{tableIDSize: 6, TableID: 120, Schema: []byte("test"), Table: []byte("t")},
+		{tableIDSize: 6, TableID: 121, Schema: []byte("test"), Table: []byte("ignored")},
+	}
+	filter, err := NewTableEventFilter([]string{`test\..*`}, []string{`test\.ignored`})
+	require.NoError(t, err)
+
+	p := NewBinlogParser()
+	p.SetEventFilter(func(eventType EventType, table *TableMapEvent) bool {
+		return eventType != RAND_EVENT && filter(eventType, table)
+	})
+	_, err = p.Parse(encodeTestEvents[0])
+	require.NoError(t, err)
+
+	for _, table := range tables {
+		table.ColumnCount = 1
+		table.ColumnType = []byte{mysql.MYSQL_TYPE_LONG}
+		table.ColumnMeta = []uint16{0}
+		table.NullBitmap = []byte{0}
+		data, err := EncodeEvent(&EventHeader{EventType: TABLE_MAP_EVENT, ServerID: 1}, table, BINLOG_CHECKSUM_ALG_CRC32)
+		require.NoError(t, err)
+		_, err = p.Parse(data)
+		require.NoError(t, err)
+	}
+
+	for i, table := range tables {
+		re, err := NewRowsEvent(WRITE_ROWS_EVENTv2, table)
+		require.NoError(t, err)
+		re.Rows = [][]any{{int32(1)}, {int32(2)}}
+		if i == len(tables)-1 {
+			re.Flags = RowsEventStmtEndFlag
+		}
+		data, err := EncodeEvent(&EventHeader{EventType: WRITE_ROWS_EVENTv2, ServerID: 1}, re, BINLOG_CHECKSUM_ALG_CRC32)
+		require.NoError(t, err)
+
+		e, err := p.Parse(data)
+		require.NoError(t, err)
+		decoded := e.Event.(*RowsEvent)
+		require.Equal(t, table.Table, decoded.Table.Table)
+		if i == 0 {
+			require.False(t, decoded.Filtered)
+			require.Equal(t, re.Rows, decoded.Rows)
+		} else {
+			require.True(t, decoded.Filtered)
+			require.Nil(t, decoded.Rows)
+		}
+	}
+	// the tables are reset at the end of the statement of the filtered event
+	require.Empty(t, p.tables)
+
+	data, err := EncodeEvent(&EventHeader{EventType: RAND_EVENT, ServerID: 1}, &RandEvent{Seed1: 1, Seed2: 2}, BINLOG_CHECKSUM_ALG_CRC32)
+	require.NoError(t, err)
+	e, err := p.Parse(data)
+	require.NoError(t, err)
+	require.IsType(t, &GenericEvent{}, e.Event)
+
+	// the events the syncer depends on are always decoded
+	p.SetEventFilter(func(EventType, *TableMapEvent) bool { return false })
+	data, err = EncodeEvent(&EventHeader{EventType: XID_EVENT, ServerID: 1}, &XIDEvent{XID: 10}, BINLOG_CHECKSUM_ALG_CRC32)
+	require.NoError(t, err)
+	e, err = p.Parse(data)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), e.Event.(*XIDEvent).XID)
+}
+
+func TestNewTableEventFilter(t *testing.T) {
+	_, err := NewTableEventFilter([]string{"("}, nil)
+	require.Error(t, err)
+
+	filter, err := NewTableEventFilter(nil, []string{`^mysql\.`})
+	require.NoError(t, err)
+	require.True(t, filter(QUERY_EVENT, nil))
+	require.True(t, filter(WRITE_ROWS_EVENTv2, &TableMapEvent{Schema: []byte("db"), Table: []byte("t")}))
+	require.False(t, filter(WRITE_ROWS_EVENTv2, &TableMapEvent{Schema: []byte("mysql"), Table: []byte("user")}))
+}
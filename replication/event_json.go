@@ -0,0 +1,537 @@
+package replication
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pingcap/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// MarshalJSON encodes the event as a JSON object for log pipelines, the event types
+// and the fields below are stable, new fields may be added. One event per line with
+// json.Encoder is NDJSON.
+//
+//	{"header": HEADER, "event": EVENT}
+//
+// HEADER has the fields of EventHeader:
+//
+//	{"type": "WRITE_ROWS_EVENTv2", "timestamp": 1700000000, "server_id": 1,
+//	 "event_size": 100, "log_pos": 4321, "flags": 0}
+//
+// EVENT depends on the type of the event, the keys are the snake case field names of
+// the event, e.g. "next_log_name" for RotateEvent.NextLogName, and:
+//   - the statements, the schema and table names, and the other text fields are JSON
+//     strings, the binary fields, e.g. GenericEvent.Data, are base64 strings;
+//   - a GTID is a string, "uuid[:tag]:gno" for MySQL and "domain-server-sequence" for
+//     MariaDB, and a GTID set is its string form, the GTID set of XID_EVENT and
+//     QUERY_EVENT is the one set by the BinlogSyncer, omitted if there is none;
+//   - the commit timestamps of GTID_LOG_EVENT are in microseconds, "immediate_commit_time"
+//     and "original_commit_time" are RFC 3339 and omitted if unknown;
+//   - TABLE_MAP_EVENT has "columns", an array of {"name", "type", "meta", "unsigned",
+//     "nullable", "collation_id", "enum_values", "set_values", "geometry_type",
+//     "visible"}, where "type" is the MYSQL_TYPE_* of the column and the others are
+//     omitted if the optional metadata doesn't have them, and "primary_key", the indexes
+//     of the primary key columns;
+//   - the rows events have "action", one of "insert", "update" and "delete", "schema"
+//     and "table", and "rows", an array of {"before": IMAGE, "after": IMAGE}, where
+//     "before" is omitted for the inserts and "after" for the deletes;
+//   - TRANSACTION_PAYLOAD_EVENT has "events", the array of the decompressed events;
+//   - the events not decoded are GenericEvent, {"data": base64}.
+//
+// IMAGE is an array of the values of the columns in the column order. A NULL is null,
+// and so is a column not in the image (binlog_row_image=MINIMAL), whose index is in
+// "before_skipped" or "after_skipped". The other values are typed:
+//
+//	{"type": "int", "value": -1}          signed integers, YEAR, ENUM index, SET and BIT bitmaps
+//	{"type": "uint", "value": 1}          unsigned integers
+//	{"type": "float", "value": 1.5}       FLOAT and DOUBLE
+//	{"type": "decimal", "value": "1.50"}  DECIMAL
+//	{"type": "string", "value": "abc"}    text, and the temporal values without parseTime
+//	{"type": "bytes", "value": "YWJj"}    base64 of the binary strings, the BLOB, GEOMETRY and VECTOR
+//	                                      values, the TEXT values without the collation in the
+//	                                      metadata, and the text that is not UTF-8
+//	{"type": "time", "value": "2006-01-02T15:04:05.999999Z"}  temporal values with parseTime, RFC 3339
+//	{"type": "json", "value": {"a": 1}}   JSON documents
+//	{"type": "json_diff", "value": [{"op": "Replace", "path": "$.a", "value": 2}]}
+//	                                      partial JSON updates, the JSON_REMOVE have no "value"
+func (e *BinlogEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Header *jsonEventHeader `json:"header"`
+		Event  any              `json:"event"`
+	}{
+		Header: newJSONEventHeader(e.Header),
+		Event:  jsonEvent(e.Event),
+	})
+}
+
+type jsonEventHeader struct {
+	Type      string `json:"type"`
+	Timestamp uint32 `json:"timestamp"`
+	ServerID  uint32 `json:"server_id"`
+	EventSize uint32 `json:"event_size"`
+	LogPos    uint32 `json:"log_pos"`
+	Flags     uint16 `json:"flags"`
+}
+
+func newJSONEventHeader(h *EventHeader) *jsonEventHeader {
+	if h == nil {
+		return nil
+	}
+	return &jsonEventHeader{
+		Type:      h.EventType.String(),
+		Timestamp: h.Timestamp,
+		ServerID:  h.ServerID,
+		EventSize: h.EventSize,
+		LogPos:    h.LogPos,
+		Flags:     h.Flags,
+	}
+}
+
+// jsonEvent returns the value encoding the event, see BinlogEvent.MarshalJSON.
+func jsonEvent(ev Event) any {
+	switch e := ev.(type) {
+	case *FormatDescriptionEvent:
+		return struct {
+			Version           uint16 `json:"version"`
+			ServerVersion     string `json:"server_version"`
+			CreateTimestamp   uint32 `json:"create_timestamp"`
+			EventHeaderLength uint8  `json:"event_header_length"`
+			ChecksumAlgorithm byte   `json:"checksum_algorithm"`
+		}{e.Version, e.ServerVersion, e.CreateTimestamp, e.EventHeaderLength, byte(e.ChecksumAlgorithm)}
+	case *RotateEvent:
+		return struct {
+			Position    uint64 `json:"position"`
+			NextLogName string `json:"next_log_name"`
+		}{e.Position, string(e.NextLogName)}
+	case *PreviousGTIDsEvent:
+		return struct {
+			GTIDSets string `json:"gtid_sets"`
+		}{e.GTIDSets}
+	case *XIDEvent:
+		return struct {
+			XID  uint64 `json:"xid"`
+			GSet string `json:"gtid_set,omitempty"`
+		}{e.XID, gtidSetString(e.GSet)}
+	case *QueryEvent:
+		return struct {
+			SlaveProxyID  uint32 `json:"slave_proxy_id"`
+			ExecutionTime uint32 `json:"execution_time"`
+			ErrorCode     uint16 `json:"error_code"`
+			Schema        string `json:"schema"`
+			Query         string `json:"query"`
+			GSet          string `json:"gtid_set,omitempty"`
+		}{e.SlaveProxyID, e.ExecutionTime, e.ErrorCode, string(e.Schema), string(e.Query), gtidSetString(e.GSet)}
+	case *GTIDEvent:
+		return newJSONGTIDEvent(e)
+	case *GtidTaggedLogEvent:
+		return newJSONGTIDEvent(&e.GTIDEvent)
+	case *MariadbGTIDEvent:
+		return struct {
+			GTID     string `json:"gtid"`
+			Flags    byte   `json:"flags"`
+			CommitID uint64 `json:"commit_id"`
+		}{e.GTID.String(), e.Flags, e.CommitID}
+	case *MariadbGTIDListEvent:
+		gtids := make([]string, len(e.GTIDs))
+		for i := range e.GTIDs {
+			gtids[i] = e.GTIDs[i].String()
+		}
+		return struct {
+			GTIDs []string `json:"gtids"`
+		}{gtids}
+	case *MariadbBinlogCheckPointEvent:
+		return struct {
+			Info string `json:"info"`
+		}{string(e.Info)}
+	case *MariadbAnnotateRowsEvent:
+		return struct {
+			Query string `json:"query"`
+		}{string(e.Query)}
+	case *RowsQueryEvent:
+		return struct {
+			Query string `json:"query"`
+		}{string(e.Query)}
+	case *TableMapEvent:
+		return newJSONTableMapEvent(e)
+	case *RowsEvent:
+		return newJSONRowsEvent(e)
+	case *TransactionPayloadEvent:
+		return struct {
+			Size             uint64         `json:"size"`
+			UncompressedSize uint64         `json:"uncompressed_size"`
+			CompressionType  string         `json:"compression_type"`
+			Events           []*BinlogEvent `json:"events"`
+		}{e.Size, e.UncompressedSize, e.compressionType(), e.Events}
+	case *IntVarEvent:
+		return struct {
+			Type  byte   `json:"type"`
+			Value uint64 `json:"value"`
+		}{byte(e.Type), e.Value}
+	case *RandEvent:
+		return struct {
+			Seed1 uint64 `json:"seed1"`
+			Seed2 uint64 `json:"seed2"`
+		}{e.Seed1, e.Seed2}
+	case *UserVarEvent:
+		var value any
+		if v, err := e.ParsedValue(); err == nil {
+			value = newJSONValue(v, jsonValueColumn{})
+		} else {
+			value = newJSONValue(e.Value, jsonValueColumn{})
+		}
+		return struct {
+			Name    string `json:"name"`
+			Type    byte   `json:"type"`
+			Charset uint32 `json:"charset"`
+			Flags   uint8  `json:"flags"`
+			Value   any    `json:"value"`
+		}{string(e.Name), byte(e.Type), e.Charset, e.Flags, value}
+	case *IncidentEvent:
+		return struct {
+			Type    uint16 `json:"type"`
+			Message string `json:"message"`
+		}{uint16(e.Type), string(e.Message)}
+	case *ViewChangeEvent:
+		return struct {
+			ViewID            string            `json:"view_id"`
+			SeqNumber         uint64            `json:"seq_number"`
+			CertificationInfo map[string][]byte `json:"certification_info"`
+		}{e.ViewID, e.SeqNumber, e.CertificationInfo}
+	case *XAPrepareEvent:
+		return struct {
+			OnePhase bool   `json:"one_phase"`
+			FormatID int32  `json:"format_id"`
+			GTRID    []byte `json:"gtrid"`
+			BQUAL    []byte `json:"bqual"`
+			GSet     string `json:"gtid_set,omitempty"`
+		}{e.OnePhase, e.FormatID, e.GTRID, e.BQUAL, gtidSetString(e.GSet)}
+	case *TransactionContextEvent:
+		return struct {
+			ServerUUID      string   `json:"server_uuid"`
+			ThreadID        uint32   `json:"thread_id"`
+			GTIDSpecified   bool     `json:"gtid_specified"`
+			SnapshotVersion []byte   `json:"snapshot_version"`
+			WriteSet        [][]byte `json:"write_set"`
+			ReadSet         [][]byte `json:"read_set"`
+		}{e.ServerUUID, e.ThreadID, e.GTIDSpecified, e.SnapshotVersion, e.WriteSet, e.ReadSet}
+	case *StartEncryptionEvent:
+		return struct {
+			CryptoScheme uint8  `json:"crypto_scheme"`
+			KeyVersion   uint32 `json:"key_version"`
+			Nonce        []byte `json:"nonce"`
+		}{e.CryptoScheme, e.KeyVersion, e.Nonce}
+	case *BeginLoadQueryEvent:
+		return struct {
+			FileID    uint32 `json:"file_id"`
+			BlockData []byte `json:"block_data"`
+		}{e.FileID, e.BlockData}
+	case *ExecuteLoadQueryEvent:
+		return struct {
+			SlaveProxyID     uint32 `json:"slave_proxy_id"`
+			ExecutionTime    uint32 `json:"execution_time"`
+			SchemaLength     uint8  `json:"schema_length"`
+			ErrorCode        uint16 `json:"error_code"`
+			StatusVars       uint16 `json:"status_vars"`
+			FileID           uint32 `json:"file_id"`
+			StartPos         uint32 `json:"start_pos"`
+			EndPos           uint32 `json:"end_pos"`
+			DupHandlingFlags uint8  `json:"dup_handling_flags"`
+		}{
+			e.SlaveProxyID, e.ExecutionTime, e.SchemaLength, e.ErrorCode, e.StatusVars,
+			e.FileID, e.StartPos, e.EndPos, e.DupHandlingFlags,
+		}
+	case *HeartbeatEvent:
+		return struct {
+			Version  int    `json:"version"`
+			Filename string `json:"filename"`
+			Offset   uint64 `json:"offset"`
+		}{e.Version, e.Filename, e.Offset}
+	case *GenericEvent:
+		return struct {
+			Data []byte `json:"data"`
+		}{e.Data}
+	default:
+		return ev
+	}
+}
+
+func gtidSetString(s mysql.GTIDSet) string {
+	if s == nil {
+		return ""
+	}
+	return s.String()
+}
+
+type jsonGTIDEvent struct {
+	GTID                     string `json:"gtid,omitempty"`
+	CommitFlag               uint8  `json:"commit_flag"`
+	LastCommitted            int64  `json:"last_committed"`
+	SequenceNumber           int64  `json:"sequence_number"`
+	ImmediateCommitTimestamp uint64 `json:"immediate_commit_timestamp"`
+	OriginalCommitTimestamp  uint64 `json:"original_commit_timestamp"`
+	ImmediateCommitTime      string `json:"immediate_commit_time,omitempty"`
+	OriginalCommitTime       string `json:"original_commit_time,omitempty"`
+	TransactionLength        uint64 `json:"transaction_length"`
+	ImmediateServerVersion   uint32 `json:"immediate_server_version"`
+	OriginalServerVersion    uint32 `json:"original_server_version"`
+}
+
+func newJSONGTIDEvent(e *GTIDEvent) *jsonGTIDEvent {
+	j := &jsonGTIDEvent{
+		CommitFlag:               e.CommitFlag,
+		LastCommitted:            e.LastCommitted,
+		SequenceNumber:           e.SequenceNumber,
+		ImmediateCommitTimestamp: e.ImmediateCommitTimestamp,
+		OriginalCommitTimestamp:  e.OriginalCommitTimestamp,
+		ImmediateCommitTime:      formatJSONTime(e.ImmediateCommitTime()),
+		OriginalCommitTime:       formatJSONTime(e.OriginalCommitTime()),
+		TransactionLength:        e.TransactionLength,
+		ImmediateServerVersion:   e.ImmediateServerVersion,
+		OriginalServerVersion:    e.OriginalServerVersion,
+	}
+	if e.GNO > 0 {
+		// not an anonymous transaction
+		if gtid, err := e.GTIDNext(); err == nil {
+			j.GTID = gtid.String()
+		}
+	}
+	return j
+}
+
+func formatJSONTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+type jsonColumn struct {
+	Name         string   `json:"name,omitempty"`
+	Type         byte     `json:"type"`
+	Meta         uint16   `json:"meta"`
+	Unsigned     *bool    `json:"unsigned,omitempty"`
+	Nullable     *bool    `json:"nullable,omitempty"`
+	CollationID  *uint64  `json:"collation_id,omitempty"`
+	EnumValues   []string `json:"enum_values,omitempty"`
+	SetValues    []string `json:"set_values,omitempty"`
+	GeometryType *uint64  `json:"geometry_type,omitempty"`
+	Visible      *bool    `json:"visible,omitempty"`
+}
+
+func newJSONTableMapEvent(e *TableMapEvent) any {
+	names := e.ColumnNameString()
+	unsigned := e.UnsignedMap()
+	collations := e.CollationMap()
+	enumSetCollations := e.EnumSetCollationMap()
+	enumValues := e.EnumStrValueMap()
+	setValues := e.SetStrValueMap()
+	geometryTypes := e.GeometryTypeMap()
+	visibility := e.VisibilityMap()
+
+	columns := make([]jsonColumn, min(int(e.ColumnCount), len(e.ColumnType), len(e.ColumnMeta)))
+	for i := range columns {
+		c := &columns[i]
+		if i < len(names) {
+			c.Name = names[i]
+		}
+		c.Type = e.realType(i)
+		c.Meta = e.ColumnMeta[i]
+		if v, ok := unsigned[i]; ok {
+			c.Unsigned = &v
+		}
+		if available, nullable := e.Nullable(i); available {
+			c.Nullable = &nullable
+		}
+		if v, ok := collations[i]; ok {
+			c.CollationID = &v
+		} else if v, ok := enumSetCollations[i]; ok {
+			c.CollationID = &v
+		}
+		c.EnumValues = enumValues[i]
+		c.SetValues = setValues[i]
+		if v, ok := geometryTypes[i]; ok {
+			c.GeometryType = &v
+		}
+		if v, ok := visibility[i]; ok {
+			c.Visible = &v
+		}
+	}
+
+	return struct {
+		TableID    uint64       `json:"table_id"`
+		Flags      uint16       `json:"flags"`
+		Schema     string       `json:"schema"`
+		Table      string       `json:"table"`
+		Columns    []jsonColumn `json:"columns"`
+		PrimaryKey []uint64     `json:"primary_key,omitempty"`
+	}{e.TableID, e.Flags, string(e.Schema), string(e.Table), columns, e.PrimaryKey}
+}
+
+type jsonRow struct {
+	Before        []*jsonValue `json:"before,omitempty"`
+	BeforeSkipped []int        `json:"before_skipped,omitempty"`
+	After         []*jsonValue `json:"after,omitempty"`
+	AfterSkipped  []int        `json:"after_skipped,omitempty"`
+}
+
+// jsonRowsEvent encodes a RowsEvent. The rows are read with RowIterator, so the rows of an
+// event decoded lazily are encoded too, and MarshalJSON returns the error decoding them.
+type jsonRowsEvent struct {
+	e *RowsEvent
+}
+
+func newJSONRowsEvent(e *RowsEvent) any {
+	return jsonRowsEvent{e: e}
+}
+
+func (j jsonRowsEvent) MarshalJSON() ([]byte, error) {
+	e := j.e
+	var schema, table string
+	var collations map[int]uint64
+	if e.Table != nil {
+		schema, table = string(e.Table.Schema), string(e.Table.Table)
+		collations = e.Table.CollationMap()
+	}
+
+	tp := e.Type()
+	rows := make([]jsonRow, 0, len(e.Rows))
+	var row jsonRow
+	images := 0
+	it := e.RowIterator()
+	for it.Next() {
+		values, skipped := e.jsonImage(it.Row(), it.SkippedColumns(), collations)
+		images++
+		switch {
+		case tp == EnumRowsEventTypeUpdate && images%2 == 1:
+			// the after image follows
+			row = jsonRow{Before: values, BeforeSkipped: skipped}
+			continue
+		case tp == EnumRowsEventTypeUpdate:
+			row.After, row.AfterSkipped = values, skipped
+		case tp == EnumRowsEventTypeDelete:
+			row = jsonRow{Before: values, BeforeSkipped: skipped}
+		default:
+			row = jsonRow{After: values, AfterSkipped: skipped}
+		}
+		rows = append(rows, row)
+	}
+	if err := it.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return json.Marshal(struct {
+		TableID uint64    `json:"table_id"`
+		Flags   uint16    `json:"flags"`
+		Action  string    `json:"action"`
+		Schema  string    `json:"schema"`
+		Table   string    `json:"table"`
+		Rows    []jsonRow `json:"rows"`
+	}{e.TableID, e.Flags, tp.String(), schema, table, rows})
+}
+
+// jsonImage returns the values of the columns of a row image, collations are the
+// collations of the table columns.
+func (e *RowsEvent) jsonImage(row []any, skipped []int, collations map[int]uint64) ([]*jsonValue, []int) {
+	values := make([]*jsonValue, 0, len(row))
+	for col, v := range row {
+		var c jsonValueColumn
+		if e.Table != nil && col < len(e.Table.ColumnType) && col < len(e.Table.ColumnMeta) {
+			c.tp = e.Table.realType(col)
+			if collation, ok := collations[col]; ok {
+				c.binary = collation == mysql.BINARY_COLLATION_ID
+				c.text = !c.binary
+			}
+		}
+		values = append(values, newJSONValue(v, c))
+	}
+	return values, skipped
+}
+
+// jsonValueColumn is what is known about the column of a value, text and binary are
+// true if the column is known to have a character or a binary collation.
+type jsonValueColumn struct {
+	tp           byte
+	text, binary bool
+}
+
+type jsonValue struct {
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+type jsonDiff struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// newJSONValue returns the typed value of a decoded value, see RowsEvent for the types.
+func newJSONValue(v any, c jsonValueColumn) *jsonValue {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case int8, int16, int32, int64, int:
+		return &jsonValue{"int", v}
+	case uint8, uint16, uint32, uint64, uint:
+		return &jsonValue{"uint", v}
+	case float32, float64:
+		return &jsonValue{"float", v}
+	case decimal.Decimal:
+		return &jsonValue{"decimal", v.String()}
+	case time.Time:
+		return &jsonValue{"time", v.Format(time.RFC3339Nano)}
+	case *JsonDiff:
+		return &jsonValue{"json_diff", []jsonDiff{newJSONDiff(v)}}
+	case []*JsonDiff:
+		diffs := make([]jsonDiff, len(v))
+		for i, d := range v {
+			diffs[i] = newJSONDiff(d)
+		}
+		return &jsonValue{"json_diff", diffs}
+	case string:
+		return newJSONBytesValue([]byte(v), c, false)
+	case []byte:
+		return newJSONBytesValue(v, c, true)
+	default:
+		return &jsonValue{"string", fmt.Sprint(v)}
+	}
+}
+
+// newJSONBytesValue returns the typed value of a string, blob is true for the BLOB,
+// TEXT, GEOMETRY and VECTOR values, which are binary unless the column is known to be
+// a TEXT.
+func newJSONBytesValue(v []byte, c jsonValueColumn, blob bool) *jsonValue {
+	switch {
+	case c.tp == mysql.MYSQL_TYPE_JSON:
+		if len(v) == 0 {
+			// an empty document is the JSON null literal
+			return &jsonValue{"json", json.RawMessage("null")}
+		}
+		if json.Valid(v) {
+			return &jsonValue{"json", json.RawMessage(v)}
+		}
+	case c.tp == mysql.MYSQL_TYPE_NEWDECIMAL:
+		return &jsonValue{"decimal", string(v)}
+	}
+	if c.binary || (blob && !c.text) || !utf8.Valid(v) {
+		return &jsonValue{"bytes", base64.StdEncoding.EncodeToString(v)}
+	}
+	return &jsonValue{"string", string(v)}
+}
+
+func newJSONDiff(d *JsonDiff) jsonDiff {
+	j := jsonDiff{Op: d.Op.String(), Path: d.Path}
+	if d.Op != JsonDiffOperationRemove {
+		j.Value = json.RawMessage(d.Value)
+		if !json.Valid(j.Value) {
+			j.Value, _ = json.Marshal(d.Value)
+		}
+	}
+	return j
+}
@@ -0,0 +1,117 @@
+package replication
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestBinlogEventMarshalJSON(t *testing.T) {
+	table := &TableMapEvent{
+		TableID:     7,
+		Schema:      []byte("db"),
+		Table:       []byte("t"),
+		ColumnCount: 6,
+		ColumnType: []byte{
+			mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_BLOB,
+			mysql.MYSQL_TYPE_NEWDECIMAL, mysql.MYSQL_TYPE_JSON, mysql.MYSQL_TYPE_DATETIME2,
+		},
+		ColumnMeta:       []uint16{0, 255, 2, 10<<8 | 2, 4, 0},
+		NullBitmap:       []byte{0b111110},
+		SignednessBitmap: []byte{0b10000000},
+		DefaultCharset:   []uint64{255, 1, mysql.BINARY_COLLATION_ID},
+		ColumnName:       [][]byte{[]byte("id"), []byte("name"), []byte("data"), []byte("price"), []byte("doc"), []byte("ts")},
+		PrimaryKey:       []uint64{0},
+	}
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+
+	testcases := []struct {
+		event    *BinlogEvent
+		expected string
+	}{
+		{
+			&BinlogEvent{
+				Header: &EventHeader{Timestamp: 1700000000, EventType: ROTATE_EVENT, ServerID: 1, EventSize: 40, LogPos: 0, Flags: LOG_EVENT_ARTIFICIAL_F},
+				Event:  &RotateEvent{Position: 4, NextLogName: []byte("mysql-bin.000002")},
+			},
+			`{"header": {"type": "RotateEvent", "timestamp": 1700000000, "server_id": 1, "event_size": 40, "log_pos": 0, "flags": 32},
+			  "event": {"position": 4, "next_log_name": "mysql-bin.000002"}}`,
+		},
+		{
+			&BinlogEvent{
+				Header: &EventHeader{EventType: GTID_EVENT},
+				Event: &GTIDEvent{
+					SID: []byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62},
+					GNO: 23, LastCommitted: 1, SequenceNumber: 2, ImmediateCommitTimestamp: 1700000000000001,
+				},
+			},
+			`{"header": {"type": "GTIDEvent", "timestamp": 0, "server_id": 0, "event_size": 0, "log_pos": 0, "flags": 0},
+			  "event": {"gtid": "3e11fa47-71ca-11e1-9e33-c80aa9429562:23", "commit_flag": 0, "last_committed": 1, "sequence_number": 2,
+			    "immediate_commit_timestamp": 1700000000000001, "original_commit_timestamp": 0,
+			    "immediate_commit_time": "2023-11-14T22:13:20.000001Z", "transaction_length": 0,
+			    "immediate_server_version": 0, "original_server_version": 0}}`,
+		},
+		{
+			&BinlogEvent{
+				Header: &EventHeader{EventType: TABLE_MAP_EVENT},
+				Event:  table,
+			},
+			`{"header": {"type": "TableMapEvent", "timestamp": 0, "server_id": 0, "event_size": 0, "log_pos": 0, "flags": 0},
+			  "event": {"table_id": 7, "flags": 0, "schema": "db", "table": "t", "primary_key": [0], "columns": [
+			    {"name": "id", "type": 3, "meta": 0, "unsigned": true, "nullable": false},
+			    {"name": "name", "type": 15, "meta": 255, "nullable": true, "collation_id": 255},
+			    {"name": "data", "type": 252, "meta": 2, "nullable": true, "collation_id": 63},
+			    {"name": "price", "type": 246, "meta": 2562, "unsigned": false, "nullable": true},
+			    {"name": "doc", "type": 245, "meta": 4, "nullable": true},
+			    {"name": "ts", "type": 18, "meta": 0, "nullable": true}]}}`,
+		},
+		{
+			&BinlogEvent{
+				Header: &EventHeader{EventType: PARTIAL_UPDATE_ROWS_EVENT},
+				Event: &RowsEvent{
+					eventType: PARTIAL_UPDATE_ROWS_EVENT,
+					TableID:   7,
+					Table:     table,
+					Rows: [][]any{
+						{uint32(1), "a", []byte{0xff}, decimal.RequireFromString("1.50"), `{"a": 1}`, ts},
+						{uint32(1), nil, nil, "2.50", &JsonDiff{Op: JsonDiffOperationReplace, Path: "$.a", Value: "2"}, ts},
+					},
+					SkippedColumns: [][]int{nil, {2}},
+				},
+			},
+			`{"header": {"type": "PartialUpdateRowsEvent", "timestamp": 0, "server_id": 0, "event_size": 0, "log_pos": 0, "flags": 0},
+			  "event": {"table_id": 7, "flags": 0, "action": "update", "schema": "db", "table": "t", "rows": [{
+			    "before": [{"type": "uint", "value": 1}, {"type": "string", "value": "a"}, {"type": "bytes", "value": "/w=="},
+			      {"type": "decimal", "value": "1.5"}, {"type": "json", "value": {"a": 1}}, {"type": "time", "value": "2024-01-02T03:04:05.000006Z"}],
+			    "after": [{"type": "uint", "value": 1}, null, null, {"type": "decimal", "value": "2.50"},
+			      {"type": "json_diff", "value": [{"op": "Replace", "path": "$.a", "value": 2}]}, {"type": "time", "value": "2024-01-02T03:04:05.000006Z"}],
+			    "after_skipped": [2]}]}}`,
+		},
+		{
+			&BinlogEvent{
+				Header: &EventHeader{EventType: XID_EVENT},
+				Event:  &XIDEvent{XID: 9},
+			},
+			`{"header": {"type": "XIDEvent", "timestamp": 0, "server_id": 0, "event_size": 0, "log_pos": 0, "flags": 0},
+			  "event": {"xid": 9}}`,
+		},
+		{
+			&BinlogEvent{
+				Header: &EventHeader{EventType: UNKNOWN_EVENT},
+				Event:  &GenericEvent{Data: []byte("abc")},
+			},
+			`{"header": {"type": "UnknownEvent", "timestamp": 0, "server_id": 0, "event_size": 0, "log_pos": 0, "flags": 0},
+			  "event": {"data": "YWJj"}}`,
+		},
+	}
+	for _, tc := range testcases {
+		data, err := json.Marshal(tc.event)
+		require.NoError(t, err)
+		require.JSONEq(t, tc.expected, string(data))
+	}
+}
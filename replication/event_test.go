@@ -6,6 +6,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
 )
 
 func TestMariadbGTIDListEvent(t *testing.T) {
@@ -253,3 +255,318 @@ func TestHeartbeatEvent(t *testing.T) {
 		}
 	}
 }
+
+func TestEncodeEvents(t *testing.T) {
+	testcases := []struct {
+		decoded Event
+		data    []byte
+	}{
+		{
+			&GTIDEvent{},
+			[]byte("\x00Z\xa7*\u007fD\xa8\x11\xea\x94\u007f\x02B\xac\x19\x00\x02\x02\x01\x00\x00\x00\x00\x00\x00\x02v\x00\x00\x00\x00\x00\x00\x00w\x00\x00\x00\x00\x00\x00\x00\xc1G\x81\x16x\xa0\x85\x00\x00\x00\x00\x00\x00\x00\xfc\xc5\x03\x938\x01\x80\x00\x00\x00\x00"),
+		},
+		{
+			&GTIDEvent{},
+			[]byte("\x00Z\xa7*\u007fD\xa8\x11\xea\x94\u007f\x02B\xac\x19\x00\x02\x03\x01\x00\x00\x00\x00\x00\x00\x025\x00\x00\x00\x00\x00\x00\x006\x00\x00\x00\x00\x00\x00\x00"),
+		},
+		{
+			&GTIDEvent{},
+			[]byte("\x00\\\xcc\x103D\xa8\x11\xea\xbdY\x02B\xac\x19\x00\x03w\x00\x00\x00\x00\x00\x00\x00\x02x\x00\x00\x00\x00\x00\x00\x00y\x00\x00\x00\x00\x00\x00\x00j0\xb1>x\xa0\x05\xfc\xc3\x03\x938\x01\x00"),
+		},
+		{
+			&MariadbGTIDEvent{},
+			[]byte{1, 2, 3, 4, 5, 6, 7, 8, 0x2a, 1, 0x3b, 4, 0xff, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17},
+		},
+		{
+			&MariadbGTIDEvent{},
+			[]byte{1, 2, 3, 4, 5, 6, 7, 8, 0x2a, 1, 0x3b, 4, 0x01, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			&MariadbGTIDListEvent{},
+			[]byte{3, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, 5, 0, 0, 0, 6, 0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 8, 0, 0, 0, 9, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			&PreviousGTIDsEvent{},
+			[]byte{0x1, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x89, 0x6e, 0x78, 0x82, 0x18, 0xfe, 0x11, 0xef, 0xab, 0x88, 0x22, 0x22, 0x2d, 0x34, 0xd4, 0x11, 0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x89, 0x6e, 0x78, 0x82, 0x18, 0xfe, 0x11, 0xef, 0xab, 0x88, 0x22, 0x22, 0x2d, 0x34, 0xd4, 0x11, 0x8, 0x61, 0x61, 0x61, 0x61, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+		},
+		{
+			&RotateEvent{},
+			[]byte{0x4, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x62, 0x69, 0x6e, 0x6c, 0x6f, 0x67, 0x2e, 0x30, 0x30, 0x30, 0x30, 0x30, 0x32},
+		},
+		{
+			&XIDEvent{},
+			[]byte{0x2a, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+		},
+		{
+			&IntVarEvent{},
+			[]byte{1, 13, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			// BEGIN in schema "test" with Q_FLAGS2_CODE status var
+			&QueryEvent{},
+			[]byte{0x8, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x4, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x74, 0x65, 0x73, 0x74, 0x0, 0x42, 0x45, 0x47, 0x49, 0x4e},
+		},
+	}
+
+	for _, tc := range testcases {
+		require.NoError(t, tc.decoded.Decode(tc.data))
+
+		data, err := tc.decoded.(EventEncoder).Encode()
+		require.NoError(t, err)
+		require.Equal(t, tc.data, data, "%T", tc.decoded)
+	}
+}
+
+func TestMariadbCompressedQueryEvent(t *testing.T) {
+	// INSERT INTO t VALUES (1) in schema "test", the query is compressed by zlib
+	data := []byte{
+		0x8, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x4, 0x0, 0x0, 0x0, 0x0, 0x74, 0x65, 0x73, 0x74, 0x0,
+		0x81, 0x18, 0x78, 0x9c, 0xf3, 0xf4, 0x0b, 0x76, 0x0d, 0x0a, 0x51, 0xf0, 0xf4, 0x0b, 0xf1, 0x57, 0x28, 0x51,
+		0x08, 0x73, 0xf4, 0x09, 0x75, 0x0d, 0x56, 0xd0, 0x30, 0xd4, 0x04, 0x00, 0x54, 0x20, 0x06, 0x56,
+	}
+	e := &QueryEvent{compressed: true}
+	require.NoError(t, e.Decode(data))
+	require.Equal(t, []byte("test"), e.Schema)
+	require.Equal(t, []byte("INSERT INTO t VALUES (1)"), e.Query)
+
+	// the query is truncated
+	require.Error(t, (&QueryEvent{compressed: true}).Decode(data[:len(data)-4]))
+
+	parser := NewBinlogParser()
+	_, err := parser.Parse(encodeTestEvents[0])
+	require.NoError(t, err)
+
+	header := &EventHeader{Timestamp: 1700000000, EventType: MARIADB_QUERY_COMPRESSED_EVENT, ServerID: 1, LogPos: 300}
+	encoded, err := EncodeEvent(header, e, BINLOG_CHECKSUM_ALG_CRC32)
+	require.NoError(t, err)
+	ev, err := parser.Parse(encoded)
+	require.NoError(t, err)
+	require.Equal(t, e.Schema, ev.Event.(*QueryEvent).Schema)
+	require.Equal(t, e.Query, ev.Event.(*QueryEvent).Query)
+}
+
+func TestEncodePreviousGTIDsEvent(t *testing.T) {
+	for _, gset := range []string{
+		"",
+		"896e7882-18fe-11ef-ab88-22222d34d411:1-3",
+		"896e7882-18fe-11ef-ab88-22222d34d411:1-4:aaaa:1:abc:1-3,896e7882-18fe-11ef-ab88-22222d34d412:1-2",
+	} {
+		e := PreviousGTIDsEvent{GTIDSets: gset}
+		data, err := e.Encode()
+		require.NoError(t, err)
+
+		decoded := PreviousGTIDsEvent{}
+		require.NoError(t, decoded.Decode(data))
+		require.Equal(t, gset, decoded.GTIDSets)
+	}
+}
+
+func TestEncodeEventHeader(t *testing.T) {
+	h := &EventHeader{
+		Timestamp: 1700000000,
+		EventType: XID_EVENT,
+		ServerID:  100,
+		LogPos:    1234,
+		Flags:     LOG_EVENT_SUPPRESS_USE_F,
+	}
+
+	for _, checksumAlg := range []BinlogChecksum{BINLOG_CHECKSUM_ALG_OFF, BINLOG_CHECKSUM_ALG_CRC32} {
+		data, err := EncodeEvent(h, &XIDEvent{XID: 42}, checksumAlg)
+		require.NoError(t, err)
+		require.Len(t, data, int(h.EventSize))
+
+		decoded := &EventHeader{}
+		require.NoError(t, decoded.Decode(data))
+		require.Equal(t, h, decoded)
+
+		p := NewBinlogParser()
+		p.format = &FormatDescriptionEvent{ChecksumAlgorithm: checksumAlg}
+		e, err := p.Parse(data)
+		require.NoError(t, err)
+		require.Equal(t, uint64(42), e.Event.(*XIDEvent).XID)
+	}
+
+	_, err := EncodeEvent(h, &HeartbeatEvent{}, BINLOG_CHECKSUM_ALG_OFF)
+	require.Error(t, err)
+}
+
+func TestRandEvent(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x2a, 0, 0, 0, 0, 0, 0, 0}
+	ev := RandEvent{}
+	require.NoError(t, ev.Decode(data))
+	require.Equal(t, uint64(0x0807060504030201), ev.Seed1)
+	require.Equal(t, uint64(42), ev.Seed2)
+
+	encoded, err := ev.Encode()
+	require.NoError(t, err)
+	require.Equal(t, data, encoded)
+
+	require.Error(t, ev.Decode(data[:10]))
+}
+
+func TestUserVarEvent(t *testing.T) {
+	testcases := []struct {
+		data     []byte
+		name     string
+		tp       UserVarType
+		expected any
+	}{
+		{
+			// SET @a = 'abc'
+			[]byte{0x01, 0, 0, 0, 'a', 0, 0, 0x21, 0, 0, 0, 0x03, 0, 0, 0, 'a', 'b', 'c', 0},
+			"a", USER_VAR_STRING, "abc",
+		},
+		{
+			// SET @b = -1
+			[]byte{0x01, 0, 0, 0, 'b', 0, 0x02, 0x3f, 0, 0, 0, 0x08, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0},
+			"b", USER_VAR_INT, int64(-1),
+		},
+		{
+			// SET @c = 18446744073709551615
+			[]byte{0x01, 0, 0, 0, 'c', 0, 0x02, 0x3f, 0, 0, 0, 0x08, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, USER_VAR_UNSIGNED_F},
+			"c", USER_VAR_INT, uint64(18446744073709551615),
+		},
+		{
+			// SET @d = 1.5e0
+			[]byte{0x01, 0, 0, 0, 'd', 0, 0x01, 0x3f, 0, 0, 0, 0x08, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xf8, 0x3f, 0},
+			"d", USER_VAR_REAL, 1.5,
+		},
+		{
+			// SET @e = 12.34
+			[]byte{0x01, 0, 0, 0, 'e', 0, 0x04, 0x3f, 0, 0, 0, 0x04, 0, 0, 0, 0x04, 0x02, 0x8c, 0x22, 0},
+			"e", USER_VAR_DECIMAL, "12.34",
+		},
+		{
+			// SET @f = NULL
+			[]byte{0x01, 0, 0, 0, 'f', 1},
+			"f", USER_VAR_STRING, nil,
+		},
+	}
+
+	for _, tc := range testcases {
+		ev := UserVarEvent{}
+		require.NoError(t, ev.Decode(tc.data))
+		require.Equal(t, tc.name, string(ev.Name))
+		require.Equal(t, tc.tp, ev.Type)
+		require.Equal(t, tc.expected == nil, ev.IsNull)
+
+		v, err := ev.ParsedValue()
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, v)
+
+		encoded, err := ev.Encode()
+		require.NoError(t, err)
+		require.Equal(t, tc.data, encoded)
+	}
+
+	// before MySQL 5.7 there is no flags
+	ev := UserVarEvent{}
+	require.NoError(t, ev.Decode([]byte{0x01, 0, 0, 0, 'a', 0, 0, 0x21, 0, 0, 0, 0x01, 0, 0, 0, 'x'}))
+	require.Equal(t, []byte("x"), ev.Value)
+	require.Zero(t, ev.Flags)
+
+	require.Error(t, ev.Decode([]byte{0x05, 0, 0, 0, 'a', 0}))
+}
+
+func TestIncidentEvent(t *testing.T) {
+	data := append([]byte{0x01, 0x00, 0x0b}, "lost events"...)
+	ev := IncidentEvent{}
+	require.NoError(t, ev.Decode(data))
+	require.Equal(t, INCIDENT_LOST_EVENTS, ev.Type)
+	require.Equal(t, "lost events", string(ev.Message))
+
+	encoded, err := ev.Encode()
+	require.NoError(t, err)
+	require.Equal(t, data, encoded)
+}
+
+func TestViewChangeEvent(t *testing.T) {
+	data := make([]byte, 40)
+	copy(data, "15879424373591843:1")
+	data = append(data, 0x05, 0, 0, 0, 0, 0, 0, 0, 0x02, 0, 0, 0)
+	data = append(data, 0x02, 0, 'k', '1', 0x03, 0, 0, 0, 'v', '1', '1')
+	data = append(data, 0x02, 0, 'k', '2', 0x00, 0, 0, 0)
+
+	ev := ViewChangeEvent{}
+	require.NoError(t, ev.Decode(data))
+	require.Equal(t, "15879424373591843:1", ev.ViewID)
+	require.Equal(t, uint64(5), ev.SeqNumber)
+	require.Equal(t, map[string][]byte{"k1": []byte("v11"), "k2": {}}, ev.CertificationInfo)
+
+	encoded, err := ev.Encode()
+	require.NoError(t, err)
+	require.Equal(t, data, encoded)
+
+	require.Error(t, ev.Decode(data[:len(data)-5]))
+}
+
+func TestXAPrepareEvent(t *testing.T) {
+	data := []byte{0x00, 0x01, 0, 0, 0, 0x03, 0, 0, 0, 0x01, 0, 0, 0, 'a', 'b', 'c', 'd'}
+	ev := XAPrepareEvent{}
+	require.NoError(t, ev.Decode(data))
+	require.False(t, ev.OnePhase)
+	require.Equal(t, int32(1), ev.FormatID)
+	require.Equal(t, "abc", string(ev.GTRID))
+	require.Equal(t, "d", string(ev.BQUAL))
+	require.Equal(t, "X'616263',X'64',1", ev.XID())
+
+	encoded, err := ev.Encode()
+	require.NoError(t, err)
+	require.Equal(t, data, encoded)
+}
+
+func TestTransactionContextEvent(t *testing.T) {
+	gset, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-23")
+	require.NoError(t, err)
+	snapshot := gset.Encode()
+	serverUUID := "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+	data := []byte{byte(len(serverUUID)), 0x0a, 0, 0, 0, 0x01, byte(len(snapshot)), 0, 0, 0, 0x02, 0, 0, 0, 0x01, 0, 0, 0}
+	data = append(data, serverUUID...)
+	data = append(data, snapshot...)
+	data = append(data, 0x02, 0, 'w', '1', 0x02, 0, 'w', '2')
+	data = append(data, 0x01, 0, 'r')
+
+	ev := TransactionContextEvent{}
+	require.NoError(t, ev.Decode(data))
+	require.Equal(t, serverUUID, ev.ServerUUID)
+	require.Equal(t, uint32(10), ev.ThreadID)
+	require.True(t, ev.GTIDSpecified)
+	require.Equal(t, [][]byte{[]byte("w1"), []byte("w2")}, ev.WriteSet)
+	require.Equal(t, [][]byte{[]byte("r")}, ev.ReadSet)
+
+	snapshotSet, err := ev.SnapshotGTIDSet()
+	require.NoError(t, err)
+	require.True(t, gset.Equal(snapshotSet))
+
+	encoded, err := ev.Encode()
+	require.NoError(t, err)
+	require.Equal(t, data, encoded)
+
+	require.Error(t, ev.Decode(data[:len(data)-1]))
+}
+
+func TestParseControlEvents(t *testing.T) {
+	testcases := []struct {
+		eventType EventType
+		event     Event
+	}{
+		{RAND_EVENT, &RandEvent{Seed1: 1, Seed2: 2}},
+		{USER_VAR_EVENT, &UserVarEvent{Name: []byte("a"), IsNull: true}},
+		{INCIDENT_EVENT, &IncidentEvent{Type: INCIDENT_LOST_EVENTS, Message: []byte("lost")}},
+		{VIEW_CHANGE_EVENT, &ViewChangeEvent{ViewID: "1:2", SeqNumber: 3, CertificationInfo: map[string][]byte{}}},
+		{XA_PREPARE_LOG_EVENT, &XAPrepareEvent{FormatID: 1, GTRID: []byte("g"), BQUAL: []byte{}}},
+		{TRANSACTION_CONTEXT_EVENT, &TransactionContextEvent{ServerUUID: "u", SnapshotVersion: []byte{}, WriteSet: [][]byte{}, ReadSet: [][]byte{}}},
+	}
+
+	parser := NewBinlogParser()
+	parser.format = &FormatDescriptionEvent{}
+	for _, tc := range testcases {
+		data, err := EncodeEvent(&EventHeader{EventType: tc.eventType}, tc.event, BINLOG_CHECKSUM_ALG_OFF)
+		require.NoError(t, err)
+
+		e, err := parser.Parse(data)
+		require.NoError(t, err)
+		require.Equal(t, tc.event, e.Event, tc.eventType.String())
+	}
+}
@@ -0,0 +1,164 @@
+package replication
+
+import (
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// SyncSource is a server of the replication topology the BinlogSyncer can sync from.
+type SyncSource struct {
+	Host string
+	Port uint16
+	// ServerUUID is the @@server_uuid of the server, @@server_id for MariaDB. If set for
+	// a failover candidate, the server must report it, e.g. to not follow a stale DNS name.
+	ServerUUID string
+}
+
+// String returns the address of the source.
+func (s SyncSource) String() string {
+	if s.Port == 0 {
+		return s.Host
+	}
+	return net.JoinHostPort(s.Host, strconv.Itoa(int(s.Port)))
+}
+
+// CurrentSource returns the server the syncer is attached to, the ServerUUID is only
+// known with BinlogSyncerConfig.FailoverSources or DiscoverSources.
+func (b *BinlogSyncer) CurrentSource() SyncSource {
+	b.sourceM.Lock()
+	defer b.sourceM.Unlock()
+
+	return b.source
+}
+
+func (b *BinlogSyncer) setSource(s SyncSource) {
+	b.sourceM.Lock()
+	defer b.sourceM.Unlock()
+
+	b.source = s
+}
+
+// failoverEnabled reports whether the syncer fails over to other servers.
+func (b *BinlogSyncer) failoverEnabled() bool {
+	return len(b.cfg.FailoverSources) > 0 || b.cfg.DiscoverSources != nil
+}
+
+// checkSource verifies the server of the new connection can continue the sync, and
+// records it as the current source.
+func (b *BinlogSyncer) checkSource() error {
+	var query string
+	switch b.cfg.Flavor {
+	case mysql.MariaDBFlavor:
+		query = "SELECT @@GLOBAL.server_id, @@GLOBAL.gtid_binlog_pos"
+	default:
+		query = "SELECT @@GLOBAL.server_uuid, @@GLOBAL.gtid_executed"
+	}
+	r, err := b.c.Execute(query)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	serverUUID, err := r.GetString(0, 0)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	executed, err := r.GetString(0, 1)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	source := SyncSource{Host: b.cfg.Host, Port: b.cfg.Port, ServerUUID: b.sourceUUID}
+	if err = verifySource(source, b.cfg.Flavor, b.c.GetServerVersion(), serverUUID, executed, b.prevGset); err != nil {
+		return errors.Trace(err)
+	}
+
+	source.ServerUUID = serverUUID
+	b.setSource(source)
+	return nil
+}
+
+// verifySource checks the flavor, the server UUID and the executed GTID set reported by
+// the server of source, the GTID set must contain gset, the transactions received so far.
+func verifySource(source SyncSource, flavor string, version string, serverUUID string, executed string, gset mysql.GTIDSet) error {
+	if isMariaDB := strings.Contains(version, "MariaDB"); isMariaDB != (flavor == mysql.MariaDBFlavor) {
+		return errors.Errorf("server %s of version %s is not of flavor %s", source, version, flavor)
+	}
+	if source.ServerUUID != "" && source.ServerUUID != serverUUID {
+		return errors.Errorf("server %s has server UUID %s, but %s expected", source, serverUUID, source.ServerUUID)
+	}
+	if gset == nil {
+		return nil
+	}
+
+	executedSet, err := mysql.ParseGTIDSet(flavor, executed)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !executedSet.Contain(gset) {
+		return errors.Errorf("server %s with GTID set %s has not executed all of GTID set %s", source, executed, gset)
+	}
+	return nil
+}
+
+// failoverSources returns the candidates to fail over to, the failed source excluded.
+func (b *BinlogSyncer) failoverSources(failed SyncSource) ([]SyncSource, error) {
+	sources := b.cfg.FailoverSources
+	if b.cfg.DiscoverSources != nil {
+		var err error
+		if sources, err = b.cfg.DiscoverSources(b.ctx); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	candidates := make([]SyncSource, 0, len(sources))
+	for _, s := range sources {
+		if s.Host == failed.Host && s.Port == failed.Port {
+			continue
+		}
+		candidates = append(candidates, s)
+	}
+	return candidates, nil
+}
+
+// failover resumes the GTID sync from the first candidate which can continue it, after
+// the current source failed with cause. If none can, the current source is kept for the
+// next retry.
+func (b *BinlogSyncer) failover(cause error) error {
+	failed := SyncSource{Host: b.cfg.Host, Port: b.cfg.Port, ServerUUID: b.sourceUUID}
+	candidates, err := b.failoverSources(failed)
+	if err != nil {
+		return errors.Annotatef(cause, "discover failover sources: %v", err)
+	}
+
+	lastConnectionID := b.lastConnectionID
+	for _, s := range candidates {
+		if b.isClosed() {
+			return errors.Trace(ErrSyncClosed)
+		}
+
+		b.cfg.Logger.Warn("source is unavailable, try to fail over",
+			slog.String("source", failed.String()), slog.String("candidate", s.String()), slog.Any("error", cause))
+
+		b.cfg.Host, b.cfg.Port, b.sourceUUID = s.Host, s.Port, s.ServerUUID
+		// the connection ID is of the failed source
+		b.lastConnectionID = 0
+		if err = b.prepareSyncGTID(b.prevGset); err != nil {
+			b.cfg.Logger.Warn("failover candidate can't continue the sync",
+				slog.String("candidate", s.String()), slog.Any("error", err))
+			continue
+		}
+
+		b.cfg.Logger.Info("failed over to new source", slog.String("from", failed.String()),
+			slog.String("to", s.String()), slog.String("server UUID", b.CurrentSource().ServerUUID))
+		return nil
+	}
+
+	b.cfg.Host, b.cfg.Port, b.sourceUUID = failed.Host, failed.Port, failed.ServerUUID
+	b.lastConnectionID = lastConnectionID
+	return errors.Annotatef(cause, "no failover source among %d candidates", len(candidates))
+}
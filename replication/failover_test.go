@@ -0,0 +1,69 @@
+package replication
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestVerifySource(t *testing.T) {
+	const uuid = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	gset, err := mysql.ParseGTIDSet(mysql.MySQLFlavor, uuid+":1-10")
+	require.NoError(t, err)
+
+	source := SyncSource{Host: "replica1", Port: 3306}
+	require.NoError(t, verifySource(source, mysql.MySQLFlavor, "8.0.36", uuid, uuid+":1-20", gset))
+	// position based sync
+	require.NoError(t, verifySource(source, mysql.MySQLFlavor, "8.0.36", uuid, "", nil))
+
+	err = verifySource(source, mysql.MySQLFlavor, "8.0.36", uuid, uuid+":1-9", gset)
+	require.ErrorContains(t, err, "has not executed all of GTID set")
+	err = verifySource(source, mysql.MySQLFlavor, "10.11.6-MariaDB", uuid, uuid+":1-20", gset)
+	require.ErrorContains(t, err, "is not of flavor mysql")
+
+	source.ServerUUID = "5e11fa47-71ca-11e1-9e33-c80aa9429562"
+	err = verifySource(source, mysql.MySQLFlavor, "8.0.36", uuid, uuid+":1-20", gset)
+	require.ErrorContains(t, err, "but "+source.ServerUUID+" expected")
+
+	gset, err = mysql.ParseGTIDSet(mysql.MariaDBFlavor, "0-1-100")
+	require.NoError(t, err)
+	source = SyncSource{Host: "replica2"}
+	require.NoError(t, verifySource(source, mysql.MariaDBFlavor, "10.11.6-MariaDB", "2", "0-1-120", gset))
+	err = verifySource(source, mysql.MariaDBFlavor, "10.11.6-MariaDB", "2", "0-1-90", gset)
+	require.ErrorContains(t, err, "has not executed all of GTID set")
+}
+
+func TestFailoverSources(t *testing.T) {
+	failed := SyncSource{Host: "source", Port: 3306}
+	b := NewBinlogSyncer(BinlogSyncerConfig{
+		ServerID: 100,
+		Host:     failed.Host,
+		Port:     failed.Port,
+		FailoverSources: []SyncSource{
+			{Host: "replica1", Port: 3306},
+			failed,
+			{Host: "replica2", Port: 3307, ServerUUID: "3e11fa47-71ca-11e1-9e33-c80aa9429562"},
+		},
+	})
+	require.True(t, b.failoverEnabled())
+	require.Equal(t, SyncSource{Host: "source", Port: 3306}, b.CurrentSource())
+	require.Equal(t, "source:3306", b.CurrentSource().String())
+
+	candidates, err := b.failoverSources(failed)
+	require.NoError(t, err)
+	require.Equal(t, []SyncSource{b.cfg.FailoverSources[0], b.cfg.FailoverSources[2]}, candidates)
+
+	// discovered at each failover
+	calls := 0
+	b.cfg.DiscoverSources = func(ctx context.Context) ([]SyncSource, error) {
+		calls++
+		return []SyncSource{failed, {Host: "replica3", Port: 3306}}, nil
+	}
+	candidates, err = b.failoverSources(failed)
+	require.NoError(t, err)
+	require.Equal(t, []SyncSource{{Host: "replica3", Port: 3306}}, candidates)
+	require.Equal(t, 1, calls)
+}
@@ -615,6 +615,26 @@ func (d *jsonBinaryDecoder) decodeVariableLength(data []byte) (int, int) {
 }
 
 func (e *RowsEvent) decodeJSONPartialBinary(data []byte) (*JsonDiff, error) {
+	diff, _, err := e.decodeJSONDiff(data)
+	return diff, err
+}
+
+// decodeJSONPartialBinaryDiffs decodes all the diffs of a partially updated JSON value.
+func (e *RowsEvent) decodeJSONPartialBinaryDiffs(data []byte) ([]*JsonDiff, error) {
+	var diffs []*JsonDiff
+	for len(data) > 0 {
+		diff, n, err := e.decodeJSONDiff(data)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, diff)
+		data = data[n:]
+	}
+	return diffs, nil
+}
+
+// decodeJSONDiff decodes the first diff of data and returns the number of bytes read.
+func (e *RowsEvent) decodeJSONDiff(data []byte) (*JsonDiff, int, error) {
 	// see Json_diff_vector::read_binary() in mysql-server/sql/json_diff.cc
 	operationNumber := JsonDiffOperation(data[0])
 	switch operationNumber {
@@ -622,15 +642,18 @@ func (e *RowsEvent) decodeJSONPartialBinary(data []byte) (*JsonDiff, error) {
 	case JsonDiffOperationInsert:
 	case JsonDiffOperationRemove:
 	default:
-		return nil, ErrCorruptedJSONDiff
+		return nil, 0, ErrCorruptedJSONDiff
 	}
-	data = data[1:]
+	pos := 1
 
-	pathLength, _, n := mysql.LengthEncodedInt(data)
-	data = data[n:]
+	pathLength, _, n := mysql.LengthEncodedInt(data[pos:])
+	pos += n
+	if uint64(len(data)-pos) < pathLength {
+		return nil, 0, ErrCorruptedJSONDiff
+	}
 
-	path := data[:pathLength]
-	data = data[pathLength:]
+	path := data[pos : pos+int(pathLength)]
+	pos += int(pathLength)
 
 	diff := &JsonDiff{
 		Op:   operationNumber,
@@ -639,17 +662,21 @@ func (e *RowsEvent) decodeJSONPartialBinary(data []byte) (*JsonDiff, error) {
 	}
 
 	if operationNumber == JsonDiffOperationRemove {
-		return diff, nil
+		return diff, pos, nil
 	}
 
-	valueLength, _, n := mysql.LengthEncodedInt(data)
-	data = data[n:]
+	valueLength, _, n := mysql.LengthEncodedInt(data[pos:])
+	pos += n
+	if uint64(len(data)-pos) < valueLength {
+		return nil, 0, ErrCorruptedJSONDiff
+	}
 
-	d, err := e.decodeJSONBinary(data[:valueLength])
+	d, err := e.decodeJSONBinary(data[pos : pos+int(valueLength)])
 	if err != nil {
-		return nil, fmt.Errorf("cannot read json diff for field %q: %w", path, err)
+		return nil, 0, fmt.Errorf("cannot read json diff for field %q: %w", path, err)
 	}
 	diff.Value = string(d)
+	pos += int(valueLength)
 
-	return diff, nil
+	return diff, pos, nil
 }
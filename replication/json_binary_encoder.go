@@ -0,0 +1,192 @@
+package replication
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"math"
+	"slices"
+	"strconv"
+
+	"github.com/goccy/go-json"
+	"github.com/pingcap/errors"
+)
+
+// errJSONBTooLarge is returned when a small object or array would have offsets larger
+// than 16 bits, it has to be encoded as a large one.
+var errJSONBTooLarge = errors.New("JSON value too large for small container")
+
+// encodeJSONBinary is the reverse of decodeJSONBinary, it encodes the JSON text in the
+// MySQL JSON binary format.
+func encodeJSONBinary(text []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(text))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return nil, errors.Annotate(err, "invalid JSON value")
+	}
+
+	tp, data, err := encodeJSONBValue(v)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return append([]byte{tp}, data...), nil
+}
+
+// encodeJSONBValue returns the type and the data of a value decoded from JSON text.
+func encodeJSONBValue(v any) (byte, []byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return JSONB_LITERAL, []byte{JSONB_NULL_LITERAL}, nil
+	case bool:
+		if v {
+			return JSONB_LITERAL, []byte{JSONB_TRUE_LITERAL}, nil
+		}
+		return JSONB_LITERAL, []byte{JSONB_FALSE_LITERAL}, nil
+	case json.Number:
+		return encodeJSONBNumber(v)
+	case string:
+		data := appendJSONBVariableLength(nil, len(v))
+		return JSONB_STRING, append(data, v...), nil
+	case []any:
+		return encodeJSONBContainer(nil, v)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		// MySQL sorts the keys by length, then by bytes
+		slices.SortFunc(keys, func(a, b string) int {
+			return cmp.Or(cmp.Compare(len(a), len(b)), cmp.Compare(a, b))
+		})
+		values := make([]any, len(keys))
+		for i, k := range keys {
+			values[i] = v[k]
+		}
+		return encodeJSONBContainer(keys, values)
+	default:
+		return 0, nil, errors.Errorf("invalid JSON value %#v", v)
+	}
+}
+
+func encodeJSONBNumber(n json.Number) (byte, []byte, error) {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		switch {
+		case i >= math.MinInt16 && i <= math.MaxInt16:
+			return JSONB_INT16, binary.LittleEndian.AppendUint16(nil, uint16(i)), nil
+		case i >= math.MinInt32 && i <= math.MaxInt32:
+			return JSONB_INT32, binary.LittleEndian.AppendUint32(nil, uint32(i)), nil
+		default:
+			return JSONB_INT64, binary.LittleEndian.AppendUint64(nil, uint64(i)), nil
+		}
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return JSONB_UINT64, binary.LittleEndian.AppendUint64(nil, u), nil
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return 0, nil, errors.Trace(err)
+	}
+	return JSONB_DOUBLE, binary.LittleEndian.AppendUint64(nil, math.Float64bits(f)), nil
+}
+
+// encodeJSONBContainer encodes an object if keys isn't nil, an array otherwise, as a
+// small container if its offsets fit in 16 bits.
+func encodeJSONBContainer(keys []string, values []any) (byte, []byte, error) {
+	isObject := keys != nil
+	data, err := appendJSONBContainer(keys, values, true)
+	if err == errJSONBTooLarge {
+		data, err = appendJSONBContainer(keys, values, false)
+		if isObject {
+			return JSONB_LARGE_OBJECT, data, errors.Trace(err)
+		}
+		return JSONB_LARGE_ARRAY, data, errors.Trace(err)
+	}
+	if isObject {
+		return JSONB_SMALL_OBJECT, data, errors.Trace(err)
+	}
+	return JSONB_SMALL_ARRAY, data, errors.Trace(err)
+}
+
+func appendJSONBContainer(keys []string, values []any, isSmall bool) ([]byte, error) {
+	offsetSize := jsonbGetOffsetSize(isSmall)
+	valueEntrySize := jsonbGetValueEntrySize(isSmall)
+	count := len(values)
+
+	headerSize := 2*offsetSize + count*valueEntrySize
+	if keys != nil {
+		headerSize += count * jsonbGetKeyEntrySize(isSmall)
+	}
+
+	appendOffset := func(data []byte, v int) ([]byte, error) {
+		if isSmall {
+			if v > math.MaxUint16 {
+				return nil, errJSONBTooLarge
+			}
+			return binary.LittleEndian.AppendUint16(data, uint16(v)), nil
+		}
+		if v > math.MaxUint32 {
+			return nil, errors.Errorf("JSON value of %d bytes is too large", v)
+		}
+		return binary.LittleEndian.AppendUint32(data, uint32(v)), nil
+	}
+
+	// the keys and the values which aren't inlined follow the header
+	header := make([]byte, 0, headerSize)
+	var body []byte
+	var err error
+	if header, err = appendOffset(header, count); err != nil {
+		return nil, err
+	}
+	// the size is set at the end
+	header = append(header, make([]byte, offsetSize)...)
+
+	for _, k := range keys {
+		if len(k) > math.MaxUint16 {
+			return nil, errors.Errorf("JSON key of %d bytes is too long", len(k))
+		}
+		if header, err = appendOffset(header, headerSize+len(body)); err != nil {
+			return nil, err
+		}
+		header = binary.LittleEndian.AppendUint16(header, uint16(len(k)))
+		body = append(body, k...)
+	}
+
+	for _, v := range values {
+		tp, data, err := encodeJSONBValue(v)
+		if err != nil {
+			return nil, err
+		}
+		header = append(header, tp)
+		if isInlineValue(tp, isSmall) {
+			entry := make([]byte, offsetSize)
+			copy(entry, data)
+			header = append(header, entry...)
+			continue
+		}
+		if header, err = appendOffset(header, headerSize+len(body)); err != nil {
+			return nil, err
+		}
+		body = append(body, data...)
+	}
+
+	size := headerSize + len(body)
+	sizeData, err := appendOffset(nil, size)
+	if err != nil {
+		return nil, err
+	}
+	copy(header[offsetSize:], sizeData)
+	return append(header, body...), nil
+}
+
+// appendJSONBVariableLength is the reverse of jsonBinaryDecoder.decodeVariableLength.
+func appendJSONBVariableLength(data []byte, length int) []byte {
+	for {
+		b := byte(length & 0x7F)
+		length >>= 7
+		if length == 0 {
+			return append(data, b)
+		}
+		data = append(data, b|0x80)
+	}
+}
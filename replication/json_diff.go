@@ -0,0 +1,541 @@
+package replication
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/goccy/go-json"
+	"github.com/pingcap/errors"
+)
+
+// applyJSONPartialUpdate returns the after image of the JSON column from the before image
+// of the row, whose skipped columns are beforeSkips.
+func (e *RowsEvent) applyJSONPartialUpdate(before []any, beforeSkips []int, column int, diffs []*JsonDiff) (string, error) {
+	if before == nil {
+		return "", errors.New("missing before image of the partial JSON update")
+	}
+
+	var doc string
+	switch v := before[column].(type) {
+	case string:
+		doc = v
+	case []byte:
+		doc = string(v)
+	case nil:
+		if slices.Contains(beforeSkips, column) {
+			return "", errors.Errorf("JSON column %d is not in the before image, binlog_row_image=FULL is required to apply the partial updates", column)
+		}
+		return "", errors.Errorf("JSON column %d is NULL in the before image of the partial update", column)
+	default:
+		return "", errors.Errorf("invalid before image %T of JSON column %d", v, column)
+	}
+
+	after, err := e.applyJSONDiffs(doc, diffs)
+	return after, errors.Annotatef(err, "JSON column %d", column)
+}
+
+// applyJSONDiffs applies the diffs of a PARTIAL_UPDATE_ROWS_EVENT JSON column to the
+// before image doc and returns the after image, rendered like a full JSON value decoded
+// with the same options.
+//
+// The values are parsed from the JSON text, so the numbers keep their text and the
+// object keys keep their order, the inserted keys are ordered like JSONB in the MySQL
+// text mode.
+func (e *RowsEvent) applyJSONDiffs(doc string, diffs []*JsonDiff) (string, error) {
+	p := jsonTextParser{mysqlTextMode: e.renderJSONAsMySQLText}
+
+	root, err := p.parseDocument(doc)
+	if err != nil {
+		return "", errors.Annotate(err, "parse JSON before image")
+	}
+
+	for _, diff := range diffs {
+		path, err := parseJSONPath(diff.Path)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+
+		var value any
+		if diff.Op != JsonDiffOperationRemove {
+			if value, err = p.parseDocument(diff.Value); err != nil {
+				return "", errors.Annotatef(err, "parse JSON diff value of %s", diff.Path)
+			}
+		}
+
+		if root, err = applyJSONDiff(root, path, diff.Op, value); err != nil {
+			return "", errors.Annotatef(err, "apply JSON diff %s", diff)
+		}
+	}
+
+	data, err := json.Marshal(root)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return string(data), nil
+}
+
+// jsonPathLeg is a member or an array cell of a JSON path, the array index is negative
+// if it's relative to the last element, e.g. -1 for [last].
+type jsonPathLeg struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseJSONPath parses the MySQL JSON paths logged in the partial updates, like
+// $.a[3]."b c"[last-1]. The wildcards and the ranges are not supported.
+func parseJSONPath(path string) ([]jsonPathLeg, error) {
+	if len(path) == 0 || path[0] != '$' {
+		return nil, errors.Errorf("invalid JSON path %q, it must start with '$'", path)
+	}
+
+	var legs []jsonPathLeg
+	for i := 1; i < len(path); {
+		switch path[i] {
+		case ' ', '\t', '\n', '\r':
+			i++
+		case '.':
+			i++
+			for i < len(path) && path[i] == ' ' {
+				i++
+			}
+			if i < len(path) && path[i] == '"' {
+				key, n, err := unquoteJSONString(path[i:])
+				if err != nil {
+					return nil, errors.Errorf("invalid JSON path %q: %v", path, err)
+				}
+				legs = append(legs, jsonPathLeg{key: key})
+				i += n
+				continue
+			}
+			start := i
+			for i < len(path) && path[i] != '.' && path[i] != '[' && path[i] != ' ' {
+				i++
+			}
+			if start == i || path[start:i] == "*" {
+				return nil, errors.Errorf("invalid JSON path %q, unsupported member at %d", path, start)
+			}
+			legs = append(legs, jsonPathLeg{key: path[start:i]})
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, errors.Errorf("invalid JSON path %q, missing ']'", path)
+			}
+			index, err := parseJSONPathIndex(path[i+1 : i+end])
+			if err != nil {
+				return nil, errors.Errorf("invalid JSON path %q: %v", path, err)
+			}
+			legs = append(legs, jsonPathLeg{index: index, isIndex: true})
+			i += end + 1
+		default:
+			return nil, errors.Errorf("invalid JSON path %q, unexpected %q at %d", path, path[i], i)
+		}
+	}
+
+	return legs, nil
+}
+
+func parseJSONPathIndex(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 4 || !strings.EqualFold(s[:4], "last") {
+		index, err := strconv.Atoi(s)
+		if err != nil || index < 0 {
+			return 0, errors.Errorf("unsupported array index %q", s)
+		}
+		return index, nil
+	}
+
+	rest := strings.TrimSpace(s[4:])
+	if rest == "" {
+		return -1, nil
+	}
+	if rest[0] != '-' {
+		return 0, errors.Errorf("unsupported array index %q", s)
+	}
+	offset, err := strconv.Atoi(strings.TrimSpace(rest[1:]))
+	if err != nil || offset < 0 {
+		return 0, errors.Errorf("unsupported array index %q", s)
+	}
+	return -1 - offset, nil
+}
+
+// arrayIndex returns the index of the leg in an array of n elements.
+func (l jsonPathLeg) arrayIndex(n int) int {
+	if l.index < 0 {
+		return n + l.index
+	}
+	return l.index
+}
+
+// applyJSONDiff applies the operation at the path to the value v and returns the new value.
+func applyJSONDiff(v any, path []jsonPathLeg, op JsonDiffOperation, value any) (any, error) {
+	if len(path) == 0 {
+		if op != JsonDiffOperationReplace {
+			return nil, errors.Errorf("%s of the whole document", op)
+		}
+		return value, nil
+	}
+
+	leg := path[0]
+	last := len(path) == 1
+
+	switch c := v.(type) {
+	case []any:
+		if !leg.isIndex {
+			return nil, errors.Errorf("member %q of an array", leg.key)
+		}
+		i := leg.arrayIndex(len(c))
+		if last && op == JsonDiffOperationInsert {
+			// like JSON_ARRAY_INSERT, an index after the end appends
+			i = min(max(i, 0), len(c))
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		}
+		if i < 0 || i >= len(c) {
+			return nil, errors.Errorf("array index %d out of range %d", leg.index, len(c))
+		}
+		if last && op == JsonDiffOperationRemove {
+			return append(c[:i], c[i+1:]...), nil
+		}
+		child, err := applyJSONDiff(c[i], path[1:], op, value)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = child
+		return c, nil
+	case map[string]any:
+		if leg.isIndex {
+			return nil, errors.New("array index of an object")
+		}
+		child, ok := c[leg.key]
+		if last {
+			switch {
+			case op == JsonDiffOperationInsert:
+				c[leg.key] = value
+				return c, nil
+			case !ok:
+				return nil, errors.Errorf("missing member %q", leg.key)
+			case op == JsonDiffOperationRemove:
+				delete(c, leg.key)
+				return c, nil
+			}
+		}
+		if !ok {
+			return nil, errors.Errorf("missing member %q", leg.key)
+		}
+		child, err := applyJSONDiff(child, path[1:], op, value)
+		if err != nil {
+			return nil, err
+		}
+		c[leg.key] = child
+		return c, nil
+	case jsonObject:
+		if leg.isIndex {
+			return nil, errors.New("array index of an object")
+		}
+		i, ok := c.find(leg.key)
+		if last {
+			switch {
+			case op == JsonDiffOperationInsert:
+				if ok {
+					c.values[i] = value
+				} else {
+					c = c.insert(i, leg.key, value)
+				}
+				return c, nil
+			case !ok:
+				return nil, errors.Errorf("missing member %q", leg.key)
+			case op == JsonDiffOperationRemove:
+				c.keys = append(c.keys[:i], c.keys[i+1:]...)
+				c.values = append(c.values[:i], c.values[i+1:]...)
+				return c, nil
+			}
+		}
+		if !ok {
+			return nil, errors.Errorf("missing member %q", leg.key)
+		}
+		child, err := applyJSONDiff(c.values[i], path[1:], op, value)
+		if err != nil {
+			return nil, err
+		}
+		c.values[i] = child
+		return c, nil
+	default:
+		return nil, errors.New("path leg of a scalar")
+	}
+}
+
+// jsonKeyLess is the order of the JSONB object keys, by length and then by bytes.
+func jsonKeyLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// find returns the index of key, or the index to insert it at if it's missing. The keys
+// are not sorted if they are not decoded from JSONB, so they are searched linearly.
+func (o jsonObject) find(key string) (int, bool) {
+	pos := len(o.keys)
+	for i, k := range o.keys {
+		if k == key {
+			return i, true
+		}
+		if pos == len(o.keys) && jsonKeyLess(key, k) {
+			pos = i
+		}
+	}
+	return pos, false
+}
+
+func (o jsonObject) insert(i int, key string, value any) jsonObject {
+	o.keys = append(o.keys, "")
+	copy(o.keys[i+1:], o.keys[i:])
+	o.keys[i] = key
+	o.values = append(o.values, nil)
+	copy(o.values[i+1:], o.values[i:])
+	o.values[i] = value
+	return o
+}
+
+// jsonTextParser parses the JSON text produced by jsonBinaryDecoder back into the values
+// it marshals: the numbers are kept as text, and the strings and objects are decoded
+// like the MySQL text mode does if mysqlTextMode is set.
+type jsonTextParser struct {
+	mysqlTextMode bool
+
+	data string
+	pos  int
+}
+
+func (p *jsonTextParser) parseDocument(data string) (any, error) {
+	p.data = data
+	p.pos = 0
+
+	// an empty JSON value is the JSON null literal, see decodeValue of MYSQL_TYPE_JSON
+	p.skipSpaces()
+	if p.pos == len(p.data) {
+		return nil, nil
+	}
+
+	v, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos != len(p.data) {
+		return nil, p.errorf("unexpected data after the value")
+	}
+	return v, nil
+}
+
+func (p *jsonTextParser) errorf(format string, args ...any) error {
+	return errors.Errorf("invalid JSON text at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *jsonTextParser) skipSpaces() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *jsonTextParser) consume(c byte) bool {
+	p.skipSpaces()
+	if p.pos < len(p.data) && p.data[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *jsonTextParser) parseValue() (any, error) {
+	p.skipSpaces()
+	if p.pos == len(p.data) {
+		return nil, p.errorf("missing value")
+	}
+
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		return p.parseObject()
+	case c == '[':
+		return p.parseArray()
+	case c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		if p.mysqlTextMode {
+			return jsonString(s), nil
+		}
+		return s, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := p.pos
+		for p.pos < len(p.data) && strings.IndexByte("+-0123456789.eE", p.data[p.pos]) >= 0 {
+			p.pos++
+		}
+		return jsonRawNumber(p.data[start:p.pos]), nil
+	default:
+		for _, lit := range []struct {
+			text  string
+			value any
+		}{{"true", true}, {"false", false}, {"null", nil}} {
+			if len(p.data)-p.pos >= len(lit.text) && p.data[p.pos:p.pos+len(lit.text)] == lit.text {
+				p.pos += len(lit.text)
+				return lit.value, nil
+			}
+		}
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func (p *jsonTextParser) parseObject() (any, error) {
+	p.pos++
+
+	var obj jsonObject
+	m := make(map[string]any)
+	if !p.consume('}') {
+		for {
+			p.skipSpaces()
+			if p.pos == len(p.data) || p.data[p.pos] != '"' {
+				return nil, p.errorf("missing object key")
+			}
+			key, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			if !p.consume(':') {
+				return nil, p.errorf("missing ':' after object key")
+			}
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+
+			if p.mysqlTextMode {
+				obj.keys = append(obj.keys, key)
+				obj.values = append(obj.values, value)
+			} else {
+				m[key] = value
+			}
+
+			if p.consume('}') {
+				break
+			}
+			if !p.consume(',') {
+				return nil, p.errorf("missing ',' in object")
+			}
+		}
+	}
+
+	if p.mysqlTextMode {
+		return obj, nil
+	}
+	return m, nil
+}
+
+func (p *jsonTextParser) parseArray() (any, error) {
+	p.pos++
+
+	values := make([]any, 0)
+	if p.consume(']') {
+		return values, nil
+	}
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		if p.consume(']') {
+			return values, nil
+		}
+		if !p.consume(',') {
+			return nil, p.errorf("missing ',' in array")
+		}
+	}
+}
+
+func (p *jsonTextParser) parseString() (string, error) {
+	s, n, err := unquoteJSONString(p.data[p.pos:])
+	if err != nil {
+		return "", p.errorf("%v", err)
+	}
+	p.pos += n
+	return s, nil
+}
+
+// unquoteJSONString unquotes the JSON string at the start of s and returns the number of
+// bytes read. The bytes which are not escaped are kept as is, even if they are not UTF-8.
+func unquoteJSONString(s string) (string, int, error) {
+	var buf []byte
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			return string(buf), i + 1, nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", 0, errors.New("unterminated string")
+			}
+			switch s[i] {
+			case '"', '\\', '/':
+				buf = append(buf, s[i])
+			case 'b':
+				buf = append(buf, '\b')
+			case 'f':
+				buf = append(buf, '\f')
+			case 'n':
+				buf = append(buf, '\n')
+			case 'r':
+				buf = append(buf, '\r')
+			case 't':
+				buf = append(buf, '\t')
+			case 'u':
+				r, n, err := unquoteJSONRune(s[i+1:])
+				if err != nil {
+					return "", 0, err
+				}
+				buf = utf8.AppendRune(buf, r)
+				i += n
+			default:
+				return "", 0, errors.Errorf("invalid escape %q", s[i])
+			}
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return "", 0, errors.New("unterminated string")
+}
+
+// unquoteJSONRune decodes the hex digits after \u, with the low surrogate if any.
+func unquoteJSONRune(s string) (rune, int, error) {
+	if len(s) < 4 {
+		return 0, 0, errors.New("invalid unicode escape")
+	}
+	v, err := strconv.ParseUint(s[:4], 16, 16)
+	if err != nil {
+		return 0, 0, errors.New("invalid unicode escape")
+	}
+	r := rune(v)
+	if utf16.IsSurrogate(r) && len(s) >= 10 && s[4] == '\\' && s[5] == 'u' {
+		if v2, err := strconv.ParseUint(s[6:10], 16, 16); err == nil {
+			if dec := utf16.DecodeRune(r, rune(v2)); dec != utf8.RuneError {
+				return dec, 10, nil
+			}
+		}
+	}
+	return r, 4, nil
+}
@@ -0,0 +1,144 @@
+package replication
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func appendJSONDiff(data []byte, op JsonDiffOperation, path string, value []byte) []byte {
+	data = append(data, byte(op))
+	data = mysql.AppendLengthEncodedInteger(data, uint64(len(path)))
+	data = append(data, path...)
+	if op != JsonDiffOperationRemove {
+		data = mysql.AppendLengthEncodedInteger(data, uint64(len(value)))
+		data = append(data, value...)
+	}
+	return data
+}
+
+func TestRowsEventApplyJSONPartialUpdates(t *testing.T) {
+	// {"a": [1, 2], "b": "x"}
+	before := []byte{
+		JSONB_SMALL_OBJECT, 0x02, 0x00, 0x20, 0x00,
+		0x12, 0x00, 0x01, 0x00, 0x13, 0x00, 0x01, 0x00,
+		JSONB_SMALL_ARRAY, 0x14, 0x00, JSONB_STRING, 0x1e, 0x00,
+		'a', 'b',
+		0x02, 0x00, 0x0a, 0x00, JSONB_INT16, 0x01, 0x00, JSONB_INT16, 0x02, 0x00,
+		0x01, 'x',
+	}
+
+	var diffs []byte
+	diffs = appendJSONDiff(diffs, JsonDiffOperationReplace, "$.a[1]", []byte{JSONB_INT16, 0x03, 0x00})
+	diffs = appendJSONDiff(diffs, JsonDiffOperationInsert, "$.c", []byte{JSONB_LITERAL, JSONB_TRUE_LITERAL})
+	diffs = appendJSONDiff(diffs, JsonDiffOperationRemove, "$.b", nil)
+	diffs = appendJSONDiff(diffs, JsonDiffOperationInsert, "$.a[5]", []byte{JSONB_STRING, 0x01, 'y'})
+
+	image := func(prefix []byte, id int32, json []byte) []byte {
+		data := append(prefix, 0x00)
+		data = binary.LittleEndian.AppendUint32(data, uint32(id))
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(json)))
+		return append(data, json...)
+	}
+	bi := image(nil, 1, before)
+	// PARTIAL_JSON and the partial bitmap of the JSON column
+	ai := image([]byte{0x01, 0x01}, 1, diffs)
+
+	table := &TableMapEvent{
+		ColumnType: []byte{mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_JSON},
+		ColumnMeta: []uint16{0, 4},
+	}
+	decode := func(e *RowsEvent, bitmap []byte) error {
+		n, err := e.decodeImage(bi, bitmap, EnumRowImageTypeUpdateBI)
+		require.NoError(t, err)
+		require.Len(t, bi, n)
+		_, err = e.decodeImage(ai, []byte{0x03}, EnumRowImageTypeUpdateAI)
+		return err
+	}
+
+	// the diffs are kept by default
+	e := &RowsEvent{eventType: PARTIAL_UPDATE_ROWS_EVENT, Table: table, ColumnCount: 2}
+	require.NoError(t, decode(e, []byte{0x03}))
+	require.Equal(t, `{"a":[1,2],"b":"x"}`, e.Rows[0][1])
+	require.Equal(t, &JsonDiff{Op: JsonDiffOperationReplace, Path: "$.a[1]", Value: "3"}, e.Rows[1][1])
+
+	for _, mysqlText := range []bool{false, true} {
+		e = &RowsEvent{
+			eventType:               PARTIAL_UPDATE_ROWS_EVENT,
+			Table:                   table,
+			ColumnCount:             2,
+			applyJSONPartialUpdates: true,
+			renderJSONAsMySQLText:   mysqlText,
+		}
+		require.NoError(t, decode(e, []byte{0x03}))
+		require.Equal(t, []any{int32(1), `{"a":[1,3,"y"],"c":true}`}, e.Rows[1])
+	}
+
+	// binlog_row_image=MINIMAL
+	bi = image(nil, 1, nil)[:5]
+	e = &RowsEvent{eventType: PARTIAL_UPDATE_ROWS_EVENT, Table: table, ColumnCount: 2, applyJSONPartialUpdates: true}
+	require.ErrorContains(t, decode(e, []byte{0x01}), "binlog_row_image=FULL")
+}
+
+func TestApplyJSONDiffs(t *testing.T) {
+	testcases := []struct {
+		mysqlText bool
+		doc       string
+		diffs     []*JsonDiff
+		expected  string
+	}{
+		{
+			doc: `{"b":{"x y":[{"k":1}]},"aa":2.50}`,
+			diffs: []*JsonDiff{
+				{Op: JsonDiffOperationReplace, Path: `$.b."x y"[last].k`, Value: `"é\n"`},
+				{Op: JsonDiffOperationInsert, Path: `$.b."x y"[0]`, Value: `null`},
+				{Op: JsonDiffOperationInsert, Path: `$.c`, Value: `{}`},
+			},
+			expected: `{"aa":2.50,"b":{"x y":[null,{"k":"é\n"}]},"c":{}}`,
+		},
+		{
+			// the inserted keys are ordered like JSONB
+			mysqlText: true,
+			doc:       `{"b":1,"aa":[1.0,-2e-5]}`,
+			diffs: []*JsonDiff{
+				{Op: JsonDiffOperationInsert, Path: `$.c`, Value: `"s"`},
+				{Op: JsonDiffOperationInsert, Path: `$.abc`, Value: `3`},
+				{Op: JsonDiffOperationRemove, Path: `$.aa[0]`},
+			},
+			expected: `{"b":1,"c":"s","aa":[-2e-5],"abc":3}`,
+		},
+		{
+			doc:      `[1,2]`,
+			diffs:    []*JsonDiff{{Op: JsonDiffOperationReplace, Path: `$`, Value: `"z"`}},
+			expected: `"z"`,
+		},
+		{
+			doc:      ``,
+			diffs:    []*JsonDiff{{Op: JsonDiffOperationReplace, Path: `$`, Value: `[]`}},
+			expected: `[]`,
+		},
+	}
+	for _, tc := range testcases {
+		e := &RowsEvent{renderJSONAsMySQLText: tc.mysqlText}
+		after, err := e.applyJSONDiffs(tc.doc, tc.diffs)
+		require.NoError(t, err, tc.doc)
+		require.Equal(t, tc.expected, after)
+	}
+
+	for _, diff := range []*JsonDiff{
+		{Op: JsonDiffOperationReplace, Path: `$.x`, Value: `1`},
+		{Op: JsonDiffOperationRemove, Path: `$.a[2]`},
+		{Op: JsonDiffOperationReplace, Path: `$.a.b`, Value: `1`},
+		{Op: JsonDiffOperationReplace, Path: `$[0]`, Value: `1`},
+		{Op: JsonDiffOperationReplace, Path: `$.a[*]`, Value: `1`},
+		{Op: JsonDiffOperationReplace, Path: `a`, Value: `1`},
+		{Op: JsonDiffOperationRemove, Path: `$`},
+		{Op: JsonDiffOperationReplace, Path: `$.a`, Value: `[1,`},
+	} {
+		_, err := (&RowsEvent{}).applyJSONDiffs(`{"a":[1,2]}`, []*JsonDiff{diff})
+		require.Error(t, err, diff.String())
+	}
+}
@@ -0,0 +1,52 @@
+package replication
+
+import (
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/utils"
+)
+
+// Metrics receives the measurements of a BinlogSyncer, see BinlogSyncerConfig.Metrics. The
+// methods are called from the goroutine reading the binlog stream, and OnStreamerQueue from
+// the goroutine calling BinlogStreamer.GetEvent too, so they must be fast, not block and be
+// safe for concurrent use. See the metrics package for a Prometheus collector.
+type Metrics interface {
+	// OnEvent is called for each event received, with the time taken to parse it. The
+	// raw size of the event is header.EventSize.
+	OnEvent(header *EventHeader, parseDuration time.Duration)
+	// OnReconnect is called after each attempt to re-sync a broken connection, err is nil
+	// if it succeeded.
+	OnReconnect(err error)
+	// OnSemiSyncACK is called for each semi-sync ACK sent to the source.
+	OnSemiSyncACK()
+	// OnStreamerQueue is called after an event is queued in the BinlogStreamer and after
+	// it is read from it, with the events and their raw size waiting for GetEvent.
+	OnStreamerQueue(events int, bytes int64)
+	// OnSourceDelay is called with the delay between the time an event was logged by the
+	// source and the time it is received, i.e. the seconds behind the source.
+	OnSourceDelay(delay time.Duration)
+	// OnGTIDSet is called with the executed GTID set after each transaction. The set must
+	// not be retained, it is updated in place.
+	OnGTIDSet(gset mysql.GTIDSet)
+}
+
+// noopMetrics is the Metrics of a BinlogSyncer without BinlogSyncerConfig.Metrics.
+type noopMetrics struct{}
+
+func (noopMetrics) OnEvent(*EventHeader, time.Duration) {}
+func (noopMetrics) OnReconnect(error)                   {}
+func (noopMetrics) OnSemiSyncACK()                      {}
+func (noopMetrics) OnStreamerQueue(int, int64)          {}
+func (noopMetrics) OnSourceDelay(time.Duration)         {}
+func (noopMetrics) OnGTIDSet(mysql.GTIDSet)             {}
+
+// observeEvent records the event received and the delay of the source.
+func (b *BinlogSyncer) observeEvent(h *EventHeader, parseDuration time.Duration) {
+	b.cfg.Metrics.OnEvent(h, parseDuration)
+
+	// the heartbeats and the fake rotate events have no timestamp
+	if h.Timestamp != 0 {
+		b.cfg.Metrics.OnSourceDelay(max(utils.Now().Sub(time.Unix(int64(h.Timestamp), 0)), 0))
+	}
+}
@@ -0,0 +1,56 @@
+package replication
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type metricsRecorder struct {
+	noopMetrics
+
+	events int
+	delays []time.Duration
+	queued []int
+}
+
+func (m *metricsRecorder) OnEvent(*EventHeader, time.Duration) { m.events++ }
+func (m *metricsRecorder) OnSourceDelay(d time.Duration)       { m.delays = append(m.delays, d) }
+func (m *metricsRecorder) OnStreamerQueue(events int, bytes int64) {
+	m.queued = append(m.queued, events, int(bytes))
+}
+
+func TestObserveEvent(t *testing.T) {
+	m := &metricsRecorder{}
+	b := NewBinlogSyncer(BinlogSyncerConfig{ServerID: 100, Metrics: m})
+
+	b.observeEvent(&EventHeader{EventType: XID_EVENT, Timestamp: uint32(time.Now().Add(-10 * time.Second).Unix())}, 0)
+	// a heartbeat has no timestamp
+	b.observeEvent(&EventHeader{EventType: HEARTBEAT_EVENT}, 0)
+	// the clocks may be skewed
+	b.observeEvent(&EventHeader{EventType: XID_EVENT, Timestamp: uint32(time.Now().Add(time.Hour).Unix())}, 0)
+
+	require.Equal(t, 3, m.events)
+	require.Len(t, m.delays, 2)
+	require.InDelta(t, 10*time.Second, m.delays[0], float64(2*time.Second))
+	require.Equal(t, time.Duration(0), m.delays[1])
+}
+
+func TestStreamerQueueMetrics(t *testing.T) {
+	m := &metricsRecorder{}
+	s := NewBinlogStreamerWithLimits(10, 0)
+	s.metrics = m
+	ctx := context.Background()
+
+	for _, size := range []uint32{10, 20} {
+		require.NoError(t, s.enqueue(ctx, &BinlogEvent{Header: &EventHeader{EventSize: size}}))
+	}
+	_, err := s.GetEvent(ctx)
+	require.NoError(t, err)
+	require.Len(t, s.DumpEvents(), 1)
+
+	// the queue is reported when it grows and when it drains
+	require.Equal(t, []int{1, 10, 2, 30, 1, 20, 0, 0}, m.queued)
+}
@@ -7,6 +7,7 @@ import (
 	"hash/crc32"
 	"io"
 	"os"
+	"path/filepath"
 	"sync/atomic"
 	"time"
 
@@ -39,13 +40,23 @@ type BinlogParser struct {
 	useFloatWithTrailingZero bool
 	renderJSONAsMySQLText    bool
 	ignoreJSONDecodeErr      bool
+	applyJSONPartialUpdates  bool
+	lazyRowsDecode           bool
 	verifyChecksum           bool
 
+	eventFilter EventFilter
+
 	payloadDecoderConcurrency int
 
 	rowsEventDecodeFunc func(*RowsEvent, []byte) error
 
 	tableMapOptionalMetaDecodeFunc func([]byte) error
+
+	keyProvider EncryptionKeyProvider
+	// decrypter is set after the StartEncryptionEvent of an encrypted binlog file
+	decrypter *binlogDecrypter
+
+	stop *stopTracker
 }
 
 func NewBinlogParser() *BinlogParser {
@@ -66,6 +77,7 @@ func (p *BinlogParser) Resume() {
 
 func (p *BinlogParser) Reset() {
 	p.format = nil
+	p.decrypter = nil
 }
 
 type OnEventFunc func(*BinlogEvent) error
@@ -77,6 +89,12 @@ func (p *BinlogParser) ParseFile(name string, offset int64, onEvent OnEventFunc)
 	}
 	defer f.Close()
 
+	// the decryption of the previous file
+	p.decrypter = nil
+	if p.stop != nil {
+		p.stop.file = filepath.Base(name)
+	}
+
 	b := make([]byte, 4)
 	if _, err = f.Read(b); err != nil {
 		return errors.Trace(err)
@@ -95,11 +113,18 @@ func (p *BinlogParser) ParseFile(name string, offset int64, onEvent OnEventFunc)
 		if err = p.parseFormatDescriptionEvent(f, onEvent); err != nil {
 			return errors.Annotatef(err, "parse FormatDescriptionEvent")
 		}
+		if err = p.parseStartEncryptionEvent(f, offset, onEvent); err != nil {
+			return errors.Annotatef(err, "parse StartEncryptionEvent")
+		}
 	}
 
 	if _, err = f.Seek(offset, io.SeekStart); err != nil {
 		return errors.Errorf("seek %s to %d error %v", name, offset, err)
 	}
+	if p.decrypter != nil {
+		// the IV of an event is derived from its position
+		p.decrypter.pos = uint32(offset)
+	}
 
 	return p.ParseReader(f, onEvent)
 }
@@ -109,6 +134,34 @@ func (p *BinlogParser) parseFormatDescriptionEvent(r io.Reader, onEvent OnEventF
 	return err
 }
 
+// parseStartEncryptionEvent parses the StartEncryptionEvent after the FormatDescriptionEvent
+// of an encrypted file if it is before offset, the events after it can't be read without it.
+func (p *BinlogParser) parseStartEncryptionEvent(f *os.File, offset int64, onEvent OnEventFunc) error {
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	header := make([]byte, EventHeaderSize)
+	if _, err = io.ReadFull(f, header); err != nil {
+		// the file is too short, it's reported when reading from offset
+		return nil
+	}
+	h, err := p.parseHeader(header)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if h.EventType != MARIADB_START_ENCRYPTION_EVENT || pos+int64(h.EventSize) > offset {
+		return nil
+	}
+
+	if _, err = f.Seek(pos, io.SeekStart); err != nil {
+		return errors.Trace(err)
+	}
+	_, err = p.parseSingleEvent(f, onEvent)
+	return err
+}
+
 // ParseSingleEvent parses single binlog event and passes the event to onEvent function.
 func (p *BinlogParser) ParseSingleEvent(r io.Reader, onEvent OnEventFunc) (bool, error) {
 	return p.parseSingleEvent(r, onEvent)
@@ -146,6 +199,15 @@ func (p *BinlogParser) parseSingleEvent(r io.Reader, onEvent OnEventFunc) (bool,
 
 	var rawData []byte
 	rawData = append(rawData, buf.Bytes()...)
+	if p.decrypter != nil {
+		// only the event size of the header is in clear
+		if err = p.decrypter.decrypt(rawData); err != nil {
+			return false, errors.Trace(err)
+		}
+		if h, err = p.parseHeader(rawData); err != nil {
+			return false, errors.Trace(err)
+		}
+	}
 	bodyLen := int(h.EventSize) - EventHeaderSize
 	body := rawData[EventHeaderSize:]
 	if len(body) != bodyLen {
@@ -161,9 +223,30 @@ func (p *BinlogParser) parseSingleEvent(r io.Reader, onEvent OnEventFunc) (bool,
 		return false, errors.Trace(err)
 	}
 
-	if err = onEvent(&BinlogEvent{RawData: rawData, Header: h, Event: e}); err != nil {
+	if h.EventType == MARIADB_START_ENCRYPTION_EVENT {
+		if err = p.startDecryption(h, body); err != nil {
+			return false, errors.Trace(err)
+		}
+	}
+
+	be := &BinlogEvent{RawData: rawData, Header: h, Event: e}
+	var stopAfter bool
+	if p.stop != nil {
+		var stopBefore bool
+		if stopBefore, stopAfter, err = p.stop.next(be); err != nil {
+			return false, errors.Trace(err)
+		}
+		if stopBefore {
+			return false, io.EOF
+		}
+	}
+
+	if err = onEvent(be); err != nil {
 		return false, errors.Trace(err)
 	}
+	if stopAfter {
+		return false, io.EOF
+	}
 
 	return false, nil
 }
@@ -175,6 +258,10 @@ func (p *BinlogParser) ParseReader(r io.Reader, onEvent OnEventFunc) error {
 			if err == errMissingTableMapEvent {
 				continue
 			}
+			if err == io.EOF {
+				// the stop condition is met
+				return err
+			}
 			return errors.Trace(err)
 		}
 
@@ -186,6 +273,24 @@ func (p *BinlogParser) ParseReader(r io.Reader, onEvent OnEventFunc) error {
 	return nil
 }
 
+// startDecryption decrypts the events after the StartEncryptionEvent of a binlog file.
+func (p *BinlogParser) startDecryption(h *EventHeader, body []byte) error {
+	if p.keyProvider == nil {
+		return errors.New("binlog file is encrypted, the key provider is required, see SetEncryptionKeyProvider")
+	}
+
+	e := new(StartEncryptionEvent)
+	if err := e.Decode(body); err != nil {
+		return errors.Annotatef(err, "decode %s", h.EventType)
+	}
+	d, err := newBinlogDecrypter(p.keyProvider, e, h.LogPos)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	p.decrypter = d
+	return nil
+}
+
 func (p *BinlogParser) SetRawMode(mode bool) {
 	p.rawMode = mode
 }
@@ -216,10 +321,41 @@ func (p *BinlogParser) SetIgnoreJSONDecodeError(ignoreJSONDecodeErr bool) {
 	p.ignoreJSONDecodeErr = ignoreJSONDecodeErr
 }
 
+// SetApplyJSONPartialUpdates toggles applying the JSON diffs of PARTIAL_UPDATE_ROWS_EVENTs.
+// See BinlogSyncerConfig.ApplyJSONPartialUpdates.
+func (p *BinlogParser) SetApplyJSONPartialUpdates(apply bool) {
+	p.applyJSONPartialUpdates = apply
+}
+
+// SetLazyRowsDecode toggles decoding the rows of the RowsEvents only when they are read
+// with RowsEvent.RowIterator. See BinlogSyncerConfig.LazyRowsDecode.
+func (p *BinlogParser) SetLazyRowsDecode(lazy bool) {
+	p.lazyRowsDecode = lazy
+}
+
+// SetEventFilter sets the filter of the events to decode, nil decodes all the events.
+// See BinlogSyncerConfig.EventFilter.
+func (p *BinlogParser) SetEventFilter(filter EventFilter) {
+	p.eventFilter = filter
+}
+
 func (p *BinlogParser) SetVerifyChecksum(verify bool) {
 	p.verifyChecksum = verify
 }
 
+// SetEncryptionKeyProvider sets the provider of the keys to read the MariaDB binlog
+// files encrypted at rest by ParseFile, ParseReader and ParseSingleEvent.
+func (p *BinlogParser) SetEncryptionKeyProvider(provider EncryptionKeyProvider) {
+	p.keyProvider = provider
+}
+
+// SetStopCondition makes ParseFile, ParseReader and ParseSingleEvent return io.EOF when
+// the condition is met, see StopCondition. The files of StopCondition.Position are
+// matched by their base names. The transactions are counted from this call.
+func (p *BinlogParser) SetStopCondition(cond StopCondition) {
+	p.stop = newStopTracker(cond, "", nil)
+}
+
 func (p *BinlogParser) SetFlavor(flavor string) {
 	p.flavor = flavor
 }
@@ -252,6 +388,9 @@ func (p *BinlogParser) cloneForPayloadDecode() *BinlogParser {
 	inner.useFloatWithTrailingZero = p.useFloatWithTrailingZero
 	inner.renderJSONAsMySQLText = p.renderJSONAsMySQLText
 	inner.ignoreJSONDecodeErr = p.ignoreJSONDecodeErr
+	inner.applyJSONPartialUpdates = p.applyJSONPartialUpdates
+	inner.lazyRowsDecode = p.lazyRowsDecode
+	inner.eventFilter = p.eventFilter
 	// verifyChecksum is intentionally left at the zero value: nested
 	// events do not carry their own checksum trailers.
 	inner.payloadDecoderConcurrency = p.payloadDecoderConcurrency
@@ -341,6 +480,8 @@ func (p *BinlogParser) parseEvent(h *EventHeader, data []byte, rawData []byte) (
 				e = &MariadbBinlogCheckPointEvent{}
 			case MARIADB_GTID_LIST_EVENT:
 				e = &MariadbGTIDListEvent{}
+			case MARIADB_START_ENCRYPTION_EVENT:
+				e = &StartEncryptionEvent{}
 			case MARIADB_GTID_EVENT:
 				ee := &MariadbGTIDEvent{}
 				ee.GTID.ServerID = h.ServerID
@@ -349,6 +490,18 @@ func (p *BinlogParser) parseEvent(h *EventHeader, data []byte, rawData []byte) (
 				e = &PreviousGTIDsEvent{}
 			case INTVAR_EVENT:
 				e = &IntVarEvent{}
+			case RAND_EVENT:
+				e = &RandEvent{}
+			case USER_VAR_EVENT:
+				e = &UserVarEvent{}
+			case INCIDENT_EVENT:
+				e = &IncidentEvent{}
+			case VIEW_CHANGE_EVENT:
+				e = &ViewChangeEvent{}
+			case XA_PREPARE_LOG_EVENT:
+				e = &XAPrepareEvent{}
+			case TRANSACTION_CONTEXT_EVENT:
+				e = &TransactionContextEvent{}
 			case TRANSACTION_PAYLOAD_EVENT:
 				e = p.newTransactionPayloadEvent()
 			case HEARTBEAT_EVENT:
@@ -358,6 +511,11 @@ func (p *BinlogParser) parseEvent(h *EventHeader, data []byte, rawData []byte) (
 			default:
 				e = &GenericEvent{}
 			}
+
+			// the rows events are filtered by their table when they are decoded
+			if _, ok := e.(*RowsEvent); !ok && p.eventFilter != nil && filteredEventType(h.EventType) && !p.eventFilter(h.EventType, nil) {
+				e = &GenericEvent{}
+			}
 		} else {
 			e = &GenericEvent{}
 		}
@@ -453,58 +611,24 @@ func (p *BinlogParser) verifyCrc32Checksum(rawData []byte) error {
 func (p *BinlogParser) newRowsEvent(h *EventHeader) *RowsEvent {
 	e := &RowsEvent{}
 
-	postHeaderLen := p.format.EventTypeHeaderLengths[h.EventType-1]
-	if postHeaderLen == 6 {
+	// the table id has 6 bytes if the format description event doesn't have the
+	// post header length of the event type
+	e.tableIDSize = 6
+	if i := int(h.EventType) - 1; i >= 0 && i < len(p.format.EventTypeHeaderLengths) && p.format.EventTypeHeaderLengths[i] == 6 {
 		e.tableIDSize = 4
-	} else {
-		e.tableIDSize = 6
 	}
 
-	e.needBitmap2 = false
 	e.tables = p.tables
-	e.eventType = h.EventType
+	e.setEventType(h.EventType)
 	e.parseTime = p.parseTime
 	e.timestampStringLocation = p.timestampStringLocation
 	e.useDecimal = p.useDecimal
 	e.useFloatWithTrailingZero = p.useFloatWithTrailingZero
 	e.renderJSONAsMySQLText = p.renderJSONAsMySQLText
 	e.ignoreJSONDecodeErr = p.ignoreJSONDecodeErr
-
-	switch h.EventType {
-	case WRITE_ROWS_EVENTv0:
-		e.Version = 0
-	case UPDATE_ROWS_EVENTv0:
-		e.Version = 0
-	case DELETE_ROWS_EVENTv0:
-		e.Version = 0
-	case WRITE_ROWS_EVENTv1:
-		e.Version = 1
-	case DELETE_ROWS_EVENTv1:
-		e.Version = 1
-	case UPDATE_ROWS_EVENTv1:
-		e.Version = 1
-		e.needBitmap2 = true
-	case MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
-		e.Version = 1
-		e.compressed = true
-	case MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1:
-		e.Version = 1
-		e.compressed = true
-	case MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1:
-		e.Version = 1
-		e.compressed = true
-		e.needBitmap2 = true
-	case WRITE_ROWS_EVENTv2:
-		e.Version = 2
-	case UPDATE_ROWS_EVENTv2:
-		e.Version = 2
-		e.needBitmap2 = true
-	case DELETE_ROWS_EVENTv2:
-		e.Version = 2
-	case PARTIAL_UPDATE_ROWS_EVENT:
-		e.Version = 2
-		e.needBitmap2 = true
-	}
+	e.applyJSONPartialUpdates = p.applyJSONPartialUpdates
+	e.lazyRowsDecode = p.lazyRowsDecode
+	e.filter = p.eventFilter
 
 	return e
 }
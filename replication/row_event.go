@@ -895,7 +895,7 @@ const RowsEventStmtEndFlag = 0x01
 // - mysql.MYSQL_TYPE_VARCHAR: string
 // - mysql.MYSQL_TYPE_VAR_STRING: string
 // - mysql.MYSQL_TYPE_STRING: string
-// - mysql.MYSQL_TYPE_JSON: []byte / *replication.JsonDiff
+// - mysql.MYSQL_TYPE_JSON: []byte / *replication.JsonDiff, string if partial updates are applied
 // - mysql.MYSQL_TYPE_GEOMETRY: []byte
 // - mysql.MYSQL_TYPE_VECTOR: []byte
 type RowsEvent struct {
@@ -949,12 +949,22 @@ type RowsEvent struct {
 	Rows           [][]any
 	SkippedColumns [][]int
 
+	// Filtered reports the rows were not decoded because the EventFilter of the parser
+	// filtered out the event, only the header is decoded.
+	Filtered bool
+
+	// rowsData is the rows data of a lazily decoded event, see DecodeDataLazily
+	rowsData []byte
+
 	parseTime                bool
 	timestampStringLocation  *time.Location
 	useDecimal               bool
 	useFloatWithTrailingZero bool
 	renderJSONAsMySQLText    bool
 	ignoreJSONDecodeErr      bool
+	applyJSONPartialUpdates  bool
+	lazyRowsDecode           bool
+	filter                   EventFilter
 }
 
 // EnumRowsEventType is an abridged type describing the operation which triggered the given RowsEvent.
@@ -1113,16 +1123,7 @@ func (e *RowsEvent) DecodeData(pos int, data []byte) (err2 error) {
 	e.SkippedColumns = make([][]int, 0, rowsLen)
 	e.Rows = make([][]any, 0, rowsLen)
 
-	var rowImageType EnumRowImageType
-	switch e.eventType {
-	case WRITE_ROWS_EVENTv0, WRITE_ROWS_EVENTv1, WRITE_ROWS_EVENTv2, MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
-		rowImageType = EnumRowImageTypeWriteAI
-	case DELETE_ROWS_EVENTv0, DELETE_ROWS_EVENTv1, DELETE_ROWS_EVENTv2, MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1:
-		rowImageType = EnumRowImageTypeDeleteBI
-	default:
-		rowImageType = EnumRowImageTypeUpdateBI
-	}
-
+	rowImageType := e.firstImageType()
 	for pos < len(data) {
 		// Parse the first image
 		if n, err = e.decodeImage(data[pos:], e.ColumnBitmap1, rowImageType); err != nil {
@@ -1147,14 +1148,34 @@ func (e *RowsEvent) Decode(data []byte) error {
 	if err != nil {
 		return err
 	}
+	if e.filter != nil && !e.filter(e.eventType, e.Table) {
+		e.Filtered = true
+		return nil
+	}
+	if e.lazyRowsDecode {
+		return e.DecodeDataLazily(pos, data)
+	}
 	return e.DecodeData(pos, data)
 }
 
+// firstImageType returns the type of the first image of the rows, the after image
+// follows it in the update events.
+func (e *RowsEvent) firstImageType() EnumRowImageType {
+	switch e.eventType {
+	case WRITE_ROWS_EVENTv0, WRITE_ROWS_EVENTv1, WRITE_ROWS_EVENTv2, MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
+		return EnumRowImageTypeWriteAI
+	case DELETE_ROWS_EVENTv0, DELETE_ROWS_EVENTv1, DELETE_ROWS_EVENTv2, MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1:
+		return EnumRowImageTypeDeleteBI
+	default:
+		return EnumRowImageTypeUpdateBI
+	}
+}
+
 func (e *RowsEvent) Type() EnumRowsEventType {
 	switch e.eventType {
 	case WRITE_ROWS_EVENTv0, WRITE_ROWS_EVENTv1, WRITE_ROWS_EVENTv2, MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1:
 		return EnumRowsEventTypeInsert
-	case UPDATE_ROWS_EVENTv0, UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2, MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1:
+	case UPDATE_ROWS_EVENTv0, UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2, PARTIAL_UPDATE_ROWS_EVENT, MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1:
 		return EnumRowsEventTypeUpdate
 	case DELETE_ROWS_EVENTv0, DELETE_ROWS_EVENTv1, DELETE_ROWS_EVENTv2, MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1:
 		return EnumRowsEventTypeDelete
@@ -1174,6 +1195,27 @@ func isBitSetIncr(bitmap []byte, i *int) bool {
 }
 
 func (e *RowsEvent) decodeImage(data []byte, bitmap []byte, rowImageType EnumRowImageType) (int, error) {
+	var before []any
+	var beforeSkips []int
+	if rowImageType == EnumRowImageTypeUpdateAI && len(e.Rows) > 0 {
+		before, beforeSkips = e.Rows[len(e.Rows)-1], e.SkippedColumns[len(e.SkippedColumns)-1]
+	}
+
+	row, skips, n, err := e.decodeRow(data, bitmap, rowImageType, nil, before, beforeSkips)
+	if err != nil {
+		return 0, err
+	}
+
+	e.Rows = append(e.Rows, row)
+	e.SkippedColumns = append(e.SkippedColumns, skips)
+	return n, nil
+}
+
+// decodeRow decodes a row image, only the columns set in columns if it's not nil. before
+// is the before image of an after image, to apply the partial JSON updates to.
+func (e *RowsEvent) decodeRow(data []byte, bitmap []byte, rowImageType EnumRowImageType, columns []bool,
+	before []any, beforeSkips []int,
+) (row []any, skips []int, n int, err error) {
 	// Rows_log_event::print_verbose_one_row()
 
 	pos := 0
@@ -1192,7 +1234,7 @@ func (e *RowsEvent) decodeImage(data []byte, bitmap []byte, rowImageType EnumRow
 		}
 	}
 
-	row := make([]any, e.ColumnCount)
+	row = make([]any, e.ColumnCount)
 	unsignedMap := e.Table.UnsignedMap()
 
 	// refer: https://github.com/alibaba/canal/blob/c3e38e50e269adafdd38a48c63a1740cde304c67/dbsync/src/main/java/com/taobao/tddl/dbsync/binlog/event/RowsLogBuffer.java#L63
@@ -1204,7 +1246,7 @@ func (e *RowsEvent) decodeImage(data []byte, bitmap []byte, rowImageType EnumRow
 	if col < int(e.ColumnCount) {
 		count += bits.OnesCount8(bitmap[col>>3] & byte((1<<(int(e.ColumnCount)-col))-1))
 	}
-	skips := make([]int, 0, int(e.ColumnCount)-count)
+	skips = make([]int, 0, int(e.ColumnCount)-count)
 	count = bitmapByteSize(count)
 
 	nullBitmap := data[pos : pos+count]
@@ -1234,18 +1276,38 @@ func (e *RowsEvent) decodeImage(data []byte, bitmap []byte, rowImageType EnumRow
 			continue
 		}
 
-		var n int
-		var err error
+		if columns != nil && !columns[i] {
+			if n, err = e.skipValue(data[pos:], e.Table.ColumnType[i], e.Table.ColumnMeta[i], unsignedMap[i]); err != nil {
+				return nil, nil, 0, err
+			}
+			pos += n
+			continue
+		}
+
 		row[i], n, err = e.decodeValue(data[pos:], e.Table.ColumnType[i], e.Table.ColumnMeta[i], isPartial, unsignedMap[i])
 		if err != nil {
-			return 0, err
+			return nil, nil, 0, err
 		}
 		pos += n
+
+		if diffs, ok := row[i].([]*JsonDiff); ok {
+			if row[i], err = e.applyJSONPartialUpdate(before, beforeSkips, i, diffs); err != nil {
+				return nil, nil, 0, err
+			}
+		}
 	}
 
-	e.Rows = append(e.Rows, row)
-	e.SkippedColumns = append(e.SkippedColumns, skips)
-	return pos, nil
+	return row, skips, pos, nil
+}
+
+// skipValue returns the size of the value like decodeValue, without decoding the values
+// which are costly to decode.
+func (e *RowsEvent) skipValue(data []byte, tp byte, meta uint16, isUnsigned bool) (int, error) {
+	if tp == mysql.MYSQL_TYPE_JSON {
+		return int(mysql.FixedLengthInt(data[0:meta])) + int(meta), nil
+	}
+	_, n, err := e.decodeValue(data, tp, meta, false, isUnsigned)
+	return n, err
 }
 
 func (e *RowsEvent) parseFracTime(t any) any {
@@ -1461,7 +1523,10 @@ func (e *RowsEvent) decodeValue(data []byte, tp byte, meta uint16, isPartial boo
 		if length == 0 {
 			v = []byte{}
 		} else {
-			if isPartial {
+			if isPartial && e.applyJSONPartialUpdates {
+				// applied to the before image by decodeImage
+				v, err = e.decodeJSONPartialBinaryDiffs(data[meta:n])
+			} else if isPartial {
 				var diff *JsonDiff
 				diff, err = e.decodeJSONPartialBinary(data[meta:n])
 				if err == nil {
@@ -1897,9 +1962,11 @@ func (e *RowsEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "Event type: %s (%s)", e.Type(), e.eventType)
 
 	fmt.Fprintf(w, "Values:\n")
-	for _, rows := range e.Rows {
+	// the rows of an event decoded lazily are only read by RowIterator
+	it := e.RowIterator()
+	for it.Next() {
 		fmt.Fprintf(w, "--\n")
-		for j, d := range rows {
+		for j, d := range it.Row() {
 			switch dt := d.(type) {
 			case []byte:
 				fmt.Fprintf(w, "%d:%q\n", j, dt)
@@ -1910,6 +1977,9 @@ func (e *RowsEvent) Dump(w io.Writer) {
 			}
 		}
 	}
+	if err := it.Err(); err != nil {
+		fmt.Fprintf(w, "Error: %v\n", err)
+	}
 	fmt.Fprintln(w)
 }
 
@@ -0,0 +1,840 @@
+package replication
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// NewRowsEvent returns an empty rows event of the given type for table, which
+// can be filled with Rows and encoded.
+func NewRowsEvent(eventType EventType, table *TableMapEvent) (*RowsEvent, error) {
+	e := &RowsEvent{
+		tableIDSize: table.tableIDSize,
+		Table:       table,
+		TableID:     table.TableID,
+		ColumnCount: table.ColumnCount,
+	}
+	if !e.setEventType(eventType) {
+		return nil, errors.Errorf("%s is not a rows event", eventType)
+	}
+
+	return e, nil
+}
+
+func (e *TableMapEvent) Encode() ([]byte, error) {
+	if len(e.Schema) > math.MaxUint8 || len(e.Table) > math.MaxUint8 {
+		return nil, errors.Errorf("schema or table name is too long, %d and %d bytes", len(e.Schema), len(e.Table))
+	}
+	if len(e.ColumnType) != int(e.ColumnCount) || len(e.ColumnMeta) != int(e.ColumnCount) {
+		return nil, errors.Errorf("expect %d column types and metas but got %d and %d",
+			e.ColumnCount, len(e.ColumnType), len(e.ColumnMeta))
+	}
+
+	nullBitmap := e.NullBitmap
+	if nullBitmap == nil {
+		nullBitmap = make([]byte, bitmapByteSize(int(e.ColumnCount)))
+	} else if len(nullBitmap) != bitmapByteSize(int(e.ColumnCount)) {
+		return nil, errors.Errorf("invalid null bitmap size %d", len(nullBitmap))
+	}
+
+	meta, err := e.encodeMeta()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	data := appendFixedLengthInt(nil, e.TableID, e.encodedTableIDSize())
+	data = binary.LittleEndian.AppendUint16(data, e.Flags)
+
+	data = append(data, byte(len(e.Schema)))
+	data = append(data, e.Schema...)
+	data = append(data, 0x00)
+
+	data = append(data, byte(len(e.Table)))
+	data = append(data, e.Table...)
+	data = append(data, 0x00)
+
+	data = mysql.AppendLengthEncodedInteger(data, e.ColumnCount)
+	data = append(data, e.ColumnType...)
+
+	data = mysql.AppendLengthEncodedInteger(data, uint64(len(meta)))
+	data = append(data, meta...)
+
+	data = append(data, nullBitmap...)
+
+	return e.appendOptionalMeta(data)
+}
+
+func (e *TableMapEvent) encodedTableIDSize() int {
+	if e.tableIDSize == 0 {
+		return 6
+	}
+	return e.tableIDSize
+}
+
+// encodeMeta is the reverse of decodeMeta.
+func (e *TableMapEvent) encodeMeta() ([]byte, error) {
+	data := make([]byte, 0, 2*len(e.ColumnType))
+	for i, t := range e.ColumnType {
+		meta := e.ColumnMeta[i]
+		switch t {
+		case mysql.MYSQL_TYPE_STRING,
+			mysql.MYSQL_TYPE_NEWDECIMAL:
+			data = append(data, byte(meta>>8), byte(meta))
+		case mysql.MYSQL_TYPE_VAR_STRING,
+			mysql.MYSQL_TYPE_VARCHAR,
+			mysql.MYSQL_TYPE_BIT:
+			data = binary.LittleEndian.AppendUint16(data, meta)
+		case mysql.MYSQL_TYPE_BLOB,
+			mysql.MYSQL_TYPE_DOUBLE,
+			mysql.MYSQL_TYPE_FLOAT,
+			mysql.MYSQL_TYPE_GEOMETRY,
+			mysql.MYSQL_TYPE_VECTOR,
+			mysql.MYSQL_TYPE_JSON,
+			mysql.MYSQL_TYPE_TIME2,
+			mysql.MYSQL_TYPE_DATETIME2,
+			mysql.MYSQL_TYPE_TIMESTAMP2:
+			data = append(data, byte(meta))
+		case mysql.MYSQL_TYPE_NEWDATE,
+			mysql.MYSQL_TYPE_ENUM,
+			mysql.MYSQL_TYPE_SET,
+			mysql.MYSQL_TYPE_TINY_BLOB,
+			mysql.MYSQL_TYPE_MEDIUM_BLOB,
+			mysql.MYSQL_TYPE_LONG_BLOB:
+			return nil, errors.Errorf("unsupport type in binlog %d", t)
+		}
+	}
+
+	return data, nil
+}
+
+// appendOptionalMeta is the reverse of decodeOptionalMeta. Fields are written in
+// the order of their type codes, as MySQL does.
+func (e *TableMapEvent) appendOptionalMeta(data []byte) ([]byte, error) {
+	appendField := func(t byte, v []byte) {
+		data = append(data, t)
+		data = mysql.AppendLengthEncodedInteger(data, uint64(len(v)))
+		data = append(data, v...)
+	}
+
+	if e.SignednessBitmap != nil {
+		appendField(TABLE_MAP_OPT_META_SIGNEDNESS, e.SignednessBitmap)
+	}
+	if len(e.DefaultCharset) > 0 {
+		appendField(TABLE_MAP_OPT_META_DEFAULT_CHARSET, encodeIntSeq(e.DefaultCharset))
+	}
+	if len(e.ColumnCharset) > 0 {
+		appendField(TABLE_MAP_OPT_META_COLUMN_CHARSET, encodeIntSeq(e.ColumnCharset))
+	}
+	if len(e.ColumnName) > 0 {
+		var v []byte
+		for _, name := range e.ColumnName {
+			if len(name) > math.MaxUint8 {
+				return nil, errors.Errorf("column name %q is too long", name)
+			}
+			v = append(v, byte(len(name)))
+			v = append(v, name...)
+		}
+		appendField(TABLE_MAP_OPT_META_COLUMN_NAME, v)
+	}
+	if len(e.SetStrValue) > 0 {
+		appendField(TABLE_MAP_OPT_META_SET_STR_VALUE, encodeStrValue(e.SetStrValue))
+	}
+	if len(e.EnumStrValue) > 0 {
+		appendField(TABLE_MAP_OPT_META_ENUM_STR_VALUE, encodeStrValue(e.EnumStrValue))
+	}
+	if len(e.GeometryType) > 0 {
+		appendField(TABLE_MAP_OPT_META_GEOMETRY_TYPE, encodeIntSeq(e.GeometryType))
+	}
+	if len(e.PrimaryKey) > 0 {
+		hasPrefix := false
+		for _, prefix := range e.PrimaryKeyPrefix {
+			if prefix != 0 {
+				hasPrefix = true
+				break
+			}
+		}
+
+		if hasPrefix {
+			if len(e.PrimaryKeyPrefix) != len(e.PrimaryKey) {
+				return nil, errors.Errorf("expect %d primary key prefixes but got %d", len(e.PrimaryKey), len(e.PrimaryKeyPrefix))
+			}
+			var v []byte
+			for i, column := range e.PrimaryKey {
+				v = mysql.AppendLengthEncodedInteger(v, column)
+				v = mysql.AppendLengthEncodedInteger(v, e.PrimaryKeyPrefix[i])
+			}
+			appendField(TABLE_MAP_OPT_META_PRIMARY_KEY_WITH_PREFIX, v)
+		} else {
+			appendField(TABLE_MAP_OPT_META_SIMPLE_PRIMARY_KEY, encodeIntSeq(e.PrimaryKey))
+		}
+	}
+	if len(e.EnumSetDefaultCharset) > 0 {
+		appendField(TABLE_MAP_OPT_META_ENUM_AND_SET_DEFAULT_CHARSET, encodeIntSeq(e.EnumSetDefaultCharset))
+	}
+	if len(e.EnumSetColumnCharset) > 0 {
+		appendField(TABLE_MAP_OPT_META_ENUM_AND_SET_COLUMN_CHARSET, encodeIntSeq(e.EnumSetColumnCharset))
+	}
+	if e.VisibilityBitmap != nil {
+		appendField(TABLE_MAP_OPT_META_COLUMN_VISIBILITY, e.VisibilityBitmap)
+	}
+
+	return data, nil
+}
+
+func encodeIntSeq(seq []uint64) []byte {
+	var data []byte
+	for _, i := range seq {
+		data = mysql.AppendLengthEncodedInteger(data, i)
+	}
+	return data
+}
+
+func encodeStrValue(values [][][]byte) []byte {
+	var data []byte
+	for _, vals := range values {
+		data = mysql.AppendLengthEncodedInteger(data, uint64(len(vals)))
+		for _, val := range vals {
+			data = mysql.AppendLengthEncodedInteger(data, uint64(len(val)))
+			data = append(data, val...)
+		}
+	}
+	return data
+}
+
+// Encode serializes the rows event from Rows, using Table for the column types.
+//
+// Values must have the Go types produced by the decoder (see RowsEvent),
+// strings are also accepted for temporal and decimal columns. The rows of
+// compressed MariaDB events are compressed like DecodeData expects. JSON
+// values are given as JSON text and encoded in the MySQL JSON binary format.
+// Partial JSON updates are not supported.
+func (e *RowsEvent) Encode() ([]byte, error) {
+	if e.Table == nil {
+		return nil, errors.Errorf("table map event of table id %d is required to encode rows", e.TableID)
+	}
+
+	tableIDSize := e.tableIDSize
+	if tableIDSize == 0 {
+		tableIDSize = 6
+	}
+
+	data := appendFixedLengthInt(nil, e.TableID, tableIDSize)
+	data = binary.LittleEndian.AppendUint16(data, e.Flags)
+
+	if e.Version == 2 {
+		extraData := e.encodeExtraData()
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(extraData)+2))
+		data = append(data, extraData...)
+	}
+
+	data = mysql.AppendLengthEncodedInteger(data, e.ColumnCount)
+
+	bitmap1, err := e.columnBitmap(e.ColumnBitmap1)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	data = append(data, bitmap1...)
+
+	var bitmap2 []byte
+	if e.needBitmap2 {
+		if bitmap2, err = e.columnBitmap(e.ColumnBitmap2); err != nil {
+			return nil, errors.Trace(err)
+		}
+		data = append(data, bitmap2...)
+	}
+	rowsPos := len(data)
+
+	var rowImageType EnumRowImageType
+	switch e.Type() {
+	case EnumRowsEventTypeInsert:
+		rowImageType = EnumRowImageTypeWriteAI
+	case EnumRowsEventTypeDelete:
+		rowImageType = EnumRowImageTypeDeleteBI
+	default:
+		rowImageType = EnumRowImageTypeUpdateBI
+	}
+
+	for i := 0; i < len(e.Rows); i++ {
+		if data, err = e.encodeImage(data, e.Rows[i], bitmap1, rowImageType); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if e.needBitmap2 {
+			i++
+			if i == len(e.Rows) {
+				return nil, errors.New("missing after image of the last updated row")
+			}
+			if data, err = e.encodeImage(data, e.Rows[i], bitmap2, EnumRowImageTypeUpdateAI); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+	}
+
+	if e.compressed {
+		rows, err := mysql.CompressMariadbData(data[rowsPos:])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		data = append(data[:rowsPos], rows...)
+	}
+
+	return data, nil
+}
+
+// setEventType sets the event type and the fields depending on it, it returns
+// false if t is not a rows event type.
+func (e *RowsEvent) setEventType(t EventType) bool {
+	e.eventType = t
+	e.needBitmap2 = false
+	e.compressed = false
+
+	switch t {
+	case WRITE_ROWS_EVENTv0, UPDATE_ROWS_EVENTv0, DELETE_ROWS_EVENTv0:
+		e.Version = 0
+		e.needBitmap2 = t == UPDATE_ROWS_EVENTv0
+	case WRITE_ROWS_EVENTv1, DELETE_ROWS_EVENTv1:
+		e.Version = 1
+	case UPDATE_ROWS_EVENTv1:
+		e.Version = 1
+		e.needBitmap2 = true
+	case MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1, MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1:
+		e.Version = 1
+		e.compressed = true
+	case MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1:
+		e.Version = 1
+		e.compressed = true
+		e.needBitmap2 = true
+	case WRITE_ROWS_EVENTv2, DELETE_ROWS_EVENTv2:
+		e.Version = 2
+	case UPDATE_ROWS_EVENTv2, PARTIAL_UPDATE_ROWS_EVENT:
+		e.Version = 2
+		e.needBitmap2 = true
+	default:
+		return false
+	}
+
+	return true
+}
+
+// encodeExtraData is the reverse of decodeExtraData.
+func (e *RowsEvent) encodeExtraData() []byte {
+	if len(e.NdbData) > 0 || e.NdbFormat != 0 {
+		data := []byte{ENUM_EXTRA_ROW_INFO_TYPECODE_NDB, byte(len(e.NdbData) + 2), e.NdbFormat}
+		return append(data, e.NdbData...)
+	}
+
+	if e.PartitionId != 0 || e.SourcePartitionId != 0 {
+		data := []byte{ENUM_EXTRA_ROW_INFO_TYPECODE_PARTITION}
+		data = binary.LittleEndian.AppendUint16(data, e.PartitionId)
+		if e.needBitmap2 {
+			data = binary.LittleEndian.AppendUint16(data, e.SourcePartitionId)
+		}
+		return data
+	}
+
+	return nil
+}
+
+// columnBitmap returns bitmap, or a bitmap with all columns set when it is empty.
+func (e *RowsEvent) columnBitmap(bitmap []byte) ([]byte, error) {
+	size := bitmapByteSize(int(e.ColumnCount))
+	if len(bitmap) == 0 {
+		bitmap = make([]byte, size)
+		for i := range int(e.ColumnCount) {
+			bitmap[i>>3] |= 1 << (uint(i) & 7)
+		}
+		return bitmap, nil
+	}
+	if len(bitmap) != size {
+		return nil, errors.Errorf("invalid column bitmap size %d, must %d", len(bitmap), size)
+	}
+
+	return bitmap, nil
+}
+
+// encodeImage is the reverse of decodeImage.
+func (e *RowsEvent) encodeImage(data []byte, row []any, bitmap []byte, rowImageType EnumRowImageType) ([]byte, error) {
+	if len(row) != int(e.ColumnCount) {
+		return nil, errors.Errorf("expect %d columns in row but got %d", e.ColumnCount, len(row))
+	}
+	if int(e.ColumnCount) > len(e.Table.ColumnType) {
+		return nil, errors.Errorf("table map event has %d columns but rows event has %d", len(e.Table.ColumnType), e.ColumnCount)
+	}
+
+	if e.eventType == PARTIAL_UPDATE_ROWS_EVENT && rowImageType == EnumRowImageTypeUpdateAI {
+		// binlog_row_value_options, partial JSON updates are never written
+		data = mysql.AppendLengthEncodedInteger(data, 0)
+	}
+
+	count := 0
+	for i := range int(e.ColumnCount) {
+		if isBitSet(bitmap, i) {
+			count++
+		}
+	}
+
+	nullBitmapPos := len(data)
+	data = append(data, make([]byte, bitmapByteSize(count))...)
+
+	var err error
+	nullBitmapIndex := 0
+	for i := range int(e.ColumnCount) {
+		if !isBitSet(bitmap, i) {
+			continue
+		}
+
+		if row[i] == nil {
+			data[nullBitmapPos+(nullBitmapIndex>>3)] |= 1 << (uint(nullBitmapIndex) & 7)
+			nullBitmapIndex++
+			continue
+		}
+		nullBitmapIndex++
+
+		if data, err = e.encodeValue(data, row[i], e.Table.ColumnType[i], e.Table.ColumnMeta[i]); err != nil {
+			return nil, errors.Annotatef(err, "column %d", i)
+		}
+	}
+
+	return data, nil
+}
+
+// encodeValue is the reverse of decodeValue.
+func (e *RowsEvent) encodeValue(data []byte, v any, tp byte, meta uint16) ([]byte, error) {
+	length := 0
+
+	if tp == mysql.MYSQL_TYPE_STRING {
+		if meta >= 256 {
+			b0 := uint8(meta >> 8)
+			b1 := uint8(meta & 0xFF)
+
+			if b0&0x30 != 0x30 {
+				length = int(uint16(b1) | (uint16((b0&0x30)^0x30) << 4))
+				tp = b0 | 0x30
+			} else {
+				length = int(meta & 0xFF)
+				tp = b0
+			}
+		} else {
+			length = int(meta)
+		}
+	}
+
+	switch tp {
+	case mysql.MYSQL_TYPE_NULL:
+		return data, nil
+	case mysql.MYSQL_TYPE_TINY:
+		return appendIntValue(data, v, 1)
+	case mysql.MYSQL_TYPE_SHORT:
+		return appendIntValue(data, v, 2)
+	case mysql.MYSQL_TYPE_INT24:
+		return appendIntValue(data, v, 3)
+	case mysql.MYSQL_TYPE_LONG:
+		return appendIntValue(data, v, 4)
+	case mysql.MYSQL_TYPE_LONGLONG:
+		return appendIntValue(data, v, 8)
+	case mysql.MYSQL_TYPE_NEWDECIMAL:
+		return appendDecimal(data, v, int(meta>>8), int(meta&0xFF))
+	case mysql.MYSQL_TYPE_FLOAT:
+		switch f := v.(type) {
+		case float32:
+			return binary.LittleEndian.AppendUint32(data, math.Float32bits(f)), nil
+		case float64:
+			return binary.LittleEndian.AppendUint32(data, math.Float32bits(float32(f))), nil
+		}
+	case mysql.MYSQL_TYPE_DOUBLE:
+		switch f := v.(type) {
+		case float64:
+			return binary.LittleEndian.AppendUint64(data, math.Float64bits(f)), nil
+		case float32:
+			return binary.LittleEndian.AppendUint64(data, math.Float64bits(float64(f))), nil
+		}
+	case mysql.MYSQL_TYPE_BIT:
+		nbits := ((meta >> 8) * 8) + (meta & 0xFF)
+		n := int(nbits+7) / 8
+		i, err := toUint64(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendBigEndian(data, i, n), nil
+	case mysql.MYSQL_TYPE_TIMESTAMP:
+		sec, _, err := e.timestampValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(data, uint32(sec)), nil
+	case mysql.MYSQL_TYPE_TIMESTAMP2:
+		sec, usec, err := e.timestampValue(v)
+		if err != nil {
+			return nil, err
+		}
+		data = binary.BigEndian.AppendUint32(data, uint32(sec))
+		return appendFracPart(data, usec, meta), nil
+	case mysql.MYSQL_TYPE_DATETIME:
+		dt, err := toDatetime(v)
+		if err != nil {
+			return nil, err
+		}
+		i := uint64(dt.year)*10000000000 + uint64(dt.month)*100000000 + uint64(dt.day)*1000000 +
+			uint64(dt.hour)*10000 + uint64(dt.minute)*100 + uint64(dt.second)
+		return binary.LittleEndian.AppendUint64(data, i), nil
+	case mysql.MYSQL_TYPE_DATETIME2:
+		dt, err := toDatetime(v)
+		if err != nil {
+			return nil, err
+		}
+		ymd := int64(dt.year*13+dt.month)<<5 | int64(dt.day)
+		hms := int64(dt.hour)<<12 | int64(dt.minute)<<6 | int64(dt.second)
+		data = appendBigEndian(data, uint64((ymd<<17|hms)+DATETIMEF_INT_OFS), 5)
+		return appendFracPart(data, dt.usec, meta), nil
+	case mysql.MYSQL_TYPE_TIME:
+		t, err := toTime(v)
+		if err != nil {
+			return nil, err
+		}
+		i := t.hour*10000 + t.minute*100 + t.second
+		return appendFixedLengthInt(data, uint64(i), 3), nil
+	case mysql.MYSQL_TYPE_TIME2:
+		t, err := toTime(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendTime2(data, t, meta), nil
+	case mysql.MYSQL_TYPE_DATE:
+		dt, err := toDatetime(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendFixedLengthInt(data, uint64(dt.year*16*32+dt.month*32+dt.day), 3), nil
+	case mysql.MYSQL_TYPE_YEAR:
+		year, err := toUint64(v)
+		if err != nil {
+			return nil, err
+		}
+		if year != 0 {
+			year -= 1900
+		}
+		return append(data, byte(year)), nil
+	case mysql.MYSQL_TYPE_ENUM:
+		l := int(meta & 0xFF)
+		if l != 1 && l != 2 {
+			return nil, fmt.Errorf("unknown ENUM packlen=%d", l)
+		}
+		return appendIntValue(data, v, l)
+	case mysql.MYSQL_TYPE_SET:
+		return appendIntValue(data, v, int(meta&0xFF))
+	case mysql.MYSQL_TYPE_BLOB,
+		mysql.MYSQL_TYPE_GEOMETRY,
+		mysql.MYSQL_TYPE_VECTOR:
+		b, ok := toBytes(v)
+		if !ok {
+			break
+		}
+		if meta < 1 || meta > 4 {
+			return nil, fmt.Errorf("invalid blob packlen = %d", meta)
+		}
+		data = appendFixedLengthInt(data, uint64(len(b)), int(meta))
+		return append(data, b...), nil
+	case mysql.MYSQL_TYPE_VARCHAR,
+		mysql.MYSQL_TYPE_VAR_STRING:
+		length = int(meta)
+		fallthrough
+	case mysql.MYSQL_TYPE_STRING:
+		b, ok := toBytes(v)
+		if !ok {
+			break
+		}
+		if length < 256 {
+			data = append(data, byte(len(b)))
+		} else {
+			data = binary.LittleEndian.AppendUint16(data, uint16(len(b)))
+		}
+		return append(data, b...), nil
+	case mysql.MYSQL_TYPE_JSON:
+		b, ok := toBytes(v)
+		if !ok {
+			break
+		}
+		if len(b) > 0 {
+			var err error
+			if b, err = encodeJSONBinary(b); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		data = appendFixedLengthInt(data, uint64(len(b)), int(meta))
+		return append(data, b...), nil
+	default:
+		return nil, fmt.Errorf("unsupport type %d in binlog and don't know how to handle", tp)
+	}
+
+	return nil, fmt.Errorf("invalid value %#v for type %d", v, tp)
+}
+
+func appendFixedLengthInt(data []byte, v uint64, n int) []byte {
+	for i := range n {
+		data = append(data, byte(v>>(8*uint(i))))
+	}
+	return data
+}
+
+func appendBigEndian(data []byte, v uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		data = append(data, byte(v>>(8*uint(i))))
+	}
+	return data
+}
+
+func appendIntValue(data []byte, v any, n int) ([]byte, error) {
+	i, err := toUint64(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendFixedLengthInt(data, i, n), nil
+}
+
+// toUint64 returns the two's complement bits of an integer value.
+func toUint64(v any) (uint64, error) {
+	switch i := v.(type) {
+	case int:
+		return uint64(i), nil
+	case int8:
+		return uint64(i), nil
+	case int16:
+		return uint64(i), nil
+	case int32:
+		return uint64(i), nil
+	case int64:
+		return uint64(i), nil
+	case uint:
+		return uint64(i), nil
+	case uint8:
+		return uint64(i), nil
+	case uint16:
+		return uint64(i), nil
+	case uint32:
+		return uint64(i), nil
+	case uint64:
+		return i, nil
+	default:
+		return 0, fmt.Errorf("invalid integer value %#v", v)
+	}
+}
+
+func toBytes(v any) ([]byte, bool) {
+	switch b := v.(type) {
+	case []byte:
+		return b, true
+	case string:
+		return []byte(b), true
+	default:
+		return nil, false
+	}
+}
+
+// appendDecimal is the reverse of decodeDecimal.
+func appendDecimal(data []byte, v any, precision int, decimals int) ([]byte, error) {
+	var s string
+	switch d := v.(type) {
+	case string:
+		s = d
+	case []byte:
+		s = string(d)
+	case decimal.Decimal:
+		s = d.StringFixed(int32(decimals))
+	default:
+		return nil, fmt.Errorf("invalid decimal value %#v", v)
+	}
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	intDigits, fracDigits, _ := strings.Cut(s, ".")
+
+	integral := precision - decimals
+	intDigits = strings.TrimLeft(intDigits, "0")
+	if len(intDigits) > integral {
+		return nil, fmt.Errorf("decimal value %#v is out of range for DECIMAL(%d,%d)", v, precision, decimals)
+	}
+	intDigits = strings.Repeat("0", integral-len(intDigits)) + intDigits
+	if len(fracDigits) > decimals {
+		fracDigits = fracDigits[:decimals]
+	} else {
+		fracDigits += strings.Repeat("0", decimals-len(fracDigits))
+	}
+
+	uncompIntegral := integral / digitsPerInteger
+	uncompFractional := decimals / digitsPerInteger
+	compIntegral := integral - (uncompIntegral * digitsPerInteger)
+
+	start := len(data)
+
+	var err error
+	appendDigits := func(digits string, size int) {
+		if size == 0 || err != nil {
+			return
+		}
+		var value uint64
+		if value, err = strconv.ParseUint(digits, 10, 32); err != nil {
+			err = fmt.Errorf("invalid decimal value %#v", v)
+			return
+		}
+		data = appendBigEndian(data, value, size)
+	}
+
+	appendDigits(intDigits[:compIntegral], compressedBytes[compIntegral])
+	for pos := compIntegral; pos < integral; pos += digitsPerInteger {
+		appendDigits(intDigits[pos:pos+digitsPerInteger], 4)
+	}
+	pos := 0
+	for range uncompFractional {
+		appendDigits(fracDigits[pos:pos+digitsPerInteger], 4)
+		pos += digitsPerInteger
+	}
+	appendDigits(fracDigits[pos:], compressedBytes[decimals-pos])
+	if err != nil {
+		return nil, err
+	}
+
+	if negative {
+		for i := start; i < len(data); i++ {
+			data[i] = ^data[i]
+		}
+	}
+	data[start] ^= 0x80
+
+	return data, nil
+}
+
+// appendFracPart appends the fractional seconds of TIMESTAMP2 and DATETIME2.
+func appendFracPart(data []byte, usec int, dec uint16) []byte {
+	switch dec {
+	case 1, 2:
+		return append(data, byte(usec/10000))
+	case 3, 4:
+		return binary.BigEndian.AppendUint16(data, uint16(usec/100))
+	case 5, 6:
+		return appendBigEndian(data, uint64(usec), 3)
+	}
+	return data
+}
+
+func appendTime2(data []byte, t timeParts, dec uint16) []byte {
+	// packed in the same way as MySQL my_time_packed_to_binary
+	packed := (int64(t.hour)<<12|int64(t.minute)<<6|int64(t.second))<<24 + int64(t.usec)
+	if t.negative {
+		packed = -packed
+	}
+
+	intPart := packed >> 24
+	fracPart := packed % (1 << 24)
+
+	switch dec {
+	case 1, 2:
+		data = appendBigEndian(data, uint64(intPart+TIMEF_INT_OFS), 3)
+		return append(data, byte(int8(fracPart/10000)))
+	case 3, 4:
+		data = appendBigEndian(data, uint64(intPart+TIMEF_INT_OFS), 3)
+		return binary.BigEndian.AppendUint16(data, uint16(int16(fracPart/100)))
+	case 5, 6:
+		return appendBigEndian(data, uint64(packed+TIMEF_OFS), 6)
+	default:
+		return appendBigEndian(data, uint64(intPart+TIMEF_INT_OFS), 3)
+	}
+}
+
+// timestampValue returns the seconds and microseconds of a TIMESTAMP value.
+func (e *RowsEvent) timestampValue(v any) (int64, int, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t.Unix(), t.Nanosecond() / 1000, nil
+	case string:
+		if strings.HasPrefix(t, "0000-00-00") {
+			dt, err := toDatetime(t)
+			return 0, dt.usec, err
+		}
+
+		loc := e.timestampStringLocation
+		if loc == nil {
+			loc = time.Local
+		}
+		tt, err := time.ParseInLocation(time.DateTime, t, loc)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid timestamp value %q", t)
+		}
+		return tt.Unix(), tt.Nanosecond() / 1000, nil
+	default:
+		return 0, 0, fmt.Errorf("invalid timestamp value %#v", v)
+	}
+}
+
+type datetimeParts struct {
+	year, month, day, hour, minute, second, usec int
+}
+
+// toDatetime splits a DATE or DATETIME value, it supports zero dates which
+// can't be represented by time.Time.
+func toDatetime(v any) (datetimeParts, error) {
+	var dt datetimeParts
+	switch t := v.(type) {
+	case time.Time:
+		dt.year, dt.month, dt.day = t.Year(), int(t.Month()), t.Day()
+		dt.hour, dt.minute, dt.second = t.Clock()
+		dt.usec = t.Nanosecond() / 1000
+		return dt, nil
+	case string:
+		date, clock, _ := strings.Cut(t, " ")
+		if _, err := fmt.Sscanf(date, "%d-%d-%d", &dt.year, &dt.month, &dt.day); err != nil {
+			return dt, fmt.Errorf("invalid date value %q", t)
+		}
+		if clock == "" {
+			return dt, nil
+		}
+		tp, err := toTime(clock)
+		if err != nil || tp.negative {
+			return dt, fmt.Errorf("invalid datetime value %q", t)
+		}
+		dt.hour, dt.minute, dt.second, dt.usec = tp.hour, tp.minute, tp.second, tp.usec
+		return dt, nil
+	default:
+		return dt, fmt.Errorf("invalid datetime value %#v", v)
+	}
+}
+
+type timeParts struct {
+	negative                   bool
+	hour, minute, second, usec int
+}
+
+// toTime parses a TIME value like "-838:59:59.000000".
+func toTime(v any) (timeParts, error) {
+	var t timeParts
+	s, ok := v.(string)
+	if !ok {
+		return t, fmt.Errorf("invalid time value %#v", v)
+	}
+
+	s, t.negative = strings.CutPrefix(s, "-")
+	clock, frac, _ := strings.Cut(s, ".")
+	if _, err := fmt.Sscanf(clock, "%d:%d:%d", &t.hour, &t.minute, &t.second); err != nil {
+		return t, fmt.Errorf("invalid time value %q", v)
+	}
+	if frac != "" {
+		if len(frac) > 6 {
+			return t, fmt.Errorf("invalid time value %q", v)
+		}
+		usec, err := strconv.Atoi(frac + strings.Repeat("0", 6-len(frac)))
+		if err != nil {
+			return t, fmt.Errorf("invalid time value %q", v)
+		}
+		t.usec = usec
+	}
+
+	return t, nil
+}
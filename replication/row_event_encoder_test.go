@@ -0,0 +1,176 @@
+package replication
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// binlog events of "CREATE TABLE db.tbl (id INT); INSERT INTO db.tbl VALUES (1)" from MySQL 5.7, with CRC32 checksum
+var encodeTestEvents = [][]byte{
+	// FORMAT_DESCRIPTION_EVENT
+	{0x64, 0x61, 0x72, 0x63, 0xf, 0xb, 0x0, 0x0, 0x0, 0x77, 0x0, 0x0, 0x0, 0x7b, 0x0, 0x0, 0x0, 0x1, 0x0, 0x4, 0x0, 0x35, 0x2e, 0x37, 0x2e, 0x32, 0x32, 0x2d, 0x6c, 0x6f, 0x67, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x64, 0x61, 0x72, 0x63, 0x13, 0x38, 0xd, 0x0, 0x8, 0x0, 0x12, 0x0, 0x4, 0x4, 0x4, 0x4, 0x12, 0x0, 0x0, 0x5f, 0x0, 0x4, 0x1a, 0x8, 0x0, 0x0, 0x0, 0x8, 0x8, 0x8, 0x2, 0x0, 0x0, 0x0, 0xa, 0xa, 0xa, 0x2a, 0x2a, 0x0, 0x12, 0x34, 0x0, 0x1, 0xb8, 0x78, 0x9d, 0xfe},
+	// TABLE_MAP_EVENT
+	{0x8d, 0x61, 0x72, 0x63, 0x13, 0xb, 0x0, 0x0, 0x0, 0x2c, 0x0, 0x0, 0x0, 0xa7, 0x0, 0x0, 0x0, 0x1, 0x0, 0x6c, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x2, 0x64, 0x62, 0x0, 0x3, 0x74, 0x62, 0x6c, 0x0, 0x1, 0x3, 0x0, 0x0, 0x63, 0x17, 0xe6, 0xf0},
+	// WRITE_ROWS_EVENTv2
+	{0xb6, 0x61, 0x72, 0x63, 0x1e, 0xb, 0x0, 0x0, 0x0, 0x28, 0x0, 0x0, 0x0, 0xcf, 0x0, 0x0, 0x0, 0x1, 0x0, 0x6c, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x2, 0x0, 0x1, 0xff, 0x0, 0x1, 0x0, 0x0, 0x0, 0xf9, 0xf7, 0x89, 0x2a},
+}
+
+func TestEncodeParsedEvents(t *testing.T) {
+	parser := NewBinlogParser()
+	for _, data := range encodeTestEvents {
+		e, err := parser.Parse(data)
+		require.NoError(t, err)
+
+		encoded, err := EncodeEvent(e.Header, e.Event, parser.format.ChecksumAlgorithm)
+		require.NoError(t, err)
+		require.Equal(t, data, encoded)
+	}
+}
+
+func TestEncodeRowsEvent(t *testing.T) {
+	parser := NewBinlogParser()
+	_, err := parser.Parse(encodeTestEvents[0])
+	require.NoError(t, err)
+
+	table := &TableMapEvent{
+		tableIDSize: 6,
+		TableID:     120,
+		Flags:       1,
+		Schema:      []byte("test"),
+		Table:       []byte("t"),
+		ColumnCount: 12,
+		ColumnType: []byte{
+			mysql.MYSQL_TYPE_LONG,
+			mysql.MYSQL_TYPE_TINY,
+			mysql.MYSQL_TYPE_VARCHAR,
+			mysql.MYSQL_TYPE_NEWDECIMAL,
+			mysql.MYSQL_TYPE_DATETIME2,
+			mysql.MYSQL_TYPE_TIME2,
+			mysql.MYSQL_TYPE_BLOB,
+			mysql.MYSQL_TYPE_DOUBLE,
+			mysql.MYSQL_TYPE_DATE,
+			mysql.MYSQL_TYPE_STRING,
+			mysql.MYSQL_TYPE_LONGLONG,
+			mysql.MYSQL_TYPE_JSON,
+		},
+		ColumnMeta: []uint16{0, 0, 1020, 10<<8 | 2, 6, 3, 2, 8, 0, uint16(mysql.MYSQL_TYPE_ENUM)<<8 | 1, 0, 4},
+		NullBitmap: []byte{0xfe, 0x0f},
+		ColumnName: [][]byte{
+			[]byte("id"), []byte("tiny"), []byte("name"), []byte("price"), []byte("created"), []byte("duration"),
+			[]byte("data"), []byte("score"), []byte("day"), []byte("kind"), []byte("big"), []byte("doc"),
+		},
+		PrimaryKey:       []uint64{0},
+		PrimaryKeyPrefix: []uint64{0},
+	}
+
+	rows := [][]any{
+		{int32(-5), int8(-1), "hello", "-123.45", "2024-02-29 13:14:15.123456", "-12:34:56.789", []byte("blob"), 3.5, "2024-01-02", int64(2), int64(-1),
+			`{"a":[1,-70000,3.5,"x",true,null],"bb":{"c":18446744073709551615}}`},
+		{int32(7), nil, "", "0.01", "0000-00-00 00:00:00.000000", "00:00:00", []byte{}, -0.25, "0000-00-00", int64(1), nil, `[]`},
+	}
+
+	header := &EventHeader{Timestamp: 1700000000, EventType: TABLE_MAP_EVENT, ServerID: 1, LogPos: 200}
+	data, err := EncodeEvent(header, table, BINLOG_CHECKSUM_ALG_CRC32)
+	require.NoError(t, err)
+
+	e, err := parser.Parse(data)
+	require.NoError(t, err)
+	require.Equal(t, header, e.Header)
+	te := e.Event.(*TableMapEvent)
+	require.Equal(t, table.ColumnType, te.ColumnType)
+	require.Equal(t, table.ColumnMeta, te.ColumnMeta)
+	require.Equal(t, table.NullBitmap, te.NullBitmap)
+	require.Equal(t, table.ColumnName, te.ColumnName)
+	require.Equal(t, table.PrimaryKey, te.PrimaryKey)
+
+	for _, eventType := range []EventType{
+		WRITE_ROWS_EVENTv2, UPDATE_ROWS_EVENTv2, DELETE_ROWS_EVENTv1,
+		MARIADB_WRITE_ROWS_COMPRESSED_EVENT_V1, MARIADB_UPDATE_ROWS_COMPRESSED_EVENT_V1, MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1,
+	} {
+		re, err := NewRowsEvent(eventType, table)
+		require.NoError(t, err)
+		re.Rows = rows
+
+		header = &EventHeader{Timestamp: 1700000000, EventType: eventType, ServerID: 1, LogPos: 300}
+		data, err = EncodeEvent(header, re, BINLOG_CHECKSUM_ALG_CRC32)
+		require.NoError(t, err)
+
+		e, err = parser.Parse(data)
+		require.NoError(t, err)
+		require.Equal(t, rows, e.Event.(*RowsEvent).Rows)
+	}
+
+	_, err = NewRowsEvent(QUERY_EVENT, table)
+	require.Error(t, err)
+
+	// an update needs both the before and after image
+	re, err := NewRowsEvent(UPDATE_ROWS_EVENTv2, table)
+	require.NoError(t, err)
+	re.Rows = rows[:1]
+	_, err = re.Encode()
+	require.Error(t, err)
+}
+
+func TestEncodeJSONBinary(t *testing.T) {
+	e := &RowsEvent{}
+	large := strings.Repeat("x", 70000)
+	for _, text := range []string{
+		`null`,
+		`"s"`,
+		`-9223372036854775808`,
+		`{"key":{"nested":[false,{}]},"k":-1}`,
+		// the offsets of the large containers don't fit in 16 bits
+		`["` + large + `",1,{"a":"` + large + `"}]`,
+	} {
+		data, err := encodeJSONBinary([]byte(text))
+		require.NoError(t, err)
+		decoded, err := e.decodeJSONBinary(data)
+		require.NoError(t, err)
+		require.JSONEq(t, text, string(decoded))
+	}
+
+	data, err := encodeJSONBinary([]byte(`["` + large + `"]`))
+	require.NoError(t, err)
+	require.Equal(t, JSONB_LARGE_ARRAY, data[0])
+
+	_, err = encodeJSONBinary([]byte(`{"a":`))
+	require.Error(t, err)
+}
+
+func TestEncodeDecimal(t *testing.T) {
+	testcases := []struct {
+		value     any
+		precision int
+		decimals  int
+		expected  string
+	}{
+		{"-10.55", 4, 2, "-10.55"},
+		{"12345", 10, 3, "12345.000"},
+		{"123.4", 10, 2, "123.40"},
+		{"-0.0000000123450000987650000", 30, 25, "-0.0000000123450000987650000"},
+		{"1234500009876.50000", 30, 5, "1234500009876.50000"},
+		{"99999999999.99", 13, 2, "99999999999.99"},
+		{"+0.01", 7, 3, "0.010"},
+		{decimal.RequireFromString("-3699.01"), 13, 2, "-3699.01"},
+	}
+
+	for _, tc := range testcases {
+		data, err := appendDecimal(nil, tc.value, tc.precision, tc.decimals)
+		require.NoError(t, err)
+
+		value, n, err := decodeDecimal(data, tc.precision, tc.decimals, false)
+		require.NoError(t, err)
+		require.Len(t, data, n)
+		require.Equal(t, tc.expected, value)
+	}
+
+	_, err := appendDecimal(nil, "123.45", 4, 2)
+	require.Error(t, err)
+	_, err = appendDecimal(nil, "1x.45", 4, 2)
+	require.Error(t, err)
+}
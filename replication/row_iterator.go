@@ -0,0 +1,165 @@
+package replication
+
+import (
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// DecodeDataLazily keeps the rows data after the header decoded by DecodeHeader, instead
+// of decoding the rows into Rows like DecodeData. The rows are decoded by RowIterator. The
+// data must not be modified while the event is in use.
+func (e *RowsEvent) DecodeDataLazily(pos int, data []byte) error {
+	data = data[pos:]
+	if e.compressed {
+		var err error
+		if data, err = mysql.DecompressMariadbData(data); err != nil {
+			return err
+		}
+	}
+
+	e.Rows = nil
+	e.SkippedColumns = nil
+	e.rowsData = data
+	return nil
+}
+
+// RowIterator reads the rows of a RowsEvent one at a time, see RowsEvent.RowIterator.
+//
+//	it := e.RowIterator()
+//	for it.Next() {
+//		row := it.Row()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type RowIterator struct {
+	e       *RowsEvent
+	columns []bool
+
+	// data and pos are the rows data of a lazily decoded event
+	data []byte
+	pos  int
+	// index is the index of the next row in Rows of a decoded event
+	index int
+
+	imageType   EnumRowImageType
+	row, before []any
+	skips       []int
+	beforeSkips []int
+	err         error
+}
+
+// RowIterator returns an iterator over the rows of the event, in the order of Rows, i.e.
+// the before and after images alternate in the update events. If columns are given, only
+// these columns are decoded, the others are nil.
+//
+// The rows of an event decoded by DecodeDataLazily, see BinlogSyncerConfig.LazyRowsDecode,
+// are decoded from the event data as they are read, so only the current row is kept in
+// memory. Otherwise they are read from Rows.
+func (e *RowsEvent) RowIterator(columns ...int) *RowIterator {
+	it := &RowIterator{e: e, data: e.rowsData, imageType: e.firstImageType()}
+	if len(columns) > 0 {
+		it.columns = make([]bool, e.ColumnCount)
+		for _, c := range columns {
+			if c >= 0 && c < len(it.columns) {
+				it.columns[c] = true
+			}
+		}
+	}
+	return it
+}
+
+// Next decodes the next row, it returns false after the last row or on an error.
+func (it *RowIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.data == nil {
+		return it.nextDecoded()
+	}
+	if it.pos >= len(it.data) {
+		return false
+	}
+
+	if it.imageType == EnumRowImageTypeUpdateAI {
+		it.before, it.beforeSkips = it.row, it.skips
+	} else {
+		it.before, it.beforeSkips = nil, nil
+	}
+
+	bitmap := it.e.ColumnBitmap1
+	if it.imageType == EnumRowImageTypeUpdateAI {
+		bitmap = it.e.ColumnBitmap2
+	}
+
+	var n int
+	it.row, it.skips, n, it.err = it.decodeRow(bitmap)
+	if it.err != nil {
+		it.row, it.skips = nil, nil
+		return false
+	}
+	it.pos += n
+
+	if it.e.needBitmap2 {
+		if it.imageType == EnumRowImageTypeUpdateAI {
+			it.imageType = EnumRowImageTypeUpdateBI
+		} else {
+			it.imageType = EnumRowImageTypeUpdateAI
+		}
+	}
+	return true
+}
+
+func (it *RowIterator) decodeRow(bitmap []byte) (row []any, skips []int, n int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("parse rows event panic %v, data %q, at %d, table map %#v", r, it.data, it.pos, it.e.Table)
+		}
+	}()
+
+	row, skips, n, err = it.e.decodeRow(it.data[it.pos:], bitmap, it.imageType, it.columns, it.before, it.beforeSkips)
+	return row, skips, n, errors.Trace(err)
+}
+
+// nextDecoded reads the next row of Rows.
+func (it *RowIterator) nextDecoded() bool {
+	if it.index >= len(it.e.Rows) {
+		return false
+	}
+
+	it.row = it.e.Rows[it.index]
+	it.skips = nil
+	if it.index < len(it.e.SkippedColumns) {
+		it.skips = it.e.SkippedColumns[it.index]
+	}
+	it.index++
+
+	if it.columns != nil {
+		row := make([]any, len(it.row))
+		for i, v := range it.row {
+			if i < len(it.columns) && it.columns[i] {
+				row[i] = v
+			}
+		}
+		it.row = row
+	}
+	return true
+}
+
+// Row returns the current row, the values have the types of Rows.
+func (it *RowIterator) Row() []any {
+	return it.row
+}
+
+// SkippedColumns returns the columns which are not in the current row image, see
+// RowsEvent.SkippedColumns.
+func (it *RowIterator) SkippedColumns() []int {
+	return it.skips
+}
+
+// Err returns the error which stopped the iteration.
+func (it *RowIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,104 @@
+package replication
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestRowIterator(t *testing.T) {
+	table := &TableMapEvent{
+		tableIDSize: 6,
+		TableID:     120,
+		Schema:      []byte("test"),
+		Table:       []byte("t"),
+		ColumnCount: 4,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_NEWDECIMAL},
+		ColumnMeta:  []uint16{0, 1020, 2, 10<<8 | 2},
+		NullBitmap:  []byte{0x0e},
+	}
+	rows := [][]any{
+		{int32(1), "a", []byte("large blob"), "1.50"},
+		{int32(1), "b", nil, "2.50"},
+		{int32(2), "c", []byte{}, "-0.01"},
+		{int32(2), nil, []byte("another blob"), "0.00"},
+	}
+
+	eager := NewBinlogParser()
+	lazy := NewBinlogParser()
+	lazy.SetLazyRowsDecode(true)
+	for _, p := range []*BinlogParser{eager, lazy} {
+		_, err := p.Parse(encodeTestEvents[0])
+		require.NoError(t, err)
+		data, err := EncodeEvent(&EventHeader{EventType: TABLE_MAP_EVENT, ServerID: 1}, table, BINLOG_CHECKSUM_ALG_CRC32)
+		require.NoError(t, err)
+		_, err = p.Parse(data)
+		require.NoError(t, err)
+	}
+
+	readRows := func(it *RowIterator) [][]any {
+		var rows [][]any
+		for it.Next() {
+			require.Equal(t, []int{}, it.SkippedColumns())
+			rows = append(rows, it.Row())
+		}
+		require.NoError(t, it.Err())
+		return rows
+	}
+
+	for _, eventType := range []EventType{UPDATE_ROWS_EVENTv2, WRITE_ROWS_EVENTv2, MARIADB_DELETE_ROWS_COMPRESSED_EVENT_V1} {
+		re, err := NewRowsEvent(eventType, table)
+		require.NoError(t, err)
+		re.Rows = rows
+		data, err := EncodeEvent(&EventHeader{EventType: eventType, ServerID: 1}, re, BINLOG_CHECKSUM_ALG_CRC32)
+		require.NoError(t, err)
+
+		eagerBinlogEvent, err := eager.Parse(data)
+		require.NoError(t, err)
+		decoded := eagerBinlogEvent.Event.(*RowsEvent)
+		require.Equal(t, rows, readRows(decoded.RowIterator()))
+
+		e, err := lazy.Parse(data)
+		require.NoError(t, err)
+		lazyEvent := e.Event.(*RowsEvent)
+		require.Nil(t, lazyEvent.Rows)
+		require.Equal(t, rows, readRows(lazyEvent.RowIterator()))
+
+		// the rows are encoded and dumped like the decoded ones
+		expected, err := json.Marshal(eagerBinlogEvent)
+		require.NoError(t, err)
+		encoded, err := json.Marshal(e)
+		require.NoError(t, err)
+		require.JSONEq(t, string(expected), string(encoded))
+		var expectedDump, dump bytes.Buffer
+		decoded.Dump(&expectedDump)
+		lazyEvent.Dump(&dump)
+		require.Equal(t, expectedDump.String(), dump.String())
+		require.Contains(t, dump.String(), "large blob")
+
+		// only the projected columns are decoded
+		projected := [][]any{
+			{int32(1), nil, nil, "1.50"},
+			{int32(1), nil, nil, "2.50"},
+			{int32(2), nil, nil, "-0.01"},
+			{int32(2), nil, nil, "0.00"},
+		}
+		require.Equal(t, projected, readRows(lazyEvent.RowIterator(0, 3)))
+		require.Equal(t, projected, readRows(decoded.RowIterator(0, 3)))
+		require.Equal(t, rows, decoded.Rows)
+	}
+
+	// a truncated event fails the iteration
+	e := &RowsEvent{Table: table, ColumnCount: 4, ColumnBitmap1: []byte{0x0f}, eventType: WRITE_ROWS_EVENTv2}
+	require.NoError(t, e.DecodeDataLazily(0, []byte{0x00, 0x01, 0x00}))
+	it := e.RowIterator()
+	require.False(t, it.Next())
+	require.ErrorContains(t, it.Err(), "parse rows event panic")
+	require.False(t, it.Next())
+	_, err := json.Marshal(&BinlogEvent{Header: &EventHeader{EventType: WRITE_ROWS_EVENTv2}, Event: e})
+	require.ErrorContains(t, err, "parse rows event panic")
+}
@@ -0,0 +1,134 @@
+package replication
+
+import (
+	"encoding/binary"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// pendingACK is a semi-sync ACK the source waits for, see BinlogSyncerConfig.SemiSyncManualACK.
+type pendingACK struct {
+	pos mysql.Position
+	// conn is the connection the event was received on, the ACK is only sent on it
+	conn  *client.Conn
+	timer *time.Timer
+}
+
+// semiSyncACKs are the pending ACKs in the order of the events.
+type semiSyncACKs struct {
+	m       sync.Mutex
+	pending []*pendingACK
+}
+
+// AckPosition sends the semi-sync ACK of the events at or before pos, with
+// BinlogSyncerConfig.SemiSyncManualACK. pos is the LogPos of the last event the consumer
+// durably stored in the binlog file of the event. The source only waits for the ACK of
+// the last event of a transaction, and an ACK covers all the transactions before it, so
+// acknowledging every event or every transaction is not required.
+//
+// It's safe to call it from any goroutine, e.g. from GetEvent's consumer or from the
+// SynchronousEventHandler while it handles the event.
+func (b *BinlogSyncer) AckPosition(pos mysql.Position) error {
+	return errors.Trace(b.ackPending(pos, false))
+}
+
+// addPendingACK adds the ACK of the event at pos, it is sent by AckPosition or by the
+// timeout fallback.
+func (b *BinlogSyncer) addPendingACK(pos mysql.Position) {
+	b.acks.m.Lock()
+	defer b.acks.m.Unlock()
+
+	a := &pendingACK{pos: pos, conn: b.c}
+	if b.cfg.SemiSyncACKTimeout > 0 {
+		a.timer = time.AfterFunc(b.cfg.SemiSyncACKTimeout, func() {
+			if err := b.ackPending(pos, true); err != nil {
+				b.cfg.Logger.Warn("failed to reply semi-sync ACK", slog.Any("error", err))
+			}
+		})
+	}
+	b.acks.pending = append(b.acks.pending, a)
+}
+
+// ackPending sends the ACK of the last pending event at or before pos.
+func (b *BinlogSyncer) ackPending(pos mysql.Position, timedOut bool) error {
+	b.acks.m.Lock()
+	defer b.acks.m.Unlock()
+
+	n := 0
+	for n < len(b.acks.pending) && ackCovers(pos, b.acks.pending[n].pos) {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+
+	last := b.acks.pending[n-1]
+	for _, a := range b.acks.pending[:n] {
+		if a.timer != nil {
+			a.timer.Stop()
+		}
+	}
+	b.acks.pending = b.acks.pending[n:]
+
+	if timedOut {
+		b.cfg.Logger.Warn("semi-sync ACK is not acknowledged by the consumer in time, reply it anyway",
+			slog.String("file", last.pos.Name), slog.Uint64("position", uint64(last.pos.Pos)))
+	}
+	if err := writeSemiSyncACK(last.conn, last.pos); err != nil {
+		return errors.Trace(err)
+	}
+	b.cfg.Metrics.OnSemiSyncACK()
+	return nil
+}
+
+// clearPendingACKs drops the pending ACKs, e.g. when the connection is closed.
+func (b *BinlogSyncer) clearPendingACKs() {
+	b.acks.m.Lock()
+	defer b.acks.m.Unlock()
+
+	for _, a := range b.acks.pending {
+		if a.timer != nil {
+			a.timer.Stop()
+		}
+	}
+	b.acks.pending = nil
+}
+
+// ackCovers reports whether the ACK of pos covers the event at eventPos.
+func ackCovers(pos mysql.Position, eventPos mysql.Position) bool {
+	if pos.Name == eventPos.Name {
+		return pos.Pos >= eventPos.Pos
+	}
+	if !hasBinlogFileSeq(pos.Name) || !hasBinlogFileSeq(eventPos.Name) {
+		return false
+	}
+	return pos.Compare(eventPos) >= 0
+}
+
+// writeSemiSyncACK writes the ACK packet like replySemiSyncACK, but as the stream is read
+// concurrently, it doesn't use the sequence of the connection. The ACK is always packet 0.
+func writeSemiSyncACK(c *client.Conn, p mysql.Position) error {
+	data := make([]byte, 4+1+8+len(p.Name))
+	length := len(data) - 4
+	data[0] = byte(length)
+	data[1] = byte(length >> 8)
+	data[2] = byte(length >> 16)
+	data[4] = SemiSyncIndicator
+	binary.LittleEndian.PutUint64(data[5:], uint64(p.Pos))
+	copy(data[13:], p.Name)
+
+	n, err := c.Conn.Conn.Write(data)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if n != len(data) {
+		return errors.Errorf("write semi-sync ACK, only %d bytes written, while %d expected", n, len(data))
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package replication
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/packet"
+)
+
+// readSemiSyncACK reads an ACK packet written by writeSemiSyncACK.
+func readSemiSyncACK(t *testing.T, r io.Reader) mysql.Position {
+	header := make([]byte, 4)
+	_, err := io.ReadFull(r, header)
+	require.NoError(t, err)
+	require.Equal(t, byte(0), header[3])
+
+	data := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	_, err = io.ReadFull(r, data)
+	require.NoError(t, err)
+	require.Equal(t, byte(SemiSyncIndicator), data[0])
+	return mysql.Position{Name: string(data[9:]), Pos: uint32(binary.LittleEndian.Uint64(data[1:]))}
+}
+
+func TestSemiSyncManualACK(t *testing.T) {
+	replica, source := net.Pipe()
+	defer replica.Close()
+	defer source.Close()
+
+	b := NewBinlogSyncer(BinlogSyncerConfig{ServerID: 100, SemiSyncEnabled: true, SemiSyncManualACK: true})
+	b.c = &client.Conn{Conn: packet.NewConn(replica)}
+
+	b.addPendingACK(mysql.Position{Name: "mysql-bin.000001", Pos: 100})
+	b.addPendingACK(mysql.Position{Name: "mysql-bin.000001", Pos: 200})
+	b.addPendingACK(mysql.Position{Name: "mysql-bin.000002", Pos: 150})
+
+	// nothing is pending before the first event
+	require.NoError(t, b.AckPosition(mysql.Position{Name: "mysql-bin.000001", Pos: 99}))
+
+	// the last pending event at or before the position
+	go func() {
+		require.NoError(t, b.AckPosition(mysql.Position{Name: "mysql-bin.000001", Pos: 250}))
+	}()
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 200}, readSemiSyncACK(t, source))
+
+	go func() {
+		require.NoError(t, b.AckPosition(mysql.Position{Name: "mysql-bin.000003", Pos: 4}))
+	}()
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000002", Pos: 150}, readSemiSyncACK(t, source))
+	require.Empty(t, b.acks.pending)
+}
+
+func TestSemiSyncACKTimeout(t *testing.T) {
+	replica, source := net.Pipe()
+	defer replica.Close()
+	defer source.Close()
+
+	b := NewBinlogSyncer(BinlogSyncerConfig{
+		ServerID:           100,
+		SemiSyncEnabled:    true,
+		SemiSyncManualACK:  true,
+		SemiSyncACKTimeout: 10 * time.Millisecond,
+	})
+	b.c = &client.Conn{Conn: packet.NewConn(replica)}
+
+	// replied without AckPosition
+	b.addPendingACK(mysql.Position{Name: "mysql-bin.000001", Pos: 100})
+	require.Equal(t, mysql.Position{Name: "mysql-bin.000001", Pos: 100}, readSemiSyncACK(t, source))
+
+	// dropped on reconnect
+	b.cfg.SemiSyncACKTimeout = time.Hour
+	b.addPendingACK(mysql.Position{Name: "mysql-bin.000001", Pos: 200})
+	b.clearPendingACKs()
+	require.Empty(t, b.acks.pending)
+}
@@ -0,0 +1,182 @@
+package replication
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// StopCondition ends the events of a BinlogSyncer or a BinlogParser at a transaction
+// boundary, e.g. for point-in-time recovery. The BinlogStreamer returns io.EOF after the
+// last event of the last transaction, and the parser returns io.EOF. The events stop at
+// the first condition met, the zero value never stops.
+//
+// The transaction boundaries are found in the decoded events, so it has no effect in
+// raw mode.
+type StopCondition struct {
+	// Position stops before the first transaction starting at or after the position.
+	Position mysql.Position
+
+	// GTIDSet stops after the transaction with which the executed GTID set contains it.
+	// The executed set starts with the GTID set the sync started from, or with the
+	// PREVIOUS_GTIDS_EVENT (GTID_LIST_EVENT for MariaDB) of the first file read from its
+	// beginning, otherwise it only has the transactions read.
+	GTIDSet mysql.GTIDSet
+
+	// Time stops before the first transaction committed at or after the time. The commit
+	// time is the immediate commit timestamp of the GTID event (MySQL 8.0.1+), otherwise it
+	// is the timestamp of the first event of the transaction, like the --stop-datetime of
+	// mysqlbinlog.
+	Time time.Time
+
+	// Transactions stops after the number of transactions.
+	Transactions int
+}
+
+func (c *StopCondition) isZero() bool {
+	return c.Position.Name == "" && c.GTIDSet == nil && c.Time.IsZero() && c.Transactions <= 0
+}
+
+// stopTracker checks a StopCondition on the events.
+type stopTracker struct {
+	cond    StopCondition
+	tracker transactionTracker
+
+	// file is the name of the current binlog file
+	file string
+	// gset is the executed GTID set, it's only tracked for cond.GTIDSet
+	gset mysql.GTIDSet
+	// count is the number of transactions read
+	count int
+}
+
+// newStopTracker returns nil if the condition never stops. file is the first binlog file,
+// and gset is the GTID set executed before the first event.
+func newStopTracker(cond StopCondition, file string, gset mysql.GTIDSet) *stopTracker {
+	if cond.isZero() {
+		return nil
+	}
+
+	s := &stopTracker{cond: cond, file: file}
+	if cond.GTIDSet != nil && gset != nil {
+		s.gset = gset.Clone()
+	}
+	return s
+}
+
+// next checks the condition on the event, it returns whether the events stop before the
+// event, or after it.
+func (s *stopTracker) next(e *BinlogEvent) (before bool, after bool, err error) {
+	switch ev := e.Event.(type) {
+	case *RotateEvent:
+		s.file = string(ev.NextLogName)
+	case *PreviousGTIDsEvent:
+		if s.cond.GTIDSet != nil && s.gset == nil {
+			if s.gset, err = mysql.ParseMysqlGTIDSet(ev.GTIDSets); err != nil {
+				return false, false, errors.Trace(err)
+			}
+		}
+	case *MariadbGTIDListEvent:
+		if s.cond.GTIDSet != nil && s.gset == nil {
+			set, _ := mysql.ParseMariadbGTIDSet("")
+			for i := range ev.GTIDs {
+				if err = set.(*mysql.MariadbGTIDSet).AddSet(&ev.GTIDs[i]); err != nil {
+					return false, false, errors.Trace(err)
+				}
+			}
+			s.gset = set
+		}
+	}
+
+	txn, first, last, err := s.tracker.track(e)
+	if err != nil {
+		return false, false, errors.Trace(err)
+	}
+	if first && s.stopBefore(e.Header, txn) {
+		return true, false, nil
+	}
+	if !last {
+		return false, false, nil
+	}
+
+	s.count++
+	if s.cond.Transactions > 0 && s.count >= s.cond.Transactions {
+		return false, true, nil
+	}
+	if s.cond.Position.Name != "" && e.Header.LogPos > 0 {
+		// the next transaction starts after this event
+		if s.reachedPosition(e.Header.LogPos) {
+			return false, true, nil
+		}
+	}
+	if s.cond.GTIDSet != nil && txn.gtid != "" {
+		if s.gset == nil {
+			if s.gset, err = s.newGTIDSet(); err != nil {
+				return false, false, errors.Trace(err)
+			}
+		}
+		if err = s.gset.Update(txn.gtid); err != nil {
+			return false, false, errors.Trace(err)
+		}
+		if s.gset.Contain(s.cond.GTIDSet) {
+			return false, true, nil
+		}
+	}
+	return false, false, nil
+}
+
+// stopBefore checks the condition at the first event of a transaction.
+func (s *stopTracker) stopBefore(h *EventHeader, txn *trackedTransaction) bool {
+	if s.cond.Position.Name != "" && h.LogPos > h.EventSize {
+		if s.reachedPosition(h.LogPos - h.EventSize) {
+			return true
+		}
+	}
+	if !s.cond.Time.IsZero() {
+		commitTime := txn.commitTime
+		if commitTime.IsZero() {
+			commitTime = time.Unix(int64(h.Timestamp), 0)
+		}
+		if !commitTime.Before(s.cond.Time) {
+			return true
+		}
+	}
+	if s.cond.GTIDSet != nil && s.gset != nil && s.gset.Contain(s.cond.GTIDSet) {
+		// the sync started after the condition
+		return true
+	}
+	return false
+}
+
+// reachedPosition reports whether pos of the current file is at or after cond.Position.
+// A file name without the numeric extension of the binlog files only matches itself.
+func (s *stopTracker) reachedPosition(pos uint32) bool {
+	if s.file == s.cond.Position.Name {
+		return pos >= s.cond.Position.Pos
+	}
+	if !hasBinlogFileSeq(s.file) || !hasBinlogFileSeq(s.cond.Position.Name) {
+		return false
+	}
+	return mysql.Position{Name: s.file, Pos: pos}.Compare(s.cond.Position) >= 0
+}
+
+func hasBinlogFileSeq(name string) bool {
+	i := strings.LastIndexByte(name, '.')
+	if i == -1 {
+		return false
+	}
+	_, err := strconv.Atoi(name[i+1:])
+	return err == nil
+}
+
+// newGTIDSet returns an empty GTID set of the flavor of the condition.
+func (s *stopTracker) newGTIDSet() (mysql.GTIDSet, error) {
+	if _, ok := s.cond.GTIDSet.(*mysql.MariadbGTIDSet); ok {
+		return mysql.ParseMariadbGTIDSet("")
+	}
+	return mysql.ParseMysqlGTIDSet("")
+}
@@ -0,0 +1,134 @@
+package replication
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestParserStopCondition(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		filepath.Join(dir, "mysql-bin.000001"),
+		filepath.Join(dir, "mysql-bin.000002"),
+	}
+	writeTimeSearchBinlog(t, names[0], 1000, 1, []uint64{1001_000000, 1002_000000}, false, "mysql-bin.000002")
+	starts, _ := writeTimeSearchBinlog(t, names[1], 1010, 3, []uint64{1011_000000, 1012_000000}, false, "")
+
+	gset := func(s string) mysql.GTIDSet {
+		set, err := mysql.ParseMysqlGTIDSet(s)
+		require.NoError(t, err)
+		return set
+	}
+
+	testcases := []struct {
+		cond StopCondition
+		gnos []int64
+		eof  bool
+	}{
+		{StopCondition{}, []int64{1, 2, 3, 4}, false},
+		{StopCondition{Transactions: 3}, []int64{1, 2, 3}, true},
+		{StopCondition{GTIDSet: gset(testTimeSearchUUID + ":1-2")}, []int64{1, 2}, true},
+		{StopCondition{GTIDSet: gset(testTimeSearchUUID + ":4")}, []int64{1, 2, 3, 4}, true},
+		{StopCondition{Time: time.Unix(1011, 0)}, []int64{1, 2}, true},
+		{StopCondition{Time: time.Unix(1011, 500000000)}, []int64{1, 2, 3}, true},
+		{StopCondition{Position: mysql.Position{Name: "mysql-bin.000002", Pos: starts[0]}}, []int64{1, 2}, true},
+		{StopCondition{Position: mysql.Position{Name: "mysql-bin.000002", Pos: starts[1] - 1}}, []int64{1, 2, 3}, true},
+		{StopCondition{Position: mysql.Position{Name: "mysql-bin.000003", Pos: 4}, Transactions: 10}, []int64{1, 2, 3, 4}, false},
+	}
+	for _, tc := range testcases {
+		p := NewBinlogParser()
+		p.SetStopCondition(tc.cond)
+
+		var gnos []int64
+		var last *BinlogEvent
+		var err error
+		for _, name := range names {
+			err = p.ParseFile(name, 0, func(e *BinlogEvent) error {
+				if gtid, ok := e.Event.(*GTIDEvent); ok {
+					gnos = append(gnos, gtid.GNO)
+				}
+				last = e
+				return nil
+			})
+			if err != nil {
+				break
+			}
+		}
+		require.Equal(t, tc.gnos, gnos, tc.cond)
+		if !tc.eof {
+			require.NoError(t, err, tc.cond)
+			continue
+		}
+		require.Equal(t, io.EOF, err, tc.cond)
+		// at a transaction boundary
+		require.Contains(t, []EventType{XID_EVENT, FORMAT_DESCRIPTION_EVENT, PREVIOUS_GTIDS_EVENT}, last.Header.EventType, tc.cond)
+	}
+
+	// the executed set of the second file already contains the GTID set
+	p := NewBinlogParser()
+	p.SetStopCondition(StopCondition{GTIDSet: gset(testTimeSearchUUID + ":1")})
+	err := p.ParseFile(names[1], 0, func(e *BinlogEvent) error {
+		require.NotEqual(t, GTID_EVENT, e.Header.EventType)
+		return nil
+	})
+	require.Equal(t, io.EOF, err)
+}
+
+func TestBinlogStreamerStopEOF(t *testing.T) {
+	s := NewBinlogStreamer()
+	for i := range 3 {
+		require.NoError(t, s.AddEventToStreamer(&BinlogEvent{Header: &EventHeader{LogPos: uint32(i)}}))
+	}
+	s.closeWithError(io.EOF)
+
+	// the events sent before the stop are returned first
+	for i := range 3 {
+		e, err := s.GetEvent(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, uint32(i), e.Header.LogPos)
+	}
+	for range 2 {
+		_, err := s.GetEvent(context.Background())
+		require.Equal(t, io.EOF, err)
+	}
+}
+
+func TestStopTrackerMariadb(t *testing.T) {
+	gtid := func(seq uint64, flags uint8) *BinlogEvent {
+		return &BinlogEvent{
+			Header: &EventHeader{EventType: MARIADB_GTID_EVENT},
+			Event:  &MariadbGTIDEvent{GTID: mysql.MariadbGTID{DomainID: 0, ServerID: 1, SequenceNumber: seq}, Flags: flags},
+		}
+	}
+	query := func(q string) *BinlogEvent {
+		return &BinlogEvent{Header: &EventHeader{EventType: QUERY_EVENT}, Event: &QueryEvent{Schema: []byte("db"), Query: []byte(q)}}
+	}
+	xid := &BinlogEvent{Header: &EventHeader{EventType: XID_EVENT}, Event: &XIDEvent{XID: 1}}
+
+	testcases := []struct {
+		name   string
+		events []*BinlogEvent
+	}{
+		// statement based, the GTID event replaces the BEGIN
+		{"xid", []*BinlogEvent{gtid(1, 0), query("INSERT INTO t VALUES (1)"), query("INSERT INTO t VALUES (2)"), xid}},
+		{"commit", []*BinlogEvent{gtid(1, 0), query("INSERT INTO t VALUES (1)"), query("COMMIT")}},
+		{"standalone", []*BinlogEvent{gtid(1, BINLOG_MARIADB_FL_STANDALONE|BINLOG_MARIADB_FL_DDL), query("CREATE TABLE t (id int)")}},
+	}
+	for _, tc := range testcases {
+		s := newStopTracker(StopCondition{Transactions: 1}, "mariadb-bin.000001", nil)
+		for i, e := range tc.events {
+			before, after, err := s.next(e)
+			require.NoError(t, err, tc.name)
+			require.False(t, before, tc.name)
+			// the transaction ends at its last event
+			require.Equal(t, i == len(tc.events)-1, after, "%s: event %d", tc.name, i)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package replication
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// trackedTransaction is the transaction being read by a transactionTracker.
+type trackedTransaction struct {
+	// gtid is empty if the transaction has no GTID, e.g. an anonymous GTID event
+	gtid string
+	// commitTime is the immediate commit timestamp of the GTID event, if any
+	commitTime time.Time
+	// inBegin is true after the BEGIN of the transaction
+	inBegin bool
+}
+
+// transactionTracker finds the transaction boundaries in a binlog event stream. A
+// transaction starts at its GTID event, or at its BEGIN or statement without GTID, and
+// ends at its XID event, COMMIT, XA PREPARE, or the statement committed on its own like DDL.
+type transactionTracker struct {
+	txn *trackedTransaction
+}
+
+// track returns the transaction of the event and whether the event is its first or last
+// event. The transaction is nil for the events between the transactions.
+func (t *transactionTracker) track(e *BinlogEvent) (txn *trackedTransaction, first bool, last bool, err error) {
+	switch ev := e.Event.(type) {
+	case *GTIDEvent:
+		t.txn = &trackedTransaction{commitTime: ev.ImmediateCommitTime()}
+		if e.Header.EventType != ANONYMOUS_GTID_EVENT {
+			next, err := ev.GTIDNext()
+			if err != nil {
+				return nil, false, false, errors.Trace(err)
+			}
+			t.txn.gtid = next.String()
+		}
+		return t.txn, true, false, nil
+	case *GtidTaggedLogEvent:
+		next, err := ev.GTIDNext()
+		if err != nil {
+			return nil, false, false, errors.Trace(err)
+		}
+		t.txn = &trackedTransaction{gtid: next.String(), commitTime: ev.ImmediateCommitTime()}
+		return t.txn, true, false, nil
+	case *MariadbGTIDEvent:
+		// the GTID event replaces the BEGIN, the transaction ends at its XID event or
+		// COMMIT unless it's standalone, e.g. DDL
+		t.txn = &trackedTransaction{gtid: ev.GTID.String(), inBegin: !ev.IsStandalone()}
+		return t.txn, true, false, nil
+	case *QueryEvent:
+		first = t.txn == nil
+		if first {
+			t.txn = new(trackedTransaction)
+		}
+		query := strings.ToUpper(strings.TrimSpace(string(ev.Query)))
+		switch {
+		case query == "BEGIN" || strings.HasPrefix(query, "XA START"):
+			t.txn.inBegin = true
+			return t.txn, first, false, nil
+		case t.txn.inBegin && query != "COMMIT" && query != "ROLLBACK":
+			// a statement of the transaction
+			return t.txn, first, false, nil
+		}
+	case *XIDEvent, *XAPrepareEvent, *TransactionPayloadEvent:
+		first = t.txn == nil
+		if first {
+			t.txn = new(trackedTransaction)
+		}
+	default:
+		return t.txn, false, false, nil
+	}
+
+	// the last event of the transaction
+	txn, t.txn = t.txn, nil
+	return txn, first, true, nil
+}
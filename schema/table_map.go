@@ -0,0 +1,192 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/pkg/parser/charset"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// ErrMissingRowMetadata is returned by NewTableFromTableMap if the TableMapEvent
+// doesn't have the column names.
+var ErrMissingRowMetadata = errors.New("table map event has no column names, binlog_row_metadata=FULL is required")
+
+// NewTableFromTableMap builds the table from the optional metadata of a TableMapEvent,
+// which is logged with binlog_row_metadata=FULL (MySQL 8.0.1+ or MariaDB 10.5+).
+// Unlike NewTable, it doesn't query the server and the table is the one the row events
+// after the TableMapEvent were written with.
+//
+// The column types are rebuilt from the binlog column types and metadata, so the display
+// width of integers and the comments are lost, and only the primary key index is known.
+func NewTableFromTableMap(e *replication.TableMapEvent) (*Table, error) {
+	names := e.ColumnNameString()
+	if len(names) != int(e.ColumnCount) {
+		return nil, ErrMissingRowMetadata
+	}
+
+	ta := &Table{
+		Schema:  string(e.Schema),
+		Name:    string(e.Table),
+		Columns: make([]TableColumn, 0, e.ColumnCount),
+		Indexes: make([]*Index, 0, 1),
+	}
+
+	unsigned := e.UnsignedMap()
+	collations := e.CollationMap()
+	enumSetCollations := e.EnumSetCollationMap()
+	enumValues := e.EnumStrValueMap()
+	setValues := e.SetStrValueMap()
+	geometryTypes := e.GeometryTypeMap()
+
+	for i, name := range names {
+		collationID, ok := collations[i]
+		if !ok {
+			collationID = enumSetCollations[i]
+		}
+
+		columnType := tableMapColumnType(e, i, collationID, enumValues[i], setValues[i], geometryTypes[i])
+		if unsigned[i] {
+			columnType += " unsigned"
+		}
+
+		collation := ""
+		if collationID != 0 && collationID != mysql.BINARY_COLLATION_ID && e.ColumnType[i] != mysql.MYSQL_TYPE_GEOMETRY {
+			if co, err := charset.GetCollationByID(int(collationID)); err == nil {
+				collation = co.Name
+			}
+		}
+
+		ta.AddColumn(name, columnType, collation, "")
+	}
+
+	if len(e.PrimaryKey) > 0 {
+		pk := ta.AddIndex("PRIMARY")
+		ta.PKColumns = make([]int, len(e.PrimaryKey))
+		for i, col := range e.PrimaryKey {
+			if col >= uint64(len(ta.Columns)) {
+				return nil, errors.Errorf("invalid primary key column %d of table %s", col, ta)
+			}
+			pk.AddColumn(ta.Columns[col].Name, 0)
+			ta.PKColumns[i] = int(col)
+		}
+	}
+
+	return ta, nil
+}
+
+// tableMapColumnType returns the column type of the i-th column like SHOW FULL COLUMNS
+// without the unsigned attribute.
+func tableMapColumnType(e *replication.TableMapEvent, i int, collationID uint64, enumValues []string, setValues []string, geometryType uint64) string {
+	meta := e.ColumnMeta[i]
+	binaryString := collationID == mysql.BINARY_COLLATION_ID
+
+	switch e.ColumnType[i] {
+	case mysql.MYSQL_TYPE_TINY:
+		return "tinyint"
+	case mysql.MYSQL_TYPE_SHORT:
+		return "smallint"
+	case mysql.MYSQL_TYPE_INT24:
+		return "mediumint"
+	case mysql.MYSQL_TYPE_LONG:
+		return "int"
+	case mysql.MYSQL_TYPE_LONGLONG:
+		return "bigint"
+	case mysql.MYSQL_TYPE_YEAR:
+		return "year"
+	case mysql.MYSQL_TYPE_FLOAT:
+		return "float"
+	case mysql.MYSQL_TYPE_DOUBLE:
+		return "double"
+	case mysql.MYSQL_TYPE_NEWDECIMAL:
+		return fmt.Sprintf("decimal(%d,%d)", meta>>8, meta&0xff)
+	case mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_NEWDATE:
+		return "date"
+	case mysql.MYSQL_TYPE_DATETIME, mysql.MYSQL_TYPE_DATETIME2:
+		return withFsp("datetime", meta)
+	case mysql.MYSQL_TYPE_TIMESTAMP, mysql.MYSQL_TYPE_TIMESTAMP2:
+		return withFsp("timestamp", meta)
+	case mysql.MYSQL_TYPE_TIME, mysql.MYSQL_TYPE_TIME2:
+		return withFsp("time", meta)
+	case mysql.MYSQL_TYPE_BIT:
+		return fmt.Sprintf("bit(%d)", (meta>>8)*8+meta&0xff)
+	case mysql.MYSQL_TYPE_JSON:
+		return "json"
+	case mysql.MYSQL_TYPE_GEOMETRY:
+		return geometryTypeName(geometryType)
+	case mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING:
+		if binaryString {
+			return fmt.Sprintf("varbinary(%d)", meta)
+		}
+		return fmt.Sprintf("varchar(%d)", charLength(int(meta), collationID))
+	case mysql.MYSQL_TYPE_BLOB:
+		prefix := []string{"", "tiny", "", "medium", "long"}
+		if meta >= uint16(len(prefix)) {
+			meta = 2
+		}
+		if binaryString {
+			return prefix[meta] + "blob"
+		}
+		return prefix[meta] + "text"
+	case mysql.MYSQL_TYPE_STRING:
+		// see the decoding of MYSQL_TYPE_STRING in RowsEvent
+		b0, b1 := byte(meta>>8), byte(meta)
+		length := int(b1)
+		if b0&0x30 != 0x30 {
+			length = int(uint16(b1) | (uint16((b0&0x30)^0x30) << 4))
+			b0 |= 0x30
+		}
+		switch b0 {
+		case mysql.MYSQL_TYPE_ENUM:
+			return "enum(" + quoteValues(enumValues) + ")"
+		case mysql.MYSQL_TYPE_SET:
+			return "set(" + quoteValues(setValues) + ")"
+		}
+		if binaryString {
+			return fmt.Sprintf("binary(%d)", length)
+		}
+		return fmt.Sprintf("char(%d)", charLength(length, collationID))
+	default:
+		return ""
+	}
+}
+
+func withFsp(name string, fsp uint16) string {
+	if fsp == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s(%d)", name, fsp)
+}
+
+// geometryTypeName returns the name of the geometry type in the table map, see Field::geometry_type.
+func geometryTypeName(t uint64) string {
+	names := []string{"geometry", "point", "linestring", "polygon", "multipoint", "multilinestring", "multipolygon", "geometrycollection"}
+	if t < uint64(len(names)) {
+		return names[t]
+	}
+	return "geometry"
+}
+
+// charLength converts the byte length of a character column to its length in characters.
+func charLength(length int, collationID uint64) int {
+	cs, _, err := charset.GetCharsetInfoByID(int(collationID))
+	if err != nil {
+		return length
+	}
+	info, err := charset.GetCharsetInfo(cs)
+	if err != nil || info.Maxlen <= 1 {
+		return length
+	}
+	return length / info.Maxlen
+}
+
+func quoteValues(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	}
+	return strings.Join(quoted, ",")
+}
@@ -0,0 +1,100 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+func TestNewTableFromTableMap(t *testing.T) {
+	e := &replication.TableMapEvent{
+		Schema:      []byte("test"),
+		Table:       []byte("t"),
+		ColumnCount: 9,
+		ColumnType: []byte{
+			mysql.MYSQL_TYPE_LONGLONG,
+			mysql.MYSQL_TYPE_TINY,
+			mysql.MYSQL_TYPE_NEWDECIMAL,
+			mysql.MYSQL_TYPE_VARCHAR,
+			mysql.MYSQL_TYPE_VARCHAR,
+			mysql.MYSQL_TYPE_STRING,
+			mysql.MYSQL_TYPE_STRING,
+			mysql.MYSQL_TYPE_BLOB,
+			mysql.MYSQL_TYPE_DATETIME2,
+		},
+		ColumnMeta: []uint16{
+			0,
+			0,
+			10<<8 | 2,
+			1020,
+			16,
+			uint16(mysql.MYSQL_TYPE_ENUM)<<8 | 1,
+			uint16(mysql.MYSQL_TYPE_STRING)<<8 | 40,
+			4,
+			3,
+		},
+		ColumnName: [][]byte{
+			[]byte("id"), []byte("flag"), []byte("price"), []byte("name"), []byte("hash"),
+			[]byte("state"), []byte("code"), []byte("body"), []byte("created"),
+		},
+		// id, flag and price are numeric columns, id and price are unsigned
+		SignednessBitmap: []byte{0xa0},
+		// utf8mb4_general_ci for name, code and body, binary for hash
+		ColumnCharset:        []uint64{45, 63, 45, 45},
+		EnumSetColumnCharset: []uint64{45},
+		EnumStrValue:         [][][]byte{{[]byte("on"), []byte("off")}},
+		PrimaryKey:           []uint64{0, 3},
+	}
+
+	ta, err := NewTableFromTableMap(e)
+	require.NoError(t, err)
+	require.Equal(t, "test", ta.Schema)
+	require.Equal(t, "t", ta.Name)
+
+	expected := []struct {
+		name      string
+		rawType   string
+		tp        int
+		unsigned  bool
+		collation string
+	}{
+		{"id", "bigint unsigned", TYPE_NUMBER, true, ""},
+		{"flag", "tinyint", TYPE_NUMBER, false, ""},
+		{"price", "decimal(10,2) unsigned", TYPE_DECIMAL, true, ""},
+		{"name", "varchar(255)", TYPE_STRING, false, "utf8mb4_general_ci"},
+		{"hash", "varbinary(16)", TYPE_BINARY, false, ""},
+		{"state", "enum('on','off')", TYPE_ENUM, false, "utf8mb4_general_ci"},
+		{"code", "char(10)", TYPE_STRING, false, "utf8mb4_general_ci"},
+		{"body", "longtext", TYPE_STRING, false, "utf8mb4_general_ci"},
+		{"created", "datetime(3)", TYPE_DATETIME, false, ""},
+	}
+	require.Len(t, ta.Columns, len(expected))
+	for i, c := range expected {
+		col := ta.Columns[i]
+		require.Equal(t, c.name, col.Name)
+		require.Equal(t, c.rawType, col.RawType)
+		require.Equal(t, c.tp, col.Type, c.name)
+		require.Equal(t, c.unsigned, col.IsUnsigned, c.name)
+		require.Equal(t, c.collation, col.Collation, c.name)
+	}
+	require.Equal(t, []string{"on", "off"}, ta.Columns[5].EnumValues)
+
+	require.Equal(t, []int{0, 3}, ta.PKColumns)
+	require.Len(t, ta.Indexes, 1)
+	require.Equal(t, "PRIMARY", ta.Indexes[0].Name)
+	require.Equal(t, []string{"id", "name"}, ta.Indexes[0].Columns)
+
+	// binlog_row_metadata=MINIMAL
+	e = &replication.TableMapEvent{
+		Schema:      []byte("test"),
+		Table:       []byte("t"),
+		ColumnCount: 1,
+		ColumnType:  []byte{mysql.MYSQL_TYPE_LONG},
+		ColumnMeta:  []uint16{0},
+	}
+	_, err = NewTableFromTableMap(e)
+	require.ErrorIs(t, err, ErrMissingRowMetadata)
+}
@@ -0,0 +1,541 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+const (
+	defaultRelayHeartbeatPeriod = 30 * time.Second
+	defaultRelayPollInterval    = 100 * time.Millisecond
+)
+
+var heartbeatPeriodRegexp = regexp.MustCompile(`(?i)@(?:master|source)_heartbeat_period\s*=\s*(\d+)`)
+
+// binlogChecksumRegexp matches the checksum a replica expects, e.g.
+// "SET @master_binlog_checksum = @@global.binlog_checksum" or "@source_binlog_checksum='NONE'".
+var binlogChecksumRegexp = regexp.MustCompile(`(?i)@(?:master|source)_binlog_checksum\s*=\s*(?:'([^']*)'|"([^"]*)"|(@@(?:global\.)?binlog_checksum))`)
+
+// BinlogRelayConfig is the configuration of a BinlogRelayHandler.
+type BinlogRelayConfig struct {
+	// Dir is the directory of the binlog files, as written by BinlogSyncer.StartBackup
+	// or replication.BinlogWriter. Files are ordered by their numeric extension.
+	Dir string
+	// ServerID is used in the headers of the artificial ROTATE and HEARTBEAT events.
+	ServerID uint32
+	// HeartbeatPeriod is used when the replica doesn't set @source_heartbeat_period, 30s by default.
+	HeartbeatPeriod time.Duration
+	// PollInterval is how often the last file is checked for new events, 100ms by default.
+	PollInterval time.Duration
+}
+
+// BinlogRelayHandler serves COM_BINLOG_DUMP and COM_BINLOG_DUMP_GTID from a directory of
+// binlog files, so that many replicas can follow one upstream stream. It tails the last
+// file and follows the files as they are rotated, sending heartbeats while idle.
+//
+// It also answers the queries a BinlogSyncer runs before dumping. A BinlogRelayHandler
+// keeps per connection state, so one should be created for every connection and closed
+// when the connection is gone.
+type BinlogRelayHandler struct {
+	EmptyHandler
+
+	cfg             BinlogRelayConfig
+	heartbeatPeriod time.Duration
+	// checksumAlg is the checksum algorithm negotiated by the replica, it's used for the
+	// artificial ROTATE_EVENT sent before the FORMAT_DESCRIPTION_EVENT of the first file
+	checksumAlg replication.BinlogChecksum
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewBinlogRelayHandler creates a BinlogRelayHandler for one connection.
+func NewBinlogRelayHandler(cfg BinlogRelayConfig) *BinlogRelayHandler {
+	if cfg.HeartbeatPeriod <= 0 {
+		cfg.HeartbeatPeriod = defaultRelayHeartbeatPeriod
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultRelayPollInterval
+	}
+
+	h := &BinlogRelayHandler{cfg: cfg, heartbeatPeriod: cfg.HeartbeatPeriod}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+
+	return h
+}
+
+// Close stops the running dump, if any.
+func (h *BinlogRelayHandler) Close() {
+	h.cancel()
+}
+
+// HandleQuery answers the queries a replica runs before dumping, other queries are
+// handled by EmptyHandler.
+func (h *BinlogRelayHandler) HandleQuery(query string) (*mysql.Result, error) {
+	q := strings.ToUpper(strings.TrimSpace(query))
+	switch {
+	case strings.HasPrefix(q, "SHOW GLOBAL VARIABLES LIKE 'BINLOG_CHECKSUM'"):
+		checksum, err := h.binlogChecksum()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return buildVariablesResult([][]any{{"binlog_checksum", checksum}})
+	case strings.HasPrefix(q, "SHOW VARIABLES"), strings.HasPrefix(q, "SHOW GLOBAL VARIABLES"):
+		// semi-sync and other server features are not supported
+		return buildVariablesResult(nil)
+	case strings.HasPrefix(q, "KILL "):
+		// sent by a reconnecting replica, its old dump stops once the old connection is gone
+		return nil, nil
+	case strings.HasPrefix(q, "SET "):
+		if m := heartbeatPeriodRegexp.FindStringSubmatch(query); m != nil {
+			ns, err := strconv.ParseInt(m[1], 10, 64)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			h.heartbeatPeriod = time.Duration(ns)
+		}
+		if m := binlogChecksumRegexp.FindStringSubmatch(query); m != nil {
+			checksum := m[1] + m[2]
+			if m[3] != "" {
+				var err error
+				if checksum, err = h.binlogChecksum(); err != nil {
+					return nil, errors.Trace(err)
+				}
+			}
+			h.checksumAlg = replication.BINLOG_CHECKSUM_ALG_OFF
+			if strings.EqualFold(checksum, "CRC32") {
+				h.checksumAlg = replication.BINLOG_CHECKSUM_ALG_CRC32
+			}
+		}
+		return nil, nil
+	}
+
+	return h.EmptyHandler.HandleQuery(query)
+}
+
+func buildVariablesResult(values [][]any) (*mysql.Result, error) {
+	r, err := mysql.BuildSimpleResultset([]string{"Variable_name", "Value"}, values, false)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return mysql.NewResult(r), nil
+}
+
+// HandleRegisterSlave accepts any replica.
+func (h *BinlogRelayHandler) HandleRegisterSlave([]byte) error {
+	return nil
+}
+
+// HandleBinlogDump streams the events from pos, an empty file name means the first file.
+func (h *BinlogRelayHandler) HandleBinlogDump(pos mysql.Position) (*replication.BinlogStreamer, error) {
+	files, err := h.binlogFiles()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("no binlog file in %s", h.cfg.Dir)
+	}
+
+	if pos.Name == "" {
+		pos.Name = files[0]
+	} else if !slices.Contains(files, pos.Name) {
+		return nil, errors.Errorf("could not find binlog file %s", pos.Name)
+	}
+	pos.Pos = max(pos.Pos, uint32(len(replication.BinLogFileHeader)))
+
+	return h.startDump(pos, nil), nil
+}
+
+// HandleBinlogDumpGTID streams the transactions which are not in gtidSet, starting from
+// the last file whose PREVIOUS_GTIDS_EVENT is contained in gtidSet.
+func (h *BinlogRelayHandler) HandleBinlogDumpGTID(gtidSet *mysql.MysqlGTIDSet) (*replication.BinlogStreamer, error) {
+	files, err := h.binlogFiles()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	for i := len(files) - 1; i >= 0; i-- {
+		previous, err := h.previousGTIDs(files[i])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if gtidSet.Contain(previous) {
+			pos := mysql.Position{Name: files[i], Pos: uint32(len(replication.BinLogFileHeader))}
+			return h.startDump(pos, gtidSet), nil
+		}
+	}
+
+	return nil, errors.Errorf("the binlog files in %s don't contain all the transactions missing from %s", h.cfg.Dir, gtidSet)
+}
+
+func (h *BinlogRelayHandler) startDump(pos mysql.Position, gtidSet mysql.GTIDSet) *replication.BinlogStreamer {
+	s := replication.NewBinlogStreamer()
+	d := &relayDump{
+		h:               h,
+		s:               s,
+		gtidSet:         gtidSet,
+		heartbeatPeriod: h.heartbeatPeriod,
+		parser:          replication.NewBinlogParser(),
+		checksumAlg:     h.checksumAlg,
+	}
+	d.parser.SetRawMode(true)
+
+	go func() {
+		if err := d.run(pos); err != nil {
+			s.AddErrorToStreamer(err)
+		}
+	}()
+
+	return s
+}
+
+// binlogFiles returns the binlog files in the directory, in order.
+func (h *BinlogRelayHandler) binlogFiles() ([]string, error) {
+	entries, err := os.ReadDir(h.cfg.Dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !isBinlogFileName(name) {
+			continue
+		}
+		files = append(files, name)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return mysql.CompareBinlogFileName(files[i], files[j]) < 0
+	})
+
+	return files, nil
+}
+
+func isBinlogFileName(name string) bool {
+	ext := filepath.Ext(name)
+	if len(ext) < 2 || len(ext) == len(name) {
+		return false
+	}
+	_, err := strconv.ParseUint(ext[1:], 10, 32)
+	return err == nil
+}
+
+// binlogChecksum returns the checksum algorithm of the last binlog file, in the
+// form of the binlog_checksum system variable.
+func (h *BinlogRelayHandler) binlogChecksum() (string, error) {
+	files, err := h.binlogFiles()
+	if err != nil || len(files) == 0 {
+		return "NONE", errors.Trace(err)
+	}
+
+	fde, _, err := h.readFileHead(files[len(files)-1])
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if fde.ChecksumAlgorithm == replication.BINLOG_CHECKSUM_ALG_CRC32 {
+		return "CRC32", nil
+	}
+	return "NONE", nil
+}
+
+func (h *BinlogRelayHandler) previousGTIDs(name string) (mysql.GTIDSet, error) {
+	_, previous, err := h.readFileHead(name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if previous == nil {
+		return nil, errors.Errorf("%s has no PREVIOUS_GTIDS_EVENT", name)
+	}
+
+	return mysql.ParseMysqlGTIDSet(previous.GTIDSets)
+}
+
+// readFileHead reads the FORMAT_DESCRIPTION_EVENT and, if it follows, the PREVIOUS_GTIDS_EVENT of a file.
+func (h *BinlogRelayHandler) readFileHead(name string) (*replication.FormatDescriptionEvent, *replication.PreviousGTIDsEvent, error) {
+	var (
+		fde      *replication.FormatDescriptionEvent
+		previous *replication.PreviousGTIDsEvent
+	)
+
+	parser := replication.NewBinlogParser()
+	parser.SetRawMode(true)
+	errStop := errors.New("stop")
+	err := parser.ParseFile(filepath.Join(h.cfg.Dir, name), 0, func(e *replication.BinlogEvent) error {
+		switch e.Header.EventType {
+		case replication.FORMAT_DESCRIPTION_EVENT:
+			fde = e.Event.(*replication.FormatDescriptionEvent)
+			return nil
+		case replication.PREVIOUS_GTIDS_EVENT:
+			previous = &replication.PreviousGTIDsEvent{}
+			if err := previous.Decode(eventBody(e.RawData, fde.ChecksumAlgorithm)); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		return errStop
+	})
+	if err != nil && errors.Cause(err) != errStop {
+		return nil, nil, errors.Trace(err)
+	}
+	if fde == nil {
+		return nil, nil, errors.Errorf("%s has no FORMAT_DESCRIPTION_EVENT", name)
+	}
+
+	return fde, previous, nil
+}
+
+// eventBody strips the header and the checksum from a raw event.
+func eventBody(data []byte, checksumAlg replication.BinlogChecksum) []byte {
+	if checksumAlg == replication.BINLOG_CHECKSUM_ALG_CRC32 {
+		data = data[:len(data)-replication.BinlogChecksumLength]
+	}
+	return data[replication.EventHeaderSize:]
+}
+
+// relayDump is a running dump of one connection.
+type relayDump struct {
+	h       *BinlogRelayHandler
+	s       *replication.BinlogStreamer
+	gtidSet mysql.GTIDSet
+
+	heartbeatPeriod time.Duration
+	lastSent        time.Time
+
+	parser      *replication.BinlogParser
+	checksumAlg replication.BinlogChecksum
+	skipping    bool
+}
+
+func (d *relayDump) run(pos mysql.Position) error {
+	for {
+		next, err := d.dumpFile(pos)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		pos = next
+	}
+}
+
+// dumpFile sends the events of one file from pos and returns the position to continue at.
+func (d *relayDump) dumpFile(pos mysql.Position) (mysql.Position, error) {
+	f, err := os.Open(filepath.Join(d.h.cfg.Dir, pos.Name))
+	if err != nil {
+		return pos, errors.Trace(err)
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(replication.BinLogFileHeader))
+	if _, err = io.ReadFull(f, magic); err != nil {
+		return pos, errors.Trace(err)
+	} else if !bytes.Equal(magic, replication.BinLogFileHeader) {
+		return pos, errors.Errorf("%s is not a valid binlog file", pos.Name)
+	}
+
+	// like MySQL, start every file with an artificial ROTATE_EVENT and its FORMAT_DESCRIPTION_EVENT
+	rotate := &replication.RotateEvent{Position: uint64(pos.Pos), NextLogName: []byte(pos.Name)}
+	err = d.sendArtificial(replication.ROTATE_EVENT, 0, replication.LOG_EVENT_ARTIFICIAL_F, rotate)
+	if err != nil {
+		return pos, errors.Trace(err)
+	}
+
+	offset := int64(len(replication.BinLogFileHeader))
+	for {
+		data, err := d.readEvent(f, offset, pos)
+		if err != nil {
+			return pos, errors.Trace(err)
+		}
+		if data == nil {
+			// the file ended without a ROTATE_EVENT, e.g. the writer restarted
+			next, err := d.h.nextFile(pos.Name)
+			return mysql.Position{Name: next, Pos: uint32(len(replication.BinLogFileHeader))}, errors.Trace(err)
+		}
+
+		e, err := d.parser.Parse(data)
+		if err != nil {
+			return pos, errors.Trace(err)
+		}
+		end := offset + int64(len(data))
+
+		switch ev := e.Event.(type) {
+		case *replication.FormatDescriptionEvent:
+			d.checksumAlg = ev.ChecksumAlgorithm
+			d.skipping = false
+			if int64(pos.Pos) > offset {
+				// the events before pos are not sent, so mark the FORMAT_DESCRIPTION_EVENT as not to be applied
+				e.RawData = d.withLogPos(data, 0)
+			}
+			if err = d.send(e); err != nil {
+				return pos, errors.Trace(err)
+			}
+			offset = max(end, int64(pos.Pos))
+			continue
+		case *replication.RotateEvent:
+			if err = d.send(e); err != nil {
+				return pos, errors.Trace(err)
+			}
+			return mysql.Position{Name: string(ev.NextLogName), Pos: uint32(ev.Position)}, nil
+		}
+
+		if d.gtidSet != nil {
+			if err = d.updateSkipping(e.Header.EventType, data); err != nil {
+				return pos, errors.Trace(err)
+			}
+		}
+		if !d.skipping {
+			if err = d.send(e); err != nil {
+				return pos, errors.Trace(err)
+			}
+		}
+		offset = end
+	}
+}
+
+// updateSkipping skips the transactions the replica already has, which start with a GTID event.
+func (d *relayDump) updateSkipping(t replication.EventType, data []byte) error {
+	var gtid *replication.GTIDEvent
+	switch t {
+	case replication.GTID_EVENT:
+		gtid = &replication.GTIDEvent{}
+		if err := gtid.Decode(eventBody(data, d.checksumAlg)); err != nil {
+			return errors.Trace(err)
+		}
+	case replication.GTID_TAGGED_LOG_EVENT:
+		tagged := &replication.GtidTaggedLogEvent{}
+		if err := tagged.Decode(eventBody(data, d.checksumAlg)); err != nil {
+			return errors.Trace(err)
+		}
+		gtid = &tagged.GTIDEvent
+	default:
+		return nil
+	}
+
+	next, err := gtid.GTIDNext()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	d.skipping = d.gtidSet.Contain(next)
+
+	return nil
+}
+
+// readEvent reads the event at offset, waiting for it to be written. It returns nil
+// if the file has no more events and a newer file exists.
+func (d *relayDump) readEvent(f *os.File, offset int64, pos mysql.Position) ([]byte, error) {
+	header := make([]byte, replication.EventHeaderSize)
+	for {
+		n, err := f.ReadAt(header, offset)
+		if err != nil && err != io.EOF {
+			return nil, errors.Trace(err)
+		}
+		if n == len(header) {
+			size := binary.LittleEndian.Uint32(header[9:])
+			if size < replication.EventHeaderSize {
+				return nil, errors.Errorf("invalid event size %d at %s:%d", size, pos.Name, offset)
+			}
+			data := make([]byte, size)
+			n, err = f.ReadAt(data, offset)
+			if err != nil && err != io.EOF {
+				return nil, errors.Trace(err)
+			}
+			if n == len(data) {
+				return data, nil
+			}
+		} else if n == 0 {
+			next, err := d.h.nextFile(pos.Name)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if next != "" {
+				return nil, nil
+			}
+		}
+
+		if err = d.wait(pos.Name, uint32(offset)); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+}
+
+// wait waits for new events, sending a heartbeat if nothing was sent for a while.
+func (d *relayDump) wait(name string, pos uint32) error {
+	if d.heartbeatPeriod > 0 && time.Since(d.lastSent) >= d.heartbeatPeriod {
+		err := d.sendArtificial(replication.HEARTBEAT_EVENT, pos, 0, &replication.GenericEvent{Data: []byte(name)})
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	select {
+	case <-d.h.ctx.Done():
+		return errors.Trace(d.h.ctx.Err())
+	case <-time.After(d.h.cfg.PollInterval):
+		return nil
+	}
+}
+
+// nextFile returns the file after name, or "" if name is the last one.
+func (h *BinlogRelayHandler) nextFile(name string) (string, error) {
+	files, err := h.binlogFiles()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	for _, file := range files {
+		if mysql.CompareBinlogFileName(file, name) > 0 {
+			return file, nil
+		}
+	}
+	return "", nil
+}
+
+func (d *relayDump) sendArtificial(t replication.EventType, logPos uint32, flags uint16, e replication.Event) error {
+	h := &replication.EventHeader{
+		EventType: t,
+		ServerID:  d.h.cfg.ServerID,
+		LogPos:    logPos,
+		Flags:     flags,
+	}
+	data, err := replication.EncodeEvent(h, e, d.checksumAlg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(d.send(&replication.BinlogEvent{RawData: data, Header: h, Event: e}))
+}
+
+func (d *relayDump) send(e *replication.BinlogEvent) error {
+	if err := d.h.ctx.Err(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := d.s.AddEventToStreamer(e); err != nil {
+		return errors.Trace(err)
+	}
+	d.lastSent = time.Now()
+
+	return nil
+}
+
+// withLogPos returns a copy of the raw event with the LogPos of the header replaced.
+func (d *relayDump) withLogPos(data []byte, logPos uint32) []byte {
+	data = bytes.Clone(data)
+	binary.LittleEndian.PutUint32(data[13:], logPos)
+	if d.checksumAlg == replication.BINLOG_CHECKSUM_ALG_CRC32 {
+		n := len(data) - replication.BinlogChecksumLength
+		binary.LittleEndian.PutUint32(data[n:], crc32.ChecksumIEEE(data[:n]))
+	}
+	return data
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+var relayTestSID = uuid.MustParse("5aa72a7f-44a8-11e6-885a-0e7e1c9d8b3a")
+
+func writeRelayTestTransaction(t *testing.T, w *replication.BinlogWriter, gno int64) {
+	events := []*replication.BinlogEvent{
+		{Header: &replication.EventHeader{EventType: replication.GTID_EVENT, ServerID: 1}, Event: &replication.GTIDEvent{SID: relayTestSID[:], GNO: gno}},
+		{Header: &replication.EventHeader{EventType: replication.QUERY_EVENT, ServerID: 1}, Event: &replication.QueryEvent{Query: []byte("BEGIN")}},
+		{Header: &replication.EventHeader{EventType: replication.XID_EVENT, ServerID: 1}, Event: &replication.XIDEvent{XID: uint64(gno)}},
+	}
+	for _, e := range events {
+		require.NoError(t, w.WriteEvent(e))
+	}
+}
+
+func startRelayTestServer(t *testing.T, dir string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				h := NewBinlogRelayHandler(BinlogRelayConfig{Dir: dir, ServerID: 100, PollInterval: 10 * time.Millisecond})
+				defer h.Close()
+
+				co, err := NewDefaultServer().NewConn(conn, "root", "secret", h)
+				if err != nil {
+					return
+				}
+				for {
+					if err = co.HandleCommand(); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func nextXID(t *testing.T, s *replication.BinlogStreamer) (uint64, []replication.EventType) {
+	var types []replication.EventType
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		e, err := s.GetEvent(ctx)
+		cancel()
+		require.NoError(t, err)
+
+		types = append(types, e.Header.EventType)
+		if xid, ok := e.Event.(*replication.XIDEvent); ok {
+			return xid.XID, types
+		}
+	}
+}
+
+func TestBinlogRelayHandler(t *testing.T) {
+	dir := t.TempDir()
+	w, err := replication.NewBinlogWriter(replication.BinlogWriterConfig{Dir: dir, ServerID: 1})
+	require.NoError(t, err)
+	defer w.Close()
+
+	for gno := int64(1); gno <= 3; gno++ {
+		writeRelayTestTransaction(t, w, gno)
+	}
+	require.NoError(t, w.Rotate())
+	for gno := int64(4); gno <= 5; gno++ {
+		writeRelayTestTransaction(t, w, gno)
+	}
+
+	host, port, err := net.SplitHostPort(startRelayTestServer(t, dir))
+	require.NoError(t, err)
+
+	newSyncer := func() *replication.BinlogSyncer {
+		p, err := net.LookupPort("tcp", port)
+		require.NoError(t, err)
+		b := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{
+			ServerID:        1001,
+			Flavor:          mysql.MySQLFlavor,
+			Host:            host,
+			Port:            uint16(p),
+			User:            "root",
+			Password:        "secret",
+			HeartbeatPeriod: 50 * time.Millisecond,
+		})
+		t.Cleanup(b.Close)
+		return b
+	}
+
+	// by file and position, following the rotation
+	s, err := newSyncer().StartSync(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+	require.NoError(t, err)
+	for gno := uint64(1); gno <= 5; gno++ {
+		xid, types := nextXID(t, s)
+		require.Equal(t, gno, xid)
+		if gno == 1 {
+			require.Equal(t, []replication.EventType{
+				replication.ROTATE_EVENT, replication.FORMAT_DESCRIPTION_EVENT, replication.PREVIOUS_GTIDS_EVENT,
+				replication.GTID_EVENT, replication.QUERY_EVENT, replication.XID_EVENT,
+			}, types)
+		}
+	}
+
+	// new events of the last file are tailed, heartbeats are sent while idle
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	e, err := s.GetEvent(ctx)
+	cancel()
+	require.NoError(t, err)
+	require.Equal(t, replication.HEARTBEAT_EVENT, e.Header.EventType)
+
+	writeRelayTestTransaction(t, w, 6)
+	xid, _ := nextXID(t, s)
+	require.Equal(t, uint64(6), xid)
+
+	// by GTID set, starting from the second file and skipping the executed transactions
+	gset, err := mysql.ParseMysqlGTIDSet("5aa72a7f-44a8-11e6-885a-0e7e1c9d8b3a:1-4")
+	require.NoError(t, err)
+	s, err = newSyncer().StartSyncGTID(gset)
+	require.NoError(t, err)
+	xid, _ = nextXID(t, s)
+	require.Equal(t, uint64(5), xid)
+	xid, _ = nextXID(t, s)
+	require.Equal(t, uint64(6), xid)
+
+	// a starting position in the middle of a file
+	pos := w.Position()
+	writeRelayTestTransaction(t, w, 7)
+	s, err = newSyncer().StartSync(pos)
+	require.NoError(t, err)
+	xid, _ = nextXID(t, s)
+	require.Equal(t, uint64(7), xid)
+
+	h := NewBinlogRelayHandler(BinlogRelayConfig{Dir: dir})
+	defer h.Close()
+	_, err = h.HandleBinlogDump(mysql.Position{Name: "mysql-bin.000009", Pos: 4})
+	require.Error(t, err)
+}
+
+func TestBinlogRelayChecksum(t *testing.T) {
+	dir := t.TempDir()
+	w, err := replication.NewBinlogWriter(replication.BinlogWriterConfig{Dir: dir, ServerID: 1})
+	require.NoError(t, err)
+	writeRelayTestTransaction(t, w, 1)
+	require.NoError(t, w.Close())
+
+	firstRotate := func(query string) *replication.BinlogEvent {
+		h := NewBinlogRelayHandler(BinlogRelayConfig{Dir: dir})
+		defer h.Close()
+		_, err := h.HandleQuery(query)
+		require.NoError(t, err)
+		s, err := h.HandleBinlogDump(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		e, err := s.GetEvent(ctx)
+		require.NoError(t, err)
+		require.Equal(t, replication.ROTATE_EVENT, e.Header.EventType)
+		return e
+	}
+
+	size := replication.EventHeaderSize + 8 + len("mysql-bin.000001")
+	e := firstRotate("SET @master_binlog_checksum='NONE', @source_binlog_checksum='NONE'")
+	require.Len(t, e.RawData, size)
+
+	// the checksum of the binlog files
+	e = firstRotate("SET @master_binlog_checksum= @@global.binlog_checksum")
+	require.Len(t, e.RawData, size+replication.BinlogChecksumLength)
+	n := len(e.RawData) - replication.BinlogChecksumLength
+	require.Equal(t, crc32.ChecksumIEEE(e.RawData[:n]), binary.LittleEndian.Uint32(e.RawData[n:]))
+}
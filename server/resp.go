@@ -361,12 +361,15 @@ func (c *Conn) writeBinlogEvents(s *replication.BinlogStreamer) error {
 		data = append(data, mysql.OK_HEADER)
 
 		data = append(data, ev.RawData...)
-		if err := c.WritePacket(data); err != nil {
-			return err
+		err = c.WritePacket(data)
+		if err == nil {
+			// Deliver each event immediately (heartbeat/semi-sync timing); GetEvent
+			// may block indefinitely.
+			err = c.Flush()
 		}
-		// Deliver each event immediately (heartbeat/semi-sync timing); GetEvent
-		// may block indefinitely.
-		if err := c.Flush(); err != nil {
+		if err != nil {
+			// let the producer of the events know that the replica is gone
+			s.AddErrorToStreamer(err)
 			return err
 		}
 	}